@@ -178,7 +178,7 @@ func mirror() {
 	borderStripes := tracer.NewStripedPattern(
 		tracer.ColorName(colornames.Lightgray), tracer.ColorName(colornames.White))
 	borderStripes.SetTransform(tracer.IM().Scale(0.1, 1, 1).RotateY(math.Pi / 2))
-	borderP := tracer.NewPerturbedPattern(borderStripes, 0.1)
+	borderP := tracer.NewPerturbedPattern(borderStripes, 0.1, 1)
 
 	// top border
 	topBorder := tracer.NewUnitCube()
@@ -393,6 +393,9 @@ func pond() {
 	surface.Material().Reflective = 1
 	surface.Material().Transparency = 0.6
 	surface.Material().RefractiveIndex = 1.3442
+	// deep water turns blue-green
+	surface.Material().Absorption = tracer.NewColor(0.7, 0.9, 0.92)
+	surface.Material().AbsorptionDensity = 0.15
 	surface.Material().Color = tracer.ColorName(colornames.White)
 	surface.Material().ShadowCaster = false
 	surfaceRealP1 := tracer.NewStripedPattern(
@@ -401,7 +404,7 @@ func pond() {
 		tracer.ColorName(colornames.Lightgray), tracer.ColorName(colornames.Lightskyblue))
 	surfaceRealP2.SetTransform(tracer.IM().RotateY(math.Pi / 2))
 	surfaceBlendedP := tracer.NewBlendedPattern(surfaceRealP1, surfaceRealP2)
-	surfacePP := tracer.NewPerturbedPattern(surfaceBlendedP, 0.4)
+	surfacePP := tracer.NewPerturbedPattern(surfaceBlendedP, 0.4, 1)
 	surface.Material().SetPattern(surfacePP)
 	w.AddObject(surface)
 
@@ -652,7 +655,7 @@ func cone() {
 	c.SetTransform(tracer.IM().Translate(-1, 1, 0))
 	cp := tracer.NewStripedPattern(tracer.ColorName(colornames.Red), tracer.ColorName(colornames.White))
 	cp.SetTransform(tracer.IM().Scale(0.1, 0.1, 0.1))
-	cpp := tracer.NewPerturbedPattern(cp, 0.4)
+	cpp := tracer.NewPerturbedPattern(cp, 0.4, 1)
 	c.Material().SetPattern(cpp)
 	w.AddObject(c)
 
@@ -661,7 +664,7 @@ func cone() {
 	s.SetTransform(tracer.IM().Translate(-1, 3, 0))
 	sp := tracer.NewStripedPattern(tracer.ColorName(colornames.Red), tracer.ColorName(colornames.Blue))
 	sp.SetTransform(tracer.IM().Scale(0.3, 0.3, 0.3).RotateZ(math.Pi / 2))
-	spp := tracer.NewPerturbedPattern(sp, 0.4)
+	spp := tracer.NewPerturbedPattern(sp, 0.4, 1)
 	s.Material().SetPattern(spp)
 	s.Material().Transparency = 0.8
 	s.Material().Ambient = 0.1
@@ -937,6 +940,82 @@ func csg() {
 	tracer.Render(w)
 }
 
+// subsurface is the reference scene for subsurface scattering, a marble sphere, a skin CSG shape and a milk mesh,
+// lit from behind so light shines through their thin parts
+func subsurface() {
+	w := envxy(640, 480)
+	w.Config.Antialias = 8
+	w.Config.Integrator = tracer.NewPathTracerIntegrator(16)
+
+	// behind and above the objects
+	l := spherearealight(0, 4, 6, 0.5, colornames.White)
+	l.SetIntensity(l.Intensity().Scale(20))
+	w.SetLights(tracer.Lights{l})
+
+	w.AddObject(floor(0))
+
+	// the built in materials are measured per millimeter, one unit of the scene is 20mm
+	material := func(name string) *tracer.Material {
+		ss, err := tracer.SubsurfaceByName(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return tracer.NewSubsurfaceMaterial(ss.Scale(20))
+	}
+
+	marble := tracer.NewUnitSphere()
+	marble.SetTransform(tracer.IM().Translate(-2.5, 1, 2))
+	marble.SetMaterial(material("marble"))
+	w.AddObject(marble)
+
+	// a rounded cube, the material goes on the members of the CSG shape, those are what rays hit
+	skin := material("skin1")
+	s1 := tracer.NewUnitSphere()
+	s1.SetTransform(tracer.IM().Scale(1.3, 1.3, 1.3))
+	s1.SetMaterial(skin)
+	s2 := tracer.NewUnitCube()
+	s2.SetMaterial(skin)
+	rounded := tracer.NewCSG(s1, s2, tracer.Intersect)
+	rounded.SetTransform(tracer.IM().RotateY(math.Pi/4).Translate(0, 1, 2))
+	w.AddObject(rounded)
+
+	w.AddObject(cubemesh(2.5, 1, 2, 1, material("wholemilk")))
+
+	tracer.Render(w)
+}
+
+// cubemesh returns a closed triangle mesh of a cube centered at x,y,z with sides of 2*s
+func cubemesh(x, y, z, s float64, m *tracer.Material) *tracer.TriangleMesh {
+	var verts []tracer.Point
+	for _, c := range [][3]float64{
+		{-1, -1, -1}, {1, -1, -1}, {1, 1, -1}, {-1, 1, -1},
+		{-1, -1, 1}, {1, -1, 1}, {1, 1, 1}, {-1, 1, 1},
+	} {
+		verts = append(verts, tracer.NewPoint(x+s*c[0], y+s*c[1], z+s*c[2]))
+	}
+	normals := []tracer.Vector{
+		tracer.NewVector(0, 0, -1), tracer.NewVector(0, 0, 1), tracer.NewVector(0, -1, 0),
+		tracer.NewVector(0, 1, 0), tracer.NewVector(-1, 0, 0), tracer.NewVector(1, 0, 0),
+	}
+	vertexIndex := []int{
+		0, 1, 2, 3, // front
+		4, 5, 6, 7, // back
+		0, 1, 5, 4, // bottom
+		3, 2, 6, 7, // top
+		0, 3, 7, 4, // left
+		1, 2, 6, 5, // right
+	}
+	// one normal per face, the texture coordinates are unused
+	var normalIndex []int
+	for f := range normals {
+		normalIndex = append(normalIndex, f, f, f, f)
+	}
+	textures := make([]tracer.Point, len(normals))
+
+	return tracer.NewMesh(6, []int{4, 4, 4, 4, 4, 4}, vertexIndex, normalIndex, normalIndex, make([]int, 6),
+		verts, normals, textures, []*tracer.Material{m})
+}
+
 func env() *tracer.World {
 	width, height := 640.0, 480.0
 	// width, height := 1000.0, 1000.0
@@ -1185,7 +1264,7 @@ func pedestal() *tracer.Cube {
 	up := tracer.NewUVCheckersPattern(8, 8,
 		tracer.ColorName(colornames.White), tracer.ColorName(colornames.Violet))
 	cp := tracer.NewTextureMapPattern(up, tracer.NewCubeMapSame(up))
-	p := tracer.NewPerturbedPattern(cp, 0.09)
+	p := tracer.NewPerturbedPattern(cp, 0.09, 1)
 	s.Material().SetPattern(p)
 
 	return s
@@ -1363,7 +1442,7 @@ func simplesphere() {
 	// pattern := tracer.NewTextureMapPattern(uvpattern, mapper)
 	// sphere1.Material().SetPattern(pattern)
 	sphere1.Material().Color = tracer.ColorName(colornames.Red)
-	pert := tracer.NewNoisePerturber(1)
+	pert := tracer.NewNoisePerturber(1, 1)
 	pert.SetTransform(tracer.IM().Scale(.15, .15, .15))
 
 	sphere1.Material().SetPerturber(pert)
@@ -1479,6 +1558,33 @@ func heightmapsphere(filename string) {
 	tracer.Render(w)
 }
 
+// displacedsphere is heightmapsphere with true displacement, the bumps show on the silhouette and cast shadows
+func displacedsphere(filename string) {
+	w := envxy(640, 480)
+
+	sphere1 := tracer.NewUnitSphere()
+	sphere1.SetTransform(
+		tracer.IM().Scale(2.3, 2.3, 2.3).Translate(0, 2.3, 1))
+	sphere1.Material().Color = tracer.ColorName(colornames.Lightgoldenrodyellow)
+
+	mesh, err := tracer.ShapeToMesh(sphere1, 32)
+	if err != nil {
+		log.Fatal(err)
+	}
+	t, err := tracer.LoadTexture(filename, tracer.ColorEncodingLinear)
+	if err != nil {
+		log.Fatal(err)
+	}
+	height := tracer.NewTextureMap(tracer.NewTextureSampler(t), tracer.ChannelLuminance)
+	d := tracer.NewDisplacement(height, 0.05)
+	d.Midlevel = 0.5
+
+	w.AddObject(d.Apply(mesh))
+	w.AddObject(floor(0))
+	w.AddObject(backWall(50))
+	tracer.Render(w)
+}
+
 func cubeMap() {
 
 	w := env()
@@ -2025,6 +2131,7 @@ func main() {
 	// brickwall(dir)
 	// simplesphere()
 	// heightmapsphere(path.Join(dir, "brick_bump.png"))
+	// displacedsphere(path.Join(dir, "brick_bump.png"))
 	// simpleroom()
 	// emissive()
 	// simpletexturewall(path.Join(dir, "brick_bump.png"))
@@ -2053,6 +2160,7 @@ func main() {
 	// group()
 	// triangle()
 	// csg()
+	// subsurface()
 
 	// dir := fmt.Sprintf(path.Join(utils.Homedir(), "go/src/github.com/DanTulovsky/tracer/obj"))
 	// f := path.Join(dir, "cubes2.obj")
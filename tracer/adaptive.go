@@ -0,0 +1,51 @@
+package tracer
+
+import (
+	"math"
+)
+
+// sampleStats tracks the running mean and variance of the luminance of the samples taken in a pixel
+// Uses Welford's online algorithm, so samples do not need to be stored
+type sampleStats struct {
+	n        int
+	mean, m2 float64
+}
+
+// add adds a new sample
+func (s *sampleStats) add(clr Color) {
+	v := clr.Luminance()
+
+	s.n++
+	delta := v - s.mean
+	s.mean = s.mean + delta/float64(s.n)
+	s.m2 = s.m2 + delta*(v-s.mean)
+}
+
+// variance returns the sample variance
+func (s *sampleStats) variance() float64 {
+	if s.n < 2 {
+		return 0
+	}
+	return s.m2 / float64(s.n-1)
+}
+
+// relativeError returns the standard error of the mean relative to the mean
+// Dark pixels are compared against a floor, otherwise they would never converge
+func (s *sampleStats) relativeError() float64 {
+	if s.n < 2 {
+		return math.Inf(1)
+	}
+	stdErr := math.Sqrt(s.variance() / float64(s.n))
+	return stdErr / math.Max(s.mean, 0.1)
+}
+
+// converged returns true if no more samples are needed according to the adaptive sampling config
+func (s *sampleStats) converged(wc *WorldConfig) bool {
+	if s.n < wc.AdaptiveMinSamples {
+		return false
+	}
+	if s.n >= wc.AdaptiveMaxSamples {
+		return true
+	}
+	return s.relativeError() <= wc.AdaptiveThreshold
+}
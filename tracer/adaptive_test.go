@@ -0,0 +1,140 @@
+package tracer
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSampleStats(t *testing.T) {
+	tests := []struct {
+		name         string
+		samples      []Color
+		wantMean     float64
+		wantVariance float64
+	}{
+		{
+			name:         "constant",
+			samples:      []Color{White(), White(), White(), White()},
+			wantMean:     1,
+			wantVariance: 0,
+		},
+		{
+			name:         "black and white",
+			samples:      []Color{White(), Black(), White(), Black()},
+			wantMean:     0.5,
+			wantVariance: 1.0 / 3,
+		},
+		{
+			name:         "single",
+			samples:      []Color{White()},
+			wantMean:     1,
+			wantVariance: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &sampleStats{}
+			for _, c := range tt.samples {
+				s.add(c)
+			}
+			assert.InDelta(t, tt.wantMean, s.mean, 0.00001, "should equal")
+			assert.InDelta(t, tt.wantVariance, s.variance(), 0.00001, "should equal")
+		})
+	}
+}
+
+func TestSampleStats_converged(t *testing.T) {
+	wc := NewWorldConfig()
+	wc.AdaptiveMinSamples = 4
+	wc.AdaptiveMaxSamples = 8
+	wc.AdaptiveThreshold = 0.01
+
+	tests := []struct {
+		name    string
+		samples []Color
+		want    bool
+	}{
+		{
+			name:    "not enough samples",
+			samples: []Color{White(), White()},
+			want:    false,
+		},
+		{
+			name:    "flat pixel",
+			samples: []Color{White(), White(), White(), White()},
+			want:    true,
+		},
+		{
+			name:    "noisy pixel",
+			samples: []Color{White(), Black(), White(), Black()},
+			want:    false,
+		},
+		{
+			name:    "noisy pixel at max samples",
+			samples: []Color{White(), Black(), White(), Black(), White(), Black(), White(), Black()},
+			want:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &sampleStats{}
+			for _, c := range tt.samples {
+				s.add(c)
+			}
+			assert.Equal(t, tt.want, s.converged(wc), "should equal")
+		})
+	}
+}
+
+func TestSampleStats_relativeError(t *testing.T) {
+	s := &sampleStats{}
+	assert.True(t, math.IsInf(s.relativeError(), 1), "no samples should be infinitely noisy")
+
+	for i := 0; i < 100; i++ {
+		s.add(NewColor(0.5, 0.5, 0.5))
+	}
+	assert.Equal(t, 0.0, s.relativeError(), "should equal")
+}
+
+func TestWorld_RenderAdaptive(t *testing.T) {
+	w, camera := smallTestWorld()
+	w.Config.AdaptiveSampling = true
+	w.Config.AdaptiveMinSamples = 4
+	w.Config.AdaptiveMaxSamples = 32
+	w.Config.AdaptiveThreshold = 0.01
+	w.Config.Seed = 1
+
+	canvas := NewCanvas(11, 11)
+	w.Render(camera, canvas)
+
+	film := w.Film()
+	maxCount := 0
+	for y := 0; y < film.Height; y++ {
+		for x := 0; x < film.Width; x++ {
+			if n := film.SampleCount(x, y); n > maxCount {
+				maxCount = n
+			}
+		}
+	}
+
+	// background is flat, the sphere edge is not
+	assert.Equal(t, 4, film.SampleCount(0, 0), "should equal")
+	assert.True(t, maxCount > 4, "edge pixels should get more samples")
+
+	// the center pixel converges to the average over the whole pixel, compare with a converged render of 1024
+	// jittered samples per pixel
+	reference, camera := smallTestWorld()
+	reference.Config.Progressive = true
+	reference.Config.ProgressiveMaxSamples = 1024
+	reference.Config.Seed = 2
+	want := NewCanvas(11, 11)
+	reference.Render(camera, want)
+
+	got, err := canvas.Get(5, 5)
+	assert.NoError(t, err)
+	wantClr, err := want.Get(5, 5)
+	assert.NoError(t, err)
+	assert.InDelta(t, wantClr.G, got.G, 0.02, "should be close")
+}
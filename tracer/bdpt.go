@@ -0,0 +1,633 @@
+package tracer
+
+import (
+	"math"
+	"math/rand"
+)
+
+// lightSource is a light the bidirectional path tracer can start light subpaths from
+type lightSource struct {
+	// light is set for point and spot lights
+	light Light
+	// e is set for area lights and emissive objects
+	e *emitter
+}
+
+// isDelta returns true for lights without area, rays can never hit those
+func (ls *lightSource) isDelta() bool {
+	return ls.e == nil
+}
+
+// spotCosMax returns the cosine of the half angle of a spot light
+func spotCosMax(l *SpotLight) float64 {
+	return math.Cos(l.Angle() / 2)
+}
+
+// uniformSampleCone returns a uniformly distributed direction within the cone around dir
+func uniformSampleCone(dir Vector, cosMax float64, rng *rand.Rand) Vector {
+	cos := 1 - rng.Float64()*(1-cosMax)
+	sin := math.Sqrt(math.Max(0, 1-cos*cos))
+	phi := 2 * math.Pi * rng.Float64()
+
+	return newONB(dir).local(sin*math.Cos(phi), sin*math.Sin(phi), cos)
+}
+
+// sampleLe samples a ray leaving the light
+// Returns the origin, the normal there (zero for point and spot lights), the direction, the emitted light
+// and the pdfs of picking the origin (area) and the direction (solid angle).
+func (ls *lightSource) sampleLe(rng *rand.Rand) (p Point, n, dir Vector, le Color, pdfPos, pdfDir float64) {
+	switch l := ls.light.(type) {
+	case *PointLight:
+		dir = uniformSampleSphere(rng)
+		return l.Position(), Vector{}, dir, l.Intensity(), 1, 1 / (4 * math.Pi)
+	case *SpotLight:
+		cosMax := spotCosMax(l)
+		dir = uniformSampleCone(l.Direction(), cosMax, rng)
+		return l.Position(), Vector{}, dir, l.Intensity(), 1, 1 / (2 * math.Pi * (1 - cosMax))
+	}
+
+	p, n, pdfPos = ls.e.sample(rng)
+
+	// emitters are two sided, pick a side then a cosine weighted direction
+	side := n
+	if rng.Float64() < 0.5 {
+		side = n.Negate()
+	}
+	dir = newONB(side).local(cosineSampleHemisphere(rng))
+
+	return p, n, dir, ls.e.radiance(dir), pdfPos, ls.pdfDir(n, dir)
+}
+
+// pdfDir returns the pdf (solid angle) of sampleLe picking direction dir, leaving from a point with normal n
+func (ls *lightSource) pdfDir(n, dir Vector) float64 {
+	switch l := ls.light.(type) {
+	case *PointLight:
+		return 1 / (4 * math.Pi)
+	case *SpotLight:
+		cosMax := spotCosMax(l)
+		if l.Direction().Dot(dir) < cosMax {
+			return 0
+		}
+		return 1 / (2 * math.Pi * (1 - cosMax))
+	}
+	return 0.5 * math.Abs(n.Dot(dir)) / math.Pi
+}
+
+// pdfPos returns the pdf (area) of sampleLe picking the point p
+func (ls *lightSource) pdfPos(p Point) float64 {
+	if ls.isDelta() {
+		return 1
+	}
+	_, pdf := ls.e.pointPdf(p)
+	return pdf
+}
+
+// sampleLi samples a point on the light, as seen from ref
+// Returns the point, the normal there, the light arriving at ref and the pdf (solid angle at ref).
+// For point and spot lights the pdf is 1 and the falloff is included in the light.
+func (ls *lightSource) sampleLi(ref Point, rng *rand.Rand) (p Point, n Vector, li Color, pdf float64) {
+	switch l := ls.light.(type) {
+	case *PointLight:
+		d := ref.SubPoint(l.Position())
+		return l.Position(), Vector{}, l.Intensity().Scale(1 / d.Dot(d)), 1
+	case *SpotLight:
+		dist, dir := ref.SubPoint(l.Position()).MagnitudeNormalize()
+		if l.Direction().Dot(dir) < spotCosMax(l) {
+			return l.Position(), Vector{}, Black(), 1
+		}
+		return l.Position(), Vector{}, l.Intensity().Scale(1 / (dist * dist)), 1
+	}
+
+	p, n, pdfA := ls.e.sample(rng)
+	dist, dir := ref.SubPoint(p).MagnitudeNormalize()
+	cos := math.Abs(n.Dot(dir))
+	if cos == 0 || dist == 0 {
+		return p, n, Black(), 0
+	}
+	return p, n, ls.e.radiance(dir), pdfA * dist * dist / cos
+}
+
+type vertexKind int
+
+const (
+	cameraVertex vertexKind = iota
+	lightVertex
+	surfaceVertex
+)
+
+// bdptVertex is a vertex of a camera or light subpath
+type bdptVertex struct {
+	kind vertexKind
+	p    Point
+	// origin is where rays leaving the vertex start, just above the surface (see rayOrigin)
+	origin Point
+	// n is the surface normal, zero for the camera, point and spot lights
+	n Vector
+
+	// beta is the throughput of the subpath up to this vertex
+	beta Color
+	// delta is true if the path was continued with a specular bounce
+	delta bool
+	// pdfFwd is the pdf (area) of the subpath reaching this vertex, pdfRev of the other subpath reaching it
+	pdfFwd, pdfRev float64
+
+	// bsdf is set for surfaces that scatter light
+	bsdf *bsdf
+	// source is the light this vertex is on, for light vertices and surfaces of emitters
+	source *lightSource
+	// le is the light emitted towards the previous vertex, for surfaces of emitters
+	le Color
+}
+
+// onSurface returns true if the vertex has a normal
+func (v *bdptVertex) onSurface() bool {
+	return v.n != Vector{}
+}
+
+// rayOrigin returns the point rays from the vertex towards p start from, surfaces can be left from either side
+func (v *bdptVertex) rayOrigin(p Point) Point {
+	if v.bsdf != nil {
+		return v.bsdf.origin(p)
+	}
+	return v.origin
+}
+
+// connectible returns true if the vertex can be connected to a vertex of the other subpath
+func (v *bdptVertex) connectible() bool {
+	switch v.kind {
+	case surfaceVertex:
+		return v.bsdf != nil && v.bsdf.nonSpecular()
+	}
+	return true
+}
+
+// isDeltaLight returns true for vertices on point and spot lights
+func (v *bdptVertex) isDeltaLight() bool {
+	return v.kind == lightVertex && v.source.isDelta()
+}
+
+// f returns the bsdf of a surface vertex for light scattered towards next
+func (v *bdptVertex) f(next *bdptVertex) Color {
+	return v.bsdf.f(next.p.SubPoint(v.p).Normalize())
+}
+
+// convertDensity converts a solid angle pdf at this vertex into an area pdf at next
+func (v *bdptVertex) convertDensity(pdf float64, next *bdptVertex) float64 {
+	d := next.p.SubPoint(v.p)
+	dist2 := d.Dot(d)
+	if dist2 == 0 {
+		return 0
+	}
+	if next.onSurface() {
+		pdf *= math.Abs(next.n.Dot(d.Scale(1 / math.Sqrt(dist2))))
+	}
+	return pdf / dist2
+}
+
+// pdf returns the pdf (area) of this vertex sampling next, having been reached from prev
+func (v *bdptVertex) pdf(w *World, prev, next *bdptVertex) float64 {
+	dir := next.p.SubPoint(v.p).Normalize()
+
+	var pdf float64
+	switch v.kind {
+	case lightVertex:
+		return v.pdfLight(next)
+	case cameraVertex:
+		_, pdf = w.Camera().importance(dir)
+	case surfaceVertex:
+		if v.bsdf == nil {
+			return 0
+		}
+		pdf = v.bsdf.pdf(dir)
+		if prev != nil {
+			pdf = v.bsdf.pdfDir(prev.p.SubPoint(v.p).Normalize(), dir)
+		}
+	}
+	return v.convertDensity(pdf, next)
+}
+
+// pdfLight returns the pdf (area) of a light vertex emitting towards next
+func (v *bdptVertex) pdfLight(next *bdptVertex) float64 {
+	d := next.p.SubPoint(v.p)
+	dist2 := d.Dot(d)
+	if dist2 == 0 {
+		return 0
+	}
+	dir := d.Scale(1 / math.Sqrt(dist2))
+
+	pdf := v.source.pdfDir(v.n, dir) / dist2
+	if next.onSurface() {
+		pdf *= math.Abs(next.n.Dot(dir))
+	}
+	return pdf
+}
+
+// BDPTIntegrator is a bidirectional path tracer
+// For every camera ray a subpath is traced from the camera and another one from a random light, and every
+// vertex of one is connected to every vertex of the other. All the ways of building a path are weighed with
+// multiple importance sampling (power heuristic). Paths connected straight to the camera land on other pixels,
+// and are splatted into the film. This finds caustics (light focused by glass onto diffuse surfaces) that the
+// path tracer misses, even from point lights.
+// Materials and lights are treated the same as by the path tracer.
+type BDPTIntegrator struct {
+	// MaxDepth is the maximum number of bounces of the full path
+	MaxDepth int
+
+	sources []*lightSource
+	// sources by the shape rays hit
+	sourceByShape map[Shaper]*lightSource
+}
+
+// NewBDPTIntegrator returns a new bidirectional path tracer
+func NewBDPTIntegrator(maxDepth int) *BDPTIntegrator {
+	return &BDPTIntegrator{
+		MaxDepth: maxDepth,
+	}
+}
+
+// Preprocess implements the Integrator interface
+func (bd *BDPTIntegrator) Preprocess(w *World) {
+	bd.sources = nil
+	bd.sourceByShape = make(map[Shaper]*lightSource)
+
+	for _, l := range w.Lights {
+		switch l.(type) {
+		case *PointLight, *SpotLight:
+			bd.sources = append(bd.sources, &lightSource{light: l})
+		}
+	}
+
+	emitters, _ := findEmitters(w)
+	for _, e := range emitters {
+		ls := &lightSource{light: e.light, e: e}
+		bd.sources = append(bd.sources, ls)
+		bd.sourceByShape[e.shape] = ls
+	}
+}
+
+// choicePdf returns the probability of picking any one light
+func (bd *BDPTIntegrator) choicePdf() float64 {
+	return 1 / float64(len(bd.sources))
+}
+
+// Li implements the Integrator interface
+func (bd *BDPTIntegrator) Li(w *World, r Ray, xs Intersections, rng *rand.Rand) Color {
+	cameraPath := bd.cameraSubpath(w, r, xs, rng)
+	lightPath := bd.lightSubpath(w, xs, rng)
+
+	result := Black()
+	for t := 1; t <= len(cameraPath); t++ {
+		for s := 0; s <= len(lightPath); s++ {
+			depth := s + t - 2
+			if (s == 1 && t == 1) || depth < 0 || depth > bd.MaxDepth {
+				continue
+			}
+
+			if t == 1 {
+				// light subpath seen by the camera, this lands on some other pixel
+				if clr, x, y, ok := bd.connectCamera(w, lightPath, s, xs); ok && w.Film() != nil {
+					w.Film().AddSplat(x, y, clr)
+				}
+				continue
+			}
+			result = result.Add(bd.connect(w, lightPath, cameraPath, s, t, xs, rng))
+		}
+	}
+
+	return result
+}
+
+// cameraSubpath traces a subpath starting with the camera ray r
+func (bd *BDPTIntegrator) cameraSubpath(w *World, r Ray, xs Intersections, rng *rand.Rand) []*bdptVertex {
+	_, pdfDir := w.Camera().importance(r.Dir)
+
+	path := []*bdptVertex{{kind: cameraVertex, p: r.Origin, origin: r.Origin, beta: White()}}
+	return bd.randomWalk(w, r, White(), pdfDir, bd.MaxDepth+1, path, true, xs, rng)
+}
+
+// lightSubpath traces a subpath starting on a random light
+func (bd *BDPTIntegrator) lightSubpath(w *World, xs Intersections, rng *rand.Rand) []*bdptVertex {
+	if len(bd.sources) == 0 {
+		return nil
+	}
+
+	ls := bd.sources[rng.Intn(len(bd.sources))]
+	p, n, dir, le, pdfPos, pdfDir := ls.sampleLe(rng)
+	if pdfPos == 0 || pdfDir == 0 || le == Black() {
+		return nil
+	}
+
+	v := &bdptVertex{
+		kind:   lightVertex,
+		p:      p,
+		origin: p,
+		n:      n,
+		source: ls,
+		beta:   le.Scale(1 / (bd.choicePdf() * pdfPos)),
+		pdfFwd: bd.choicePdf() * pdfPos,
+	}
+
+	cos := 1.0
+	if v.onSurface() {
+		cos = math.Abs(n.Dot(dir))
+		// start just off the surface of the emitter, on the side the ray leaves from
+		v.origin = p.AddVector(n.Scale(math.Copysign(1e-4, n.Dot(dir))))
+	}
+
+	return bd.randomWalk(w, NewRay(v.origin, dir), v.beta.Scale(cos/pdfDir), pdfDir, bd.MaxDepth, []*bdptVertex{v}, false, xs, rng)
+}
+
+// randomWalk extends the path by following ray r and sampling the bsdf at every hit
+// beta is the throughput and pdf the pdf (solid angle) of the ray.
+func (bd *BDPTIntegrator) randomWalk(w *World, r Ray, beta Color, pdf float64, maxDepth int, path []*bdptVertex, camera bool, xs Intersections, rng *rand.Rand) []*bdptVertex {
+	if maxDepth == 0 {
+		return path
+	}
+
+	pdfFwd := pdf
+	for bounces := 0; ; {
+		xs = w.Intersections(r, xs[:0])
+		hit, err := xs.Hit()
+		if err != nil {
+			break
+		}
+		state := PrepareComputations(hit, r, xs)
+		beta = beta.Blend(state.transmittance())
+
+		prev := path[len(path)-1]
+		v := &bdptVertex{
+			kind:   surfaceVertex,
+			p:      state.Point,
+			origin: state.OverPoint,
+			n:      state.NormalV,
+			beta:   beta,
+		}
+		v.pdfFwd = prev.convertDensity(pdfFwd, v)
+
+		// emitters don't scatter light, same as in the path tracer
+		if m := state.material(); m.Emissive != Black() {
+			if camera {
+				v.source = bd.sourceByShape[state.Object]
+				v.le = m.Emissive
+				if v.source != nil {
+					v.le = v.source.e.radiance(state.EyeV)
+				}
+				path = append(path, v)
+			}
+			break
+		}
+
+		v.bsdf = newBSDF(state)
+		path = append(path, v)
+
+		if bounces++; bounces >= maxDepth {
+			break
+		}
+
+		s, ok := v.bsdf.sample(rng)
+		if !ok {
+			break
+		}
+		beta = beta.Blend(s.weight)
+
+		pdfFwd = s.pdf
+		pdfRev := v.bsdf.pdfDir(s.wi, state.EyeV)
+		if s.specular {
+			v.delta = true
+			pdfFwd, pdfRev = 0, 0
+		}
+		prev.pdfRev = v.convertDensity(pdfRev, prev)
+
+		r = NewRay(s.origin, s.wi)
+	}
+
+	return path
+}
+
+// geometry returns the geometry term between two vertices, 0 if they can't see each other
+func (bd *BDPTIntegrator) geometry(w *World, v0, v1 *bdptVertex, xs Intersections) float64 {
+	d := v1.p.SubPoint(v0.p)
+	dist2 := d.Dot(d)
+	if dist2 == 0 {
+		return 0
+	}
+	dir := d.Scale(1 / math.Sqrt(dist2))
+
+	g := 1 / dist2
+	if v0.onSurface() {
+		g *= math.Abs(v0.n.Dot(dir))
+	}
+	if v1.onSurface() {
+		g *= math.Abs(v1.n.Dot(dir))
+	}
+	if g == 0 {
+		return 0
+	}
+
+	origin := v0.rayOrigin(v1.p)
+	dist, dir := v1.p.SubPoint(origin).MagnitudeNormalize()
+	if w.pathOccluded(origin, dir, dist, xs) {
+		return 0
+	}
+	return g
+}
+
+// connect returns the light carried by the path made of the first s vertices of the light subpath and
+// the first t (> 1) vertices of the camera subpath
+func (bd *BDPTIntegrator) connect(w *World, lightPath, cameraPath []*bdptVertex, s, t int, xs Intersections, rng *rand.Rand) Color {
+	pt := cameraPath[t-1]
+	var sampled *bdptVertex
+	var result Color
+
+	switch s {
+	case 0:
+		// the camera subpath hit an emitter
+		if pt.le == Black() {
+			return Black()
+		}
+		result = pt.beta.Blend(pt.le)
+		if pt.source == nil {
+			// emitters that can't be sampled are only found this way
+			return result
+		}
+	case 1:
+		// pick a new point on a light, like the path tracer does
+		if !pt.connectible() || len(bd.sources) == 0 {
+			return Black()
+		}
+		ls := bd.sources[rng.Intn(len(bd.sources))]
+		p, n, li, pdf := ls.sampleLi(pt.p, rng)
+		if pdf == 0 || li == Black() {
+			return Black()
+		}
+		sampled = &bdptVertex{
+			kind:   lightVertex,
+			p:      p,
+			origin: p,
+			n:      n,
+			source: ls,
+			beta:   li.Scale(1 / (pdf * bd.choicePdf())),
+		}
+		sampled.pdfFwd = bd.choicePdf() * ls.pdfPos(p)
+
+		origin := pt.rayOrigin(p)
+		dist, dir := p.SubPoint(origin).MagnitudeNormalize()
+		result = pt.beta.Blend(pt.f(sampled)).Blend(sampled.beta).Scale(math.Abs(pt.n.Dot(dir)))
+		if result == Black() || w.pathOccluded(origin, dir, dist, xs) {
+			return Black()
+		}
+	default:
+		qs := lightPath[s-1]
+		if !qs.connectible() || !pt.connectible() {
+			return Black()
+		}
+		result = qs.beta.Blend(qs.f(pt)).Blend(pt.f(qs)).Blend(pt.beta)
+		if result == Black() {
+			return Black()
+		}
+		result = result.Scale(bd.geometry(w, qs, pt, xs))
+	}
+
+	if result == Black() {
+		return result
+	}
+	return result.Scale(bd.misWeight(w, lightPath, cameraPath, sampled, s, t))
+}
+
+// connectCamera returns the light carried by the first s vertices of the light subpath to the camera,
+// and where it lands on the canvas
+func (bd *BDPTIntegrator) connectCamera(w *World, lightPath []*bdptVertex, s int, xs Intersections) (clr Color, x, y float64, ok bool) {
+	qs := lightPath[s-1]
+	if !qs.connectible() {
+		return clr, 0, 0, false
+	}
+
+	camera := w.Camera()
+	origin := qs.rayOrigin(camera.Position())
+	dist, dir := camera.Position().SubPoint(origin).MagnitudeNormalize()
+	x, y, ok = camera.rasterPosition(dir.Negate())
+	if !ok {
+		return clr, 0, 0, false
+	}
+
+	// We * cos at the camera is the pdf of the camera ray
+	_, pdf := camera.importance(dir.Negate())
+	sampled := &bdptVertex{
+		kind:   cameraVertex,
+		p:      camera.Position(),
+		origin: camera.Position(),
+		beta:   White().Scale(pdf / (dist * dist)),
+	}
+
+	clr = qs.beta.Blend(qs.f(sampled)).Blend(sampled.beta).Scale(math.Abs(qs.n.Dot(dir)))
+	if clr == Black() || w.pathOccluded(origin, dir, dist, xs) {
+		return clr, 0, 0, false
+	}
+
+	return clr.Scale(bd.misWeight(w, lightPath, nil, sampled, s, 1)), x, y, true
+}
+
+// misWeight returns the multiple importance sampling weight of the strategy using s light and t camera vertices
+// sampled replaces the first vertex of the light (s == 1) or camera (t == 1) subpath.
+func (bd *BDPTIntegrator) misWeight(w *World, lightPath, cameraPath []*bdptVertex, sampled *bdptVertex, s, t int) float64 {
+	if s+t == 2 {
+		return 1
+	}
+
+	// delta distributions have a pdf of 0, ignore them in the ratios
+	remap0 := func(f float64) float64 {
+		if f == 0 {
+			return 1
+		}
+		return f
+	}
+
+	light := make([]*bdptVertex, s)
+	copy(light, lightPath)
+	camera := make([]*bdptVertex, t)
+	copy(camera, cameraPath)
+	if s == 1 {
+		light[0] = sampled
+	}
+	if t == 1 {
+		camera[0] = sampled
+	}
+
+	// the pdfs of the vertices next to the connection change, work on copies as the subpaths are shared
+	dup := func(v *bdptVertex) *bdptVertex {
+		c := *v
+		return &c
+	}
+	var qs, qsMinus, ptMinus *bdptVertex
+	pt := dup(camera[t-1])
+	camera[t-1] = pt
+	if t > 1 {
+		ptMinus = dup(camera[t-2])
+		camera[t-2] = ptMinus
+	}
+	if s > 0 {
+		qs = dup(light[s-1])
+		light[s-1] = qs
+	}
+	if s > 1 {
+		qsMinus = dup(light[s-2])
+		light[s-2] = qsMinus
+	}
+
+	// the connection vertices are not specular, otherwise there would be no connection
+	pt.delta = false
+	if qs != nil {
+		qs.delta = false
+	}
+
+	if s > 0 {
+		pt.pdfRev = qs.pdf(w, qsMinus, pt)
+	} else {
+		pt.pdfRev = bd.choicePdf() * pt.source.pdfPos(pt.p)
+	}
+	if ptMinus != nil {
+		if s > 0 {
+			ptMinus.pdfRev = pt.pdf(w, qs, ptMinus)
+		} else {
+			ptMinus.pdfRev = pt.lightSourceVertex().pdfLight(ptMinus)
+		}
+	}
+	if qs != nil {
+		qs.pdfRev = pt.pdf(w, ptMinus, qs)
+	}
+	if qsMinus != nil {
+		qsMinus.pdfRev = qs.pdf(w, pt, qsMinus)
+	}
+
+	// sum the ratios of the pdfs of all the other strategies to this one
+	sumRi := 0.0
+	ri := 1.0
+	for i := t - 1; i > 0; i-- {
+		ri *= remap0(camera[i].pdfRev) / remap0(camera[i].pdfFwd)
+		if !camera[i].delta && !camera[i-1].delta {
+			sumRi += ri
+		}
+	}
+
+	ri = 1
+	for i := s - 1; i >= 0; i-- {
+		ri *= remap0(light[i].pdfRev) / remap0(light[i].pdfFwd)
+
+		deltaLight := light[0].isDeltaLight()
+		if i > 0 {
+			deltaLight = light[i-1].delta
+		}
+		if !light[i].delta && !deltaLight {
+			sumRi += ri
+		}
+	}
+
+	return 1 / (1 + sumRi)
+}
+
+// lightSourceVertex returns the surface vertex of an emitter as a light vertex
+func (v *bdptVertex) lightSourceVertex() *bdptVertex {
+	c := *v
+	c.kind = lightVertex
+	return &c
+}
@@ -0,0 +1,177 @@
+package tracer
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// renderFilm renders spp jittered samples per pixel into a new film and returns it
+func renderFilm(w *World, integrator Integrator, spp int) *Film {
+	camera := w.Camera()
+	w.film = NewFilm(int(camera.Hsize), int(camera.Vsize), NewBoxFilter(0.5))
+	integrator.Preprocess(w)
+
+	rng := rand.New(rand.NewSource(1))
+	xs := NewIntersections()
+	for py := 0; py < int(camera.Vsize); py++ {
+		for px := 0; px < int(camera.Hsize); px++ {
+			for i := 0; i < spp; i++ {
+				x, y := float64(px)+rng.Float64(), float64(py)+rng.Float64()
+				w.film.AddPixelSample(px, py, x, y, integrator.Li(w, camera.RayForPixel(x, y), xs, rng))
+			}
+		}
+	}
+	return w.film
+}
+
+// filmMean returns the mean (unclamped) color of the pixels of the film include returns true for, with the splats
+func filmMean(f *Film, include func(px, py int) bool) Color {
+	sum := Black()
+	n := 0
+	for i, p := range f.pixels {
+		if !include(i%f.Width, i/f.Width) {
+			continue
+		}
+		sum = sum.Add(p.sum.Scale(1 / p.weight)).Add(f.splats[i].Scale(float64(f.Width*f.Height) / float64(f.samples)))
+		n++
+	}
+	return sum.Scale(1 / float64(n))
+}
+
+// allPixels includes every pixel in filmMean
+func allPixels(px, py int) bool { return true }
+
+func bdptTestCamera() *Camera {
+	camera := NewCamera(16, 12, math.Pi/3)
+	camera.SetTransform(ViewTransform(NewPoint(0, 2.5, -4), NewPoint(0, 0.5, 1), NewVector(0, 1, 0)))
+	return camera
+}
+
+func TestBDPTIntegrator_MatchesPathTracer(t *testing.T) {
+	tests := []struct {
+		name  string
+		world func() *World
+	}{
+		{
+			name:  "area lights",
+			world: pathTestWorld,
+		},
+		{
+			name: "point and spot lights",
+			world: func() *World {
+				w := pathTestWorld()
+				w.Objects = w.Objects[:2]
+				w.SetLights(Lights{
+					NewPointLight(NewPoint(-2, 4, -1), NewColor(10, 10, 10)),
+					NewSpotLight(NewPoint(1, 3, 1), NewColor(5, 5, 5), math.Pi/3, NewPoint(1, 0, 1)),
+				})
+				return w
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := tt.world()
+			w.SetCamera(bdptTestCamera())
+			want := filmMean(renderFilm(w, NewPathTracerIntegrator(8), 256), allPixels)
+
+			w = tt.world()
+			w.SetCamera(bdptTestCamera())
+			got := filmMean(renderFilm(w, NewBDPTIntegrator(8), 256), allPixels)
+
+			assert.InEpsilon(t, want.R, got.R, 0.05, "should converge to the same result")
+			assert.InEpsilon(t, want.G, got.G, 0.05, "should converge to the same result")
+			assert.InEpsilon(t, want.B, got.B, 0.05, "should converge to the same result")
+		})
+	}
+}
+
+func TestBDPTIntegrator_Caustic(t *testing.T) {
+	// a point light reflected onto the floor by a vertical mirror, the path tracer can't find those paths
+	// In front of the mirror the reflected light is the direct light of the light mirrored behind it, the path
+	// tracer renders that exactly. The floor can't light itself through the mirror, it would be at a grazing angle.
+	light := NewPoint(0, 3, 1)
+	mirrorX := 1.5
+	world := func(mirror bool, lights ...Point) *World {
+		w := NewWorld(NewWorldConfig())
+		w.AddObject(NewPlane())
+
+		if mirror {
+			m := NewPlane()
+			m.SetTransform(IM().RotateZ(math.Pi/2).Translate(mirrorX, 0, 0))
+			m.Material().Diffuse = 0
+			m.Material().Ambient = 0
+			m.Material().Specular = 0
+			m.Material().Reflective = 1
+			w.AddObject(m)
+		}
+
+		var ls Lights
+		for _, l := range lights {
+			ls = append(ls, NewPointLight(l, NewColor(10, 10, 10)))
+		}
+		w.SetLights(ls)
+		w.SetCamera(bdptTestCamera())
+		return w
+	}
+
+	// the pixels of the floor in front of the mirror, with a margin for the size of the pixels
+	camera := bdptTestCamera()
+	floor := func(px, py int) bool {
+		r := camera.RayForPixel(float64(px)+0.5, float64(py)+0.5)
+		if r.Dir.Y() >= 0 {
+			return false
+		}
+		return r.Position(-r.Origin.Y()/r.Dir.Y()).X() < mirrorX-0.5
+	}
+
+	mirrored := NewPoint(2*mirrorX-light.X(), light.Y(), light.Z())
+	want := filmMean(renderFilm(world(false, mirrored), NewPathTracerIntegrator(8), 16), floor)
+
+	direct := filmMean(renderFilm(world(true, light), NewPathTracerIntegrator(8), 16), floor)
+	got := filmMean(renderFilm(world(true, light), NewBDPTIntegrator(8), 256), floor).Sub(direct)
+
+	assert.True(t, want.Luminance() > direct.Luminance()/4, "the caustic should be a large part of the light")
+	assert.InEpsilon(t, want.R, got.R, 0.05, "caustic should match the mirrored light")
+	assert.InEpsilon(t, want.G, got.G, 0.05, "caustic should match the mirrored light")
+	assert.InEpsilon(t, want.B, got.B, 0.05, "caustic should match the mirrored light")
+}
+
+func TestLightSource_SampleLe(t *testing.T) {
+	sphere := NewUnitSphere()
+	e, _ := newEmitter(sphere, nil, true)
+
+	tests := []struct {
+		name string
+		ls   *lightSource
+	}{
+		{
+			name: "point light",
+			ls:   &lightSource{light: NewPointLight(NewPoint(0, 1, 0), White())},
+		},
+		{
+			name: "spot light",
+			ls:   &lightSource{light: NewSpotLight(NewPoint(0, 1, 0), White(), math.Pi/4, NewPoint(0, 0, 0))},
+		},
+		{
+			name: "emitter",
+			ls:   &lightSource{e: e},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rng := rand.New(rand.NewSource(1))
+			for i := 0; i < 100; i++ {
+				p, n, dir, _, pdfPos, pdfDir := tt.ls.sampleLe(rng)
+				assert.InDelta(t, 1, dir.Magnitude(), 1e-9, "direction should be normalized")
+				assert.InDelta(t, tt.ls.pdfDir(n, dir), pdfDir, 1e-9, "pdf should match")
+				assert.InDelta(t, tt.ls.pdfPos(p), pdfPos, 1e-9, "pdf should match")
+			}
+		})
+	}
+}
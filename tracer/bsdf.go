@@ -0,0 +1,298 @@
+package tracer
+
+import (
+	"math"
+	"math/rand"
+)
+
+// bsdf describes how a surface scatters light, as seen by the path tracer
+// The Phong material is mapped to a lambertian diffuse lobe plus mirror reflection and refraction, which are glossy
+// (GGX microfacets) for rough materials. Principled materials add a clear coat and a sheen lobe.
+// The Phong highlight is a fake reflection of point lights and is not used.
+type bsdf struct {
+	state *IntersectionState
+
+	// n is the shading normal, on the same side as the outgoing (eye) direction wo
+	n, wo Vector
+
+	// albedo is the diffuse reflectance
+	albedo Color
+	// mirror and transmit are the weights of reflection and refraction
+	mirror, transmit float64
+
+	// m and clr are the material and its color, used to tint the reflections of metals
+	m   *Material
+	clr Color
+
+	// rough is the microfacet distribution, nil for perfect mirrors and glass
+	rough *ggx
+	frame onb
+
+	// coat is the distribution of the clear coat of principled materials, nil if there is none
+	coat *ggx
+
+	// probabilities of sampling each lobe, the sheen is sampled with the diffuse lobe
+	pDiffuse, pMirror, pTransmit, pCoat float64
+}
+
+// newBSDF returns the bsdf at the intersection
+func newBSDF(state *IntersectionState) *bsdf {
+	m := state.material()
+	clr := m.surfaceColor(state.Object, state.Point, state.texCoords())
+
+	b := &bsdf{
+		state:    state,
+		n:        state.NormalV,
+		wo:       state.EyeV,
+		albedo:   clr.Scale(m.Diffuse * (1 - m.Metallic)),
+		mirror:   m.reflectivity(),
+		transmit: m.Transparency,
+		m:        m,
+		clr:      clr,
+		rough:    m.microfacet(),
+		frame:    newONB(state.NormalV),
+		coat:     m.coat(),
+	}
+
+	// same as shadeHit, use Schlick approximation for the Fresnel Effect when both are present
+	if b.mirror > 0 && b.transmit > 0 {
+		reflectance := Schlick(state)
+		b.mirror *= reflectance
+		b.transmit *= 1 - reflectance
+	}
+
+	diffuse := b.albedo.Luminance() + m.sheen.Luminance()
+	coat := 0.0
+	if b.coat != nil {
+		coat = m.clearcoat * (clearcoatF0 + (1-clearcoatF0)*schlickWeight(b.wo.Dot(b.n)))
+	}
+
+	total := diffuse + b.mirror + b.transmit + coat
+	if total > 0 {
+		b.pDiffuse = diffuse / total
+		b.pMirror = b.mirror / total
+		b.pTransmit = b.transmit / total
+		b.pCoat = coat / total
+	}
+	return b
+}
+
+// nonSpecular returns true if the bsdf has a non-specular part, only then is it worth sampling lights
+func (b *bsdf) nonSpecular() bool {
+	return b.pDiffuse > 0 || b.pCoat > 0 || (b.rough != nil && b.pMirror+b.pTransmit > 0)
+}
+
+// origin returns the point rays towards p leave from, above or below the surface
+func (b *bsdf) origin(p Point) Point {
+	if p.SubPoint(b.state.Point).Dot(b.n) < 0 {
+		return b.state.UnderPoint
+	}
+	return b.state.OverPoint
+}
+
+// f returns the value of the (non-specular part of) the bsdf for light arriving from direction wi
+func (b *bsdf) f(wi Vector) Color {
+	return b.fDir(b.wo, wi)
+}
+
+// pdf returns the probability density of sample returning wi (non-specular part only)
+func (b *bsdf) pdf(wi Vector) float64 {
+	return b.pdfDir(b.wo, wi)
+}
+
+// indexes returns the refractive indexes on the side of wo and on the other side
+func (b *bsdf) indexes(wo Vector) (etaO, etaI float64) {
+	if b.n.Dot(wo) > 0 {
+		return b.state.N1, b.state.N2
+	}
+	return b.state.N2, b.state.N1
+}
+
+// transmissionHalf returns the microfacet normal that refracts local direction wo into wi, ok is false if there is none
+func (b *bsdf) transmissionHalf(wo, wi Vector, etaO, etaI float64) (h Vector, ok bool) {
+	h = wo.Scale(etaO).AddVector(wi.Scale(etaI)).Negate().Normalize()
+	if h.z < 0 {
+		h = h.Negate()
+	}
+	// both directions must be on opposite sides of the microfacet too
+	return h, wo.Dot(h)*wi.Dot(h) < 0
+}
+
+// fDir returns the value of the (non-specular part of) the bsdf for light arriving from wi, leaving towards wo
+func (b *bsdf) fDir(wo, wi Vector) Color {
+	cosO, cosI := b.n.Dot(wo), b.n.Dot(wi)
+	result := Black()
+
+	if cosO > 0 && cosI > 0 {
+		result = b.albedo.Scale(1 / math.Pi)
+
+		if b.rough != nil && b.mirror > 0 {
+			lo, li := b.frame.toLocal(wo), b.frame.toLocal(wi)
+			h := lo.AddVector(li).Normalize()
+			brdf := b.rough.d(h) * b.rough.g(lo, li) / (4 * lo.z * li.z)
+			result = result.Add(b.m.reflectionTint(b.clr, lo.Dot(h)).Scale(b.mirror * brdf))
+		}
+
+		if b.m.sheen != Black() || b.coat != nil {
+			lo, li := b.frame.toLocal(wo), b.frame.toLocal(wi)
+			result = result.Add(b.m.sheenBRDF(lo, li))
+			if b.coat != nil {
+				result = result.Add(White().Scale(b.m.coatBRDF(b.coat, lo, li)))
+			}
+		}
+	}
+
+	if cosO*cosI < 0 && b.rough != nil && b.transmit > 0 {
+		// the distribution is symmetric, evaluate it from above the surface
+		lo, li := b.frame.toLocal(wo), b.frame.toLocal(wi)
+		if lo.z < 0 {
+			lo, li = lo.Negate(), li.Negate()
+		}
+		etaO, etaI := b.indexes(wo)
+		h, ok := b.transmissionHalf(lo, li, etaO, etaI)
+		if !ok {
+			return result
+		}
+
+		// without the (etaO / etaI)^2 radiance scaling, the same as perfect refraction
+		dO, dI := lo.Dot(h), li.Dot(h)
+		den := etaO*dO + etaI*dI
+		btdf := math.Abs(dO*dI/(lo.z*li.z)) * etaI * etaI * b.rough.d(h) * b.rough.g(lo, li) / (den * den)
+		result = result.Add(White().Scale(b.transmit * btdf))
+	}
+
+	return result
+}
+
+// pdfDir returns the probability density of sampling wi for light leaving towards wo (non-specular part only)
+func (b *bsdf) pdfDir(wo, wi Vector) float64 {
+	cosO, cosI := b.n.Dot(wo), b.n.Dot(wi)
+	pdf := 0.0
+
+	if cosO > 0 && cosI > 0 {
+		pdf = b.pDiffuse * cosI / math.Pi
+
+		if b.rough != nil && b.pMirror > 0 {
+			lo, li := b.frame.toLocal(wo), b.frame.toLocal(wi)
+			h := lo.AddVector(li).Normalize()
+			pdf += b.pMirror * b.rough.pdfVisible(lo, h) / (4 * lo.Dot(h))
+		}
+
+		if b.pCoat > 0 {
+			lo, li := b.frame.toLocal(wo), b.frame.toLocal(wi)
+			h := lo.AddVector(li).Normalize()
+			pdf += b.pCoat * b.coat.pdfVisible(lo, h) / (4 * lo.Dot(h))
+		}
+	}
+
+	if cosO*cosI < 0 && b.rough != nil && b.pTransmit > 0 {
+		lo, li := b.frame.toLocal(wo), b.frame.toLocal(wi)
+		if lo.z < 0 {
+			lo, li = lo.Negate(), li.Negate()
+		}
+		etaO, etaI := b.indexes(wo)
+		h, ok := b.transmissionHalf(lo, li, etaO, etaI)
+		if !ok {
+			return pdf
+		}
+
+		// change of variables from the microfacet normal to the refracted direction
+		dO, dI := lo.Dot(h), li.Dot(h)
+		den := etaO*dO + etaI*dI
+		pdf += b.pTransmit * b.rough.pdfVisible(lo, h) * etaI * etaI * math.Abs(dI) / (den * den)
+	}
+
+	return pdf
+}
+
+// bsdfSample is a direction sampled from a bsdf
+type bsdfSample struct {
+	wi Vector
+	// weight is f * cos / pdf
+	weight Color
+	pdf    float64
+	// specular is true for perfect reflection and refraction, these can't be combined with light sampling
+	specular bool
+	// origin is the point to continue the path from, above or below the surface
+	origin Point
+}
+
+// sample picks an incoming direction, ok is false if the path should end
+func (b *bsdf) sample(rng *rand.Rand) (s bsdfSample, ok bool) {
+	u := rng.Float64()
+	lo := b.frame.toLocal(b.wo)
+
+	var wi Vector
+	switch {
+	case u < b.pDiffuse:
+		wi = b.frame.local(cosineSampleHemisphere(rng))
+	case u < b.pDiffuse+b.pMirror:
+		if b.rough == nil {
+			return bsdfSample{
+				wi:       b.state.ReflectV,
+				weight:   b.m.reflectionTint(b.clr, b.wo.Dot(b.n)).Scale(b.mirror / b.pMirror),
+				pdf:      math.Inf(1),
+				specular: true,
+				origin:   b.state.OverPoint,
+			}, true
+		}
+
+		l := reflect(lo, b.rough.sampleVisible(lo, rng))
+		if l.z <= 0 {
+			return s, false
+		}
+		wi = b.frame.local(l.x, l.y, l.z)
+	case u < b.pDiffuse+b.pMirror+b.pTransmit:
+		if b.rough == nil {
+			dir, ok := refractedDirection(b.state)
+			if !ok {
+				// total internal reflection, same as RefractedColor
+				return s, false
+			}
+			return bsdfSample{
+				wi:       dir,
+				weight:   White().Scale(b.transmit / b.pTransmit),
+				pdf:      math.Inf(1),
+				specular: true,
+				origin:   b.state.UnderPoint,
+			}, true
+		}
+
+		l, ok := refract(lo, b.rough.sampleVisible(lo, rng), b.state.N1/b.state.N2)
+		if !ok || l.z >= 0 {
+			return s, false
+		}
+		wi = b.frame.local(l.x, l.y, l.z)
+	case u < b.pDiffuse+b.pMirror+b.pTransmit+b.pCoat:
+		l := reflect(lo, b.coat.sampleVisible(lo, rng))
+		if l.z <= 0 {
+			return s, false
+		}
+		wi = b.frame.local(l.x, l.y, l.z)
+	default:
+		return s, false
+	}
+
+	// weigh by all the lobes that could have produced wi
+	pdf := b.pdf(wi)
+	if pdf == 0 {
+		return s, false
+	}
+	cos := b.n.Dot(wi)
+	origin := b.state.OverPoint
+	if cos < 0 {
+		origin = b.state.UnderPoint
+	}
+
+	return bsdfSample{
+		wi:     wi,
+		weight: b.f(wi).Scale(math.Abs(cos) / pdf),
+		pdf:    pdf,
+		origin: origin,
+	}, true
+}
+
+// refractedDirection returns the direction of the refracted ray, ok is false on total internal reflection
+func refractedDirection(state *IntersectionState) (Vector, bool) {
+	return refract(state.EyeV, state.NormalV, state.N1/state.N2)
+}
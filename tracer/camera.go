@@ -78,6 +78,27 @@ func (c *Camera) setPixelSize() {
 
 // RayForPixel returns a ray that starts at the camera and passes through x,y on the canvas
 func (c *Camera) RayForPixel(x, y float64) Ray {
+	origin := Origin().TimesMatrix(c.TransformInverse)
+	return NewRay(origin, c.pixelDirection(origin, x, y))
+}
+
+// RayForPixelDifferentials returns the ray through x,y on the canvas with differentials through x+s,y and x,y+s
+// Textures use the differentials to filter, s is the distance between samples in pixels (see differentialScale).
+func (c *Camera) RayForPixelDifferentials(x, y, s float64) Ray {
+	origin := Origin().TimesMatrix(c.TransformInverse)
+
+	r := NewRay(origin, c.pixelDirection(origin, x, y))
+	r.Differentials = &RayDifferentials{
+		RxOrigin: origin,
+		RyOrigin: origin,
+		RxDir:    c.pixelDirection(origin, x+s, y),
+		RyDir:    c.pixelDirection(origin, x, y+s),
+	}
+	return r
+}
+
+// pixelDirection returns the direction from origin (the camera position) through x,y on the canvas
+func (c *Camera) pixelDirection(origin Point, x, y float64) Vector {
 	// due to antialiasing, the passed in x,y is already offset
 	xoffset := x * c.PixelSize
 	yoffset := y * c.PixelSize
@@ -87,10 +108,61 @@ func (c *Camera) RayForPixel(x, y float64) Ray {
 	wx := c.HalfWidth - xoffset
 	wy := c.HalfHeight - yoffset
 
-	// transform the canvas point and the origin using the camera's matrix
+	// transform the canvas point using the camera's matrix
 	pixel := NewPoint(wx, wy, -1).TimesMatrix(c.TransformInverse)
-	origin := Origin().TimesMatrix(c.TransformInverse)
-	direction := pixel.SubPoint(origin).Normalize()
+	return pixel.SubPoint(origin).Normalize()
+}
+
+// Position returns the position of the camera in world space
+func (c *Camera) Position() Point {
+	return Origin().TimesMatrix(c.TransformInverse)
+}
+
+// rasterPosition returns the raster coordinates where the ray leaving the camera in direction dir (world space)
+// crosses the canvas, ok is false if it doesn't
+func (c *Camera) rasterPosition(dir Vector) (x, y float64, ok bool) {
+	d := dir.TimesMatrix(c.Transform)
+
+	// camera looks toward -z
+	if d.z >= 0 {
+		return 0, 0, false
+	}
+	// point on the canvas, one unit away
+	px, py := d.x/-d.z, d.y/-d.z
+
+	x = (c.HalfWidth - px) / c.PixelSize
+	y = (c.HalfHeight - py) / c.PixelSize
+	if x < 0 || y < 0 || x >= c.Hsize || y >= c.Vsize {
+		return 0, 0, false
+	}
+	return x, y, true
+}
+
+// canvasFrame returns the normal of the canvas (world space, pointing away from the camera), its distance from
+// the camera and its area
+// ViewTransform doesn't always produce an orthonormal matrix, so this is worked out in world space.
+func (c *Camera) canvasFrame() (n Vector, dist, area float64) {
+	ex := NewVector(1, 0, 0).TimesMatrix(c.TransformInverse)
+	ey := NewVector(0, 1, 0).TimesMatrix(c.TransformInverse)
+	ez := NewVector(0, 0, -1).TimesMatrix(c.TransformInverse)
+
+	scale, n := ex.Cross(ey).MagnitudeNormalize()
+	if n.Dot(ez) < 0 {
+		n = n.Negate()
+	}
+	return n, n.Dot(ez), c.Hsize * c.Vsize * c.PixelSize * c.PixelSize * scale
+}
+
+// importance returns the importance (We) of a ray leaving the camera in direction dir (normalized, world space),
+// and the pdf (solid angle) of RayForPixel generating it, for a uniformly chosen position on the canvas
+func (c *Camera) importance(dir Vector) (we, pdf float64) {
+	if _, _, ok := c.rasterPosition(dir); !ok {
+		return 0, 0
+	}
+
+	n, dist, area := c.canvasFrame()
+	cos := dir.Dot(n)
+	pdf = dist * dist / (area * cos * cos * cos)
 
-	return NewRay(origin, direction)
+	return pdf / cos, pdf
 }
@@ -2,6 +2,7 @@ package tracer
 
 import (
 	"math"
+	"math/rand"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -180,3 +181,51 @@ func TestCamera_RayForPixel(t *testing.T) {
 		})
 	}
 }
+
+func TestCamera_RayForPixelDifferentials(t *testing.T) {
+	camera := NewCamera(201, 101, math.Pi/2)
+	camera.SetTransform(IM().Translate(0, -2, 5).RotateY(math.Pi / 4))
+
+	assert.Nil(t, camera.RayForPixel(100, 50).Differentials, "plain rays have none")
+
+	r := camera.RayForPixelDifferentials(100, 50, 0.5)
+	assert.NotNil(t, r.Differentials, "should have differentials")
+	assert.True(t, r.Dir.Equal(camera.RayForPixel(100, 50).Dir), "should equal")
+	assert.True(t, r.Differentials.RxOrigin.Equal(r.Origin), "should equal")
+	assert.True(t, r.Differentials.RxDir.Equal(camera.RayForPixel(100.5, 50).Dir), "should equal")
+	assert.True(t, r.Differentials.RyDir.Equal(camera.RayForPixel(100, 50.5).Dir), "should equal")
+}
+
+func TestCamera_RasterPosition(t *testing.T) {
+	camera := NewCamera(16, 12, math.Pi/3)
+	camera.SetTransform(ViewTransform(NewPoint(0, 2.5, -4), NewPoint(0, 0.5, 1), NewVector(0, 1, 0)))
+
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		x, y := rng.Float64()*camera.Hsize, rng.Float64()*camera.Vsize
+		gotX, gotY, ok := camera.rasterPosition(camera.RayForPixel(x, y).Dir)
+		assert.True(t, ok, "should be on the canvas")
+		assert.InDelta(t, x, gotX, 1e-9, "should equal")
+		assert.InDelta(t, y, gotY, 1e-9, "should equal")
+	}
+
+	_, _, ok := camera.rasterPosition(camera.RayForPixel(8, 6).Dir.Negate())
+	assert.False(t, ok, "behind the camera")
+	_, _, ok = camera.rasterPosition(camera.RayForPixel(-1, 6).Dir)
+	assert.False(t, ok, "outside the canvas")
+}
+
+func TestCamera_Importance(t *testing.T) {
+	camera := NewCamera(16, 12, math.Pi/3)
+	camera.SetTransform(ViewTransform(NewPoint(0, 2.5, -4), NewPoint(0, 0.5, 1), NewVector(0, 1, 0)))
+
+	// the pdf integrates to 1 over the sphere of directions
+	rng := rand.New(rand.NewSource(1))
+	n := 200000
+	sum := 0.0
+	for i := 0; i < n; i++ {
+		_, pdf := camera.importance(uniformSampleSphere(rng))
+		sum += pdf * 4 * math.Pi
+	}
+	assert.InDelta(t, 1, sum/float64(n), 0.02, "should be close")
+}
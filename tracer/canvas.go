@@ -21,6 +21,18 @@ type Canvas struct {
 	// this is a list where each 3 numbers are a vertex
 	points    []float32
 	oglColors []float32
+
+	// covered marks the pixels that were rendered (column major), nil means all of them
+	// Partial renders (crop windows, tile ranges) only cover part of the canvas.
+	covered [][]bool
+
+	// Encoding is how colors are written to images (ExportToPNG) and shown on screen
+	// sRGB converts them from the working space and applies the sRGB curve, linear writes the values as they are.
+	Encoding ColorEncoding
+
+	// WorkingSpace is the space of the colors of the canvas, sRGB encoding converts them from it (see
+	// WorldConfig.WorkingSpace)
+	WorkingSpace WorkingSpace
 }
 
 // NewCanvas returns a pointer to a new canvas
@@ -80,9 +92,10 @@ func (c *Canvas) Set(x, y int, clr Color) error {
 
 	// colum major order; (height*c+r)*3
 	i := ((c.Height * x) + y) * 3
-	c.oglColors[i] = float32(clr.R)
-	c.oglColors[i+1] = float32(clr.G)
-	c.oglColors[i+2] = float32(clr.B)
+	display := c.encode(clr)
+	c.oglColors[i] = float32(display.R)
+	c.oglColors[i+1] = float32(display.G)
+	c.oglColors[i+2] = float32(display.B)
 	return nil
 }
 
@@ -99,9 +112,10 @@ func (c *Canvas) SetFloat(x, y float64, clr Color) error {
 
 	// colum major order; (height*c+r)*3
 	i := ((c.Height * intx) + inty) * 3
-	c.oglColors[i] = float32(clr.R)
-	c.oglColors[i+1] = float32(clr.G)
-	c.oglColors[i+2] = float32(clr.B)
+	display := c.encode(clr)
+	c.oglColors[i] = float32(display.R)
+	c.oglColors[i+1] = float32(display.G)
+	c.oglColors[i+2] = float32(display.B)
 	return nil
 }
 
@@ -113,7 +127,20 @@ func (c *Canvas) Get(x, y int) (Color, error) {
 	return c.colors[x][y], nil
 }
 
-// ExportToPNG exports the canvas to a png file
+// Covered returns true if the pixel at the given coordinates was rendered
+func (c *Canvas) Covered(x, y int) bool {
+	if c.covered == nil {
+		return true
+	}
+	return c.covered[x][y]
+}
+
+// SetCoverage sets which pixels of the canvas were rendered (column major), nil means all of them
+func (c *Canvas) SetCoverage(mask [][]bool) {
+	c.covered = mask
+}
+
+// ExportToPNG exports the canvas to a png file, pixels that were not rendered are transparent
 func (c *Canvas) ExportToPNG(w io.Writer) error {
 	// create an image covering the entire canvas
 	upLeft := image.Point{0, 0}
@@ -125,11 +152,15 @@ func (c *Canvas) ExportToPNG(w io.Writer) error {
 
 	for col := 0; col < c.Width; col++ {
 		for row := 0; row < c.Height; row++ {
+			if !c.Covered(col, row) {
+				// image.NewRGBA starts out transparent
+				continue
+			}
 			sem <- true
 			go func(img *image.RGBA, col, row int, clr color.Color) {
 				defer func() { <-sem }()
 				img.Set(col, row, clr)
-			}(img, col, row, c.colors[col][row])
+			}(img, col, row, c.encode(c.colors[col][row]))
 		}
 	}
 
@@ -144,3 +175,89 @@ func (c *Canvas) ExportToPNG(w io.Writer) error {
 
 	return nil
 }
+
+// encode returns the color as written to images, clamped to [0, 1]
+func (c *Canvas) encode(clr Color) Color {
+	if c.Encoding == ColorEncodingLinear {
+		return clr.Clamp()
+	}
+	return c.WorkingSpace.ToSRGB(clr).Clamp().LinearToSRGB()
+}
+
+// decode returns the color of the value read from an image, the inverse of encode
+func (c *Canvas) decode(clr Color) Color {
+	if c.Encoding == ColorEncodingLinear {
+		return clr
+	}
+	return c.WorkingSpace.FromSRGB(clr.SRGBToLinear())
+}
+
+// NewCanvasFromPNG reads a canvas written by ExportToPNG, transparent pixels are marked as not rendered
+func NewCanvasFromPNG(r io.Reader) (*Canvas, error) {
+	img, err := png.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	canvas := NewCanvas(bounds.Dx(), bounds.Dy())
+	mask := make([][]bool, canvas.Width)
+	partial := false
+
+	for x := 0; x < canvas.Width; x++ {
+		mask[x] = make([]bool, canvas.Height)
+		for y := 0; y < canvas.Height; y++ {
+			clr := img.At(bounds.Min.X+x, bounds.Min.Y+y)
+			if _, _, _, a := clr.RGBA(); a == 0 {
+				partial = true
+				continue
+			}
+			mask[x][y] = true
+			canvas.Set(x, y, canvas.decode(ColorName(clr)))
+		}
+	}
+
+	if partial {
+		canvas.SetCoverage(mask)
+	}
+	return canvas, nil
+}
+
+// MergeCanvases stitches partial renders of the same frame into one canvas
+// Every rendered pixel is copied into the result, later canvases win if they overlap.
+func MergeCanvases(parts ...*Canvas) (*Canvas, error) {
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("nothing to merge")
+	}
+
+	width, height := parts[0].Width, parts[0].Height
+	canvas := NewCanvas(width, height)
+	mask := make([][]bool, width)
+	for x := range mask {
+		mask[x] = make([]bool, height)
+	}
+
+	for i, p := range parts {
+		if p.Width != width || p.Height != height {
+			return nil, fmt.Errorf("canvas %v is %vx%v, expected %vx%v", i, p.Width, p.Height, width, height)
+		}
+		for x := 0; x < width; x++ {
+			for y := 0; y < height; y++ {
+				if p.Covered(x, y) {
+					canvas.Set(x, y, p.colors[x][y])
+					mask[x][y] = true
+				}
+			}
+		}
+	}
+
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			if !mask[x][y] {
+				canvas.SetCoverage(mask)
+				return canvas, nil
+			}
+		}
+	}
+	return canvas, nil
+}
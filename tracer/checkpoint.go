@@ -0,0 +1,355 @@
+package tracer
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+)
+
+// tile is a rectangular block of pixels rendered as a single unit of work, [x0, x1) x [y0, y1)
+type tile struct {
+	x0, y0, x1, y1 int
+}
+
+// tiles splits a width x height image into tiles of (at most) size x size pixels, in row major order
+func tiles(width, height, size int) []tile {
+	if size <= 0 {
+		size = 16
+	}
+
+	var ts []tile
+	for y := 0; y < height; y += size {
+		for x := 0; x < width; x += size {
+			t := tile{x0: x, y0: y, x1: x + size, y1: y + size}
+			if t.x1 > width {
+				t.x1 = width
+			}
+			if t.y1 > height {
+				t.y1 = height
+			}
+			ts = append(ts, t)
+		}
+	}
+	return ts
+}
+
+// checkpointStats is the serialized form of sampleStats
+type checkpointStats struct {
+	N        int
+	Mean, M2 float64
+}
+
+// checkpoint is everything needed to resume a tiled render
+// Every tile seeds its own random number generator from Seed and its index, so the seed is the whole RNG state.
+type checkpoint struct {
+	Width, Height int
+	TileSize      int
+	Seed          int64
+
+	// Settings is the hash of the settings and scene the render was started with, see settingsHash
+	Settings uint64
+
+	// accumulated film data, row major order
+	Sums    []Color
+	Weights []float64
+	Stats   []checkpointStats
+	Splats  []Color
+	Samples int64
+
+	// Done marks the tiles that are finished
+	Done []bool
+}
+
+// tileRender keeps track of the state of a tiled render
+type tileRender struct {
+	film  *Film
+	tiles []tile
+	seed  int64
+	// settings is the hash of the render settings, a checkpoint with other settings can't be resumed
+	settings uint64
+
+	// workers hold the read lock while rendering a tile, writing a checkpoint takes the write lock.
+	// This way a checkpoint never contains half a tile.
+	mu   sync.RWMutex
+	done []bool
+}
+
+// newTileRender returns the state of a new tiled render
+func newTileRender(film *Film, tileSize int, seed int64) *tileRender {
+	ts := tiles(film.Width, film.Height, tileSize)
+	return &tileRender{
+		film:  film,
+		tiles: ts,
+		seed:  seed,
+		done:  make([]bool, len(ts)),
+	}
+}
+
+// rng returns the random number generator of the i-th tile
+func (tr *tileRender) rng(i int) *rand.Rand {
+	return rand.New(rand.NewSource(tr.seed + int64(i)))
+}
+
+// checkpoint returns the current state of the render, the caller must hold the write lock
+func (tr *tileRender) checkpoint(tileSize int) *checkpoint {
+	f := tr.film
+	cp := &checkpoint{
+		Width:    f.Width,
+		Height:   f.Height,
+		TileSize: tileSize,
+		Seed:     tr.seed,
+		Settings: tr.settings,
+		Sums:     make([]Color, len(f.pixels)),
+		Weights:  make([]float64, len(f.pixels)),
+		Stats:    make([]checkpointStats, len(f.stats)),
+		Splats:   append([]Color(nil), f.splats...),
+		Samples:  f.samples,
+		Done:     append([]bool(nil), tr.done...),
+	}
+
+	for i, p := range f.pixels {
+		cp.Sums[i] = p.sum
+		cp.Weights[i] = p.weight
+	}
+	for i, s := range f.stats {
+		cp.Stats[i] = checkpointStats{N: s.n, Mean: s.mean, M2: s.m2}
+	}
+	return cp
+}
+
+// restore loads the state of the render from a checkpoint
+func (tr *tileRender) restore(cp *checkpoint, tileSize int) error {
+	f := tr.film
+	if cp.Width != f.Width || cp.Height != f.Height {
+		return fmt.Errorf("checkpoint is for a %vx%v image, rendering %vx%v", cp.Width, cp.Height, f.Width, f.Height)
+	}
+	if cp.TileSize != tileSize || len(cp.Done) != len(tr.tiles) {
+		return fmt.Errorf("checkpoint uses a tile size of %v, rendering with %v", cp.TileSize, tileSize)
+	}
+	if len(cp.Sums) != len(f.pixels) || len(cp.Weights) != len(f.pixels) || len(cp.Stats) != len(f.stats) {
+		return fmt.Errorf("checkpoint is corrupt, pixel data does not match the image size")
+	}
+
+	if cp.Settings != tr.settings {
+		return fmt.Errorf("checkpoint was written with other render settings or another scene")
+	}
+
+	// checkpoints written before splats existed have none
+	if cp.Splats != nil && len(cp.Splats) != len(f.splats) {
+		return fmt.Errorf("checkpoint is corrupt, splat data does not match the image size")
+	}
+
+	tr.seed = cp.Seed
+	f.samples = cp.Samples
+	copy(f.splats, cp.Splats)
+	copy(tr.done, cp.Done)
+	for i := range f.pixels {
+		f.pixels[i] = filmPixel{sum: cp.Sums[i], weight: cp.Weights[i]}
+	}
+	for i, s := range cp.Stats {
+		f.stats[i] = sampleStats{n: s.N, mean: s.Mean, m2: s.M2}
+	}
+	return nil
+}
+
+// numDone returns the number of finished tiles
+func (cp *checkpoint) numDone() int {
+	n := 0
+	for _, d := range cp.Done {
+		if d {
+			n++
+		}
+	}
+	return n
+}
+
+// writeCheckpoint saves the checkpoint to a file
+// The checkpoint is written to a temporary file first, so a crash while writing never destroys the previous one.
+func writeCheckpoint(file string, cp *checkpoint) error {
+	tmp := file + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	if err := gob.NewEncoder(f).Encode(cp); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// readCheckpoint loads a checkpoint from a file
+func readCheckpoint(file string) (*checkpoint, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cp := &checkpoint{}
+	if err := gob.NewDecoder(f).Decode(cp); err != nil {
+		return nil, fmt.Errorf("error reading checkpoint %v: %v", file, err)
+	}
+	return cp, nil
+}
+
+// saveCheckpoint waits for all tiles in flight to finish and writes a checkpoint
+func (w *World) saveCheckpoint(tr *tileRender) {
+	tr.mu.Lock()
+	cp := tr.checkpoint(w.Config.TileSize)
+	tr.mu.Unlock()
+
+	if err := writeCheckpoint(w.Config.CheckpointFile, cp); err != nil {
+		log.Printf("error writing checkpoint: %v", err)
+		return
+	}
+	log.Printf("Wrote checkpoint to %v (%v/%v tiles done)", w.Config.CheckpointFile, cp.numDone(), len(cp.Done))
+}
+
+// renderTiles renders the given tiles that are not done yet
+func (w *World) renderTiles(tr *tileRender, canvas *Canvas, indexes []int) {
+	offsets := antialiasOffsets(w.Config.Antialias)
+
+	pending := make(chan int)
+	var wg sync.WaitGroup
+
+	for i := 0; i < w.Config.Parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// One intersections list per worker, making these per pixel is very expensive
+			xs := NewIntersections()
+
+			for i := range pending {
+				tr.mu.RLock()
+				t := tr.tiles[i]
+				rng := tr.rng(i)
+				for y := t.y0; y < t.y1; y++ {
+					for x := t.x0; x < t.x1; x++ {
+						if !w.region.traced(x, y) {
+							continue
+						}
+						p := &pixel{x: float64(x), y: float64(y)}
+						p.Render(w, tr.film, canvas, xs, offsets, rng)
+						xs = xs[:0]
+					}
+				}
+				tr.done[i] = true
+				tr.mu.RUnlock()
+			}
+		}()
+	}
+
+	// keep track of progress
+	total := float64(len(indexes))
+	done := 0.0
+	last := 0.0
+
+	for _, i := range indexes {
+		// tiles are only ever marked done by this render, no need to lock
+		if !tr.done[i] {
+			pending <- i
+		}
+		done++
+		last = showProgress(total, done, last)
+	}
+	close(pending)
+	wg.Wait()
+}
+
+// settingsHash returns a hash of everything that changes the samples of a render: the config, the camera and the scene
+// Resuming a checkpoint with other settings would mix the samples of two different images.
+func (w *World) settingsHash(camera *Camera) uint64 {
+	h := fnv.New64a()
+	c := w.Config
+
+	// only the exported fields of the integrator are settings, the rest is built by Preprocess
+	integrator, err := json.Marshal(c.Integrator)
+	if err != nil {
+		integrator = nil
+	}
+	fmt.Fprintf(h, "integrator: %T %s\n", c.Integrator, integrator)
+	if c.Filter != nil {
+		fmt.Fprintf(h, "filter: %T %+v\n", c.Filter, c.Filter)
+	}
+	fmt.Fprintf(h, "antialias: %v, spectral: %v, adaptive: %v %v %v %v\n", c.Antialias, c.Spectral, c.AdaptiveSampling,
+		c.AdaptiveThreshold, c.AdaptiveMinSamples, c.AdaptiveMaxSamples)
+	fmt.Fprintf(h, "crop: %+v, tiles: %v %v %v\n", c.CropWindow, c.TileSize, c.TileStart, c.TileEnd)
+	fmt.Fprintf(h, "lighting: %v %v %v %v %v %v %v %v %v\n", c.MaxRecusions, c.SoftShadows, c.SoftShadowRays,
+		c.AreaLightRays, c.GlossyRays, c.CausticPhotons, c.GlobalPhotons, c.PhotonGatherRadius, c.WorkingSpace)
+	fmt.Fprintf(h, "camera: %v %v %v %v\n", camera.Hsize, camera.Vsize, camera.fov, camera.Transform)
+
+	for _, o := range w.Objects {
+		fmt.Fprintf(h, "object: %T %q %v %v %v\n", o, o.Name(), o.NumShapes(), o.Transform(), o.Bounds())
+		if m := o.Material(); m != nil {
+			fmt.Fprintf(h, "material: %v %v %v %v %v %v %v %v %v %v %v %v\n", m.Color, m.Ambient, m.Diffuse, m.Specular,
+				m.Shininess, m.Reflective, m.Transparency, m.RefractiveIndex, m.Roughness, m.Anisotropy, m.Metallic,
+				m.Emissive)
+		}
+	}
+	for _, l := range w.Lights {
+		fmt.Fprintf(h, "light: %T %v %v\n", l, l.Position(), l.Intensity())
+	}
+	return h.Sum64()
+}
+
+// doTiledRender renders the image tile by tile, periodically writing a checkpoint that the render can be resumed from
+func (w *World) doTiledRender(camera *Camera, canvas *Canvas, film *Film) error {
+	tr := newTileRender(film, w.Config.TileSize, w.renderSeed())
+	tr.settings = w.settingsHash(camera)
+
+	if w.Config.ResumeFile != "" {
+		cp, err := readCheckpoint(w.Config.ResumeFile)
+		if err != nil {
+			return err
+		}
+		if err := tr.restore(cp, w.Config.TileSize); err != nil {
+			return fmt.Errorf("unable to resume from %v: %v", w.Config.ResumeFile, err)
+		}
+		log.Printf("Resuming render from %v (%v/%v tiles done)", w.Config.ResumeFile, cp.numDone(), len(cp.Done))
+		// show what is already done
+		film.ResolveAll(canvas)
+	}
+
+	stop := make(chan bool)
+	finished := make(chan bool)
+	if w.Config.CheckpointFile != "" && w.Config.CheckpointInterval > 0 {
+		go func() {
+			defer close(finished)
+			ticker := time.NewTicker(w.Config.CheckpointInterval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ticker.C:
+					w.saveCheckpoint(tr)
+				case <-stop:
+					return
+				}
+			}
+		}()
+	} else {
+		close(finished)
+	}
+
+	w.renderTiles(tr, canvas, w.region.tileIndexes(tr.tiles))
+
+	close(stop)
+	<-finished
+
+	// the final checkpoint has all tiles done, resuming from it just writes out the image
+	if w.Config.CheckpointFile != "" {
+		w.saveCheckpoint(tr)
+	}
+	return nil
+}
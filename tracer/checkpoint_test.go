@@ -0,0 +1,191 @@
+package tracer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTiles(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		size          int
+		want          []tile
+	}{
+		{
+			name:   "exact",
+			width:  4,
+			height: 2,
+			size:   2,
+			want:   []tile{{0, 0, 2, 2}, {2, 0, 4, 2}},
+		},
+		{
+			name:   "partial",
+			width:  3,
+			height: 3,
+			size:   2,
+			want:   []tile{{0, 0, 2, 2}, {2, 0, 3, 2}, {0, 2, 2, 3}, {2, 2, 3, 3}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tiles(tt.width, tt.height, tt.size), "should equal")
+		})
+	}
+}
+
+func TestCheckpoint_ReadWrite(t *testing.T) {
+	film := NewFilm(3, 2, NewBoxFilter(0.5))
+	film.AddPixelSample(1, 1, 1.5, 1.5, NewColor(0.1, 0.2, 0.3))
+	film.AddPixelSample(1, 1, 1.25, 1.75, NewColor(0.3, 0.2, 0.1))
+
+	tr := newTileRender(film, 2, 1234)
+	tr.done[1] = true
+
+	file := filepath.Join(t.TempDir(), "checkpoint")
+	assert.NoError(t, writeCheckpoint(file, tr.checkpoint(2)))
+
+	cp, err := readCheckpoint(file)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cp.numDone(), "should equal")
+
+	restored := newTileRender(NewFilm(3, 2, NewBoxFilter(0.5)), 2, 0)
+	assert.NoError(t, restored.restore(cp, 2))
+	assert.Equal(t, int64(1234), restored.seed, "should equal")
+	assert.Equal(t, tr.done, restored.done, "should equal")
+	assert.Equal(t, film.pixels, restored.film.pixels, "should equal")
+	assert.Equal(t, film.stats, restored.film.stats, "should equal")
+
+	// wrong image or tile size
+	assert.Error(t, newTileRender(NewFilm(4, 2, NewBoxFilter(0.5)), 2, 0).restore(cp, 2))
+	assert.Error(t, newTileRender(NewFilm(3, 2, NewBoxFilter(0.5)), 1, 0).restore(cp, 1))
+
+	_, err = readCheckpoint(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
+
+func TestWorld_RenderResume(t *testing.T) {
+	dir := t.TempDir()
+
+	newWorld := func() (*World, *Camera) {
+		w, camera := smallTestWorld()
+		// adaptive sampling uses random sub-pixel positions, so the RNG state matters
+		w.Config.AdaptiveSampling = true
+		w.Config.AdaptiveMaxSamples = 16
+		w.Config.TileSize = 4
+		w.Config.Seed = 42
+		return w, camera
+	}
+
+	// uninterrupted render
+	w, camera := newWorld()
+	w.Config.CheckpointFile = filepath.Join(dir, "full")
+	want := NewCanvas(11, 11)
+	w.Render(camera, want)
+
+	// render only some of the tiles, as if the render was killed
+	partial, camera := newWorld()
+	film := NewFilm(11, 11, partial.Config.Filter)
+	tr := newTileRender(film, partial.Config.TileSize, partial.Config.Seed)
+	tr.settings = partial.settingsHash(camera)
+	partial.region = partial.renderRegion(camera)
+	partial.renderTiles(tr, NewCanvas(11, 11), []int{0, 2, 3, 5})
+
+	file := filepath.Join(dir, "partial")
+	assert.NoError(t, writeCheckpoint(file, tr.checkpoint(partial.Config.TileSize)))
+
+	// resume, with a different seed in the config, the one in the checkpoint must win
+	resumed, camera := newWorld()
+	resumed.Config.Seed = 7
+	resumed.Config.ResumeFile = file
+	got := NewCanvas(11, 11)
+	assert.NoError(t, resumed.Render(camera, got))
+
+	for y := 0; y < 11; y++ {
+		for x := 0; x < 11; x++ {
+			assert.Equal(t, w.Film().SampleCount(x, y), resumed.Film().SampleCount(x, y), "should equal")
+			wantClr, err := want.Get(x, y)
+			assert.NoError(t, err)
+			gotClr, err := got.Get(x, y)
+			assert.NoError(t, err)
+			assert.Equal(t, wantClr, gotClr, "pixel (%v, %v) should equal", x, y)
+		}
+	}
+
+	// the final checkpoint has all the tiles done
+	cp, err := readCheckpoint(w.Config.CheckpointFile)
+	assert.NoError(t, err)
+	assert.Equal(t, len(cp.Done), cp.numDone(), "should equal")
+
+	_, err = os.Stat(w.Config.CheckpointFile + ".tmp")
+	assert.True(t, os.IsNotExist(err), "temporary file should be gone")
+}
+
+func TestWorld_RenderResumeSettings(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(w *World)
+	}{
+		{
+			name:   "antialias",
+			change: func(w *World) { w.Config.Antialias = 2 },
+		},
+		{
+			name:   "filter",
+			change: func(w *World) { w.Config.Filter = NewGaussianFilter(2, 2) },
+		},
+		{
+			name:   "integrator",
+			change: func(w *World) { w.Config.Integrator = NewPathTracerIntegrator(4) },
+		},
+		{
+			name:   "crop window",
+			change: func(w *World) { w.Config.CropWindow = NewCropWindow(0, 0, 5, 5) },
+		},
+		{
+			name:   "tile range",
+			change: func(w *World) { w.Config.TileStart, w.Config.TileEnd = 0, 4 },
+		},
+		{
+			name:   "spectral",
+			change: func(w *World) { w.Config.Spectral = true },
+		},
+		{
+			name:   "scene",
+			change: func(w *World) { w.Objects[0].SetTransform(IM().Translate(0, 1, 0)) },
+		},
+		{
+			name:   "lights",
+			change: func(w *World) { w.Lights[0].SetIntensity(White().Scale(2)) },
+		},
+	}
+
+	file := filepath.Join(t.TempDir(), "checkpoint")
+	w, camera := smallTestWorld()
+	w.Config.TileSize = 4
+	w.Config.CheckpointFile = file
+	assert.NoError(t, w.Render(camera, NewCanvas(11, 11)))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, camera := smallTestWorld()
+			w.Config.TileSize = 4
+			w.Config.ResumeFile = file
+			tt.change(w)
+			assert.Error(t, w.Render(camera, NewCanvas(11, 11)), "should not resume with other settings")
+		})
+	}
+
+	// the same settings resume fine
+	w, camera = smallTestWorld()
+	w.Config.TileSize = 4
+	w.Config.ResumeFile = file
+	assert.NoError(t, w.Render(camera, NewCanvas(11, 11)))
+
+	w.Config.ResumeFile = filepath.Join(t.TempDir(), "missing")
+	assert.Error(t, w.Render(camera, NewCanvas(11, 11)), "should report a missing checkpoint")
+}
@@ -103,12 +103,17 @@ func (c Color) Equal(c2 Color) bool {
 	return false
 }
 
+// Luminance returns the relative luminance of this (linear) color
+func (c Color) Luminance() float64 {
+	return 0.2126*c.R + 0.7152*c.G + 0.0722*c.B
+}
+
 // GreyScale returns the GreyScale value of this color
 // from https://stackoverflow.com/questions/17615963/standard-rgb-to-grayscale-conversion
 func (c Color) GreyScale() float64 {
 	var csrgb float64
 
-	clin := 0.2126*c.R + 0.7152*c.G + 0.0722*c.B
+	clin := c.Luminance()
 	switch {
 	case clin <= 0.0031308:
 		csrgb = 12.92 * clin
@@ -0,0 +1,149 @@
+package tracer
+
+import (
+	"math"
+)
+
+// ColorEncoding is how the values stored in an image relate to the colors used for rendering
+type ColorEncoding int
+
+const (
+	// ColorEncodingSRGB values are sRGB colors, the sRGB curve is removed and the colors converted to the working space
+	// Used for color textures and the rendered image.
+	ColorEncodingSRGB ColorEncoding = iota
+	// ColorEncodingLinear values are used as they are, for data (bump, roughness and normal maps) and images that are
+	// already linear in the working space
+	ColorEncodingLinear
+)
+
+// String returns the name of the encoding
+func (e ColorEncoding) String() string {
+	if e == ColorEncodingLinear {
+		return "linear"
+	}
+	return "sRGB"
+}
+
+// WorkingSpace is the RGB color space lighting is computed in
+// Colors of materials and lights are in the working space, sRGB textures are converted to it when sampled and the
+// rendered image is converted from it when written out. Wider spaces keep saturated colors that are out of the sRGB
+// gamut through the multiple bounces of light, so they mix more like real light does.
+type WorkingSpace int
+
+const (
+	// WorkingSpaceSRGB is linear sRGB (the Rec.709 primaries)
+	WorkingSpaceSRGB WorkingSpace = iota
+	// WorkingSpaceACEScg is the ACEScg space (the ACES AP1 primaries, D60 white point)
+	WorkingSpaceACEScg
+	// WorkingSpaceRec2020 is the linear Rec.2020 space (the UHDTV primaries)
+	WorkingSpaceRec2020
+)
+
+// workingSpaceMatrices convert linear sRGB to each working space (from) and back (to), rows are the output channels
+// The ACEScg matrices include a Bradford adaptation from the D65 white point of sRGB to D60.
+var workingSpaceMatrices = map[WorkingSpace]struct{ from, to [3][3]float64 }{
+	WorkingSpaceACEScg: {
+		from: [3][3]float64{
+			{0.6130973, 0.3395229, 0.0473793},
+			{0.0701942, 0.9163556, 0.0134526},
+			{0.0206156, 0.1095698, 0.8698151},
+		},
+		to: [3][3]float64{
+			{1.7050516, -0.6217908, -0.0832584},
+			{-0.1302571, 1.1408028, -0.0105485},
+			{-0.0240033, -0.1289687, 1.1529717},
+		},
+	},
+	WorkingSpaceRec2020: {
+		from: [3][3]float64{
+			{0.6274040, 0.3292820, 0.0433136},
+			{0.0690970, 0.9195400, 0.0113612},
+			{0.0163916, 0.0880132, 0.8955950},
+		},
+		to: [3][3]float64{
+			{1.6604903, -0.5876391, -0.0728516},
+			{-0.1245500, 1.1328999, -0.0083480},
+			{-0.0181511, -0.1005787, 1.1187299},
+		},
+	},
+}
+
+// workingSpaceOf returns the working space of the world the object is in, linear sRGB outside of worlds
+func workingSpaceOf(o Shaper) WorkingSpace {
+	if o == nil || o.WorldConfig() == nil {
+		return WorkingSpaceSRGB
+	}
+	return o.WorldConfig().WorkingSpace
+}
+
+// String returns the name of the working space
+func (ws WorkingSpace) String() string {
+	switch ws {
+	case WorkingSpaceACEScg:
+		return "ACEScg"
+	case WorkingSpaceRec2020:
+		return "Rec.2020"
+	}
+	return "linear sRGB"
+}
+
+// FromSRGB returns the linear sRGB color c in the working space
+func (ws WorkingSpace) FromSRGB(c Color) Color {
+	m, ok := workingSpaceMatrices[ws]
+	if !ok {
+		return c
+	}
+	return c.transform(m.from)
+}
+
+// ToSRGB returns the color c of the working space in linear sRGB, colors outside the sRGB gamut have negative values
+func (ws WorkingSpace) ToSRGB(c Color) Color {
+	m, ok := workingSpaceMatrices[ws]
+	if !ok {
+		return c
+	}
+	return c.transform(m.to)
+}
+
+// transform returns the color multiplied by the matrix m
+func (c Color) transform(m [3][3]float64) Color {
+	return NewColor(
+		m[0][0]*c.R+m[0][1]*c.G+m[0][2]*c.B,
+		m[1][0]*c.R+m[1][1]*c.G+m[1][2]*c.B,
+		m[2][0]*c.R+m[2][1]*c.G+m[2][2]*c.B,
+	)
+}
+
+// SRGBToLinear returns the linear value of the sRGB encoded value v
+func SRGBToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// LinearToSRGB returns the sRGB encoding of the linear value v
+func LinearToSRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// srgbTable is SRGBToLinear of each 8 bit value
+var srgbTable = func() (t [256]float64) {
+	for i := range t {
+		t[i] = SRGBToLinear(float64(i) / 255)
+	}
+	return t
+}()
+
+// SRGBToLinear returns the linear color of the sRGB encoded color
+func (c Color) SRGBToLinear() Color {
+	return NewColor(SRGBToLinear(c.R), SRGBToLinear(c.G), SRGBToLinear(c.B))
+}
+
+// LinearToSRGB returns the sRGB encoding of the linear color
+func (c Color) LinearToSRGB() Color {
+	return NewColor(LinearToSRGB(c.R), LinearToSRGB(c.G), LinearToSRGB(c.B))
+}
@@ -0,0 +1,161 @@
+package tracer
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSRGBToLinear(t *testing.T) {
+	tests := []struct {
+		encoded, linear float64
+	}{
+		{encoded: 0, linear: 0},
+		{encoded: 0.04045, linear: 0.0031308},
+		{encoded: 0.5, linear: 0.2140411},
+		{encoded: 0.7353570, linear: 0.5},
+		{encoded: 1, linear: 1},
+	}
+
+	for _, tt := range tests {
+		assert.InDelta(t, tt.linear, SRGBToLinear(tt.encoded), 1e-6, "should equal")
+		assert.InDelta(t, tt.encoded, LinearToSRGB(tt.linear), 1e-6, "should equal")
+	}
+
+	for i, v := range srgbTable {
+		assert.Equal(t, SRGBToLinear(float64(i)/255), v, "should equal")
+	}
+}
+
+func TestWorkingSpace(t *testing.T) {
+	tests := []struct {
+		ws WorkingSpace
+		// red is linear sRGB red in the working space
+		red Color
+	}{
+		{ws: WorkingSpaceSRGB, red: NewColor(1, 0, 0)},
+		{ws: WorkingSpaceACEScg, red: NewColor(0.6130973, 0.0701942, 0.0206156)},
+		{ws: WorkingSpaceRec2020, red: NewColor(0.6274040, 0.0690970, 0.0163916)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ws.String(), func(t *testing.T) {
+			assert.True(t, tt.ws.FromSRGB(NewColor(1, 0, 0)).Equal(tt.red), "should equal")
+			assert.True(t, tt.ws.FromSRGB(White()).Equal(White()), "white stays white")
+
+			c := NewColor(0.2, 0.5, 0.9)
+			assert.True(t, tt.ws.ToSRGB(tt.ws.FromSRGB(c)).Equal(c), "round trip")
+		})
+	}
+}
+
+func TestCanvas_ExportToPNGEncoding(t *testing.T) {
+	tests := []struct {
+		name     string
+		ws       WorkingSpace
+		encoding ColorEncoding
+		clr      Color
+		want     color.RGBA
+	}{
+		{
+			name: "sRGB",
+			clr:  NewColor(0.5, 0, 2),
+			want: color.RGBA{R: 188, G: 0, B: 255, A: 255},
+		},
+		{
+			name:     "linear",
+			encoding: ColorEncodingLinear,
+			clr:      NewColor(0.5, 0, 2),
+			want:     color.RGBA{R: 128, G: 0, B: 255, A: 255},
+		},
+		{
+			name: "ACEScg",
+			ws:   WorkingSpaceACEScg,
+			clr:  WorkingSpaceACEScg.FromSRGB(NewColor(0.5, 0, 0)),
+			want: color.RGBA{R: 188, G: 0, B: 0, A: 255},
+		},
+		{
+			name: "ACEScg out of gamut",
+			ws:   WorkingSpaceACEScg,
+			clr:  NewColor(0, 1, 0),
+			want: color.RGBA{R: 0, G: 255, B: 0, A: 255},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			canvas := NewCanvas(1, 1)
+			canvas.Encoding = tt.encoding
+			canvas.WorkingSpace = tt.ws
+			canvas.Set(0, 0, tt.clr)
+
+			var buf bytes.Buffer
+			assert.NoError(t, canvas.ExportToPNG(&buf))
+			img, err := png.Decode(&buf)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, color.RGBAModel.Convert(img.At(0, 0)), "should equal")
+
+			// the screen shows the same colors
+			assert.InDelta(t, float64(tt.want.R)/255, canvas.Colors()[0], 0.5/255, "should equal")
+		})
+	}
+}
+
+func TestTextureSampler_ColorEncoding(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, color.RGBA{R: 255, A: 255})
+	img.Set(1, 0, color.RGBA{A: 255})
+
+	tests := []struct {
+		name string
+		ws   WorkingSpace
+		enc  ColorEncoding
+		want Color
+	}{
+		{
+			name: "sRGB is filtered in linear space",
+			enc:  ColorEncodingSRGB,
+			want: NewColor(0.5, 0, 0),
+		},
+		{
+			name: "sRGB in ACEScg",
+			ws:   WorkingSpaceACEScg,
+			enc:  ColorEncodingSRGB,
+			want: WorkingSpaceACEScg.FromSRGB(NewColor(0.5, 0, 0)),
+		},
+		{
+			name: "data is not converted",
+			ws:   WorkingSpaceACEScg,
+			enc:  ColorEncodingLinear,
+			want: NewColor(0.5, 0, 0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := NewTextureSampler(NewImageTexture(img, tt.enc))
+
+			// half way between the two texels
+			assert.True(t, tt.want.Equal(ts.sampleIn(tt.ws, 0.5, 0.5)), "should equal")
+			// the mipmap averages linear values too, its 1x1 level is stored in 8 bits
+			got := ts.sampleAt(texCoords{u: 0.5, v: 0.5, dudx: 1, dvdy: 2, space: tt.ws})
+
+			// the same sampler in the material of a shape in a world of the working space
+			s := NewUnitSphere()
+			s.Material().Texture = ts
+			config := NewWorldConfig()
+			config.WorkingSpace = tt.ws
+			s.SetWorldConfig(config)
+			state := &IntersectionState{Object: s, U: 0.5, V: 0.5}
+			assert.True(t, tt.want.Equal(s.Material().surfaceColor(s, NewPoint(0, 0, -1), state.texCoords())),
+				"should equal")
+			assert.InDelta(t, tt.want.R, got.R, 0.005, "should equal")
+			assert.InDelta(t, tt.want.G, got.G, 0.005, "should equal")
+			assert.InDelta(t, tt.want.B, got.B, 0.005, "should equal")
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package tracer
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Conductor is the complex index of refraction (Eta + iK) of a metal, per RGB channel
+// Conductors reflect with the exact Fresnel equations, which gives metals their tint and grazing angle behaviour.
+type Conductor struct {
+	Eta, K Color
+}
+
+// NewConductor returns a new conductor with the given complex index of refraction
+func NewConductor(eta, k Color) *Conductor {
+	return &Conductor{Eta: eta, K: k}
+}
+
+// conductors are the built in metals, sampled at roughly 650nm (red), 550nm (green) and 450nm (blue)
+var conductors = map[string]*Conductor{
+	"gold":      NewConductor(NewColor(0.143, 0.374, 1.442), NewColor(3.983, 2.385, 1.603)),
+	"copper":    NewConductor(NewColor(0.200, 0.924, 1.102), NewColor(3.912, 2.452, 2.142)),
+	"silver":    NewConductor(NewColor(0.155, 0.117, 0.138), NewColor(4.828, 3.122, 2.147)),
+	"aluminium": NewConductor(NewColor(1.657, 0.880, 0.521), NewColor(9.224, 6.270, 4.837)),
+	"chrome":    NewConductor(NewColor(3.170, 2.930, 2.300), NewColor(3.340, 3.330, 3.100)),
+}
+
+// ConductorByName returns the built in conductor with the given name (gold, copper, silver, aluminium or chrome)
+func ConductorByName(name string) (*Conductor, error) {
+	name = strings.ToLower(name)
+	if name == "aluminum" {
+		name = "aluminium"
+	}
+
+	c, ok := conductors[name]
+	if !ok {
+		var names []string
+		for n := range conductors {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown conductor %q, known conductors: %v", name, strings.Join(names, ", "))
+	}
+	return NewConductor(c.Eta, c.K), nil
+}
+
+// Fresnel returns the reflectance of the conductor for light arriving at an angle with the given cosine to the normal
+func (c *Conductor) Fresnel(cos float64) Color {
+	cos = math.Max(0, math.Min(1, cos))
+	return NewColor(
+		fresnelConductor(cos, c.Eta.R, c.K.R),
+		fresnelConductor(cos, c.Eta.G, c.K.G),
+		fresnelConductor(cos, c.Eta.B, c.K.B),
+	)
+}
+
+// fresnelConductor returns the unpolarized reflectance of a conductor with index of refraction eta + ik, coming from
+// air (see pbrt, FrConductor)
+func fresnelConductor(cos, eta, k float64) float64 {
+	cos2 := cos * cos
+	sin2 := 1 - cos2
+	eta2, k2 := eta*eta, k*k
+
+	t0 := eta2 - k2 - sin2
+	a2plusb2 := math.Sqrt(t0*t0 + 4*eta2*k2)
+	t1 := a2plusb2 + cos2
+	a := math.Sqrt(0.5 * (a2plusb2 + t0))
+	t2 := 2 * cos * a
+	rs := (t1 - t2) / (t1 + t2)
+
+	t3 := cos2*a2plusb2 + sin2*sin2
+	t4 := t2 * sin2
+	rp := rs * (t3 - t4) / (t3 + t4)
+
+	return (rs + rp) / 2
+}
+
+// NewConductorMaterial returns a new metal reflecting with the exact Fresnel equations of the conductor
+func NewConductorMaterial(c *Conductor) *Material {
+	m := NewDefaultMaterial()
+	m.Metallic = 1
+	m.Conductor = c
+	return m
+}
+
+// metalFresnel returns the reflectance of the metallic part of the material, clr is the surface color and cos the
+// cosine of the angle between the eye and the (micro) normal
+// Conductors use the exact Fresnel equations, otherwise the color is the reflectance at normal incidence (Schlick).
+func (m *Material) metalFresnel(clr Color, cos float64) Color {
+	if m.Conductor != nil {
+		return m.Conductor.Fresnel(cos)
+	}
+	return schlickColor(clr, cos)
+}
@@ -0,0 +1,105 @@
+package tracer
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConductor_Fresnel(t *testing.T) {
+	gold, err := ConductorByName("gold")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name string
+		c    *Conductor
+		cos  float64
+		want Color
+	}{
+		{
+			name: "normal incidence",
+			c:    NewConductor(NewColor(0.2, 1, 2), NewColor(4, 2, 0)),
+			cos:  1,
+			// ((n-1)^2 + k^2) / ((n+1)^2 + k^2)
+			want: NewColor((0.64+16)/(1.44+16), 4.0/8, 1.0/9),
+		},
+		{
+			name: "grazing",
+			c:    gold,
+			cos:  0,
+			want: White(),
+		},
+		{
+			name: "dielectric",
+			c:    NewConductor(NewColor(1.5, 1.5, 1.5), Black()),
+			cos:  math.Cos(math.Pi / 4),
+			// exact dielectric Fresnel at 45 degrees for an index of refraction of 1.5
+			want: White().Scale(0.0502399),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.c.Fresnel(tt.cos)
+			assert.InDelta(t, tt.want.R, got.R, 1e-5, "should equal")
+			assert.InDelta(t, tt.want.G, got.G, 1e-5, "should equal")
+			assert.InDelta(t, tt.want.B, got.B, 1e-5, "should equal")
+		})
+	}
+}
+
+func TestConductorByName(t *testing.T) {
+	tests := []struct {
+		name  string
+		check func(t *testing.T, f0 Color)
+	}{
+		{
+			name:  "gold",
+			check: func(t *testing.T, f0 Color) { assert.True(t, f0.R > f0.G && f0.G > f0.B, "gold should be yellow") },
+		},
+		{
+			name:  "copper",
+			check: func(t *testing.T, f0 Color) { assert.True(t, f0.R > f0.G && f0.R > f0.B, "copper should be red") },
+		},
+		{
+			name:  "silver",
+			check: func(t *testing.T, f0 Color) { assert.True(t, f0.B > 0.9, "silver should be bright") },
+		},
+		{
+			name:  "Aluminum",
+			check: func(t *testing.T, f0 Color) { assert.True(t, f0.G > 0.9, "aluminium should be bright") },
+		},
+		{
+			name: "chrome",
+			check: func(t *testing.T, f0 Color) {
+				assert.InDelta(t, 0.55, f0.R, 0.02, "chrome should be grey")
+				assert.InDelta(t, 0.55, f0.B, 0.02, "chrome should be grey")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ConductorByName(tt.name)
+			assert.NoError(t, err)
+			tt.check(t, c.Fresnel(1))
+		})
+	}
+
+	_, err := ConductorByName("unobtainium")
+	assert.Error(t, err, "should fail")
+}
+
+func TestMaterial_ReflectionTintConductor(t *testing.T) {
+	gold, err := ConductorByName("gold")
+	assert.NoError(t, err)
+	m := NewConductorMaterial(gold)
+
+	assert.Equal(t, 1.0, m.reflectivity(), "metals reflect all light")
+	assert.True(t, m.reflectionTint(White(), 1).Equal(gold.Fresnel(1)), "should use the conductor Fresnel")
+	assert.True(t, m.reflectionTint(White(), 0.1).B > m.reflectionTint(White(), 1).B, "reflections turn white at grazing angles")
+
+	// the surface color doesn't tint conductors
+	assert.Equal(t, m.reflectionTint(White(), 0.5), m.reflectionTint(NewColor(0, 0, 1), 0.5), "should equal")
+}
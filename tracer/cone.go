@@ -148,6 +148,20 @@ func (c *Cone) IntersectWith(r Ray, t Intersections) Intersections {
 	return t
 }
 
+// UVAt returns the surface coordinates of the point p (world space), using a cylindrical map, the caps are mapped
+// to the [0, 1] square around them
+func (c *Cone) UVAt(p Point, xs *Intersection) (float64, float64) {
+	op := p.ToObjectSpace(c)
+	dist := op.X()*op.X() + op.Z()*op.Z()
+
+	// the radius of the cone is |y|
+	if r := math.Abs(op.Y()); r > 0 && dist < r*r &&
+		(op.Y() >= c.Maximum-constants.Epsilon || op.Y() <= c.Minimum+constants.Epsilon) {
+		return (op.X()/r + 1) / 2, (op.Z()/r + 1) / 2
+	}
+	return NewCylinderMap().Map(op)
+}
+
 func (c *Cone) localNormalAt(p Point, xs *Intersection) Vector {
 	// object normal, this is different for each shape
 	var on Vector
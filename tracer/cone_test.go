@@ -268,3 +268,33 @@ func TestCone_Bounds(t *testing.T) {
 		})
 	}
 }
+
+func TestCone_UVAt(t *testing.T) {
+	tests := []struct {
+		name  string
+		p     Point
+		wantU float64
+		wantV float64
+	}{
+		{
+			name:  "body",
+			p:     NewPoint(0, -0.5, -0.5),
+			wantU: 0,
+			wantV: 0.5,
+		},
+		{
+			name:  "cap",
+			p:     NewPoint(0.5, -1, 0),
+			wantU: 0.75,
+			wantV: 0.5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, v := NewClosedCone(-1, 0).UVAt(tt.p, nil)
+			assert.InDelta(t, tt.wantU, u, constants.Epsilon, "should equal")
+			assert.InDelta(t, tt.wantV, v, constants.Epsilon, "should equal")
+		})
+	}
+}
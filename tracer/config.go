@@ -1,6 +1,10 @@
 package tracer
 
-import "runtime"
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
 
 // WorldConfig collects various settings to configure the world
 type WorldConfig struct {
@@ -10,6 +14,91 @@ type WorldConfig struct {
 	// Antialiasing support
 	Antialias int
 
+	// Integrator computes the color of each camera ray
+	Integrator Integrator
+
+	// Filter is the reconstruction filter used to combine samples into pixels
+	Filter Filter
+
+	// AdaptiveSampling keeps adding samples to a pixel until its noise estimate drops below AdaptiveThreshold
+	// The Antialias samples are always taken first
+	AdaptiveSampling bool
+
+	// AdaptiveThreshold is the relative error (standard error / mean luminance) at which a pixel is done
+	AdaptiveThreshold float64
+
+	// AdaptiveMinSamples and AdaptiveMaxSamples bound the number of samples taken in each pixel
+	AdaptiveMinSamples, AdaptiveMaxSamples int
+
+	// Progressive renders the image in passes of one sample per pixel, accumulating a running average,
+	// until one of the budgets below is reached. At least one budget must be set, Render fails otherwise.
+	// The first passes sample the same positions as Antialias, so capping ProgressiveMaxSamples at the
+	// number of antialias samples gives the same image as a normal render.
+	Progressive bool
+
+	// ProgressiveTimeBudget stops a progressive render after this much time (checked after each pass)
+	ProgressiveTimeBudget time.Duration
+
+	// ProgressiveMaxSamples stops a progressive render after this many samples per pixel
+	ProgressiveMaxSamples int
+
+	// ProgressiveNoiseThreshold stops a progressive render once the relative error of the noisiest pixel is below it
+	ProgressiveNoiseThreshold float64
+
+	// SnapshotFile, if set, is where a progressive render periodically writes the current image to
+	SnapshotFile string
+
+	// SnapshotInterval controls how often a progressive render writes the image to SnapshotFile
+	SnapshotInterval time.Duration
+
+	// TileSize is the size (in pixels) of the square tiles checkpointed and tile range renders are split into
+	TileSize int
+
+	// CropWindow, if set, only renders the pixels inside the window, the camera still sees the full frame
+	CropWindow *CropWindow
+
+	// TileStart and TileEnd, if TileEnd is set, only render tiles [TileStart, TileEnd) of the frame
+	// Used to split a frame across several machines, the outputs are stitched together with MergeCanvases.
+	TileStart, TileEnd int
+
+	// Seed seeds the random number generators of renders, 0 picks a random seed
+	// Renders with the same seed and Parallelism produce the same image. The seed is saved in checkpoints, so a resumed
+	// render produces the same image too. Photon maps are built before the checkpoint is read, set a seed to resume
+	// photon mapped renders exactly.
+	Seed int64
+
+	// CheckpointFile, if set, renders the image in tiles and writes the progress to this file
+	// every CheckpointInterval and at the end of the render
+	CheckpointFile string
+
+	// CheckpointInterval controls how often the checkpoint is written
+	CheckpointInterval time.Duration
+
+	// ResumeFile, if set, continues the render saved in this checkpoint file
+	// Render fails if the checkpoint was written with other settings, another camera or another scene.
+	ResumeFile string
+
+	// CausticPhotons is the number of photons emitted from the lights for the caustic map, 0 disables photon mapping
+	// Only used by the Whitted integrator. The maps are built once per render: progressive passes reuse them, so their
+	// noise doesn't average out with more passes, only more photons (or a larger PhotonGatherRadius) smooth it.
+	CausticPhotons int
+
+	// GlobalPhotons is the number of photons emitted for the global (indirect light) map, 0 disables it
+	GlobalPhotons int
+
+	// PhotonGatherRadius is the radius around a hit photons are gathered from
+	// Larger values blur caustics, smaller ones need more photons to avoid noise.
+	PhotonGatherRadius float64
+
+	// Spectral traces every camera ray at a randomly sampled wavelength, so materials with a Dispersion split light
+	// into its colors. Needs many samples per pixel (Antialias or Progressive) to converge, only used by the Whitted and
+	// path tracer integrators.
+	Spectral bool
+
+	// GlossyRays is the number of rays the Whitted integrator samples glossy reflections and refractions with
+	// (materials with Roughness), only for the first bounce.
+	GlossyRays int
+
 	// Parallelism, how many pixels to render at the same time
 	Parallelism int
 
@@ -27,18 +116,43 @@ type WorldConfig struct {
 
 	// BackfaceCulling disables drawing riangles facing away from the camera
 	BackfaceCulling bool
+
+	// WorkingSpace is the color space lighting is computed in, the colors of materials and lights are in this space
+	// Use WorkingSpace.FromSRGB to convert sRGB colors. Textures and the output image are converted automatically.
+	WorkingSpace WorkingSpace
 }
 
 // NewWorldConfig returns a new world config with default settings
 func NewWorldConfig() *WorldConfig {
 	return &WorldConfig{
-		Antialias:       0,
-		AreaLightRays:   10,
-		MaxRecusions:    4,
-		Parallelism:     runtime.NumCPU(),
-		SoftShadows:     true,
-		SoftShadowRays:  6,
-		RenderPasses:    8,
-		BackfaceCulling: false, // off by default, as transpaencies require it
+		Antialias:          0,
+		Integrator:         NewWhittedIntegrator(),
+		Filter:             NewBoxFilter(0.5),
+		AdaptiveSampling:   false,
+		AdaptiveThreshold:  0.01,
+		AdaptiveMinSamples: 4,
+		AdaptiveMaxSamples: 64,
+		Progressive:        false,
+		SnapshotInterval:   time.Minute,
+		TileSize:           16,
+		CheckpointInterval: 5 * time.Minute,
+		PhotonGatherRadius: 0.1,
+		GlossyRays:         8,
+		AreaLightRays:      10,
+		MaxRecusions:       4,
+		Parallelism:        runtime.NumCPU(),
+		SoftShadows:        true,
+		SoftShadowRays:     6,
+		RenderPasses:       8,
+		BackfaceCulling:    false, // off by default, as transpaencies require it
+		WorkingSpace:       WorkingSpaceSRGB,
+	}
+}
+
+// validate returns an error if the config can't be rendered
+func (wc *WorldConfig) validate() error {
+	if wc.Progressive && wc.ProgressiveTimeBudget <= 0 && wc.ProgressiveMaxSamples <= 0 && wc.ProgressiveNoiseThreshold <= 0 {
+		return fmt.Errorf("progressive render has no time, sample or noise budget, it would never finish")
 	}
+	return nil
 }
@@ -112,6 +112,11 @@ func (csg *CSG) NormalAt(p Point, xs *Intersection) Vector {
 	panic("called NormalAt on CSG shape")
 }
 
+// UVAt is unused here, rays hit the members of the CSG shape
+func (csg *CSG) UVAt(p Point, xs *Intersection) (float64, float64) {
+	panic("called UVAt on CSG shape")
+}
+
 // PrecomputeValues precomputes some values for render speedup
 func (csg *CSG) PrecomputeValues() {
 	csg.left.PrecomputeValues()
@@ -83,6 +83,11 @@ func (c *Cube) IntersectWith(r Ray, t Intersections) Intersections {
 	return t
 }
 
+// UVAt returns the surface coordinates of the point p (world space), each face is mapped to the whole [0, 1] square
+func (c *Cube) UVAt(p Point, xs *Intersection) (float64, float64) {
+	return (&CubeMap{}).Map(p.ToObjectSpace(c))
+}
+
 func (c *Cube) localNormalAt(p Point, xs *Intersection) Vector {
 	var on Vector
 	maxc := math.Max(math.Max(math.Abs(p.X()), math.Abs(p.Y())), math.Abs(p.Z()))
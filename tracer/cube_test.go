@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/DanTulovsky/tracer/constants"
 	"github.com/google/go-cmp/cmp"
 	"github.com/stretchr/testify/assert"
 )
@@ -262,3 +263,33 @@ func TestCube_NormalAt(t *testing.T) {
 		})
 	}
 }
+
+func TestCube_UVAt(t *testing.T) {
+	tests := []struct {
+		name  string
+		p     Point
+		wantU float64
+		wantV float64
+	}{
+		{
+			name:  "front",
+			p:     NewPoint(0.5, 0.5, 1),
+			wantU: 0.75,
+			wantV: 0.25,
+		},
+		{
+			name:  "up",
+			p:     NewPoint(0.5, 1, -0.5),
+			wantU: 0.75,
+			wantV: 0.25,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, v := NewUnitCube().UVAt(tt.p, nil)
+			assert.InDelta(t, tt.wantU, u, constants.Epsilon, "should equal")
+			assert.InDelta(t, tt.wantV, v, constants.Epsilon, "should equal")
+		})
+	}
+}
@@ -143,6 +143,18 @@ func (c *Cylinder) IntersectWith(r Ray, t Intersections) Intersections {
 	return t
 }
 
+// UVAt returns the surface coordinates of the point p (world space), using a cylindrical map, the caps are mapped
+// to the [0, 1] square around them
+func (c *Cylinder) UVAt(p Point, xs *Intersection) (float64, float64) {
+	op := p.ToObjectSpace(c)
+	dist := op.X()*op.X() + op.Z()*op.Z()
+
+	if dist < 1 && (op.Y() >= c.Maximum-constants.Epsilon || op.Y() <= c.Minimum+constants.Epsilon) {
+		return (op.X() + 1) / 2, (op.Z() + 1) / 2
+	}
+	return NewCylinderMap().Map(op)
+}
+
 func (c *Cylinder) localNormalAt(p Point, xs *Intersection) Vector {
 	// object normal, this is different for each shape
 	var on Vector
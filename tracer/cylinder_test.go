@@ -463,3 +463,39 @@ func TestCylinder_Bounds(t *testing.T) {
 		})
 	}
 }
+
+func TestCylinder_UVAt(t *testing.T) {
+	tests := []struct {
+		name  string
+		p     Point
+		wantU float64
+		wantV float64
+	}{
+		{
+			name:  "body",
+			p:     NewPoint(0, 0.5, -1),
+			wantU: 0,
+			wantV: 0.5,
+		},
+		{
+			name:  "top cap",
+			p:     NewPoint(0.5, 1, 0),
+			wantU: 0.75,
+			wantV: 0.5,
+		},
+		{
+			name:  "bottom cap",
+			p:     NewPoint(0, 0, -0.5),
+			wantU: 0.5,
+			wantV: 0.25,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, v := NewClosedCylinder(0, 1).UVAt(tt.p, nil)
+			assert.InDelta(t, tt.wantU, u, constants.Epsilon, "should equal")
+			assert.InDelta(t, tt.wantV, v, constants.Epsilon, "should equal")
+		})
+	}
+}
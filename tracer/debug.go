@@ -0,0 +1,95 @@
+package tracer
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// DebugMode selects what the debug integrator shows
+type DebugMode int
+
+const (
+	// DebugNormals shows the surface normal, mapped from [-1, 1] to [0, 1]
+	DebugNormals DebugMode = iota
+
+	// DebugUVs shows the surface (texture) coordinates as red (u) and green (v)
+	DebugUVs
+
+	// DebugDepth shows the distance to the hit, white is close, black is MaxDepth or further
+	DebugDepth
+
+	// DebugBarycentrics shows the barycentric coordinates of triangle hits, other shapes are black
+	DebugBarycentrics
+
+	// DebugMaterialIDs gives each material its own color
+	DebugMaterialIDs
+)
+
+// DebugIntegrator visualizes geometric information about the first hit
+type DebugIntegrator struct {
+	Mode DebugMode
+
+	// MaxDepth is the distance shown as black by DebugDepth
+	MaxDepth float64
+
+	// materialIDs is filled in by Preprocess, in the order the materials appear in the world
+	materialIDs map[*Material]int
+}
+
+// NewDebugIntegrator returns a new debug integrator
+func NewDebugIntegrator(mode DebugMode) *DebugIntegrator {
+	return &DebugIntegrator{
+		Mode:     mode,
+		MaxDepth: 100,
+	}
+}
+
+// Preprocess implements the Integrator interface
+func (di *DebugIntegrator) Preprocess(w *World) {
+	di.materialIDs = make(map[*Material]int)
+
+	walkShapes(w.Objects, func(s Shaper) {
+		if _, ok := di.materialIDs[s.Material()]; !ok {
+			di.materialIDs[s.Material()] = len(di.materialIDs)
+		}
+	})
+}
+
+// Li implements the Integrator interface
+func (di *DebugIntegrator) Li(w *World, r Ray, xs Intersections, rng *rand.Rand) Color {
+	xs = w.Intersections(r, xs)
+	hit, err := xs.Hit()
+	if err != nil {
+		return Black()
+	}
+	state := PrepareComputations(hit, r, xs)
+
+	switch di.Mode {
+	case DebugNormals:
+		n := state.NormalV
+		return NewColor((n.x+1)/2, (n.y+1)/2, (n.z+1)/2)
+	case DebugUVs:
+		return NewColor(state.U, state.V, 0).Clamp()
+	case DebugDepth:
+		return White().Scale(math.Max(0, 1-state.T/di.MaxDepth))
+	case DebugBarycentrics:
+		switch state.Object.(type) {
+		case *Triangle, *SmoothTriangle:
+			return NewColor(1-hit.u-hit.v, hit.u, hit.v)
+		}
+		return Black()
+	case DebugMaterialIDs:
+		id, ok := di.materialIDs[state.Object.Material()]
+		if !ok {
+			// material added after Preprocess
+			return White()
+		}
+		// golden angle steps give neighbouring ids very different hues
+		clr := colorful.Hsv(math.Mod(float64(id)*137.508, 360), 0.7, 0.9)
+		return NewColor(clr.R, clr.G, clr.B)
+	}
+
+	return Black()
+}
@@ -0,0 +1,167 @@
+package tracer
+
+import (
+	"math"
+)
+
+// differentialStep is the distance (world space) over which the changes of the surface coordinates and the normal
+// around a hit are measured
+const differentialStep = 1e-4
+
+// texCoords are the surface coordinates of a hit and their change from one pixel to the next, the derivatives are
+// zero if the ray had no differentials
+type texCoords struct {
+	u, v                   float64
+	dudx, dvdx, dudy, dvdy float64
+
+	// space is the working space textures are sampled in
+	space WorkingSpace
+}
+
+// surfaceDifferentials describe how the hit moves between neighbouring pixels, see RayDifferentials
+type surfaceDifferentials struct {
+	// dpdx, dpdy are the offsets from the hit to where the differential rays hit the tangent plane
+	dpdx, dpdy Vector
+	// dndx, dndy are the changes of the normal, dwodx, dwody the changes of the eye vector
+	dndx, dndy   Vector
+	dwodx, dwody Vector
+}
+
+// texCoords returns the surface coordinates of the hit, with their derivatives
+func (s *IntersectionState) texCoords() texCoords {
+	return texCoords{
+		u: s.U, v: s.V, dudx: s.DuDx, dvdx: s.DvDx, dudy: s.DuDy, dvdy: s.DvDy,
+		space: workingSpaceOf(s.Object),
+	}
+}
+
+// differentiate sets the footprint of the hit from the differentials of the ray r
+func (s *IntersectionState) differentiate(r Ray) {
+	d := r.Differentials
+	n := s.NormalV
+	plane := n.Dot(s.Point.SubPoint(Origin()))
+
+	// where a differential ray hits the tangent plane
+	offset := func(o Point, dir Vector) (Vector, bool) {
+		den := n.Dot(dir)
+		if den == 0 {
+			return Vector{}, false
+		}
+		t := (plane - n.Dot(o.SubPoint(Origin()))) / den
+		return o.AddVector(dir.Scale(t)).SubPoint(s.Point), true
+	}
+	dpdx, okx := offset(d.RxOrigin, d.RxDir)
+	dpdy, oky := offset(d.RyOrigin, d.RyDir)
+	if !okx || !oky {
+		return
+	}
+
+	sd := &surfaceDifferentials{
+		dpdx:  dpdx,
+		dpdy:  dpdy,
+		dwodx: r.Dir.SubVector(d.RxDir),
+		dwody: r.Dir.SubVector(d.RyDir),
+	}
+	s.DuDx, s.DvDx, sd.dndx = s.derivatives(dpdx)
+	s.DuDy, s.DvDy, sd.dndy = s.derivatives(dpdy)
+	s.differentials = sd
+}
+
+// derivatives returns the change of the surface coordinates and of the normal moving by dp along the tangent plane
+// The change is measured over a short step and scaled, so footprints that cover many repeats of a texture still
+// measure the local rate of change.
+func (s *IntersectionState) derivatives(dp Vector) (du, dv float64, dn Vector) {
+	length := dp.Magnitude()
+	if length == 0 {
+		return 0, 0, Vector{}
+	}
+	h := math.Min(1, differentialStep/length)
+	p := s.Point.AddVector(dp.Scale(h))
+
+	u, v := s.Object.UVAt(p, nil)
+	n := s.Object.NormalAt(p, nil)
+	if s.Inside {
+		n = n.Negate()
+	}
+	return wrapUVDelta(u-s.U) / h, wrapUVDelta(v-s.V) / h, n.SubVector(s.NormalV).Scale(1 / h)
+}
+
+// wrapUVDelta returns the difference between two surface coordinates, across the seam of maps that wrap around
+func wrapUVDelta(d float64) float64 {
+	switch {
+	case d > 0.5:
+		return d - 1
+	case d < -0.5:
+		return d + 1
+	}
+	return d
+}
+
+// reflectedDifferentials returns the differentials of the ray perfectly reflected at the hit in direction wi, nil if
+// the hit has none
+func (s *IntersectionState) reflectedDifferentials(wi Vector) *RayDifferentials {
+	sd := s.differentials
+	if sd == nil {
+		return nil
+	}
+	n, wo := s.NormalV, s.EyeV
+
+	dir := func(dndx, dwodx Vector) Vector {
+		dDNdx := dwodx.Dot(n) + wo.Dot(dndx)
+		return wi.SubVector(dwodx).AddVector(dndx.Scale(wo.Dot(n)).AddVector(n.Scale(dDNdx)).Scale(2))
+	}
+	return &RayDifferentials{
+		RxOrigin: s.Point.AddVector(sd.dpdx),
+		RyOrigin: s.Point.AddVector(sd.dpdy),
+		RxDir:    dir(sd.dndx, sd.dwodx),
+		RyDir:    dir(sd.dndy, sd.dwody),
+	}
+}
+
+// refractedDifferentials returns the differentials of the ray perfectly refracted at the hit in direction wi, nil if
+// the hit has none
+func (s *IntersectionState) refractedDifferentials(wi Vector) *RayDifferentials {
+	sd := s.differentials
+	if sd == nil {
+		return nil
+	}
+	n, wo := s.NormalV, s.EyeV
+	eta := s.N1 / s.N2
+	cosI, cosT := wo.Dot(n), wi.Dot(n)
+	if cosT == 0 {
+		return nil
+	}
+
+	// wi = -eta wo + mu n, differentiated
+	mu := eta*cosI + cosT
+	dir := func(dndx, dwodx Vector) Vector {
+		dDNdx := dwodx.Dot(n) + wo.Dot(dndx)
+		dmudx := (eta + eta*eta*cosI/cosT) * dDNdx
+		return wi.SubVector(dwodx.Scale(eta)).AddVector(dndx.Scale(mu)).AddVector(n.Scale(dmudx))
+	}
+	return &RayDifferentials{
+		RxOrigin: s.Point.AddVector(sd.dpdx),
+		RyOrigin: s.Point.AddVector(sd.dpdy),
+		RxDir:    dir(sd.dndx, sd.dwodx),
+		RyDir:    dir(sd.dndy, sd.dwody),
+	}
+}
+
+// specularDifferentials returns the differentials of the ray leaving the hit in direction wi after a perfect reflection
+// or refraction, nil if the hit has none
+func (s *IntersectionState) specularDifferentials(wi Vector) *RayDifferentials {
+	if wi.Dot(s.NormalV) > 0 {
+		return s.reflectedDifferentials(wi)
+	}
+	return s.refractedDifferentials(wi)
+}
+
+// differentialScale returns how much to shrink camera ray differentials by for the antialias setting, the samples of
+// a pixel are closer together than the pixels
+func differentialScale(antialias int) float64 {
+	if antialias <= 0 {
+		return 1
+	}
+	// antialias samples 2^antialias points per pixel
+	return math.Pow(2, -float64(antialias)/2)
+}
@@ -0,0 +1,154 @@
+package tracer
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// differentialsTestState returns the state of the camera ray through pixel (x, y) hitting the shape
+func differentialsTestState(t *testing.T, camera *Camera, shape Shaper, x, y float64) (*IntersectionState, Ray) {
+	r := camera.RayForPixelDifferentials(x, y, 1)
+	xs := shape.IntersectWith(r, NewIntersections())
+	hit, err := xs.Hit()
+	assert.NoError(t, err)
+	return PrepareComputations(hit, r, xs), r
+}
+
+func TestIntersectionState_Differentiate(t *testing.T) {
+	camera := NewCamera(100, 100, math.Pi/3)
+	camera.SetTransform(ViewTransform(NewPoint(0.3, 2, -1), NewPoint(0.3, 0, 2), NewVector(0, 1, 0)))
+	plane := NewPlane()
+
+	state, _ := differentialsTestState(t, camera, plane, 50, 70)
+	nextX, _ := differentialsTestState(t, camera, plane, 51, 70)
+	nextY, _ := differentialsTestState(t, camera, plane, 50, 71)
+
+	// the plane is flat and its coordinates are linear, the footprint is exact
+	assert.InDelta(t, nextX.U-state.U, state.DuDx, 1e-6, "should equal")
+	assert.InDelta(t, nextX.V-state.V, state.DvDx, 1e-6, "should equal")
+	assert.InDelta(t, nextY.U-state.U, state.DuDy, 1e-6, "should equal")
+	assert.InDelta(t, nextY.V-state.V, state.DvDy, 1e-6, "should equal")
+	assert.True(t, state.differentials.dndx.Equal(NewVector(0, 0, 0)), "the normal doesn't change")
+
+	// without differentials there is no footprint
+	r := NewRay(NewPoint(0, 1, 0), NewVector(0, -1, 1))
+	xs := plane.IntersectWith(r, NewIntersections())
+	state = PrepareComputations(xs[0], r, xs)
+	assert.Equal(t, texCoords{u: state.U, v: state.V}, state.texCoords(), "should equal")
+	assert.Nil(t, state.reflectedDifferentials(state.ReflectV), "should be nil")
+}
+
+func TestIntersectionState_ReflectedDifferentials(t *testing.T) {
+	camera := NewCamera(100, 100, math.Pi/3)
+	camera.SetTransform(ViewTransform(NewPoint(0, 0, -5), NewPoint(0, 0, 0), NewVector(0, 1, 0)))
+
+	// spread returns the angle between a ray and its x differential
+	spread := func(dir Vector, d *RayDifferentials) float64 {
+		return math.Acos(dir.Normalize().Dot(d.RxDir.Normalize()))
+	}
+
+	t.Run("flat mirror", func(t *testing.T) {
+		plane := NewPlane()
+		plane.SetTransform(IM().RotateX(math.Pi / 3))
+
+		state, r := differentialsTestState(t, camera, plane, 50, 50)
+		got := state.reflectedDifferentials(state.ReflectV)
+
+		assert.True(t, got.RxDir.Equal(r.Differentials.RxDir.Reflect(state.NormalV)), "mirrors the differentials")
+		assert.InDelta(t, 0, got.RxOrigin.SubPoint(state.Point).Dot(state.NormalV), 1e-9, "on the mirror")
+		assert.InDelta(t, spread(r.Dir, r.Differentials), spread(state.ReflectV, got), 1e-6, "keeps the spread")
+	})
+
+	t.Run("convex mirror", func(t *testing.T) {
+		sphere := NewUnitSphere()
+
+		state, r := differentialsTestState(t, camera, sphere, 50, 50)
+		got := state.reflectedDifferentials(state.ReflectV)
+
+		assert.True(t, spread(state.ReflectV, got) > 5*spread(r.Dir, r.Differentials), "reflections spread out")
+	})
+}
+
+func TestIntersectionState_RefractedDifferentials(t *testing.T) {
+	camera := NewCamera(100, 100, math.Pi/3)
+	camera.SetTransform(ViewTransform(NewPoint(0, 2, -5), NewPoint(0, 0, 0), NewVector(0, 1, 0)))
+
+	// the same index of refraction on both sides doesn't bend the ray
+	plane := NewPlane()
+	plane.Material().Transparency = 1
+	plane.Material().RefractiveIndex = 1
+
+	state, r := differentialsTestState(t, camera, plane, 40, 60)
+	dir, ok := refractedDirection(state)
+	assert.True(t, ok, "should refract")
+	got := state.refractedDifferentials(dir)
+
+	assert.True(t, got.RxDir.Equal(r.Differentials.RxDir), "should equal")
+	assert.True(t, got.RyDir.Equal(r.Differentials.RyDir), "should equal")
+	assert.True(t, state.specularDifferentials(dir).RxDir.Equal(got.RxDir), "should equal")
+
+	// glass bends the differentials the same as the ray through the next pixel
+	plane.Material().RefractiveIndex = 1.5
+	state, _ = differentialsTestState(t, camera, plane, 40, 60)
+	dir, _ = refractedDirection(state)
+	got = state.refractedDifferentials(dir)
+	next, _ := differentialsTestState(t, camera, plane, 41, 60)
+	want, _ := refractedDirection(next)
+
+	assert.InDelta(t, 0, got.RxDir.SubVector(want).Magnitude(), 1e-4, "should equal")
+}
+
+func TestWorld_RenderMipmap(t *testing.T) {
+	// black and white checkers, one per half unit of the floor
+	texture := NewCanvas(2, 2)
+	texture.Set(0, 0, White())
+	texture.Set(1, 1, White())
+
+	tests := []struct {
+		name   string
+		mipmap MipmapFilter
+		want   func(Color) bool
+	}{
+		{
+			name:   "mipmap",
+			mipmap: MipmapAnisotropic,
+			want:   func(c Color) bool { return math.Abs(c.R-0.5) < 0.1 },
+		},
+		{
+			name:   "no mipmap",
+			mipmap: MipmapNone,
+			want:   func(c Color) bool { return c.Equal(Black()) || c.Equal(White()) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := NewWorld(NewWorldConfig())
+			w.Config.Antialias = 0
+			w.SetLights(Lights{NewPointLight(NewPoint(0, 10, 0), White())})
+
+			floor := NewPlane()
+			m := NewDefaultMaterial()
+			m.Ambient, m.Diffuse, m.Specular = 1, 0, 0
+			m.Texture = NewTextureSampler(NewCanvasTexture(texture))
+			m.Texture.Filter = TextureFilterNearest
+			m.Texture.Mipmap = tt.mipmap
+			floor.SetMaterial(m)
+			w.AddObject(floor)
+
+			camera := NewCamera(11, 11, math.Pi/3)
+			camera.SetTransform(ViewTransform(NewPoint(0, 1, 0), NewPoint(0, 1, 10), NewVector(0, 1, 0)))
+			w.SetCamera(camera)
+
+			canvas := NewCanvas(11, 11)
+			w.Render(camera, canvas)
+
+			// just below the horizon, each pixel covers many checkers
+			got, err := canvas.Get(5, 6)
+			assert.NoError(t, err)
+			assert.True(t, tt.want(got), "got %v", got)
+		})
+	}
+}
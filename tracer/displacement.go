@@ -0,0 +1,254 @@
+package tracer
+
+// maxDisplacementDepth limits how many times tessellation splits the triangles of the original mesh
+const maxDisplacementDepth = 16
+
+// Displacement moves the surface of meshes along their normals by a height map, unlike perturbers, which only bend
+// the shading normals, the bumps change the silhouette and cast shadows
+// The mesh is tessellated adaptively first: edges are split where the height changes more than the triangles can
+// follow. Vertices at the same place (the seams of texture coordinates, the edges of cubes) move together, so the
+// surface stays closed. Use ShapeToMesh to displace spheres, planes and cubes.
+type Displacement struct {
+	// Height is the height of the surface, read at the vertices: patterns at the point and textures at the texture
+	// coordinates of the mesh
+	Height *MaterialMap
+
+	// Scale is the distance (object space) the surface moves where the height is 1
+	Scale float64
+
+	// Midlevel is the height that stays in place, 0 only raises the surface and 0.5 raises and lowers it
+	Midlevel float64
+
+	// Tolerance is the largest distance (object space) between the displaced surface and its triangles, measured at
+	// the middle of the edges
+	Tolerance float64
+
+	// MinEdge and MaxEdge are the shortest edge tessellation splits and the longest edge it leaves (0 for no limit)
+	MinEdge, MaxEdge float64
+}
+
+// NewDisplacement returns a new displacement by the height map, the defaults suit objects about 1 unit in size
+func NewDisplacement(height *MaterialMap, scale float64) *Displacement {
+	return &Displacement{
+		Height:    height,
+		Scale:     scale,
+		Tolerance: 0.002,
+		MinEdge:   0.02,
+	}
+}
+
+// displacedVertex is a vertex of the tessellated mesh, with the direction and distance it moves
+type displacedVertex struct {
+	meshVertex
+	dir Vector
+	d   float64
+}
+
+// position returns the displaced position of the vertex
+func (v displacedVertex) position() Point {
+	return v.p.AddVector(v.dir.Scale(v.d))
+}
+
+// displacedTriangle is a triangle of the tessellated mesh
+type displacedTriangle struct {
+	v        [3]displacedVertex
+	material *Material
+}
+
+// displacer tessellates and displaces one mesh
+type displacer struct {
+	*Displacement
+	mesh *TriangleMesh
+
+	// dirs is the direction the vertices at each place of the mesh move in, the average of their normals
+	dirs map[Point]Vector
+	// heights caches the displacement at each place, the first vertex there reads the height map for all of them
+	heights map[Point]float64
+	tris    []displacedTriangle
+}
+
+// newDisplacer returns a displacer of m, vertices at the same place move in the same direction
+func newDisplacer(d *Displacement, m *TriangleMesh) *displacer {
+	dp := &displacer{Displacement: d, mesh: m, dirs: make(map[Point]Vector), heights: make(map[Point]float64)}
+
+	// the distinct normals at each place, the sides of a seam have the same normal and count once
+	normals := make(map[Point][]Vector)
+	add := func(p Point, n Vector) {
+		n = n.Normalize()
+		for _, seen := range normals[p] {
+			if seen.Equal(n) {
+				return
+			}
+		}
+		normals[p] = append(normals[p], n)
+	}
+	for _, t := range m.Triangles {
+		add(t.P1, t.N1)
+		add(t.P2, t.N2)
+		add(t.P3, t.N3)
+	}
+
+	for p, ns := range normals {
+		var dir Vector
+		for _, n := range ns {
+			dir = dir.AddVector(n)
+		}
+		if dir.Magnitude() == 0 {
+			dir = ns[0]
+		}
+		dp.dirs[p] = dir.Normalize()
+	}
+	return dp
+}
+
+// Apply returns a new mesh of the displaced surface of m, with the same transform and materials
+// The normals are recomputed from the displaced triangles, vertices at the same place with the same normal (the seams
+// of texture coordinates) share them, and the bounds are those of the displaced vertices.
+func (d *Displacement) Apply(m *TriangleMesh) *TriangleMesh {
+	dp := newDisplacer(d, m)
+
+	for _, t := range m.Triangles {
+		a := dp.vertex(meshVertex{p: t.P1, n: t.N1.Normalize(), vt: t.VT1}, dp.dirs[t.P1])
+		b := dp.vertex(meshVertex{p: t.P2, n: t.N2.Normalize(), vt: t.VT2}, dp.dirs[t.P2])
+		c := dp.vertex(meshVertex{p: t.P3, n: t.N3.Normalize(), vt: t.VT3}, dp.dirs[t.P3])
+		dp.tessellate(a, b, c, t.Material(), 0)
+	}
+
+	result := newTriangleMesh(dp.triangles())
+	result.SetTransform(m.Transform())
+	result.SetMaterial(m.Material())
+	result.SetName(m.Name())
+	return result
+}
+
+// vertex returns the vertex with its displacement, moving in direction dir
+func (dp *displacer) vertex(v meshVertex, dir Vector) displacedVertex {
+	d, ok := dp.heights[v.p]
+	if !ok {
+		tc := texCoords{u: v.vt.x, v: v.vt.y, space: workingSpaceOf(dp.mesh)}
+		h := dp.Height.valueAt(dp.mesh, v.p.ToWorldSpace(dp.mesh), tc)
+		d = (h - dp.Midlevel) * dp.Scale
+		dp.heights[v.p] = d
+	}
+	return displacedVertex{meshVertex: v, dir: dir, d: d}
+}
+
+// midpoint returns the vertex in the middle of the edge a-b, the same for b-a
+func (dp *displacer) midpoint(a, b displacedVertex) displacedVertex {
+	n := a.n.AddVector(b.n)
+	if n.Magnitude() == 0 {
+		n = a.n
+	}
+	// the triangles on both sides of a seam have the same directions at the ends of the edge, so they agree here too
+	dir := a.dir.AddVector(b.dir)
+	if dir.Magnitude() == 0 {
+		dir = a.dir
+	}
+	return dp.vertex(meshVertex{
+		p:  NewPoint((a.p.x+b.p.x)/2, (a.p.y+b.p.y)/2, (a.p.z+b.p.z)/2),
+		n:  n.Normalize(),
+		vt: NewPoint((a.vt.x+b.vt.x)/2, (a.vt.y+b.vt.y)/2, (a.vt.z+b.vt.z)/2),
+	}, dir.Normalize())
+}
+
+// split returns true if the edge a-b, with the middle vertex mid, needs splitting
+// It only looks at the edge, so the triangles on both sides of it agree and the mesh stays closed.
+func (dp *displacer) split(a, b, mid displacedVertex) bool {
+	length := b.p.SubPoint(a.p).Magnitude()
+	switch {
+	case length <= dp.MinEdge:
+		return false
+	case dp.MaxEdge > 0 && length > dp.MaxEdge:
+		return true
+	}
+	pa, pb := a.position(), b.position()
+	flat := NewPoint((pa.x+pb.x)/2, (pa.y+pb.y)/2, (pa.z+pb.z)/2)
+	return mid.position().SubPoint(flat).Magnitude() > dp.Tolerance
+}
+
+// tessellate splits the triangle a, b, c until its edges follow the displaced surface, and keeps the pieces
+func (dp *displacer) tessellate(a, b, c displacedVertex, mat *Material, depth int) {
+	v := [3]displacedVertex{a, b, c}
+	var mid [3]displacedVertex
+	var split [3]bool
+	count := 0
+	if depth < maxDisplacementDepth {
+		for i := 0; i < 3; i++ {
+			// edge i is v[i]-v[i+1]
+			mid[i] = dp.midpoint(v[i], v[(i+1)%3])
+			split[i] = dp.split(v[i], v[(i+1)%3], mid[i])
+			if split[i] {
+				count++
+			}
+		}
+	}
+
+	switch count {
+	case 0:
+		dp.tris = append(dp.tris, displacedTriangle{v: v, material: mat})
+	case 1:
+		// rotate the split edge to 0
+		for !split[0] {
+			v = [3]displacedVertex{v[1], v[2], v[0]}
+			mid = [3]displacedVertex{mid[1], mid[2], mid[0]}
+			split = [3]bool{split[1], split[2], split[0]}
+		}
+		dp.tessellate(v[0], mid[0], v[2], mat, depth+1)
+		dp.tessellate(mid[0], v[1], v[2], mat, depth+1)
+	case 2:
+		// rotate the edge that stays to 2
+		for split[2] {
+			v = [3]displacedVertex{v[1], v[2], v[0]}
+			mid = [3]displacedVertex{mid[1], mid[2], mid[0]}
+			split = [3]bool{split[1], split[2], split[0]}
+		}
+		dp.tessellate(mid[0], v[1], mid[1], mat, depth+1)
+		dp.tessellate(v[0], mid[0], mid[1], mat, depth+1)
+		dp.tessellate(v[0], mid[1], v[2], mat, depth+1)
+	default:
+		dp.tessellate(v[0], mid[0], mid[2], mat, depth+1)
+		dp.tessellate(mid[0], v[1], mid[1], mat, depth+1)
+		dp.tessellate(mid[2], mid[1], v[2], mat, depth+1)
+		dp.tessellate(mid[0], mid[1], mid[2], mat, depth+1)
+	}
+}
+
+// triangles returns the displaced triangles, with the normals of the displaced surface
+func (dp *displacer) triangles() []*SmoothTriangle {
+	// the place and normal of a vertex before displacement
+	type key struct {
+		p Point
+		n Vector
+	}
+
+	// the normals of the triangles around each vertex, weighted by their area
+	normals := make(map[key]Vector)
+	for _, t := range dp.tris {
+		p0, p1, p2 := t.v[0].position(), t.v[1].position(), t.v[2].position()
+		face := p2.SubPoint(p0).Cross(p1.SubPoint(p0))
+		if face.Dot(t.v[0].n.AddVector(t.v[1].n).AddVector(t.v[2].n)) < 0 {
+			face = face.Negate()
+		}
+		for _, v := range t.v {
+			k := key{p: v.p, n: v.n}
+			normals[k] = normals[k].AddVector(face)
+		}
+	}
+
+	tris := make([]*SmoothTriangle, 0, len(dp.tris))
+	for _, t := range dp.tris {
+		var mv [3]meshVertex
+		for i, v := range t.v {
+			n := normals[key{p: v.p, n: v.n}]
+			if n.Magnitude() == 0 {
+				n = v.n
+			}
+			mv[i] = meshVertex{p: v.position(), n: n.Normalize(), vt: v.vt}
+		}
+		tri := newMeshTriangle(mv[0], mv[1], mv[2])
+		tri.SetMaterial(t.material)
+		tris = append(tris, tri)
+	}
+	smoothTangents(tris)
+	return tris
+}
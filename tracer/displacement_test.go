@@ -0,0 +1,204 @@
+package tracer
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// assertClosed checks that the triangles of the displaced plane cover it without cracks: every edge is shared by two
+// triangles, except the edges on the border of the plane
+func assertClosed(t *testing.T, m *TriangleMesh) {
+	type edge struct{ a, b [2]float64 }
+	edges := make(map[edge]int)
+	for _, tri := range m.Triangles {
+		p := []Point{tri.P1, tri.P2, tri.P3}
+		for i := range p {
+			a, b := [2]float64{p[i].X(), p[i].Z()}, [2]float64{p[(i+1)%3].X(), p[(i+1)%3].Z()}
+			if a[0] > b[0] || a[0] == b[0] && a[1] > b[1] {
+				a, b = b, a
+			}
+			edges[edge{a, b}]++
+		}
+	}
+
+	for e, count := range edges {
+		border := (e.a[0] == e.b[0] && math.Abs(e.a[0]) == 1) || (e.a[1] == e.b[1] && math.Abs(e.a[1]) == 1)
+		if border {
+			assert.Equal(t, 1, count, "border edge %v", e)
+		} else {
+			assert.Equal(t, 2, count, "inner edge %v", e)
+		}
+	}
+}
+
+func TestDisplacement_Apply(t *testing.T) {
+	tests := []struct {
+		name    string
+		height  Patterner
+		scale   float64
+		maxEdge float64
+		// want is the height of the vertex at x
+		want func(x float64) float64
+		// minTris and maxTris bound the number of triangles
+		minTris, maxTris int
+	}{
+		{
+			name:    "flat",
+			height:  NewSolidPattern(NewColor(0.5, 0.5, 0.5)),
+			scale:   2,
+			want:    func(x float64) float64 { return 1 },
+			minTris: 2,
+			maxTris: 2,
+		},
+		{
+			name:    "max edge",
+			height:  NewSolidPattern(Black()),
+			scale:   1,
+			maxEdge: 0.5,
+			want:    func(x float64) float64 { return 0 },
+			minTris: 32,
+			maxTris: 64,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plane, err := ShapeToMesh(NewPlane(), 1)
+			assert.NoError(t, err, "should not error")
+
+			d := NewDisplacement(NewPatternMap(tt.height, ChannelLuminance), tt.scale)
+			d.MaxEdge = tt.maxEdge
+			m := d.Apply(plane)
+
+			assert.True(t, len(m.Triangles) >= tt.minTris && len(m.Triangles) <= tt.maxTris, "triangles: %v",
+				len(m.Triangles))
+			assertClosed(t, m)
+
+			maxY := 0.0
+			for _, tri := range m.Triangles {
+				for _, p := range []Point{tri.P1, tri.P2, tri.P3} {
+					assert.InDelta(t, tt.want(p.X()), p.Y(), 1e-9, "height at %v", p)
+					maxY = math.Max(maxY, p.Y())
+				}
+				if tt.maxEdge > 0 {
+					assert.True(t, tri.E1.Magnitude() <= tt.maxEdge && tri.E2.Magnitude() <= tt.maxEdge, "edges")
+				}
+			}
+			assert.InDelta(t, maxY, m.Bounds().Max.Y(), 1e-9, "bounds around the displaced vertices")
+		})
+	}
+}
+
+func TestDisplacement_Adaptive(t *testing.T) {
+	plane, err := ShapeToMesh(NewPlane(), 4)
+	assert.NoError(t, err, "should not error")
+
+	// the gradient is linear except where it jumps back at x = 0, only the triangles left of it need splitting
+	gradient := NewGradientPattern(Black(), White())
+	gradient.SetTransform(IM().Scale(4, 4, 4))
+	d := NewDisplacement(NewPatternMap(gradient, ChannelLuminance), 0.5)
+	m := d.Apply(plane)
+	assertClosed(t, m)
+
+	near, far := 0, 0
+	for _, tri := range m.Triangles {
+		for _, p := range []Point{tri.P1, tri.P2, tri.P3} {
+			assert.InDelta(t, 0.5*(p.X()/4-math.Floor(p.X()/4)), p.Y(), 1e-9, "height at %v", p)
+		}
+		maxX := math.Max(tri.P1.X(), math.Max(tri.P2.X(), tri.P3.X()))
+		minX := math.Min(tri.P1.X(), math.Min(tri.P2.X(), tri.P3.X()))
+		if minX >= -0.5 && maxX <= 0 {
+			near++
+		} else {
+			far++
+		}
+	}
+	assert.Equal(t, 24, far, "the triangles away from the jump are kept")
+	assert.True(t, near > 8, "the triangles at the jump are split, got %v", near)
+}
+
+func TestDisplacement_Sphere(t *testing.T) {
+	s := NewUnitSphere()
+	s.SetTransform(IM().Scale(2, 2, 2))
+	sm, err := ShapeToMesh(s, 16)
+	assert.NoError(t, err, "should not error")
+
+	d := NewDisplacement(NewPatternMap(NewSolidPattern(White()), ChannelLuminance), 0.1)
+	m := d.Apply(sm)
+	m.SetWorldConfig(NewWorldConfig())
+
+	assert.InDelta(t, 1.1, m.Bounds().Max.Y(), 1e-9, "bounds around the displaced vertices")
+
+	// the silhouette grows, the normals follow the displaced surface and the transform of the mesh
+	r := NewRay(NewPoint(0.01, 0.02, -5), NewVector(0, 0, 1))
+	xs := m.IntersectWith(r, NewIntersections())
+	assert.NotEmpty(t, xs, "should hit")
+	hit := xs[0]
+	for _, x := range xs {
+		if x.T() < hit.T() {
+			hit = x
+		}
+	}
+	assert.InDelta(t, 5-2.2, hit.T(), 0.05, "should equal")
+
+	n := hit.Object().NormalAt(r.Position(hit.T()), hit)
+	assert.True(t, n.Dot(NewVector(0, 0, -1)) > 0.99, "normal: %v", n)
+}
+
+// assertWatertight checks that the displaced surface has no cracks: every edge is shared by exactly two triangles
+func assertWatertight(t *testing.T, m *TriangleMesh) {
+	key := func(p Point) [3]float64 { return [3]float64{p.X(), p.Y(), p.Z()} }
+	type edge struct{ a, b [3]float64 }
+	edges := make(map[edge]int)
+	for _, tri := range m.Triangles {
+		p := []Point{tri.P1, tri.P2, tri.P3}
+		for i := range p {
+			a, b := key(p[i]), key(p[(i+1)%3])
+			if a == b {
+				continue // degenerate edge at the poles
+			}
+			if a[0] > b[0] || a[0] == b[0] && (a[1] > b[1] || a[1] == b[1] && a[2] > b[2]) {
+				a, b = b, a
+			}
+			edges[edge{a, b}]++
+		}
+	}
+
+	for e, count := range edges {
+		assert.Equal(t, 2, count, "edge %v", e)
+	}
+}
+
+func TestDisplacement_Texture(t *testing.T) {
+	// a horizontal gradient, black at u=0 and white at u=1, the seam of the sphere and the edges of the cube read
+	// different heights on each side
+	c := NewCanvas(16, 16)
+	for x := 0; x < c.Width; x++ {
+		for y := 0; y < c.Height; y++ {
+			v := float64(x) / float64(c.Width-1)
+			assert.NoError(t, c.Set(x, y, NewColor(v, v, v)))
+		}
+	}
+	height := NewTextureMap(NewTextureSampler(NewCanvasTexture(c)), ChannelLuminance)
+
+	tests := []struct {
+		name  string
+		shape Shaper
+	}{
+		{name: "sphere", shape: NewUnitSphere()},
+		{name: "cube", shape: NewUnitCube()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm, err := ShapeToMesh(tt.shape, 16)
+			assert.NoError(t, err, "should not error")
+
+			m := NewDisplacement(height, 0.2).Apply(sm)
+			assert.True(t, len(m.Triangles) > len(sm.Triangles), "the gradient is tessellated")
+			assertWatertight(t, m)
+		})
+	}
+}
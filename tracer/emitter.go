@@ -0,0 +1,196 @@
+package tracer
+
+import (
+	"log"
+	"math"
+	"math/rand"
+)
+
+// emitter is a light emitting surface the path tracer can pick points on
+// Area lights and objects with an emissive material are emitters.
+type emitter struct {
+	shape Shaper
+	// light is nil for emissive objects that are not lights
+	light Light
+
+	// inScene is true if rays can hit the emitter, only then can light sampling be combined with bsdf sampling
+	inScene bool
+
+	// object space area of the shape
+	area float64
+
+	// object <-> world transforms, including the transforms of all the parents
+	toWorld, toObject Matrix
+	// normalToWorld is the inverse transpose of toWorld
+	normalToWorld Matrix
+	// det is the determinant of toWorld
+	det float64
+}
+
+// objectToWorld returns the matrix that transforms from the object space of s into world space
+func objectToWorld(s Shaper) Matrix {
+	m := s.Transform()
+	for p := s.Parent(); p != nil; p = p.Parent() {
+		m = p.Transform().TimesMatrix(m)
+	}
+	return m
+}
+
+// newEmitter returns a new emitter, ok is false if points on the shape can't be sampled
+func newEmitter(s Shaper, l Light, inScene bool) (e *emitter, ok bool) {
+	e = &emitter{
+		shape:   s,
+		light:   l,
+		inScene: inScene,
+	}
+
+	switch s := s.(type) {
+	case *Sphere:
+		e.area = 4 * math.Pi
+	case *Cube:
+		e.area = 24
+	case *Triangle:
+		e.area = s.E1.Cross(s.E2).Magnitude() / 2
+	case *SmoothTriangle:
+		e.area = s.E1.Cross(s.E2).Magnitude() / 2
+	default:
+		return nil, false
+	}
+
+	e.toWorld = objectToWorld(s)
+	e.toObject = e.toWorld.Inverse()
+	e.normalToWorld = e.toObject.Transpose()
+	e.det = math.Abs(e.toWorld.Determinant())
+	return e, true
+}
+
+// objectSample returns a uniformly distributed point (and the normal there) on the shape, in object space
+func (e *emitter) objectSample(rng *rand.Rand) (Point, Vector) {
+	switch s := e.shape.(type) {
+	case *Sphere:
+		n := uniformSampleSphere(rng)
+		return s.Center.AddVector(n), n
+	case *Cube:
+		// pick one of the 6 faces, then a point on it
+		face := rng.Intn(6)
+		sign := 1.0
+		if face%2 == 1 {
+			sign = -1
+		}
+		a, b := 2*rng.Float64()-1, 2*rng.Float64()-1
+		switch face / 2 {
+		case 0:
+			return NewPoint(sign, a, b), NewVector(sign, 0, 0)
+		case 1:
+			return NewPoint(a, sign, b), NewVector(0, sign, 0)
+		default:
+			return NewPoint(a, b, sign), NewVector(0, 0, sign)
+		}
+	case *SmoothTriangle:
+		return e.triangleSample(&s.Triangle, rng)
+	case *Triangle:
+		return e.triangleSample(s, rng)
+	}
+	panic("emitter with a shape that can't be sampled")
+}
+
+// triangleSample returns a uniformly distributed point on a triangle, in object space
+func (e *emitter) triangleSample(t *Triangle, rng *rand.Rand) (Point, Vector) {
+	u, v := uniformSampleTriangle(rng)
+	p := t.P1.AddVector(t.E1.Scale(u)).AddVector(t.E2.Scale(v))
+	return p, t.E2.Cross(t.E1).Normalize()
+}
+
+// objectNormal returns the normal at p (object space), the sign does not matter
+func (e *emitter) objectNormal(p Point) Vector {
+	switch s := e.shape.(type) {
+	case *Sphere:
+		return p.SubPoint(s.Center).Normalize()
+	case *Cube:
+		return s.localNormalAt(p, nil)
+	case *SmoothTriangle:
+		return s.E2.Cross(s.E1).Normalize()
+	case *Triangle:
+		return s.E2.Cross(s.E1).Normalize()
+	}
+	panic("emitter with a shape that can't be sampled")
+}
+
+// worldNormal turns an object space normal into world space, and returns how much the transform
+// stretches the area around it: dA(world) = jacobian * dA(object)
+func (e *emitter) worldNormal(n Vector) (Vector, float64) {
+	wn := n.TimesMatrix(e.normalToWorld)
+	wn.w = 0
+	l := wn.Magnitude()
+	return wn.Scale(1 / l), e.det * l
+}
+
+// sample returns a point on the emitter (world space), the normal there, and the pdf of picking it with respect to area
+func (e *emitter) sample(rng *rand.Rand) (Point, Vector, float64) {
+	p, n := e.objectSample(rng)
+	wn, jacobian := e.worldNormal(n)
+	return p.TimesMatrix(e.toWorld), wn, 1 / (e.area * jacobian)
+}
+
+// pointPdf returns the normal at the world space point p, and the pdf (with respect to area) of sample returning it
+func (e *emitter) pointPdf(p Point) (Vector, float64) {
+	n, jacobian := e.worldNormal(e.objectNormal(p.TimesMatrix(e.toObject)))
+	return n, 1 / (e.area * jacobian)
+}
+
+// radiance returns the light leaving the emitter in direction dir (normalized, pointing away from the emitter)
+func (e *emitter) radiance(dir Vector) Color {
+	switch l := e.light.(type) {
+	case nil:
+		return e.shape.Material().Emissive
+	case *AreaSpotLight:
+		if math.Acos(l.Direction().Dot(dir)) > l.Angle()/2 {
+			return Black()
+		}
+	}
+	return e.light.Intensity()
+}
+
+// findEmitters returns all the emitters in the world, and a map to find them by the shape rays hit
+// Emissive shapes that can't be sampled are only found by rays hitting them.
+func findEmitters(w *World) (emitters []*emitter, byShape map[Shaper]*emitter) {
+	byShape = make(map[Shaper]*emitter)
+
+	inScene := make(map[Shaper]bool)
+	walkShapes(w.Objects, func(s Shaper) {
+		inScene[s] = true
+	})
+
+	add := func(s Shaper, l Light, visible bool) {
+		e, ok := newEmitter(s, l, visible)
+		if !ok {
+			log.Printf("[warning] Can't sample points on emitter %v (%T), it only lights the scene when hit by chance.", s.Name(), s)
+			return
+		}
+		emitters = append(emitters, e)
+		byShape[s] = e
+	}
+
+	for _, l := range w.Lights {
+		switch l := l.(type) {
+		case *AreaLight:
+			add(l.Shape(), l, inScene[l])
+		case *AreaSpotLight:
+			add(l.Shape(), l, inScene[l])
+		}
+	}
+
+	walkShapes(w.Objects, func(s Shaper) {
+		switch s.(type) {
+		case *AreaLight, *AreaSpotLight, *Group, *TriangleMesh, *CSG:
+			// lights are handled above, containers have no surface of their own
+			return
+		}
+		if _, ok := byShape[s]; ok || s.Material().Emissive == Black() {
+			return
+		}
+		add(s, nil, true)
+	})
+
+	return emitters, byShape
+}
@@ -0,0 +1,261 @@
+package tracer
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// filmPixel holds the weighted sum of all the samples that landed on a pixel
+type filmPixel struct {
+	sum    Color
+	weight float64
+}
+
+// Film accumulates samples into pixels using a reconstruction filter
+// A sample is splatted into every pixel whose center is within the filter radius
+type Film struct {
+	Width, Height int
+	filter        Filter
+
+	// row major order
+	pixels []filmPixel
+
+	// statistics of the samples taken inside each pixel, row major order
+	stats []sampleStats
+
+	// splats holds light that lands on the film from paths not started at the pixel (e.g. light tracing)
+	// row major order, scaled by the number of pixels per sample when resolved
+	splats []Color
+	// total number of samples added with AddPixelSample
+	samples int64
+
+	// one lock per row, samples from different workers can land on the same pixel
+	rowLocks []sync.Mutex
+}
+
+// NewFilm returns a new, empty film
+func NewFilm(w, h int, f Filter) *Film {
+	return &Film{
+		Width:    w,
+		Height:   h,
+		filter:   f,
+		pixels:   make([]filmPixel, w*h),
+		stats:    make([]sampleStats, w*h),
+		splats:   make([]Color, w*h),
+		rowLocks: make([]sync.Mutex, h),
+	}
+}
+
+// Filter returns the reconstruction filter used by the film
+func (f *Film) Filter() Filter {
+	return f.filter
+}
+
+// pixelRange returns the (inclusive) range of pixels a sample at x,y contributes to
+// pixel (px, py) has its center at (px + 0.5, py + 0.5)
+func (f *Film) pixelRange(x, y float64) (x0, y0, x1, y1 int) {
+	r := f.filter.Radius()
+
+	x0 = int(math.Max(0, math.Ceil(x-0.5-r)))
+	y0 = int(math.Max(0, math.Ceil(y-0.5-r)))
+	x1 = int(math.Min(float64(f.Width-1), math.Floor(x-0.5+r)))
+	y1 = int(math.Min(float64(f.Height-1), math.Floor(y-0.5+r)))
+
+	return x0, y0, x1, y1
+}
+
+// AddSample splats the color of a sample taken at x,y (in raster space) into the film
+func (f *Film) AddSample(x, y float64, clr Color) {
+	x0, y0, x1, y1 := f.pixelRange(x, y)
+
+	for py := y0; py <= y1; py++ {
+		f.rowLocks[py].Lock()
+		for px := x0; px <= x1; px++ {
+			weight := f.filter.Evaluate(x-float64(px)-0.5, y-float64(py)-0.5)
+			if weight == 0 {
+				continue
+			}
+			p := &f.pixels[py*f.Width+px]
+			p.sum = p.sum.Add(clr.Scale(weight))
+			p.weight += weight
+		}
+		f.rowLocks[py].Unlock()
+	}
+}
+
+// pixel returns the color of a pixel, the caller must hold the row lock
+func (f *Film) pixel(x, y int) Color {
+	p := f.pixels[y*f.Width+x]
+	if p.weight == 0 {
+		return Black()
+	}
+	clr := p.sum.Scale(1 / p.weight)
+
+	// every sample splats (on average) 1 / (number of pixels) of its light into each pixel
+	if samples := atomic.LoadInt64(&f.samples); samples > 0 {
+		clr = clr.Add(f.splats[y*f.Width+x].Scale(float64(f.Width*f.Height) / float64(samples)))
+	}
+
+	// filters with negative lobes can push colors outside of [0, 1]
+	return clr.Clamp()
+}
+
+// Pixel returns the reconstructed color of the pixel at x,y
+func (f *Film) Pixel(x, y int) Color {
+	f.rowLocks[y].Lock()
+	defer f.rowLocks[y].Unlock()
+
+	return f.pixel(x, y)
+}
+
+// Resolve writes the reconstructed pixels in the given (inclusive) range into the canvas
+func (f *Film) Resolve(canvas *Canvas, x0, y0, x1, y1 int) {
+	x0, y0 = int(math.Max(0, float64(x0))), int(math.Max(0, float64(y0)))
+	x1, y1 = int(math.Min(float64(f.Width-1), float64(x1))), int(math.Min(float64(f.Height-1), float64(y1)))
+
+	for y := y0; y <= y1; y++ {
+		// hold the lock while writing into the canvas, otherwise a stale value could overwrite a newer one
+		f.rowLocks[y].Lock()
+		for x := x0; x <= x1; x++ {
+			// There is a race condition here, as canvas is also read by the GPU
+			// Only true when using GPU to display the render live.
+			canvas.Set(x, y, f.pixel(x, y))
+		}
+		f.rowLocks[y].Unlock()
+	}
+}
+
+// ResolveAll writes all the reconstructed pixels into the canvas
+func (f *Film) ResolveAll(canvas *Canvas) {
+	f.Resolve(canvas, 0, 0, f.Width-1, f.Height-1)
+}
+
+// ResolvePixel writes all pixels that samples taken inside pixel x,y could have contributed to into the canvas
+func (f *Film) ResolvePixel(canvas *Canvas, x, y int) {
+	r := int(math.Ceil(f.filter.Radius()))
+	f.Resolve(canvas, x-r, y-r, x+r, y+r)
+}
+
+// AddPixelSample adds a sample taken at x,y (in raster space) inside pixel px,py to the film
+// Unlike AddSample, this also keeps track of the number of samples and the noise in the pixel
+func (f *Film) AddPixelSample(px, py int, x, y float64, clr Color) {
+	f.AddSample(x, y, clr)
+	atomic.AddInt64(&f.samples, 1)
+
+	f.rowLocks[py].Lock()
+	defer f.rowLocks[py].Unlock()
+
+	f.stats[py*f.Width+px].add(clr)
+}
+
+// AddSplat adds light arriving at x,y (in raster space) that was not sampled from a pixel
+// Splats are not filtered, they go into the pixel containing x,y.
+func (f *Film) AddSplat(x, y float64, clr Color) {
+	px, py := int(x), int(y)
+	if x < 0 || y < 0 || px >= f.Width || py >= f.Height {
+		return
+	}
+
+	f.rowLocks[py].Lock()
+	defer f.rowLocks[py].Unlock()
+
+	i := py*f.Width + px
+	f.splats[i] = f.splats[i].Add(clr)
+}
+
+// Stats returns the statistics of the samples taken inside pixel x,y
+func (f *Film) Stats(x, y int) sampleStats {
+	f.rowLocks[y].Lock()
+	defer f.rowLocks[y].Unlock()
+
+	return f.stats[y*f.Width+x]
+}
+
+// SampleCount returns the number of samples taken inside pixel x,y
+func (f *Film) SampleCount(x, y int) int {
+	return f.Stats(x, y).n
+}
+
+// MaxRelativeError returns the relative error of the noisiest pixel
+func (f *Film) MaxRelativeError() float64 {
+	return f.maxRelativeError(nil)
+}
+
+// maxRelativeError returns the relative error of the noisiest pixel of the region, nil for the whole film
+// Pixels outside the region are not part of the render, they would never converge.
+func (f *Film) maxRelativeError(r *region) float64 {
+	x0, y0, x1, y1 := 0, 0, f.Width, f.Height
+	if r != nil {
+		x0, y0, x1, y1 = r.x0, r.y0, r.x1, r.y1
+	}
+
+	max := 0.0
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			if r != nil && !r.contains(x, y) {
+				continue
+			}
+			stats := f.Stats(x, y)
+			max = math.Max(max, stats.relativeError())
+		}
+	}
+	return max
+}
+
+// converged returns true if every pixel of the region has converged, nil for the whole film
+func (f *Film) converged(r *region, wc *WorldConfig) bool {
+	x0, y0, x1, y1 := 0, 0, f.Width, f.Height
+	if r != nil {
+		x0, y0, x1, y1 = r.x0, r.y0, r.x1, r.y1
+	}
+
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			if r != nil && !r.contains(x, y) {
+				continue
+			}
+			if stats := f.Stats(x, y); !stats.converged(wc) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Heatmap returns a canvas showing how many samples were taken in each pixel
+// Pixels with the fewest samples are blue, pixels with the most are red
+func (f *Film) Heatmap() *Canvas {
+	canvas := NewCanvas(f.Width, f.Height)
+	// the colors are for display, not light
+	canvas.Encoding = ColorEncodingLinear
+
+	min, max := math.MaxInt32, 0
+	for y := 0; y < f.Height; y++ {
+		for x := 0; x < f.Width; x++ {
+			n := f.SampleCount(x, y)
+			if n < min {
+				min = n
+			}
+			if n > max {
+				max = n
+			}
+		}
+	}
+
+	for y := 0; y < f.Height; y++ {
+		for x := 0; x < f.Width; x++ {
+			t := 0.0
+			if max > min {
+				t = float64(f.SampleCount(x, y)-min) / float64(max-min)
+			}
+			// hue goes from blue (240) to red (0)
+			clr := colorful.Hsv(240*(1-t), 1, 1)
+			canvas.Set(x, y, NewColor(clr.R, clr.G, clr.B))
+		}
+	}
+
+	return canvas
+}
@@ -0,0 +1,122 @@
+package tracer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilm_AddSample(t *testing.T) {
+	type sample struct {
+		x, y float64
+		clr  Color
+	}
+	tests := []struct {
+		name    string
+		film    *Film
+		samples []sample
+		want    map[[2]int]Color
+	}{
+		{
+			name: "box filter averages pixel",
+			film: NewFilm(3, 3, NewBoxFilter(0.5)),
+			samples: []sample{
+				{x: 1.25, y: 1.25, clr: NewColor(1, 0, 0)},
+				{x: 1.75, y: 1.25, clr: NewColor(0, 1, 0)},
+				{x: 1.25, y: 1.75, clr: NewColor(0, 0, 1)},
+				{x: 1.75, y: 1.75, clr: NewColor(1, 1, 1)},
+			},
+			want: map[[2]int]Color{
+				{1, 1}: Colors{NewColor(1, 0, 0), NewColor(0, 1, 0), NewColor(0, 0, 1), NewColor(1, 1, 1)}.Average(),
+				{0, 1}: Black(),
+				{2, 1}: Black(),
+			},
+		},
+		{
+			name: "tent filter spreads into neighbours",
+			film: NewFilm(3, 3, NewTentFilter(1.5)),
+			samples: []sample{
+				{x: 1.5, y: 1.5, clr: NewColor(1, 1, 1)},
+			},
+			want: map[[2]int]Color{
+				{1, 1}: NewColor(1, 1, 1),
+				{0, 0}: NewColor(1, 1, 1),
+				{2, 1}: NewColor(1, 1, 1),
+			},
+		},
+		{
+			name: "tent filter weighs by distance",
+			film: NewFilm(3, 1, NewTentFilter(1.5)),
+			samples: []sample{
+				{x: 0.5, y: 0.5, clr: NewColor(1, 1, 1)},
+				{x: 2.5, y: 0.5, clr: NewColor(0, 0, 0)},
+			},
+			want: map[[2]int]Color{
+				{0, 0}: NewColor(1, 1, 1),
+				{1, 0}: NewColor(0.5, 0.5, 0.5),
+				{2, 0}: NewColor(0, 0, 0),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, s := range tt.samples {
+				tt.film.AddSample(s.x, s.y, s.clr)
+			}
+
+			for p, want := range tt.want {
+				assert.True(t, want.Equal(tt.film.Pixel(p[0], p[1])), "should equal")
+			}
+		})
+	}
+}
+
+func TestFilm_Resolve(t *testing.T) {
+	film := NewFilm(4, 4, NewBoxFilter(0.5))
+	canvas := NewCanvas(4, 4)
+
+	film.AddSample(2.5, 3.5, NewColor(0.5, 0.25, 1))
+	film.ResolveAll(canvas)
+
+	got, err := canvas.Get(2, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, NewColor(0.5, 0.25, 1), got, "should equal")
+
+	got, err = canvas.Get(1, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, Black(), got, "should equal")
+}
+
+func TestFilm_Heatmap(t *testing.T) {
+	film := NewFilm(2, 1, NewBoxFilter(0.5))
+	film.AddPixelSample(0, 0, 0.5, 0.5, White())
+	for i := 0; i < 16; i++ {
+		film.AddPixelSample(1, 0, 1.5, 0.5, White())
+	}
+
+	heatmap := film.Heatmap()
+
+	least, err := heatmap.Get(0, 0)
+	assert.NoError(t, err)
+	assert.True(t, NewColor(0, 0, 1).Equal(least), "should be blue")
+
+	most, err := heatmap.Get(1, 0)
+	assert.NoError(t, err)
+	assert.True(t, NewColor(1, 0, 0).Equal(most), "should be red")
+}
+
+func TestFilm_AddSplat(t *testing.T) {
+	film := NewFilm(2, 2, NewBoxFilter(0.5))
+	for py := 0; py < 2; py++ {
+		for px := 0; px < 2; px++ {
+			film.AddPixelSample(px, py, float64(px)+0.5, float64(py)+0.5, NewColor(0.1, 0.1, 0.1))
+		}
+	}
+	film.AddSplat(1.2, 0.7, NewColor(0.2, 0, 0))
+	film.AddSplat(-1, 0.5, White())
+	film.AddSplat(2, 0.5, White())
+
+	// 4 samples, so each splat is worth 4 / 4 times its color
+	assert.True(t, NewColor(0.3, 0.1, 0.1).Equal(film.Pixel(1, 0)), "should equal")
+	assert.True(t, NewColor(0.1, 0.1, 0.1).Equal(film.Pixel(0, 0)), "should equal")
+}
@@ -0,0 +1,172 @@
+package tracer
+
+import (
+	"math"
+)
+
+// Filter is a pixel reconstruction filter, it weighs each sample by its distance from the pixel center
+// Filters with a radius larger than 0.5 spread a sample over the neighbouring pixels as well
+type Filter interface {
+	// Radius returns how far (in pixels) from the pixel center the filter extends
+	Radius() float64
+
+	// Evaluate returns the weight of a sample at offset (x, y) from the pixel center
+	Evaluate(x, y float64) float64
+}
+
+// BoxFilter weighs all samples within its radius equally
+// With a radius of 0.5 this is the same as averaging all the samples in the pixel
+type BoxFilter struct {
+	radius float64
+}
+
+// NewBoxFilter returns a new box filter
+func NewBoxFilter(radius float64) *BoxFilter {
+	return &BoxFilter{radius: radius}
+}
+
+// Radius implements the Filter interface
+func (f *BoxFilter) Radius() float64 {
+	return f.radius
+}
+
+// Evaluate implements the Filter interface
+func (f *BoxFilter) Evaluate(x, y float64) float64 {
+	// half open, so that a sample on the border of two pixels only counts towards one of them
+	if x < -f.radius || x >= f.radius || y < -f.radius || y >= f.radius {
+		return 0
+	}
+	return 1
+}
+
+// TentFilter (triangle filter) falls off linearly from the pixel center
+type TentFilter struct {
+	radius float64
+}
+
+// NewTentFilter returns a new tent filter
+func NewTentFilter(radius float64) *TentFilter {
+	return &TentFilter{radius: radius}
+}
+
+// Radius implements the Filter interface
+func (f *TentFilter) Radius() float64 {
+	return f.radius
+}
+
+// Evaluate implements the Filter interface
+func (f *TentFilter) Evaluate(x, y float64) float64 {
+	return math.Max(0, 1-math.Abs(x)/f.radius) * math.Max(0, 1-math.Abs(y)/f.radius)
+}
+
+// GaussianFilter weighs samples using a gaussian bump
+// The gaussian is shifted down so that it reaches 0 at the radius
+type GaussianFilter struct {
+	radius float64
+	// alpha controls the falloff, smaller values give a wider bump
+	alpha float64
+	// value of the gaussian at the radius
+	expR float64
+}
+
+// NewGaussianFilter returns a new gaussian filter, alpha controls the rate of falloff (2 is a good value)
+func NewGaussianFilter(radius, alpha float64) *GaussianFilter {
+	return &GaussianFilter{
+		radius: radius,
+		alpha:  alpha,
+		expR:   math.Exp(-alpha * radius * radius),
+	}
+}
+
+// Radius implements the Filter interface
+func (f *GaussianFilter) Radius() float64 {
+	return f.radius
+}
+
+// gaussian returns the 1D value of the filter
+func (f *GaussianFilter) gaussian(d float64) float64 {
+	return math.Max(0, math.Exp(-f.alpha*d*d)-f.expR)
+}
+
+// Evaluate implements the Filter interface
+func (f *GaussianFilter) Evaluate(x, y float64) float64 {
+	return f.gaussian(x) * f.gaussian(y)
+}
+
+// MitchellFilter implements the Mitchell-Netravali filter
+// B and C control the shape, B = C = 1/3 is the recommended default
+// This filter has negative lobes, so it sharpens edges (and might ring)
+type MitchellFilter struct {
+	radius float64
+	b, c   float64
+}
+
+// NewMitchellFilter returns a new Mitchell-Netravali filter
+func NewMitchellFilter(radius, b, c float64) *MitchellFilter {
+	return &MitchellFilter{
+		radius: radius,
+		b:      b,
+		c:      c,
+	}
+}
+
+// Radius implements the Filter interface
+func (f *MitchellFilter) Radius() float64 {
+	return f.radius
+}
+
+// mitchell returns the 1D value of the filter, x is in [-1, 1]
+func (f *MitchellFilter) mitchell(x float64) float64 {
+	x = math.Abs(2 * x)
+	b, c := f.b, f.c
+
+	switch {
+	case x > 2:
+		return 0
+	case x > 1:
+		return ((-b-6*c)*x*x*x + (6*b+30*c)*x*x + (-12*b-48*c)*x + (8*b + 24*c)) / 6
+	default:
+		return ((12-9*b-6*c)*x*x*x + (-18+12*b+6*c)*x*x + (6 - 2*b)) / 6
+	}
+}
+
+// Evaluate implements the Filter interface
+func (f *MitchellFilter) Evaluate(x, y float64) float64 {
+	return f.mitchell(x/f.radius) * f.mitchell(y/f.radius)
+}
+
+// LanczosFilter implements a Lanczos windowed sinc filter, the window is the same size as the radius
+type LanczosFilter struct {
+	radius float64
+}
+
+// NewLanczosFilter returns a new Lanczos filter
+func NewLanczosFilter(radius float64) *LanczosFilter {
+	return &LanczosFilter{radius: radius}
+}
+
+// Radius implements the Filter interface
+func (f *LanczosFilter) Radius() float64 {
+	return f.radius
+}
+
+// sinc returns the normalized sinc function
+func sinc(x float64) float64 {
+	if math.Abs(x) < 1e-5 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// lanczos returns the 1D value of the filter
+func (f *LanczosFilter) lanczos(x float64) float64 {
+	if math.Abs(x) >= f.radius {
+		return 0
+	}
+	return sinc(x) * sinc(x/f.radius)
+}
+
+// Evaluate implements the Filter interface
+func (f *LanczosFilter) Evaluate(x, y float64) float64 {
+	return f.lanczos(x) * f.lanczos(y)
+}
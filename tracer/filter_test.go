@@ -0,0 +1,115 @@
+package tracer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilter_Evaluate(t *testing.T) {
+	type args struct {
+		x, y float64
+	}
+	tests := []struct {
+		name   string
+		filter Filter
+		args   args
+		want   float64
+	}{
+		{
+			name:   "box center",
+			filter: NewBoxFilter(0.5),
+			args:   args{x: 0, y: 0},
+			want:   1,
+		},
+		{
+			name:   "box inside",
+			filter: NewBoxFilter(0.5),
+			args:   args{x: -0.5, y: 0.49},
+			want:   1,
+		},
+		{
+			name:   "box border",
+			filter: NewBoxFilter(0.5),
+			args:   args{x: 0.5, y: 0},
+			want:   0,
+		},
+		{
+			name:   "tent center",
+			filter: NewTentFilter(1),
+			args:   args{x: 0, y: 0},
+			want:   1,
+		},
+		{
+			name:   "tent half",
+			filter: NewTentFilter(1),
+			args:   args{x: 0.5, y: 0},
+			want:   0.5,
+		},
+		{
+			name:   "tent quarter",
+			filter: NewTentFilter(1),
+			args:   args{x: 0.5, y: -0.5},
+			want:   0.25,
+		},
+		{
+			name:   "tent outside",
+			filter: NewTentFilter(1),
+			args:   args{x: 1.5, y: 0},
+			want:   0,
+		},
+		{
+			name:   "gaussian radius",
+			filter: NewGaussianFilter(1.5, 2),
+			args:   args{x: 1.5, y: 0},
+			want:   0,
+		},
+		{
+			name:   "mitchell center",
+			filter: NewMitchellFilter(2, 1.0/3, 1.0/3),
+			args:   args{x: 0, y: 0},
+			want:   (8.0 / 9) * (8.0 / 9),
+		},
+		{
+			name:   "mitchell outside",
+			filter: NewMitchellFilter(2, 1.0/3, 1.0/3),
+			args:   args{x: 2.5, y: 0},
+			want:   0,
+		},
+		{
+			name:   "lanczos center",
+			filter: NewLanczosFilter(3),
+			args:   args{x: 0, y: 0},
+			want:   1,
+		},
+		{
+			name:   "lanczos zero crossing",
+			filter: NewLanczosFilter(3),
+			args:   args{x: 1, y: 0},
+			want:   0,
+		},
+		{
+			name:   "lanczos outside",
+			filter: NewLanczosFilter(3),
+			args:   args{x: 0, y: 3},
+			want:   0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.InDelta(t, tt.want, tt.filter.Evaluate(tt.args.x, tt.args.y), 0.00001, "should equal")
+		})
+	}
+}
+
+func TestGaussianFilter_Falloff(t *testing.T) {
+	f := NewGaussianFilter(2, 2)
+
+	center := f.Evaluate(0, 0)
+	near := f.Evaluate(0.5, 0)
+	far := f.Evaluate(1.5, 0)
+
+	assert.True(t, center > near, "center should weigh more than near")
+	assert.True(t, near > far, "near should weigh more than far")
+	assert.True(t, far > 0, "far should still be positive")
+}
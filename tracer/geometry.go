@@ -23,6 +23,8 @@ type Shaper interface {
 
 	IntersectWith(Ray, Intersections) Intersections
 	NormalAt(Point, *Intersection) Vector
+	// UVAt returns the surface (texture) coordinates of the point (world space), the intersection is optional
+	UVAt(Point, *Intersection) (float64, float64)
 	PrecomputeValues()
 
 	Material() *Material
@@ -134,7 +136,7 @@ func (s *Shape) NormalAt(p Point, xs *Intersection) Vector {
 	on := s.lna(op, xs)
 
 	// Apply any material perturbations to the normal
-	on = s.Material().PerturbNormal(on, op)
+	on = s.Material().perturbNormalAt(on, op, xs)
 
 	// world normal
 	wn := on.NormalToWorldSpace(s)
@@ -142,6 +144,11 @@ func (s *Shape) NormalAt(p Point, xs *Intersection) Vector {
 	return wn.Normalize()
 }
 
+// UVAt implements the Shaper interface
+func (s *Shape) UVAt(p Point, xs *Intersection) (float64, float64) {
+	panic("must implement UVAt")
+}
+
 // localNormalAt returns the local normal vector at the point
 func (s *Shape) localNormalAt(p Point, xs *Intersection) Vector {
 	panic("must implement localNormalAt")
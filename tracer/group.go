@@ -152,6 +152,11 @@ func (g *Group) NormalAt(p Point, xs *Intersection) Vector {
 	panic("called NormalAt on a group")
 }
 
+// UVAt is unused here, rays hit the members of the group
+func (g *Group) UVAt(p Point, xs *Intersection) (float64, float64) {
+	panic("called UVAt on a group")
+}
+
 func (g *Group) boundBoxFromBoundingBoxes(boxes []Bound) Bound {
 
 	if len(boxes) <= 0 {
@@ -0,0 +1,146 @@
+package tracer
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// Integrator computes the color seen along a camera ray
+// Integrators only use the Shaper, Light and Material interfaces, so they can be swapped without touching those.
+type Integrator interface {
+	// Preprocess is called once before rendering starts, after the world is set up
+	Preprocess(w *World)
+
+	// Li returns the color (radiance) arriving at the origin of the ray
+	Li(w *World, r Ray, xs Intersections, rng *rand.Rand) Color
+}
+
+// integrators lists the integrators that can be selected by name
+var integrators = map[string]func() Integrator{
+	"whitted":      func() Integrator { return NewWhittedIntegrator() },
+	"ao":           func() Integrator { return NewAmbientOcclusionIntegrator(16, 0) },
+	"path":         func() Integrator { return NewPathTracerIntegrator(16) },
+	"bdpt":         func() Integrator { return NewBDPTIntegrator(8) },
+	"normals":      func() Integrator { return NewDebugIntegrator(DebugNormals) },
+	"uvs":          func() Integrator { return NewDebugIntegrator(DebugUVs) },
+	"depth":        func() Integrator { return NewDebugIntegrator(DebugDepth) },
+	"barycentrics": func() Integrator { return NewDebugIntegrator(DebugBarycentrics) },
+	"materials":    func() Integrator { return NewDebugIntegrator(DebugMaterialIDs) },
+}
+
+// NewIntegrator returns the integrator with the given name, using default settings
+func NewIntegrator(name string) (Integrator, error) {
+	f, ok := integrators[name]
+	if !ok {
+		var names []string
+		for n := range integrators {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown integrator %q, valid integrators: %v", name, strings.Join(names, ", "))
+	}
+	return f(), nil
+}
+
+// WhittedIntegrator is the classic recursive ray tracer
+// Direct lighting from all lights plus perfect reflection and refraction, up to Config.MaxRecusions bounces.
+// If Config.CausticPhotons is set, photon maps are built before rendering and add caustics (and, with
+// Config.GlobalPhotons, indirect light) at diffuse surfaces.
+type WhittedIntegrator struct{}
+
+// NewWhittedIntegrator returns a new Whitted integrator
+func NewWhittedIntegrator() *WhittedIntegrator {
+	return &WhittedIntegrator{}
+}
+
+// Preprocess implements the Integrator interface
+func (wi *WhittedIntegrator) Preprocess(w *World) {
+	w.photons = w.buildPhotonMaps()
+}
+
+// Li implements the Integrator interface
+func (wi *WhittedIntegrator) Li(w *World, r Ray, xs Intersections, rng *rand.Rand) Color {
+	return w.ColorAt(r, w.Config.MaxRecusions, xs, rng)
+}
+
+// AmbientOcclusionIntegrator shades each point by how much of the hemisphere above it is not blocked by other objects
+// Lights and materials are ignored.
+type AmbientOcclusionIntegrator struct {
+	// Samples is the number of rays cast into the hemisphere at each hit
+	Samples int
+
+	// MaxDistance ignores occluders further away than this, 0 means no limit
+	MaxDistance float64
+}
+
+// NewAmbientOcclusionIntegrator returns a new ambient occlusion integrator
+func NewAmbientOcclusionIntegrator(samples int, maxDistance float64) *AmbientOcclusionIntegrator {
+	return &AmbientOcclusionIntegrator{
+		Samples:     samples,
+		MaxDistance: maxDistance,
+	}
+}
+
+// Preprocess implements the Integrator interface
+func (ao *AmbientOcclusionIntegrator) Preprocess(w *World) {}
+
+// Li implements the Integrator interface
+func (ao *AmbientOcclusionIntegrator) Li(w *World, r Ray, xs Intersections, rng *rand.Rand) Color {
+	xs = w.Intersections(r, xs)
+	hit, err := xs.Hit()
+	if err != nil {
+		return Black()
+	}
+	state := PrepareComputations(hit, r, xs)
+
+	maxDistance := ao.MaxDistance
+	if maxDistance <= 0 {
+		maxDistance = math.Inf(1)
+	}
+
+	// cosine weighted samples, so the fraction of unblocked rays is the cosine weighted visibility
+	basis := newONB(state.NormalV)
+	open := 0
+	for i := 0; i < ao.Samples; i++ {
+		dir := basis.local(cosineSampleHemisphere(rng))
+		if !w.isOccluded(NewRay(state.OverPoint, dir), maxDistance, xs[:0]) {
+			open++
+		}
+	}
+
+	return White().Scale(float64(open) / float64(ao.Samples))
+}
+
+// isOccluded returns true if the ray hits a shadow casting object closer than maxDistance
+func (w *World) isOccluded(r Ray, maxDistance float64, xs Intersections) bool {
+	// intersections are sorted
+	for _, it := range w.Intersections(r, xs) {
+		if it.t >= 0 {
+			if it.t < maxDistance && it.Object().Material().ShadowCaster {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// walkShapes calls f on every shape in the list, including the members of groups, meshes and CSGs
+func walkShapes(shapes []Shaper, f func(Shaper)) {
+	for _, s := range shapes {
+		f(s)
+
+		switch s := s.(type) {
+		case *Group:
+			walkShapes(s.Members(), f)
+		case *TriangleMesh:
+			for _, t := range s.Triangles {
+				walkShapes([]Shaper{t}, f)
+			}
+		case *CSG:
+			walkShapes([]Shaper{s.left, s.right}, f)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package tracer
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewIntegrator(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Integrator
+		wantErr bool
+	}{
+		{
+			name: "whitted",
+			want: NewWhittedIntegrator(),
+		},
+		{
+			name: "ao",
+			want: NewAmbientOcclusionIntegrator(16, 0),
+		},
+		{
+			name: "bdpt",
+			want: NewBDPTIntegrator(8),
+		},
+		{
+			name: "depth",
+			want: NewDebugIntegrator(DebugDepth),
+		},
+		{
+			name:    "unknown",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewIntegrator(tt.name)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got, "should equal")
+		})
+	}
+}
+
+func TestWhittedIntegrator_Li(t *testing.T) {
+	w := NewDefaultTestWorld()
+	r := NewRay(NewPoint(0, 0, -5), NewVector(0, 0, 1))
+	rng := rand.New(rand.NewSource(1))
+
+	want := w.ColorAt(r, w.Config.MaxRecusions, NewIntersections(), rng)
+	got := NewWhittedIntegrator().Li(w, r, NewIntersections(), rng)
+	assert.Equal(t, want, got, "should equal")
+}
+
+func TestAmbientOcclusionIntegrator_Li(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxDistance float64
+		ceiling     bool
+		want        float64
+	}{
+		{
+			name: "open sky",
+			want: 1,
+		},
+		{
+			name:    "under a ceiling",
+			ceiling: true,
+			want:    0,
+		},
+		{
+			name:        "ceiling too far away",
+			maxDistance: 0.5,
+			ceiling:     true,
+			want:        1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := NewWorld(NewWorldConfig())
+			w.AddObject(NewPlane())
+			if tt.ceiling {
+				ceiling := NewPlane()
+				ceiling.SetTransform(IM().Translate(0, 1, 0))
+				w.AddObject(ceiling)
+			}
+
+			ao := NewAmbientOcclusionIntegrator(32, tt.maxDistance)
+			ao.Preprocess(w)
+
+			// looking straight down from just below the ceiling
+			r := NewRay(NewPoint(0, 0.9, 0), NewVector(0, -1, 0))
+			got := ao.Li(w, r, NewIntersections(), rand.New(rand.NewSource(1)))
+			assert.Equal(t, White().Scale(tt.want), got, "should equal")
+		})
+	}
+}
+
+func TestDebugIntegrator_Li(t *testing.T) {
+	sphere := NewUnitSphere()
+	tri := NewSmoothTriangle(
+		NewPoint(0, 1, 3), NewPoint(-1, 0, 3), NewPoint(1, 0, 3),
+		NewVector(0, 0, -1), NewVector(0, 0, -1), NewVector(0, 0, -1),
+		NewPoint(0, 1, 0), NewPoint(0, 0, 0), NewPoint(1, 0, 0))
+
+	tests := []struct {
+		name   string
+		mode   DebugMode
+		object Shaper
+		ray    Ray
+		want   Color
+	}{
+		{
+			name:   "normals",
+			mode:   DebugNormals,
+			object: sphere,
+			ray:    NewRay(NewPoint(0, 0, -5), NewVector(0, 0, 1)),
+			want:   NewColor(0.5, 0.5, 0),
+		},
+		{
+			name:   "depth",
+			mode:   DebugDepth,
+			object: sphere,
+			ray:    NewRay(NewPoint(0, 0, -5), NewVector(0, 0, 1)),
+			want:   White().Scale(1 - 4.0/100),
+		},
+		{
+			name:   "depth miss",
+			mode:   DebugDepth,
+			object: sphere,
+			ray:    NewRay(NewPoint(0, 5, -5), NewVector(0, 0, 1)),
+			want:   Black(),
+		},
+		{
+			name:   "barycentrics",
+			mode:   DebugBarycentrics,
+			object: tri,
+			ray:    NewRay(NewPoint(0, 0.5, 0), NewVector(0, 0, 1)),
+			want:   NewColor(0.5, 0.25, 0.25),
+		},
+		{
+			name:   "barycentrics not a triangle",
+			mode:   DebugBarycentrics,
+			object: sphere,
+			ray:    NewRay(NewPoint(0, 0, -5), NewVector(0, 0, 1)),
+			want:   Black(),
+		},
+		{
+			name:   "uvs",
+			mode:   DebugUVs,
+			object: tri,
+			ray:    NewRay(NewPoint(0, 0.5, 0), NewVector(0, 0, 1)),
+			want:   NewColor(0.25, 0.5, 0),
+		},
+		{
+			name:   "uvs sphere",
+			mode:   DebugUVs,
+			object: sphere,
+			ray:    NewRay(NewPoint(0, 0, -5), NewVector(0, 0, 1)),
+			want:   NewColor(1, 0.5, 0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := NewWorld(NewWorldConfig())
+			w.AddObject(tt.object)
+
+			di := NewDebugIntegrator(tt.mode)
+			di.Preprocess(w)
+
+			got := di.Li(w, tt.ray, NewIntersections(), rand.New(rand.NewSource(1)))
+			assert.True(t, tt.want.Equal(got), "%v should equal %v", got, tt.want)
+		})
+	}
+}
+
+func TestDebugIntegrator_MaterialIDs(t *testing.T) {
+	w := NewWorld(NewWorldConfig())
+
+	left := NewUnitSphere()
+	left.SetTransform(IM().Translate(-2, 0, 0))
+	right := NewUnitSphere()
+	right.SetTransform(IM().Translate(2, 0, 0))
+	right.SetMaterial(left.Material())
+
+	g := NewGroup()
+	middle := NewUnitSphere()
+	g.AddMember(middle)
+
+	w.AddObject(left)
+	w.AddObject(right)
+	w.AddObject(g)
+	w.PrecomputeValues()
+
+	di := NewDebugIntegrator(DebugMaterialIDs)
+	di.Preprocess(w)
+
+	colorAt := func(x float64) Color {
+		return di.Li(w, NewRay(NewPoint(x, 0, -5), NewVector(0, 0, 1)), NewIntersections(), nil)
+	}
+
+	assert.Equal(t, colorAt(-2), colorAt(2), "same material should have the same color")
+	assert.NotEqual(t, colorAt(-2), colorAt(0), "different materials should have different colors")
+	assert.NotEqual(t, Black(), colorAt(0), "group members should have a material id")
+}
+
+func TestWorld_RenderIntegrator(t *testing.T) {
+	w, camera := smallTestWorld()
+	w.Config.Integrator = NewDebugIntegrator(DebugNormals)
+
+	canvas := NewCanvas(11, 11)
+	w.Render(camera, canvas)
+
+	got, err := canvas.Get(5, 5)
+	assert.NoError(t, err)
+	assert.True(t, NewColor(0.5, 0.5, 0).Equal(got), "should equal")
+}
@@ -99,7 +99,23 @@ type IntersectionState struct {
 	OverPoint, UnderPoint Point   // offset to properly render shadows and refraction due to floating point errors
 	ReflectV              Vector  // reflection vector
 	N1, N2                float64 // RefractiveIndex of (n1) leaving material and (n2) entering material
-	U, V                  float64 // u,v values for where the intersection occured
+	U, V                  float64 // surface (texture) coordinates of the intersection, see Shaper.UVAt
+
+	// DuDx, DvDx, DuDy, DvDy are the changes of U and V from one pixel to the next, zero if the ray had no differentials
+	DuDx, DvDx, DuDy, DvDy float64
+
+	// Medium is the object the ray travelled through to reach the hit, nil if it didn't start inside any object
+	Medium Shaper
+	// Distance is the distance from the ray origin to the hit
+	Distance float64
+	// Wavelength of the ray in spectral mode, 0 for RGB rays
+	Wavelength float64
+
+	// mat is the material of Object evaluated at the hit, see material()
+	mat *Material
+
+	// differentials is the footprint of the hit, nil if the ray had no differentials
+	differentials *surfaceDifferentials
 }
 
 func objectInList(o Shaper, list []Shaper) bool {
@@ -134,7 +150,9 @@ func delObjectFromList(o Shaper, list []Shaper) []Shaper {
 }
 
 // findRefractiveIndexes returns the refractive indexes of leaving material and entering material
-func findRefractiveIndexes(hit *Intersection, xs Intersections) (n1, n2 float64) {
+// medium is the object the ray travelled through to reach the hit (the one being left), nil if there is none.
+// wavelength is the wavelength of the ray in spectral mode (0 for RGB rays), for materials with a Dispersion.
+func findRefractiveIndexes(hit *Intersection, xs Intersections, wavelength float64) (n1, n2 float64, medium Shaper) {
 	var containers []Shaper
 
 	for _, i := range xs {
@@ -142,7 +160,8 @@ func findRefractiveIndexes(hit *Intersection, xs Intersections) (n1, n2 float64)
 			if len(containers) == 0 {
 				n1 = 1.0
 			} else {
-				n1 = containers[len(containers)-1].Material().RefractiveIndex
+				medium = containers[len(containers)-1]
+				n1 = medium.Material().ior(wavelength)
 			}
 		}
 
@@ -156,13 +175,13 @@ func findRefractiveIndexes(hit *Intersection, xs Intersections) (n1, n2 float64)
 			if len(containers) == 0 {
 				n2 = 1.0
 			} else {
-				n2 = containers[len(containers)-1].Material().RefractiveIndex
+				n2 = containers[len(containers)-1].Material().ior(wavelength)
 			}
-			return n1, n2
+			return n1, n2, medium
 		}
 	}
 
-	return n1, n2
+	return n1, n2, medium
 }
 
 // PrepareComputations prepopulates the IntersectionState structure
@@ -185,9 +204,10 @@ func PrepareComputations(hit *Intersection, r Ray, xs Intersections) *Intersecti
 	overPoint := point.AddVector(normalvScaled)
 	underPoint := point.SubVector(normalvScaled)
 	reflectv := r.Dir.Reflect(normalv)
-	n1, n2 = findRefractiveIndexes(hit, xs)
+	n1, n2, medium := findRefractiveIndexes(hit, xs, r.Wavelength)
+	u, v := object.UVAt(point, hit)
 
-	return &IntersectionState{
+	state := &IntersectionState{
 		T:          hit.T(),
 		Object:     object,
 		Point:      point,
@@ -199,9 +219,24 @@ func PrepareComputations(hit *Intersection, r Ray, xs Intersections) *Intersecti
 		ReflectV:   reflectv,
 		N1:         n1,
 		N2:         n2,
-		U:          hit.u,
-		V:          hit.v,
+		U:          u,
+		V:          v,
+		Medium:     medium,
+		Distance:   hit.T() * r.Dir.Magnitude(),
+		Wavelength: r.Wavelength,
+	}
+	if r.Differentials != nil {
+		state.differentiate(r)
+	}
+	return state
+}
+
+// transmittance returns the fraction of light that makes it from the hit back to the ray origin through the medium
+func (s *IntersectionState) transmittance() Color {
+	if s.Medium == nil {
+		return White()
 	}
+	return s.Medium.Material().transmittance(s.Distance, s.Wavelength)
 }
 
 // Schlick returns the reflectance - the fraction of light that is reflected [0,1]
@@ -215,42 +215,50 @@ func Test_findRefractiveIndexes(t *testing.T) {
 		wantN1 float64
 		wantN2 float64
 		index  int
+		// wantMedium is the object the ray travelled through: 0 for none, or glass1, glass2, glass3
+		wantMedium int
 	}{
 		{
-			name:   "test1",
-			index:  0,
-			wantN1: 1.0,
-			wantN2: 1.5,
+			name:       "test1",
+			index:      0,
+			wantMedium: 0,
+			wantN1:     1.0,
+			wantN2:     1.5,
 		},
 		{
-			name:   "test2",
-			index:  1,
-			wantN1: 1.5,
-			wantN2: 2.0,
+			name:       "test2",
+			index:      1,
+			wantMedium: 1,
+			wantN1:     1.5,
+			wantN2:     2.0,
 		},
 		{
-			name:   "test3",
-			index:  2,
-			wantN1: 2.0,
-			wantN2: 2.5,
+			name:       "test3",
+			index:      2,
+			wantMedium: 2,
+			wantN1:     2.0,
+			wantN2:     2.5,
 		},
 		{
-			name:   "test4",
-			index:  3,
-			wantN1: 2.5,
-			wantN2: 2.5,
+			name:       "test4",
+			index:      3,
+			wantMedium: 3,
+			wantN1:     2.5,
+			wantN2:     2.5,
 		},
 		{
-			name:   "test5",
-			index:  4,
-			wantN1: 2.5,
-			wantN2: 1.5,
+			name:       "test5",
+			index:      4,
+			wantMedium: 3,
+			wantN1:     2.5,
+			wantN2:     1.5,
 		},
 		{
-			name:   "test6",
-			index:  5,
-			wantN1: 1.5,
-			wantN2: 1.0,
+			name:       "test6",
+			index:      5,
+			wantMedium: 1,
+			wantN1:     1.5,
+			wantN2:     1.0,
 		},
 	}
 	for _, tt := range tests {
@@ -281,9 +289,10 @@ func Test_findRefractiveIndexes(t *testing.T) {
 				NewIntersection(glass1, 6),
 			)
 
-			n1, n2 := findRefractiveIndexes(xs[tt.index], xs)
+			n1, n2, medium := findRefractiveIndexes(xs[tt.index], xs, 0)
 			assert.Equal(t, tt.wantN1, n1, "should equal")
 			assert.Equal(t, tt.wantN2, n2, "should equal")
+			assert.Equal(t, []Shaper{nil, glass1, glass2, glass3}[tt.wantMedium], medium, "should equal")
 		})
 	}
 }
@@ -1,7 +1,6 @@
 package tracer
 
 import (
-	"log"
 	"math"
 	"math/rand"
 
@@ -247,27 +246,9 @@ func (l *SpotLight) Angle() float64 {
 }
 
 // lighting returns the color for a given point
-func lighting(m *Material, o Shaper, p Point, l Light, eye, normal Vector, intensity float64, rays int, u, v float64, rng *rand.Rand) Color {
+func lighting(m *Material, o Shaper, p Point, l Light, eye, normal Vector, intensity float64, rays int, tc texCoords, rng *rand.Rand) Color {
 	var ambient, diffuse, specular Color
-	clr := m.Color
-
-	if m.HasPattern() {
-		clr = clr.Blend(m.Pattern.ColorAtObject(o, p))
-	}
-
-	if m.HasTexture() {
-		// Texture blends with the base color, so pass it in here
-		// - Kd - material diffuse is multiplied by the texture value
-		// This is only used by Smooth Triangles, to apply textures to other shapes,
-		// use the ImageTexturePattern
-		// Awkward... consider fixing
-		switch o.(type) {
-		case *SmoothTriangle:
-			clr = clr.Blend(m.ColorAtTexture(o, u, v))
-		default:
-			log.Fatal("Texture attached to non Smooth Triangle, use an ImagePattern instead.")
-		}
-	}
+	clr := m.surfaceColor(o, p, tc)
 
 	// combine surface color with light's color/intensity
 	effectiveColor := clr.Blend(l.Intensity())
@@ -338,8 +319,17 @@ func lighting(m *Material, o Shaper, p Point, l Light, eye, normal Vector, inten
 		}
 
 		if visible {
-			// compute the diffuse contribution
-			diffuse = effectiveColor.Scale(m.Diffuse).Scale(lightDotNormal)
+			// compute the diffuse contribution, metals have none
+			diffuse = effectiveColor.Scale(m.Diffuse * (1 - m.Metallic)).Scale(lightDotNormal)
+			// clear coat and sheen of principled materials
+			diffuse = diffuse.Add(m.principledHighlight(eye, normal, lightv).Blend(l.Intensity()))
+
+			// rough materials use the microfacet highlight
+			if d := m.microfacet(); d != nil {
+				specular = m.highlight(d, clr, eye, normal, lightv).Blend(l.Intensity()).Scale(m.Specular)
+				sum = sum.Add(diffuse).Add(specular)
+				continue
+			}
 
 			// reflectDotEye represens the cosine of the angle between the relfection vector and the eye vector
 			// a negative number means the light reflects away from the eye
@@ -361,5 +351,5 @@ func lighting(m *Material, o Shaper, p Point, l Light, eye, normal Vector, inten
 
 // ColorAtPoint returns the clamped color at the given point
 func ColorAtPoint(m *Material, o Shaper, p Point, l Light, eye, normal Vector, inShadow float64, rng *rand.Rand) Color {
-	return lighting(m, o, p, l, eye, normal, inShadow, 1, 0, 0, rng).Clamp()
+	return lighting(m, o, p, l, eye, normal, inShadow, 1, texCoords{}, rng).Clamp()
 }
@@ -138,7 +138,7 @@ func Test_lighting(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := lighting(tt.args.m, tt.o, tt.args.p, tt.args.l, tt.args.eye, tt.args.normal, tt.args.inShadow, 1, 0, 0, rand.New(rand.NewSource(time.Now().Unix())))
+			got := lighting(tt.args.m, tt.o, tt.args.p, tt.args.l, tt.args.eye, tt.args.normal, tt.args.inShadow, 1, texCoords{}, rand.New(rand.NewSource(time.Now().Unix())))
 			diff := cmp.Diff(tt.want, got)
 			assert.Equal(t, "", fmt.Sprint(diff))
 		})
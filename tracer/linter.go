@@ -13,6 +13,7 @@ func (w *World) LintWorld() {
 	}
 
 	w.lintLights(w.Lights)
+	w.lintConfig()
 	log.Println()
 }
 
@@ -36,6 +37,30 @@ func lintMaterial(m *Material, o Shaper) {
 			log.Printf("[warning] Object [%v] has Transparency and ShadowCaster set.", o.Name())
 		}
 	}
+
+	// Absorption checks
+	if m.AbsorptionDensity > 0 && m.Transparency == 0 {
+		log.Printf("[warning] Object [%v] has AbsorptionDensity but no Transparency, no light gets inside.", o.Name())
+	}
+
+	// Subsurface checks
+	if m.Subsurface != nil && m.Transparency > 0 {
+		log.Printf("[warning] Object [%v] has Subsurface and Transparency, the path tracer ignores Transparency.", o.Name())
+	}
+
+	// Microfacet checks
+	if m.Roughness < 0 || m.Roughness > 1 {
+		log.Printf("[warning] Object [%v] has Roughness outside [0, 1].", o.Name())
+	}
+	if m.Anisotropy < 0 || m.Anisotropy > 1 {
+		log.Printf("[warning] Object [%v] has Anisotropy outside [0, 1].", o.Name())
+	}
+	if m.Metallic < 0 || m.Metallic > 1 {
+		log.Printf("[warning] Object [%v] has Metallic outside [0, 1].", o.Name())
+	}
+	if m.Conductor != nil && m.Metallic == 0 {
+		log.Printf("[warning] Object [%v] has a Conductor but no Metallic, the conductor is not used.", o.Name())
+	}
 }
 
 func (w *World) lintLights(lights []Light) {
@@ -57,3 +82,39 @@ func (w *World) lintLights(lights []Light) {
 	}
 
 }
+
+func (w *World) lintConfig() {
+	if w.Config.Integrator == nil {
+		log.Printf("[warning] No integrator set, using the Whitted integrator.")
+	}
+	if w.Config.Progressive {
+		if w.Config.CheckpointFile != "" || w.Config.ResumeFile != "" {
+			log.Printf("[warning] Checkpointing is not supported for progressive renders, ignoring.")
+		}
+	}
+	if w.Config.CausticPhotons > 0 {
+		if _, ok := w.Config.Integrator.(*WhittedIntegrator); !ok && w.Config.Integrator != nil {
+			log.Printf("[warning] Photon mapping is only used by the Whitted integrator, ignoring.")
+		}
+		if w.Config.PhotonGatherRadius <= 0 {
+			log.Printf("[warning] PhotonGatherRadius is not positive, no photons will be gathered.")
+		}
+		if w.Config.Progressive {
+			log.Printf("[warning] Progressive passes reuse the photon maps, their noise won't average out; raise CausticPhotons instead.")
+		}
+	}
+	if w.Config.Spectral && !w.spectral() && w.Config.Integrator != nil {
+		log.Printf("[warning] Spectral mode is only used by the Whitted and path tracer integrators, ignoring.")
+	}
+	if w.Config.GlobalPhotons > 0 && w.Config.CausticPhotons <= 0 {
+		log.Printf("[warning] GlobalPhotons is set but CausticPhotons is not, photon mapping is disabled.")
+	}
+	if w.Config.AdaptiveSampling {
+		if w.Config.AdaptiveMaxSamples < w.Config.AdaptiveMinSamples {
+			log.Printf("[warning] AdaptiveMaxSamples is smaller than AdaptiveMinSamples, pixels will stop at AdaptiveMinSamples.")
+		}
+		if w.Config.AdaptiveThreshold <= 0 {
+			log.Printf("[warning] AdaptiveThreshold is not positive, every pixel will use AdaptiveMaxSamples.")
+		}
+	}
+}
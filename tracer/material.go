@@ -2,30 +2,94 @@ package tracer
 
 import (
 	"image"
-	"log"
 	"math"
 
 	"golang.org/x/image/colornames"
 )
 
+// MaterialParam is a parameter of the material that can be driven by a MaterialMap
+type MaterialParam int
+
+const (
+	// MaterialColor is the color, the map is blended with it (and with Pattern and Texture)
+	MaterialColor MaterialParam = iota
+	// MaterialAmbient is Ambient
+	MaterialAmbient
+	// MaterialDiffuse is Diffuse
+	MaterialDiffuse
+	// MaterialSpecular is Specular
+	MaterialSpecular
+	// MaterialShininess is Shininess
+	MaterialShininess
+	// MaterialReflective is Reflective
+	MaterialReflective
+	// MaterialTransparency is Transparency
+	MaterialTransparency
+	// MaterialRoughness is Roughness
+	MaterialRoughness
+	// MaterialAnisotropy is Anisotropy
+	MaterialAnisotropy
+	// MaterialMetallic is Metallic
+	MaterialMetallic
+	// MaterialEmissive is Emissive, the map is blended with it
+	MaterialEmissive
+)
+
 // Material is a material to apply to shapes
 type Material struct {
 	Color                                                                            Color
 	Pattern                                                                          Patterner
 	Ambient, Diffuse, Specular, Shininess, Reflective, Transparency, RefractiveIndex float64
 
+	// Dispersion makes RefractiveIndex depend on the wavelength in spectral mode (see Config.Spectral)
+	Dispersion Dispersion
+
+	// Roughness makes reflections, refractions and highlights glossy, using the GGX microfacet model
+	// 0 keeps perfect mirror reflection and refraction and the Phong highlight.
+	Roughness float64
+
+	// Anisotropy (0-1) stretches glossy reflections along the tangent of the surface
+	Anisotropy float64
+
+	// Metallic turns the material into a conductor: all light is reflected (as if Reflective was 1), tinted by
+	// Color, and there is no diffuse part. Values between 0 and 1 blend between a dielectric and a conductor.
+	Metallic float64
+
+	// Conductor replaces the tint of the metallic part with the exact Fresnel reflectance of a metal, see Conductor
+	Conductor *Conductor
+
+	// Absorption is the color white light turns into after travelling a distance of 1 inside the material, with an
+	// AbsorptionDensity of 1. Light is absorbed following the Beer–Lambert law, a density of 0 absorbs nothing.
+	Absorption        Color
+	AbsorptionDensity float64
+
+	// Subsurface makes the material translucent, light entering it scatters inside (path tracer only)
+	Subsurface *Subsurface
+
 	// This material emits light
 	Emissive Color
 
 	// Some objects should not cast shadows (e.g. water in a pond)
 	ShadowCaster bool
 
-	// Some materials have textures associated with them, this is an image file read in and stored as a canvas
-	Texture *Canvas
+	// Some materials have textures associated with them, this is an image file read in and stored as a canvas, looked up
+	// by the sampler
+	Texture *TextureSampler
 
 	// Used to apply perturbations to the material (changes in the normal vector)
 	// Use this for BumpMaps
 	perturber Perturber
+
+	// Maps drive the parameters with patterns and textures, evaluated at every hit, see SetMap
+	// Maps multiply the parameters, so a parameter that is 0 (e.g. Emissive) stays 0. Only the value at the hit
+	// changes: ShadowCaster, RefractiveIndex and the search for emissive shapes use the parameters as they are.
+	Maps map[MaterialParam]*MaterialMap
+
+	// Principled replaces the Phong parameters with a principled material, evaluated at every hit
+	Principled *PrincipledMaterial
+
+	// set when a principled material is evaluated at a hit
+	principledLobes
 }
 
 // NewMaterial returns a new material
@@ -85,46 +149,94 @@ func (m *Material) PerturbNormal(normal Vector, p Point) Vector {
 	return normal
 }
 
-// ColorAtTexture returns the color at the u,v point based on the texture attached to the material
-// Only works for SmoothTriangles, used during obj import
-func (m *Material) ColorAtTexture(o Shaper, u, v float64) Color {
-	if m.Texture == nil {
-		return ColorName(colornames.Purple) // highly visible, texture emissing
+// perturbNormalAt applies the material perturbation function to the normal n at point p (object space) of the hit xs,
+// perturbers that work in tangent space are given the texture coordinates and the tangent frame of the shape
+// Shapes without a tangent frame, and points without a hit, keep their normal.
+func (m *Material) perturbNormalAt(n Vector, p Point, xs *Intersection) Vector {
+	tp, ok := m.perturber.(tangentSpacePerturber)
+	if !ok {
+		return m.PerturbNormal(n, p)
+	}
+	if xs == nil {
+		return n
 	}
+	ts, ok := xs.Object().(tangentShaper)
+	if !ok {
+		return n
+	}
+	u, v, t, b := ts.tangentsAt(p, n, xs)
+	return tp.perturbTangentSpace(n, t, b, u, v)
+}
 
-	t := o.(*SmoothTriangle)
+// surfaceColor returns the color of the material at point p (world space) on the object, including patterns and textures
+// tc are the surface coordinates of the hit, used by textures
+func (m *Material) surfaceColor(o Shaper, p Point, tc texCoords) Color {
+	clr := m.Color
 
-	w := 1 - u - v
-	x := (u*t.VT2.x + v*t.VT3.x + w*t.VT1.x) * float64((m.Texture.Width - 1))
-	y := (u*t.VT2.y + v*t.VT3.y + w*t.VT1.y) * float64((m.Texture.Height - 1))
+	if m.HasPattern() {
+		clr = clr.Blend(m.Pattern.ColorAtObject(o, p))
+	}
 
-	// wrap textures around if needed
-	if x < 0 {
-		x = float64(m.Texture.Width-1) + math.Mod(x, float64(m.Texture.Width-1))
+	if m.HasTexture() {
+		// Texture blends with the base color, so pass it in here
+		// - Kd - material diffuse is multiplied by the texture value
+		clr = clr.Blend(m.Texture.sampleAt(tc))
 	}
-	if y < 0 {
-		y = float64(m.Texture.Height-1) + math.Mod(y, float64(m.Texture.Height-1))
+	return clr
+}
+
+// usesTextures returns true if the texture, a map or the principled material of m samples a texture
+func (m *Material) usesTextures() bool {
+	if m.HasTexture() {
+		return true
 	}
+	for _, mm := range m.Maps {
+		if mm.Texture != nil {
+			return true
+		}
+	}
+	if m.Principled != nil {
+		for _, mm := range m.Principled.Maps {
+			if mm.Texture != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
 
-	clr, err := m.Texture.Get(int(x), int(y))
-	if err != nil {
-		log.Println(err)
-		return ColorName(colornames.Purple) // highly visible, texture missing
+// ColorAtTexture returns the color at the u,v point based on the texture attached to the material
+// u, v are the surface coordinates of the hit, see Shaper.UVAt
+func (m *Material) ColorAtTexture(u, v float64) Color {
+	if m.Texture == nil {
+		return ColorName(colornames.Purple) // highly visible, texture emissing
 	}
 
-	return clr
+	return m.Texture.Sample(u, v)
 }
 
-// AddDiffuseTexture adds a texture mapped to a Canvas
+// AddDiffuseTexture adds a texture of the image
 func (m *Material) AddDiffuseTexture(name string, i image.Image) error {
-	log.Println("converting image (texture) to canvas...")
-	canvas := imageToCanvas(i)
-
-	m.Texture = canvas
+	m.Texture = NewTextureSampler(NewImageTexture(i, ColorEncodingSRGB))
 
 	return nil
 }
 
+// transmittance returns the fraction of light (per channel) left after travelling distance inside the material
+// wavelength is the wavelength of the ray in spectral mode, 0 for RGB rays.
+func (m *Material) transmittance(distance, wavelength float64) Color {
+	if m.AbsorptionDensity <= 0 {
+		return White()
+	}
+	absorption := m.Absorption
+	if wavelength > 0 {
+		absorption = upsampleReflectance(absorption, wavelength)
+	}
+
+	d := m.AbsorptionDensity * distance
+	return NewColor(math.Pow(absorption.R, d), math.Pow(absorption.G, d), math.Pow(absorption.B, d))
+}
+
 // HasPattern returns true if a material has a pattern attached to it
 func (m *Material) HasPattern() bool {
 	return m.Pattern != nil
@@ -145,6 +257,77 @@ func (m *Material) SetPerturber(p Perturber) {
 	m.perturber = p
 }
 
+// SetMap drives the parameter with the map, nil removes the map
+func (m *Material) SetMap(param MaterialParam, mm *MaterialMap) {
+	if mm == nil {
+		delete(m.Maps, param)
+		return
+	}
+	if m.Maps == nil {
+		m.Maps = make(map[MaterialParam]*MaterialMap)
+	}
+	m.Maps[param] = mm
+}
+
+// scalar returns the scalar parameter driven by param, nil for color parameters
+func (m *Material) scalar(param MaterialParam) *float64 {
+	switch param {
+	case MaterialAmbient:
+		return &m.Ambient
+	case MaterialDiffuse:
+		return &m.Diffuse
+	case MaterialSpecular:
+		return &m.Specular
+	case MaterialShininess:
+		return &m.Shininess
+	case MaterialReflective:
+		return &m.Reflective
+	case MaterialTransparency:
+		return &m.Transparency
+	case MaterialRoughness:
+		return &m.Roughness
+	case MaterialAnisotropy:
+		return &m.Anisotropy
+	case MaterialMetallic:
+		return &m.Metallic
+	}
+	return nil
+}
+
+// resolveMaps returns the material with its maps evaluated at the hit
+func (m *Material) resolveMaps(state *IntersectionState) *Material {
+	o, p, tc := state.Object, state.Point, state.texCoords()
+
+	r := *m
+	r.Maps = nil
+	for param, mm := range m.Maps {
+		switch param {
+		case MaterialColor:
+			r.Color = r.Color.Blend(mm.colorAt(o, p, tc))
+		case MaterialEmissive:
+			r.Emissive = r.Emissive.Blend(mm.colorAt(o, p, tc))
+		default:
+			if v := r.scalar(param); v != nil {
+				*v *= mm.valueAt(o, p, tc)
+			}
+		}
+	}
+	return &r
+}
+
+// equalMaps returns true if a and b drive the same parameters with the same maps
+func equalMaps(a, b map[MaterialParam]*MaterialMap) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for param, mm := range a {
+		if b[param] != mm {
+			return false
+		}
+	}
+	return true
+}
+
 // Equals return true if the materials are the same
 func (m *Material) Equals(m2 *Material) bool {
 	return m.Color.Equal(m2.Color) &&
@@ -156,8 +339,18 @@ func (m *Material) Equals(m2 *Material) bool {
 		m.Reflective == m2.Reflective &&
 		m.Transparency == m2.Transparency &&
 		m.RefractiveIndex == m2.RefractiveIndex &&
+		m.Roughness == m2.Roughness &&
+		m.Anisotropy == m2.Anisotropy &&
+		m.Metallic == m2.Metallic &&
+		m.Dispersion == m2.Dispersion &&
 		m.Emissive.Equal(m2.Emissive) &&
+		m.Absorption.Equal(m2.Absorption) &&
+		m.AbsorptionDensity == m2.AbsorptionDensity &&
+		m.Subsurface == m2.Subsurface &&
 		m.ShadowCaster == m2.ShadowCaster &&
 		m.Texture == m2.Texture &&
-		m.perturber == m2.perturber
+		m.perturber == m2.perturber &&
+		equalMaps(m.Maps, m2.Maps) &&
+		m.Principled == m2.Principled &&
+		m.Conductor == m2.Conductor
 }
@@ -120,3 +120,175 @@ func TestNewDefaultMaterial(t *testing.T) {
 		})
 	}
 }
+
+func TestMaterial_Equals(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(m *Material)
+	}{
+		{
+			name:   "roughness",
+			change: func(m *Material) { m.Roughness = 0.5 },
+		},
+		{
+			name:   "anisotropy",
+			change: func(m *Material) { m.Anisotropy = 0.5 },
+		},
+		{
+			name:   "metallic",
+			change: func(m *Material) { m.Metallic = 1 },
+		},
+	}
+
+	assert.True(t, NewDefaultMaterial().Equals(NewDefaultMaterial()), "should be equal")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewDefaultMaterial()
+			tt.change(m)
+			assert.False(t, NewDefaultMaterial().Equals(m), "should not be equal")
+		})
+	}
+}
+
+func TestMaterial_Transmittance(t *testing.T) {
+	tests := []struct {
+		name     string
+		clr      Color
+		density  float64
+		distance float64
+		want     Color
+	}{
+		{
+			name:     "no density",
+			clr:      NewColor(0.5, 0.5, 0.5),
+			distance: 10,
+			want:     White(),
+		},
+		{
+			name:     "unit distance",
+			clr:      NewColor(0.9, 0.5, 0.1),
+			density:  1,
+			distance: 1,
+			want:     NewColor(0.9, 0.5, 0.1),
+		},
+		{
+			name:     "twice the distance",
+			clr:      NewColor(0.9, 0.5, 0.1),
+			density:  1,
+			distance: 2,
+			want:     NewColor(0.81, 0.25, 0.01),
+		},
+		{
+			name:     "density scales the distance",
+			clr:      NewColor(0.9, 0.5, 0.1),
+			density:  0.5,
+			distance: 4,
+			want:     NewColor(0.81, 0.25, 0.01),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewDefaultGlassMaterial()
+			m.Absorption = tt.clr
+			m.AbsorptionDensity = tt.density
+			assert.True(t, tt.want.Equal(m.transmittance(tt.distance, 0)), "should equal")
+		})
+	}
+}
+
+func TestMaterial_TextureOnAnyShape(t *testing.T) {
+	texture := NewCanvas(2, 2)
+	texture.Set(0, 0, NewColor(1, 0, 0))
+	texture.Set(1, 0, White())
+	texture.Set(0, 1, NewColor(0, 0, 1))
+	texture.Set(1, 1, NewColor(0, 1, 0))
+
+	s := NewUnitSphere()
+	s.Material().Texture = NewTextureSampler(NewCanvasTexture(texture))
+	s.Material().Texture.Filter = TextureFilterNearest
+	s.Material().Texture.SetWrap(WrapClamp)
+	g := NewGroup()
+	g.SetTransform(IM().Translate(0, 0, 5))
+	g.AddMember(s)
+
+	// the front of the sphere has u = 1, v = 0.5
+	r := NewRay(NewPoint(0, 0, -5), NewVector(0, 0, 1))
+	xs := g.IntersectWith(r, NewIntersections())
+	state := PrepareComputations(xs[0], r, xs)
+
+	got := s.Material().surfaceColor(state.Object, state.Point, state.texCoords())
+	assert.Equal(t, NewColor(0, 1, 0), got, "should equal")
+}
+
+func TestMaterial_Maps(t *testing.T) {
+	// stripes alternate at x = 1, the point is in the second stripe
+	stripes := func(c Color) *MaterialMap {
+		return NewPatternMap(NewStripedPattern(White(), c), ChannelLuminance)
+	}
+
+	tests := []struct {
+		name  string
+		param MaterialParam
+		mm    *MaterialMap
+		check func(t *testing.T, m *Material)
+	}{
+		{
+			name:  "color",
+			param: MaterialColor,
+			mm:    stripes(NewColor(1, 0, 0)),
+			check: func(t *testing.T, m *Material) {
+				assert.Equal(t, NewColor(1, 0, 0), m.Color, "should equal")
+			},
+		},
+		{
+			name:  "reflective",
+			param: MaterialReflective,
+			mm:    NewPatternMap(NewStripedPattern(White(), NewColor(0.5, 0, 0)), ChannelR),
+			check: func(t *testing.T, m *Material) {
+				assert.Equal(t, 0.25, m.Reflective, "should equal")
+			},
+		},
+		{
+			name:  "shininess",
+			param: MaterialShininess,
+			mm:    stripes(Black()),
+			check: func(t *testing.T, m *Material) {
+				assert.Equal(t, 0.0, m.Shininess, "should equal")
+				assert.Equal(t, 0.9, m.Specular, "other parameters are kept")
+			},
+		},
+		{
+			name:  "emissive",
+			param: MaterialEmissive,
+			mm:    stripes(NewColor(0, 1, 0)),
+			check: func(t *testing.T, m *Material) {
+				assert.Equal(t, NewColor(0, 2, 0), m.Emissive, "should equal")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewDefaultMaterial()
+			m.Reflective = 0.5
+			m.Emissive = NewColor(2, 2, 2)
+			m.SetMap(tt.param, tt.mm)
+
+			s := NewUnitSphere()
+			s.SetMaterial(m)
+			state := &IntersectionState{Object: s, Point: NewPoint(1.5, 0, -1)}
+			got := state.material()
+			tt.check(t, got)
+			assert.Nil(t, got.Maps, "resolved materials have no maps")
+
+			// the material itself doesn't change
+			assert.Equal(t, 0.5, m.Reflective, "should equal")
+			assert.Equal(t, NewColor(2, 2, 2), m.Emissive, "should equal")
+
+			m.SetMap(tt.param, nil)
+			assert.Empty(t, m.Maps, "should be removed")
+		})
+	}
+}
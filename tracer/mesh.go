@@ -95,7 +95,7 @@ func NewMesh(numFaces int, faceIndex, vertexIndex, normalIndex, textureIndex, ma
 			ni[l+2] = normalIndex[k+j+2]
 
 			ti[l] = textureIndex[k]
-			ti[l+1] = normalIndex[k+j+1]
+			ti[l+1] = textureIndex[k+j+1]
 			ti[l+2] = textureIndex[k+j+2]
 
 			l = l + 3
@@ -129,6 +129,7 @@ func NewMesh(numFaces int, faceIndex, vertexIndex, normalIndex, textureIndex, ma
 
 		tris[i] = tri
 	}
+	smoothTangents(tris)
 
 	m := &TriangleMesh{
 		V: v, // used to construct bounding box
@@ -218,6 +219,11 @@ func (m *TriangleMesh) NormalAt(p Point, xs *Intersection) Vector {
 	panic("called NormalAt on a mesh")
 }
 
+// UVAt is unused here, rays hit the triangles of the mesh
+func (m *TriangleMesh) UVAt(p Point, xs *Intersection) (float64, float64) {
+	panic("called UVAt on a mesh")
+}
+
 // PrecomputeValues precomputes some values for render speedup
 func (m *TriangleMesh) PrecomputeValues() {
 }
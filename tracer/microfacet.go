@@ -0,0 +1,240 @@
+package tracer
+
+import (
+	"math"
+	"math/rand"
+)
+
+// ggx is the GGX (Trowbridge-Reitz) microfacet distribution, with height correlated Smith masking
+// Rough surfaces are made of tiny perfect mirrors, the distribution describes how their normals are spread around the
+// surface normal. Directions are in the local shading frame, where the normal is +z.
+type ggx struct {
+	// alphaX and alphaY are the widths of the distribution along the tangent and the bitangent
+	alphaX, alphaY float64
+}
+
+// newGGX returns a new distribution with the given roughness (0 is a perfect mirror, 1 is very rough)
+// anisotropy (0-1) stretches the distribution along the tangent, the mapping is the one used by the Disney BRDF.
+func newGGX(roughness, anisotropy float64) *ggx {
+	alpha := math.Max(roughness*roughness, 1e-4)
+	aspect := math.Sqrt(1 - 0.9*anisotropy)
+
+	return &ggx{
+		alphaX: math.Max(alpha/aspect, 1e-4),
+		alphaY: math.Max(alpha*aspect, 1e-4),
+	}
+}
+
+// d returns the density of microfacets with normal m
+func (d *ggx) d(m Vector) float64 {
+	if m.z <= 0 {
+		return 0
+	}
+	x, y := m.x/d.alphaX, m.y/d.alphaY
+	t := x*x + y*y + m.z*m.z
+
+	return 1 / (math.Pi * d.alphaX * d.alphaY * t * t)
+}
+
+// lambda is the Smith auxiliary function for direction w
+func (d *ggx) lambda(w Vector) float64 {
+	if w.z == 0 {
+		return math.Inf(1)
+	}
+	x, y := w.x*d.alphaX, w.y*d.alphaY
+
+	return (-1 + math.Sqrt(1+(x*x+y*y)/(w.z*w.z))) / 2
+}
+
+// g1 returns the fraction of microfacets visible from direction w
+func (d *ggx) g1(w Vector) float64 {
+	return 1 / (1 + d.lambda(w))
+}
+
+// g returns the fraction of microfacets visible from both directions
+func (d *ggx) g(wo, wi Vector) float64 {
+	return 1 / (1 + d.lambda(wo) + d.lambda(wi))
+}
+
+// sampleVisible returns a microfacet normal seen from wo (which must be above the surface)
+// Only visible normals are sampled, see "Sampling the GGX Distribution of Visible Normals" (Heitz 2018).
+func (d *ggx) sampleVisible(wo Vector, rng *rand.Rand) Vector {
+	// stretch to the hemisphere configuration
+	vh := NewVector(d.alphaX*wo.x, d.alphaY*wo.y, wo.z).Normalize()
+
+	t1 := NewVector(1, 0, 0)
+	if lensq := vh.x*vh.x + vh.y*vh.y; lensq > 0 {
+		t1 = NewVector(-vh.y, vh.x, 0).Scale(1 / math.Sqrt(lensq))
+	}
+	t2 := vh.Cross(t1)
+
+	// uniform point on the projected disc
+	r := math.Sqrt(rng.Float64())
+	phi := 2 * math.Pi * rng.Float64()
+	p1, p2 := r*math.Cos(phi), r*math.Sin(phi)
+	s := 0.5 * (1 + vh.z)
+	p2 = (1-s)*math.Sqrt(1-p1*p1) + s*p2
+
+	nh := t1.Scale(p1).AddVector(t2.Scale(p2)).AddVector(vh.Scale(math.Sqrt(math.Max(0, 1-p1*p1-p2*p2))))
+
+	// unstretch
+	return NewVector(d.alphaX*nh.x, d.alphaY*nh.y, math.Max(1e-6, nh.z)).Normalize()
+}
+
+// pdfVisible returns the density of sampleVisible returning m
+func (d *ggx) pdfVisible(wo, m Vector) float64 {
+	if wo.z == 0 {
+		return 0
+	}
+	return d.g1(wo) * math.Max(0, wo.Dot(m)) * d.d(m) / math.Abs(wo.z)
+}
+
+// toLocal converts the world space vector v into the basis
+func (b onb) toLocal(v Vector) Vector {
+	return NewVector(v.Dot(b.u), v.Dot(b.v), v.Dot(b.w))
+}
+
+// reflect returns wo (pointing away from the surface) mirrored around m
+func reflect(wo, m Vector) Vector {
+	return m.Scale(2 * wo.Dot(m)).SubVector(wo)
+}
+
+// refract returns wo (pointing away from the surface) refracted through a surface with normal m, on the same side as
+// wo, eta is the ratio of the refractive indexes on the side of wo and the other side
+// ok is false on total internal reflection.
+func refract(wo, m Vector, eta float64) (wi Vector, ok bool) {
+	cosi := wo.Dot(m)
+	sin2t := eta * eta * (1 - cosi*cosi)
+	if sin2t > 1 {
+		return Vector{}, false
+	}
+
+	cost := math.Sqrt(1.0 - sin2t)
+	return m.Scale(eta*cosi - cost).SubVector(wo.Scale(eta)), true
+}
+
+// schlickColor returns the reflectance of a conductor with reflectance f0 at normal incidence
+func schlickColor(f0 Color, cos float64) Color {
+	x := math.Pow(1-math.Max(0, math.Min(1, cos)), 5)
+	return f0.Add(White().Sub(f0).Scale(x))
+}
+
+// microfacet returns the GGX distribution of the material, nil if the material is perfectly smooth
+func (m *Material) microfacet() *ggx {
+	if m.Roughness <= 0 {
+		return nil
+	}
+	return newGGX(m.Roughness, m.Anisotropy)
+}
+
+// reflectivity returns the weight of (mirror or glossy) reflections, metals reflect all light
+func (m *Material) reflectivity() float64 {
+	return m.Reflective + (1-m.Reflective)*m.Metallic
+}
+
+// reflectionTint returns the color reflections are tinted by, clr is the surface color and cos the cosine of the angle
+// between the eye and the (micro) normal
+// Only metals tint their reflections.
+func (m *Material) reflectionTint(clr Color, cos float64) Color {
+	if m.Metallic == 0 {
+		return White()
+	}
+	tint := m.metalFresnel(clr, cos)
+	return White().Scale(1 - m.Metallic).Add(tint.Scale(m.Metallic))
+}
+
+// highlight returns the GGX highlight of a light in direction lightv, it replaces the Phong highlight on rough materials
+// Like the diffuse part of the Whitted integrator, this is pi * brdf * cos, without falloff.
+func (m *Material) highlight(d *ggx, clr Color, eye, normal, lightv Vector) Color {
+	frame := newONB(normal)
+	wo, wi := frame.toLocal(eye), frame.toLocal(lightv)
+	if wo.z <= 0 || wi.z <= 0 {
+		return Black()
+	}
+	h := wo.AddVector(wi).Normalize()
+
+	// dielectrics reflect a few percent at normal incidence, metals reflect their color
+	cos := wo.Dot(h)
+	f := schlickColor(White().Scale(m.dielectricF0()), cos).Scale(1 - m.Metallic).Add(m.metalFresnel(clr, cos).Scale(m.Metallic))
+
+	brdf := d.d(h) * d.g(wo, wi) / (4 * wo.z * wi.z)
+	return f.Scale(math.Pi * brdf * wi.z)
+}
+
+// dielectricF0 returns the reflectance of the dielectric part of the material at normal incidence
+func (m *Material) dielectricF0() float64 {
+	if m.f0 > 0 {
+		return m.f0
+	}
+	ior := m.RefractiveIndex
+	if ior <= 1 {
+		ior = 1.5
+	}
+	return math.Pow((ior-1)/(ior+1), 2)
+}
+
+// glossyRays returns the number of rays to sample glossy reflections and refractions with
+// Only the first bounce is sampled with Config.GlossyRays, deeper bounces use one ray each.
+func (w *World) glossyRays(remaining int) int {
+	if remaining == w.Config.MaxRecusions && w.Config.GlossyRays > 1 {
+		return w.Config.GlossyRays
+	}
+	return 1
+}
+
+// glossyReflectedColor returns the color reflected by a rough surface, by sampling reflected rays
+func (w *World) glossyReflectedColor(state *IntersectionState, d *ggx, remaining int, xs Intersections, rng *rand.Rand) Color {
+	m := state.material()
+	clr := White()
+	if m.Metallic > 0 {
+		clr = m.surfaceColor(state.Object, state.Point, state.texCoords())
+	}
+
+	frame := newONB(state.NormalV)
+	wo := frame.toLocal(state.EyeV)
+	if wo.z <= 0 {
+		return Black()
+	}
+
+	rays := w.glossyRays(remaining)
+	sum := Black()
+	for i := 0; i < rays; i++ {
+		h := d.sampleVisible(wo, rng)
+		wi := reflect(wo, h)
+		if wi.z <= 0 {
+			continue
+		}
+
+		r := state.ray(state.OverPoint, frame.local(wi.x, wi.y, wi.z))
+		weight := d.g(wo, wi) / d.g1(wo)
+		sum = sum.Add(w.ColorAt(r, remaining-1, xs[:0], rng).Blend(m.reflectionTint(clr, wo.Dot(h))).Scale(weight))
+	}
+
+	return sum.Scale(m.reflectivity() / float64(rays))
+}
+
+// glossyRefractedColor returns the color refracted by a rough surface, by sampling refracted rays
+func (w *World) glossyRefractedColor(state *IntersectionState, d *ggx, remaining int, xs Intersections, rng *rand.Rand) Color {
+	frame := newONB(state.NormalV)
+	wo := frame.toLocal(state.EyeV)
+	if wo.z <= 0 {
+		return Black()
+	}
+
+	rays := w.glossyRays(remaining)
+	sum := Black()
+	for i := 0; i < rays; i++ {
+		h := d.sampleVisible(wo, rng)
+		wi, ok := refract(wo, h, state.N1/state.N2)
+		if !ok || wi.z >= 0 {
+			// total internal reflection, same as RefractedColor
+			continue
+		}
+
+		r := state.ray(state.UnderPoint, frame.local(wi.x, wi.y, wi.z))
+		weight := d.g(wo, wi) / d.g1(wo)
+		sum = sum.Add(w.ColorAt(r, remaining-1, xs[:0], rng).Scale(weight))
+	}
+
+	return sum.Scale(state.material().Transparency / float64(rays))
+}
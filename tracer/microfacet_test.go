@@ -0,0 +1,197 @@
+package tracer
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGGX_D(t *testing.T) {
+	tests := []struct {
+		name       string
+		roughness  float64
+		anisotropy float64
+	}{
+		{
+			name:      "smooth",
+			roughness: 0.3,
+		},
+		{
+			name:      "rough",
+			roughness: 0.8,
+		},
+		{
+			name:       "anisotropic",
+			roughness:  0.5,
+			anisotropy: 0.8,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newGGX(tt.roughness, tt.anisotropy)
+			rng := rand.New(rand.NewSource(1))
+
+			// the projected area of the microfacets is the area of the surface
+			n := 400000
+			sum := 0.0
+			for i := 0; i < n; i++ {
+				x, y, z := cosineSampleHemisphere(rng)
+				// pdf is z / pi
+				sum += d.d(NewVector(x, y, z)) * math.Pi
+			}
+			assert.InEpsilon(t, 1, sum/float64(n), 0.03, "should be normalized")
+		})
+	}
+}
+
+func TestGGX_SampleVisible(t *testing.T) {
+	d := newGGX(0.5, 0.5)
+	wo := NewVector(0.5, 0.2, 0.8).Normalize()
+	rng := rand.New(rand.NewSource(1))
+
+	// samples face wo, and the pdf integrates to one
+	n := 200000
+	sum := 0.0
+	for i := 0; i < n; i++ {
+		m := d.sampleVisible(wo, rng)
+		assert.True(t, m.Dot(wo) >= 0, "sampled normals should face wo")
+
+		x, y, z := cosineSampleHemisphere(rng)
+		sum += d.pdfVisible(wo, NewVector(x, y, z)) * math.Pi / z
+	}
+	assert.InEpsilon(t, 1, sum/float64(n), 0.03, "should be normalized")
+}
+
+// roughTestBSDF returns the bsdf where a ray from above hits a rough plane
+func roughTestBSDF(m *Material) *bsdf {
+	plane := NewPlane()
+	plane.SetMaterial(m)
+	r := NewRay(NewPoint(0, 1, -1), NewVector(0, -1, 1).Normalize())
+	xs := NewIntersections(NewIntersection(plane, math.Sqrt2))
+	return newBSDF(PrepareComputations(xs[0], r, xs))
+}
+
+func TestBSDF_Rough(t *testing.T) {
+	tests := []struct {
+		name     string
+		material func() *Material
+	}{
+		{
+			name: "glossy plastic",
+			material: func() *Material {
+				m := NewDefaultMaterial()
+				m.Reflective = 0.5
+				m.Roughness = 0.4
+				return m
+			},
+		},
+		{
+			name: "anisotropic metal",
+			material: func() *Material {
+				m := NewDefaultMaterial()
+				m.Color = NewColor(0.9, 0.6, 0.2)
+				m.Metallic = 1
+				m.Roughness = 0.5
+				m.Anisotropy = 0.7
+				return m
+			},
+		},
+		{
+			name: "principled clear coat and sheen",
+			material: func() *Material {
+				pm := NewPrincipledMaterial()
+				pm.BaseColor = NewColor(0.2, 0.4, 0.8)
+				pm.Clearcoat = 1
+				pm.ClearcoatRoughness = 0.3
+				pm.Sheen = 1
+				return pm.Material()
+			},
+		},
+		{
+			name: "rough glass",
+			material: func() *Material {
+				m := NewDefaultGlassMaterial()
+				m.Diffuse = 0
+				m.Reflective = 1
+				m.Roughness = 0.4
+				return m
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := roughTestBSDF(tt.material())
+			assert.True(t, b.nonSpecular(), "rough materials can sample lights")
+			rng := rand.New(rand.NewSource(1))
+
+			// the light scattered (f * cos) estimated with bsdf sampling and with uniform sampling should match
+			n := 200000
+			sampled, uniform, pdf := Black(), Black(), 0.0
+			for i := 0; i < n; i++ {
+				if s, ok := b.sample(rng); ok {
+					sampled = sampled.Add(s.weight)
+					assert.InEpsilon(t, b.pdf(s.wi), s.pdf, 1e-9, "pdf should match")
+				}
+
+				wi := uniformSampleSphere(rng)
+				uniform = uniform.Add(b.f(wi).Scale(math.Abs(b.n.Dot(wi)) * 4 * math.Pi))
+				pdf += b.pdf(wi) * 4 * math.Pi
+			}
+			sampled, uniform = sampled.Scale(1/float64(n)), uniform.Scale(1/float64(n))
+
+			assert.InEpsilon(t, uniform.R, sampled.R, 0.05, "should converge to the same result")
+			assert.InEpsilon(t, uniform.B, sampled.B, 0.05, "should converge to the same result")
+			assert.True(t, pdf/float64(n) <= 1.02, "pdf should integrate to at most 1")
+		})
+	}
+}
+
+func TestWorld_GlossyReflectedColor(t *testing.T) {
+	// a small roughness is very close to a perfect mirror
+	mirror := func(roughness, metallic float64) Color {
+		w := NewDefaultTestWorld()
+		w.Config.GlossyRays = 32
+		floor := NewPlane()
+		floor.SetTransform(IM().Translate(0, -1, 0))
+		floor.Material().Reflective = 0.5
+		floor.Material().Roughness = roughness
+		floor.Material().Metallic = metallic
+		floor.Material().Color = NewColor(1, 0.5, 0.5)
+		w.AddObject(floor)
+
+		r := NewRay(NewPoint(0, 0, -3), NewVector(0, -math.Sqrt2/2, math.Sqrt2/2))
+		xs := NewIntersections(NewIntersection(floor, math.Sqrt2))
+		state := PrepareComputations(xs[0], r, xs)
+		return w.ReflectedColor(state, w.Config.MaxRecusions, NewIntersections(), rand.New(rand.NewSource(1)))
+	}
+
+	want := mirror(0, 0)
+	got := mirror(0.05, 0)
+	assert.InEpsilon(t, want.R, got.R, 0.02, "should be close to a mirror")
+	assert.InEpsilon(t, want.G, got.G, 0.02, "should be close to a mirror")
+
+	// metals reflect everything, tinted by their color
+	metal := mirror(0, 1)
+	assert.InDelta(t, want.R*2, metal.R, 0.05, "should reflect all light")
+	assert.True(t, metal.G < metal.R, "should be tinted")
+}
+
+func TestMaterial_Highlight(t *testing.T) {
+	m := NewDefaultMaterial()
+	m.Roughness = 0.3
+	d := m.microfacet()
+	normal := NewVector(0, 1, 0)
+	eye := NewVector(0, 1, -1).Normalize()
+
+	got := m.highlight(d, White(), eye, normal, NewVector(0, 1, 1).Normalize())
+	assert.True(t, got.R > 0, "mirror direction should have a highlight")
+
+	got = m.highlight(d, White(), eye, normal, NewVector(0, -1, 1).Normalize())
+	assert.Equal(t, Black(), got, "light below the surface")
+
+	assert.Nil(t, NewDefaultMaterial().microfacet(), "smooth materials have no distribution")
+}
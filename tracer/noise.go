@@ -0,0 +1,204 @@
+package tracer
+
+import (
+	"math"
+	"math/rand"
+)
+
+// PerlinNoise is gradient noise, Ken Perlin's improved noise, with the lattice gradients shuffled by a seed
+// The same seed always gives the same noise.
+type PerlinNoise struct {
+	perm [512]int
+}
+
+// NewPerlinNoise returns new gradient noise for the seed
+func NewPerlinNoise(seed int64) *PerlinNoise {
+	pn := &PerlinNoise{}
+	for i, v := range rand.New(rand.NewSource(seed)).Perm(256) {
+		pn.perm[i], pn.perm[i+256] = v, v
+	}
+	return pn
+}
+
+// Eval3 returns the noise at (x, y, z), about [-1, 1], it is 0 at integer coordinates
+func (pn *PerlinNoise) Eval3(x, y, z float64) float64 {
+	xf, yf, zf := math.Floor(x), math.Floor(y), math.Floor(z)
+	xi, yi, zi := int(xf)&255, int(yf)&255, int(zf)&255
+	x, y, z = x-xf, y-yf, z-zf
+	u, v, w := fade(x), fade(y), fade(z)
+
+	p := pn.perm
+	a := p[xi] + yi
+	aa, ab := p[a]+zi, p[a+1]+zi
+	b := p[xi+1] + yi
+	ba, bb := p[b]+zi, p[b+1]+zi
+
+	return lerp(w,
+		lerp(v,
+			lerp(u, grad(p[aa], x, y, z), grad(p[ba], x-1, y, z)),
+			lerp(u, grad(p[ab], x, y-1, z), grad(p[bb], x-1, y-1, z))),
+		lerp(v,
+			lerp(u, grad(p[aa+1], x, y, z-1), grad(p[ba+1], x-1, y, z-1)),
+			lerp(u, grad(p[ab+1], x, y-1, z-1), grad(p[bb+1], x-1, y-1, z-1))))
+}
+
+// fade is the quintic curve that blends the lattice gradients, its first and second derivatives are 0 at 0 and 1
+func fade(t float64) float64 {
+	return t * t * t * (t*(t*6-15) + 10)
+}
+
+// lerp returns the linear interpolation between a and b
+func lerp(t, a, b float64) float64 {
+	return a + t*(b-a)
+}
+
+// grad returns the dot product of (x, y, z) with one of the 12 gradients (the edges of a cube) picked by hash
+func grad(hash int, x, y, z float64) float64 {
+	h := hash & 15
+	u := y
+	if h < 8 {
+		u = x
+	}
+	v := z
+	switch {
+	case h < 4:
+		v = y
+	case h == 12 || h == 14:
+		v = x
+	}
+	if h&1 != 0 {
+		u = -u
+	}
+	if h&2 != 0 {
+		v = -v
+	}
+	return u + v
+}
+
+// WorleyNoise is cellular noise: the distances to the closest of a set of feature points, one in each unit cell of
+// space, placed by a seed
+type WorleyNoise struct {
+	seed int64
+
+	// Jitter is how far from the center of their cell (in [0, 1]) feature points are, 0 gives a regular grid
+	Jitter float64
+}
+
+// NewWorleyNoise returns new cellular noise for the seed
+func NewWorleyNoise(seed int64) *WorleyNoise {
+	return &WorleyNoise{seed: seed, Jitter: 1}
+}
+
+// Eval3 returns the distances from (x, y, z) to the closest (f1) and second closest (f2) feature points, and id, which
+// is different (and random) for each cell, of the closest one
+func (wn *WorleyNoise) Eval3(x, y, z float64) (f1, f2 float64, id uint64) {
+	cx, cy, cz := int(math.Floor(x)), int(math.Floor(y)), int(math.Floor(z))
+	f1, f2 = math.Inf(1), math.Inf(1)
+
+	for i := cx - 1; i <= cx+1; i++ {
+		for j := cy - 1; j <= cy+1; j++ {
+			for k := cz - 1; k <= cz+1; k++ {
+				h := cellHash(wn.seed, i, j, k)
+				// the feature point, from three more hashes of the cell
+				fx := float64(i) + 0.5 + wn.Jitter*(hashFloat(h)-0.5)
+				fy := float64(j) + 0.5 + wn.Jitter*(hashFloat(splitmix(h))-0.5)
+				fz := float64(k) + 0.5 + wn.Jitter*(hashFloat(splitmix(splitmix(h)))-0.5)
+
+				d := math.Sqrt((x-fx)*(x-fx) + (y-fy)*(y-fy) + (z-fz)*(z-fz))
+				switch {
+				case d < f1:
+					f1, f2, id = d, f1, h
+				case d < f2:
+					f2 = d
+				}
+			}
+		}
+	}
+	return f1, f2, id
+}
+
+// splitmix returns the next value of the splitmix64 generator, a good 64 bit hash
+func splitmix(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// cellHash returns the hash of the cell (i, j, k) for the seed
+func cellHash(seed int64, i, j, k int) uint64 {
+	h := splitmix(uint64(seed))
+	h = splitmix(h ^ uint64(i))
+	h = splitmix(h ^ uint64(j))
+	return splitmix(h ^ uint64(k))
+}
+
+// hashFloat returns the hash h as a number in [0, 1)
+func hashFloat(h uint64) float64 {
+	return float64(h>>11) / (1 << 53)
+}
+
+// Fractal are the settings of noise summed over several octaves, each one at a higher frequency and lower amplitude
+// than the previous one
+type Fractal struct {
+	// Octaves is the number of layers of noise
+	Octaves int
+	// Lacunarity is how much the frequency grows from one octave to the next
+	Lacunarity float64
+	// Gain is how much the amplitude shrinks from one octave to the next
+	Gain float64
+}
+
+// NewFractal returns new fractal settings: 6 octaves, each twice the frequency and half the amplitude of the last
+func NewFractal() Fractal {
+	return Fractal{Octaves: 6, Lacunarity: 2, Gain: 0.5}
+}
+
+// sum returns the sum of f applied to the noise of each octave at p, divided by the sum of the amplitudes
+func (f Fractal) sum(n *PerlinNoise, p Point, fn func(float64) float64) float64 {
+	var total, max float64
+	freq, amp := 1.0, 1.0
+	for i := 0; i < f.Octaves; i++ {
+		total += amp * fn(n.Eval3(p.X()*freq, p.Y()*freq, p.Z()*freq))
+		max += amp
+		freq *= f.Lacunarity
+		amp *= f.Gain
+	}
+	if max == 0 {
+		return 0
+	}
+	return total / max
+}
+
+// FBM returns the fractional Brownian motion of the noise at p, about [-1, 1]
+func (f Fractal) FBM(n *PerlinNoise, p Point) float64 {
+	return f.sum(n, p, func(v float64) float64 { return v })
+}
+
+// Turbulence returns the sum of the absolute values of the noise at p, about [0, 1]
+// The creases where the noise changes sign look like the veins of marble and the billows of smoke.
+func (f Fractal) Turbulence(n *PerlinNoise, p Point) float64 {
+	return f.sum(n, p, math.Abs)
+}
+
+// Ridged returns Musgrave's ridged multifractal of the noise at p, in [0, 1] for offsets up to 1
+// The creases are turned into sharp ridges, and each octave is weighted by the previous one, so the valleys stay
+// smooth while the ridges get more detail, like mountain ranges.
+func (f Fractal) Ridged(n *PerlinNoise, p Point, offset float64) float64 {
+	var total, max float64
+	freq, amp, weight := 1.0, 1.0, 1.0
+	for i := 0; i < f.Octaves; i++ {
+		signal := offset - math.Abs(n.Eval3(p.X()*freq, p.Y()*freq, p.Z()*freq))
+		signal *= signal * weight
+		weight = math.Max(0, math.Min(1, 2*signal))
+
+		total += amp * signal
+		max += amp * offset * offset
+		freq *= f.Lacunarity
+		amp *= f.Gain
+	}
+	if max == 0 {
+		return 0
+	}
+	return total / max
+}
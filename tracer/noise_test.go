@@ -0,0 +1,89 @@
+package tracer
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// randomNoisePoints returns n random points in a 20 unit cube around the origin
+func randomNoisePoints(n int) []Point {
+	rng := rand.New(rand.NewSource(1))
+	var points []Point
+	for i := 0; i < n; i++ {
+		points = append(points, NewPoint(rng.Float64()*20-10, rng.Float64()*20-10, rng.Float64()*20-10))
+	}
+	return points
+}
+
+func TestPerlinNoise(t *testing.T) {
+	n := NewPerlinNoise(1)
+
+	assert.Equal(t, 0.0, n.Eval3(3, -2, 7), "0 on the lattice")
+	assert.Equal(t, n.Eval3(0.3, 1.7, -2.2), NewPerlinNoise(1).Eval3(0.3, 1.7, -2.2), "same seed, same noise")
+	assert.NotEqual(t, n.Eval3(0.3, 1.7, -2.2), NewPerlinNoise(2).Eval3(0.3, 1.7, -2.2), "different seed")
+
+	min, max := 0.0, 0.0
+	for _, p := range randomNoisePoints(5000) {
+		v := n.Eval3(p.X(), p.Y(), p.Z())
+		min, max = math.Min(min, v), math.Max(max, v)
+
+		// continuous
+		assert.InDelta(t, v, n.Eval3(p.X()+1e-6, p.Y(), p.Z()), 1e-4, "should be continuous")
+	}
+	assert.True(t, min >= -1.1 && min < -0.5, "min: %v", min)
+	assert.True(t, max <= 1.1 && max > 0.5, "max: %v", max)
+}
+
+func TestWorleyNoise(t *testing.T) {
+	n := NewWorleyNoise(1)
+
+	for _, p := range randomNoisePoints(1000) {
+		f1, f2, id := n.Eval3(p.X(), p.Y(), p.Z())
+		assert.True(t, f1 <= f2, "f1 is the closest")
+		// the feature point of the cell of p is at most the diagonal of a cell away
+		assert.True(t, f1 <= math.Sqrt(3), "f1: %v", f1)
+
+		g1, g2, gid := NewWorleyNoise(1).Eval3(p.X(), p.Y(), p.Z())
+		assert.Equal(t, []interface{}{f1, f2, id}, []interface{}{g1, g2, gid}, "same seed, same noise")
+	}
+
+	// without jitter the feature points are the centers of the cells
+	n.Jitter = 0
+	f1, f2, _ := n.Eval3(2.5, -3.5, 0.5)
+	assert.Equal(t, 0.0, f1, "should equal")
+	assert.Equal(t, 1.0, f2, "should equal")
+
+	f1, _, id1 := n.Eval3(2.6, -3.5, 0.5)
+	_, _, id2 := n.Eval3(2.4, -3.6, 0.4)
+	assert.InDelta(t, 0.1, f1, 1e-9, "should equal")
+	assert.Equal(t, id1, id2, "same cell")
+}
+
+func TestFractal(t *testing.T) {
+	n := NewPerlinNoise(1)
+	p := NewPoint(0.3, 1.7, -2.2)
+
+	one := Fractal{Octaves: 1, Lacunarity: 2, Gain: 0.5}
+	assert.Equal(t, n.Eval3(0.3, 1.7, -2.2), one.FBM(n, p), "one octave is the noise")
+	assert.Equal(t, math.Abs(n.Eval3(0.3, 1.7, -2.2)), one.Turbulence(n, p), "should equal")
+	assert.InDelta(t, math.Pow(1-math.Abs(n.Eval3(0.3, 1.7, -2.2)), 2), one.Ridged(n, p, 1), 1e-12, "should equal")
+
+	two := Fractal{Octaves: 2, Lacunarity: 3, Gain: 0.25}
+	want := (n.Eval3(0.3, 1.7, -2.2) + 0.25*n.Eval3(0.9, 5.1, -6.6)) / 1.25
+	assert.InDelta(t, want, two.FBM(n, p), 1e-12, "should equal")
+
+	assert.Equal(t, 0.0, Fractal{}.FBM(n, p), "no octaves")
+
+	f := NewFractal()
+	for _, p := range randomNoisePoints(1000) {
+		fbm := f.FBM(n, p)
+		assert.True(t, fbm >= -1 && fbm <= 1, "fbm: %v", fbm)
+		turbulence := f.Turbulence(n, p)
+		assert.True(t, turbulence >= 0 && turbulence <= 1, "turbulence: %v", turbulence)
+		ridged := f.Ridged(n, p, 1)
+		assert.True(t, ridged >= 0 && ridged <= 1, "ridged: %v", ridged)
+	}
+}
@@ -0,0 +1,293 @@
+package tracer
+
+import (
+	"math"
+)
+
+// noisePattern is the base of the noise patterns, which blend between two colors by the value of the noise
+// With black and white the patterns can be used as masks (see NewPatternMap) and as bumps (see PatternPerturber).
+type noisePattern struct {
+	basePattern
+	a, b Color
+
+	// value returns the noise in [0, 1] at the point in pattern space, each pattern sets it to its own function
+	value func(Point) float64
+}
+
+// newNoisePattern returns a new noise pattern base with the given colors
+func newNoisePattern(c1, c2 Color) noisePattern {
+	return noisePattern{
+		a: c1,
+		b: c2,
+		basePattern: basePattern{
+			transform:        IM(),
+			transformInverse: IM().Inverse(),
+		},
+	}
+}
+
+// ColorAtObject returns the color for the given pattern on the given object
+func (np *noisePattern) ColorAtObject(o Shaper, p Point) Color {
+	return np.colorAt(np.objectSpacePoint(o, p))
+}
+
+// ValueAt implements ScalarPattern
+func (np *noisePattern) ValueAt(p Point) float64 {
+	return np.value(p.TimesMatrix(np.TransformInverse()))
+}
+
+// colorAt returns the color at the point in pattern space
+func (np *noisePattern) colorAt(p Point) Color {
+	return np.a.Add(np.b.Sub(np.a).Scale(np.value(p)))
+}
+
+// clamp01 returns v clamped to [0, 1]
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+// PerlinPattern is gradient noise, see PerlinNoise
+type PerlinPattern struct {
+	noisePattern
+	noise *PerlinNoise
+}
+
+// NewPerlinPattern returns a new gradient noise pattern, the same seed always gives the same pattern
+func NewPerlinPattern(c1, c2 Color, seed int64) *PerlinPattern {
+	pp := &PerlinPattern{
+		noisePattern: newNoisePattern(c1, c2),
+		noise:        NewPerlinNoise(seed),
+	}
+	pp.value = pp.valueAt
+	return pp
+}
+
+// valueAt returns the noise at the point in pattern space
+func (pp *PerlinPattern) valueAt(p Point) float64 {
+	return clamp01((pp.noise.Eval3(p.X(), p.Y(), p.Z()) + 1) / 2)
+}
+
+// FBMPattern is fractional Brownian motion, octaves of gradient noise, good for clouds and dirt
+type FBMPattern struct {
+	noisePattern
+	Fractal
+	noise *PerlinNoise
+}
+
+// NewFBMPattern returns a new fBm pattern with the default fractal settings, see NewFractal
+func NewFBMPattern(c1, c2 Color, seed int64) *FBMPattern {
+	fp := &FBMPattern{
+		noisePattern: newNoisePattern(c1, c2),
+		Fractal:      NewFractal(),
+		noise:        NewPerlinNoise(seed),
+	}
+	fp.value = fp.valueAt
+	return fp
+}
+
+// valueAt returns the noise at the point in pattern space
+func (fp *FBMPattern) valueAt(p Point) float64 {
+	return clamp01((fp.FBM(fp.noise, p) + 1) / 2)
+}
+
+// TurbulencePattern is octaves of the absolute value of gradient noise, good for smoke and fire
+type TurbulencePattern struct {
+	noisePattern
+	Fractal
+	noise *PerlinNoise
+}
+
+// NewTurbulencePattern returns a new turbulence pattern with the default fractal settings, see NewFractal
+func NewTurbulencePattern(c1, c2 Color, seed int64) *TurbulencePattern {
+	tp := &TurbulencePattern{
+		noisePattern: newNoisePattern(c1, c2),
+		Fractal:      NewFractal(),
+		noise:        NewPerlinNoise(seed),
+	}
+	tp.value = tp.valueAt
+	return tp
+}
+
+// valueAt returns the noise at the point in pattern space
+func (tp *TurbulencePattern) valueAt(p Point) float64 {
+	return clamp01(tp.Turbulence(tp.noise, p))
+}
+
+// RidgedPattern is a ridged multifractal, good for mountains and lightning, see Fractal.Ridged
+type RidgedPattern struct {
+	noisePattern
+	Fractal
+	// Offset raises the ridges, lower values give thinner ridges
+	Offset float64
+	noise  *PerlinNoise
+}
+
+// NewRidgedPattern returns a new ridged multifractal pattern with the default fractal settings and an offset of 1
+func NewRidgedPattern(c1, c2 Color, seed int64) *RidgedPattern {
+	rp := &RidgedPattern{
+		noisePattern: newNoisePattern(c1, c2),
+		Fractal:      NewFractal(),
+		Offset:       1,
+		noise:        NewPerlinNoise(seed),
+	}
+	rp.value = rp.valueAt
+	return rp
+}
+
+// valueAt returns the noise at the point in pattern space
+func (rp *RidgedPattern) valueAt(p Point) float64 {
+	return clamp01(rp.Ridged(rp.noise, p, rp.Offset))
+}
+
+// WorleyMode selects the distances the WorleyPattern is made of
+type WorleyMode int
+
+const (
+	// WorleyF1 is the distance to the closest feature point, round spots
+	WorleyF1 WorleyMode = iota
+	// WorleyF2 is the distance to the second closest feature point
+	WorleyF2
+	// WorleyF2MinusF1 is the difference of the two, thin lines between the cells, like cracks or scales
+	WorleyF2MinusF1
+	// WorleyCells gives each cell a random flat value, like stones or crystals
+	WorleyCells
+)
+
+// WorleyPattern is cellular noise, see WorleyNoise
+type WorleyPattern struct {
+	noisePattern
+	Mode  WorleyMode
+	noise *WorleyNoise
+}
+
+// NewWorleyPattern returns a new cellular noise pattern, the same seed always gives the same pattern
+func NewWorleyPattern(c1, c2 Color, seed int64, mode WorleyMode) *WorleyPattern {
+	wp := &WorleyPattern{
+		noisePattern: newNoisePattern(c1, c2),
+		Mode:         mode,
+		noise:        NewWorleyNoise(seed),
+	}
+	wp.value = wp.valueAt
+	return wp
+}
+
+// Noise returns the noise of the pattern, use it to change the jitter
+func (wp *WorleyPattern) Noise() *WorleyNoise {
+	return wp.noise
+}
+
+// valueAt returns the noise at the point in pattern space
+func (wp *WorleyPattern) valueAt(p Point) float64 {
+	f1, f2, id := wp.noise.Eval3(p.X(), p.Y(), p.Z())
+	switch wp.Mode {
+	case WorleyF2:
+		return clamp01(f2)
+	case WorleyF2MinusF1:
+		return clamp01(f2 - f1)
+	case WorleyCells:
+		return hashFloat(id)
+	}
+	return clamp01(f1)
+}
+
+// MarblePattern is veins of color b in color a, sine waves along x distorted by turbulence
+type MarblePattern struct {
+	noisePattern
+	Fractal
+	// Frequency is the number of veins per unit
+	Frequency float64
+	// Distortion is how much the turbulence bends the veins
+	Distortion float64
+	noise      *PerlinNoise
+}
+
+// NewMarblePattern returns a new marble pattern, the same seed always gives the same pattern
+func NewMarblePattern(c1, c2 Color, seed int64) *MarblePattern {
+	mp := &MarblePattern{
+		noisePattern: newNoisePattern(c1, c2),
+		Fractal:      NewFractal(),
+		Frequency:    1,
+		Distortion:   5,
+		noise:        NewPerlinNoise(seed),
+	}
+	mp.value = mp.valueAt
+	return mp
+}
+
+// valueAt returns the marble at the point in pattern space
+func (mp *MarblePattern) valueAt(p Point) float64 {
+	s := math.Sin(2 * math.Pi * (mp.Frequency*p.X() + mp.Distortion*mp.Turbulence(mp.noise, p)))
+	// the veins are the narrow peaks
+	return math.Pow(1-math.Abs(s), 4)
+}
+
+// WoodPattern is the rings and grain of wood, rings of colors a and b around the y axis (the trunk), wobbled by noise
+type WoodPattern struct {
+	noisePattern
+	Fractal
+	// Rings is the number of rings per unit
+	Rings float64
+	// Distortion is how much the noise wobbles the rings
+	Distortion float64
+	// Grain is the strength of the fine streaks along the trunk
+	Grain float64
+	noise *PerlinNoise
+}
+
+// NewWoodPattern returns a new wood pattern, the same seed always gives the same pattern
+func NewWoodPattern(c1, c2 Color, seed int64) *WoodPattern {
+	wp := &WoodPattern{
+		noisePattern: newNoisePattern(c1, c2),
+		Fractal:      Fractal{Octaves: 3, Lacunarity: 2, Gain: 0.5},
+		Rings:        4,
+		Distortion:   0.1,
+		Grain:        0.2,
+		noise:        NewPerlinNoise(seed),
+	}
+	wp.value = wp.valueAt
+	return wp
+}
+
+// valueAt returns the wood at the point in pattern space
+func (wp *WoodPattern) valueAt(p Point) float64 {
+	r := math.Sqrt(p.X()*p.X()+p.Z()*p.Z()) + wp.Distortion*wp.FBM(wp.noise, p)
+	ring := r*wp.Rings - math.Floor(r*wp.Rings)
+	// early wood grows fast and is light, late wood slow and dark, so the rings are lopsided
+	v := math.Pow(ring, 3)
+
+	// the grain is noise stretched along the trunk
+	grain := wp.noise.Eval3(p.X()*40, p.Y()*2, p.Z()*40)
+	return clamp01(v + wp.Grain*grain)
+}
+
+// GranitePattern is speckled stone: crystals of random shades between colors a and b, mottled by noise
+type GranitePattern struct {
+	noisePattern
+	Fractal
+	// Crystals is the number of crystals per unit
+	Crystals float64
+	perlin   *PerlinNoise
+	worley   *WorleyNoise
+}
+
+// NewGranitePattern returns a new granite pattern, the same seed always gives the same pattern
+func NewGranitePattern(c1, c2 Color, seed int64) *GranitePattern {
+	gp := &GranitePattern{
+		noisePattern: newNoisePattern(c1, c2),
+		Fractal:      NewFractal(),
+		Crystals:     20,
+		perlin:       NewPerlinNoise(seed),
+		worley:       NewWorleyNoise(seed),
+	}
+	gp.value = gp.valueAt
+	return gp
+}
+
+// valueAt returns the granite at the point in pattern space
+func (gp *GranitePattern) valueAt(p Point) float64 {
+	_, _, id := gp.worley.Eval3(p.X()*gp.Crystals, p.Y()*gp.Crystals, p.Z()*gp.Crystals)
+	// most crystals are light, a few are dark
+	crystal := math.Pow(hashFloat(id), 0.5)
+	mottle := (gp.FBM(gp.perlin, NewPoint(p.X()*4, p.Y()*4, p.Z()*4)) + 1) / 2
+	return clamp01(0.7*crystal + 0.3*mottle)
+}
@@ -0,0 +1,181 @@
+package tracer
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNoisePatterns(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern func(seed int64) ScalarPattern
+	}{
+		{
+			name:    "perlin",
+			pattern: func(seed int64) ScalarPattern { return NewPerlinPattern(Black(), White(), seed) },
+		},
+		{
+			name:    "fbm",
+			pattern: func(seed int64) ScalarPattern { return NewFBMPattern(Black(), White(), seed) },
+		},
+		{
+			name:    "turbulence",
+			pattern: func(seed int64) ScalarPattern { return NewTurbulencePattern(Black(), White(), seed) },
+		},
+		{
+			name:    "ridged",
+			pattern: func(seed int64) ScalarPattern { return NewRidgedPattern(Black(), White(), seed) },
+		},
+		{
+			name:    "worley f1",
+			pattern: func(seed int64) ScalarPattern { return NewWorleyPattern(Black(), White(), seed, WorleyF1) },
+		},
+		{
+			name:    "worley f2 - f1",
+			pattern: func(seed int64) ScalarPattern { return NewWorleyPattern(Black(), White(), seed, WorleyF2MinusF1) },
+		},
+		{
+			name:    "worley cells",
+			pattern: func(seed int64) ScalarPattern { return NewWorleyPattern(Black(), White(), seed, WorleyCells) },
+		},
+		{
+			name:    "marble",
+			pattern: func(seed int64) ScalarPattern { return NewMarblePattern(Black(), White(), seed) },
+		},
+		{
+			name:    "wood",
+			pattern: func(seed int64) ScalarPattern { return NewWoodPattern(Black(), White(), seed) },
+		},
+		{
+			name:    "granite",
+			pattern: func(seed int64) ScalarPattern { return NewGranitePattern(Black(), White(), seed) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.pattern(1)
+			same := tt.pattern(1)
+			other := tt.pattern(2)
+			s := NewUnitSphere()
+
+			min, max, differ := 1.0, 0.0, false
+			for _, pt := range randomNoisePoints(500) {
+				v := p.ValueAt(pt)
+				assert.True(t, v >= 0 && v <= 1, "value: %v", v)
+				min, max = math.Min(min, v), math.Max(max, v)
+
+				assert.Equal(t, v, same.ValueAt(pt), "same seed, same pattern")
+				differ = differ || v != other.ValueAt(pt)
+
+				// black to white
+				assert.True(t, NewColor(v, v, v).Equal(p.ColorAtObject(s, pt)), "should equal")
+			}
+			assert.True(t, differ, "different seed, different pattern")
+			assert.True(t, max-min > 0.3, "the pattern varies, [%v, %v]", min, max)
+
+			// the transform scales the pattern
+			pt := NewPoint(0.7, -1.3, 2.1)
+			want := p.ValueAt(pt)
+			p.SetTransform(IM().Scale(2, 2, 2))
+			assert.Equal(t, want, p.ValueAt(NewPoint(1.4, -2.6, 4.2)), "should equal")
+		})
+	}
+}
+
+func TestNoisePattern_Colors(t *testing.T) {
+	a, b := NewColor(1, 0, 0), NewColor(0, 0, 1)
+	p := NewFBMPattern(a, b, 1)
+	pt := NewPoint(0.3, 1.7, -2.2)
+
+	v := p.ValueAt(pt)
+	got := p.ColorAtObject(NewUnitSphere(), pt)
+	assert.True(t, NewColor(1-v, 0, v).Equal(got), "blends from a to b")
+
+	// as a mask
+	mm := NewPatternMap(NewFBMPattern(Black(), White(), 1), ChannelLuminance)
+	assert.InDelta(t, v, mm.valueAt(NewUnitSphere(), pt, texCoords{}), 1e-9, "should equal")
+}
+
+// rampPattern is a ScalarPattern equal to x
+type rampPattern struct {
+	basePattern
+}
+
+func (rp *rampPattern) ColorAtObject(o Shaper, p Point) Color {
+	return NewColor(p.X(), p.X(), p.X())
+}
+
+func (rp *rampPattern) ValueAt(p Point) float64 {
+	return p.X()
+}
+
+func TestPatternPerturber(t *testing.T) {
+	ramp := &rampPattern{basePattern: basePattern{transform: IM(), transformInverse: IM()}}
+
+	tests := []struct {
+		name   string
+		normal Vector
+		height float64
+		want   Vector
+	}{
+		{
+			name:   "slope along the surface",
+			normal: NewVector(0, 1, 0),
+			height: 0.5,
+			want:   NewVector(-0.5, 1, 0).Normalize(),
+		},
+		{
+			name:   "slope along the normal",
+			normal: NewVector(1, 0, 0),
+			height: 0.5,
+			want:   NewVector(1, 0, 0),
+		},
+		{
+			name:   "flat",
+			normal: NewVector(0, 1, 0),
+			height: 0,
+			want:   NewVector(0, 1, 0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pp := NewPatternPerturber(ramp, tt.height)
+			got := pp.Perturb(tt.normal, NewPoint(0.2, 0, 0.3))
+			assert.True(t, tt.want.Equal(got), "want %v, got %v", tt.want, got)
+		})
+	}
+}
+
+func TestPerturbers_Seed(t *testing.T) {
+	ramp := &rampPattern{basePattern: basePattern{transform: IM(), transformInverse: IM()}}
+	p := NewPoint(0.2, 0.7, 0.3)
+
+	tests := []struct {
+		name string
+		eval func(seed int64) interface{}
+	}{
+		{
+			name: "perturbed pattern",
+			eval: func(seed int64) interface{} {
+				return NewPerturbedPattern(ramp, 0.5, seed).ColorAtObject(nil, p)
+			},
+		},
+		{
+			name: "noise perturber",
+			eval: func(seed int64) interface{} {
+				return NewNoisePerturber(1, seed).Perturb(NewVector(0, 1, 0), p)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.eval(1), tt.eval(1), "the same seed gives the same noise")
+			assert.NotEqual(t, tt.eval(1), tt.eval(2), "another seed gives other noise")
+		})
+	}
+}
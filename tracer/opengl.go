@@ -80,7 +80,11 @@ func RenderLive(w *World) {
 	// make buffers from out data and tell OpenGL about them
 	colorbo := makeVbo(canvas)
 
-	go w.Render(camera, canvas)
+	go func() {
+		if err := w.Render(camera, canvas); err != nil {
+			log.Fatalln(err)
+		}
+	}()
 
 	for !window.ShouldClose() {
 		draw(window, program, canvas, colorbo)
@@ -94,7 +98,9 @@ func RenderToFile(w *World, output string) {
 	width, height := int(camera.Hsize), int(camera.Vsize)
 	canvas := NewCanvas(width, height)
 
-	w.Render(camera, canvas)
+	if err := w.Render(camera, canvas); err != nil {
+		log.Fatalln(err)
+	}
 
 	f, err := os.Create(output)
 	if err != nil {
@@ -103,6 +109,22 @@ func RenderToFile(w *World, output string) {
 
 	log.Printf("Exporting canvas to %v", f.Name())
 	canvas.ExportToPNG(f)
+
+	if *heatmap != "" {
+		exportHeatmap(w, *heatmap)
+	}
+}
+
+// exportHeatmap writes the sample count heatmap of the last render to a file
+func exportHeatmap(w *World, output string) {
+	f, err := os.Create(output)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer f.Close()
+
+	log.Printf("Exporting sample heatmap to %v", f.Name())
+	w.Film().Heatmap().ExportToPNG(f)
 }
 
 // makeVbo gives our data to OpenGL
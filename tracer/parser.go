@@ -6,14 +6,20 @@ package tracer
 // https://www.scratchapixel.com/lessons/3d-basic-rendering/ray-tracing-polygon-mesh
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
 	"fmt"
-	"image"
+	"io"
+	"io/ioutil"
 	"log"
 	"math"
 	"os"
 	"path"
 	"path/filepath"
 	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/mokiat/go-data-front/decoder/mtl"
 	"github.com/mokiat/go-data-front/decoder/obj"
@@ -24,31 +30,139 @@ const (
 	maxMaterials = 30
 )
 
-func parseMTL(model *obj.Model, dir string) (*mtl.Library, error) {
+// materialLibrary holds the materials of the .mtl files, with the PBR extensions the decoder doesn't read
+type materialLibrary struct {
+	*mtl.Library
 
-	lib := &mtl.Library{
-		Materials: []*mtl.Material{},
+	// pbr are the PBR extensions by material name
+	pbr map[string]*mtlPBR
+}
+
+func parseMTL(model *obj.Model, dir string) (*materialLibrary, error) {
+
+	lib := &materialLibrary{
+		Library: &mtl.Library{
+			Materials: []*mtl.Material{},
+		},
+		pbr: make(map[string]*mtlPBR),
 	}
 
 	libDecoder := mtl.NewDecoder(mtl.DecodeLimits{MaxMaterialCount: maxMaterials})
 
 	for _, ml := range model.MaterialLibraries {
-		f, err := os.Open(path.Join(dir, ml))
+		data, err := ioutil.ReadFile(path.Join(dir, ml))
 		if err != nil {
 			return nil, err
 		}
-		l, err := libDecoder.Decode(f)
+		l, err := libDecoder.Decode(bytes.NewReader(data))
 		if err != nil {
 			return nil, err
 		}
 		lib.Materials = append(lib.Materials, l.Materials...)
+
+		pbr, err := parseMTLPBR(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", ml, err)
+		}
+		for name, p := range pbr {
+			lib.pbr[name] = p
+		}
 	}
 	return lib, nil
 }
 
+// mtlPBR holds the PBR extensions of a .mtl material
+// http://exocortex.com/blog/extending_wavefront_mtl_to_support_pbr
+type mtlPBR struct {
+	// values are the scalar parameters (Pr, Pm, Ps, Pc, Pcr, aniso, Ni) by key
+	values map[string]float64
+	// emission is Ke, nil if not present
+	emission *Color
+	// maps are the texture files (map_Pr, map_Pm, map_Ps, map_Pc, map_Ke and the normal map norm) by key
+	maps map[string]string
+}
+
+// mtlPBRKeys are the keys that make a material principled
+var mtlPBRKeys = []string{"Pr", "Pm", "Ps", "Pc", "Pcr", "aniso", "map_Pr", "map_Pm", "map_Ps", "map_Pc"}
+
+// isPrincipled returns true if the material uses any of the PBR parameters
+func (p *mtlPBR) isPrincipled() bool {
+	if p == nil {
+		return false
+	}
+	for _, key := range mtlPBRKeys {
+		_, isValue := p.values[key]
+		_, isMap := p.maps[key]
+		if isValue || isMap {
+			return true
+		}
+	}
+	return false
+}
+
+// value returns the value of key, or def if it is not present
+func (p *mtlPBR) value(key string, def float64) float64 {
+	if v, ok := p.values[key]; ok {
+		return v
+	}
+	return def
+}
+
+// parseMTLPBR returns the PBR extensions of the materials in the .mtl file, by material name
+func parseMTLPBR(r io.Reader) (map[string]*mtlPBR, error) {
+	result := make(map[string]*mtlPBR)
+	var current *mtlPBR
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		key := fields[0]
+		if key == "newmtl" {
+			current = &mtlPBR{values: make(map[string]float64), maps: make(map[string]string)}
+			result[fields[1]] = current
+			continue
+		}
+		if current == nil {
+			continue
+		}
+
+		switch key {
+		case "Pr", "Pm", "Ps", "Pc", "Pcr", "aniso", "Ni":
+			v, err := strconv.ParseFloat(fields[1], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %v: %v", key, err)
+			}
+			current.values[key] = v
+		case "Ke":
+			if len(fields) < 4 {
+				return nil, fmt.Errorf("invalid Ke: %v", fields[1:])
+			}
+			var c [3]float64
+			for i := range c {
+				v, err := strconv.ParseFloat(fields[i+1], 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid Ke: %v", err)
+				}
+				c[i] = v
+			}
+			clr := NewColor(c[0], c[1], c[2])
+			current.emission = &clr
+		case "map_Pr", "map_Pm", "map_Ps", "map_Pc", "map_Ke", "norm":
+			// options come before the file name
+			current.maps[key] = fields[len(fields)-1]
+		}
+	}
+
+	return result, scanner.Err()
+}
+
 // parseOBJ implements OBJ parsing and returns the model
 // dir is the directory that holds the .mtl files
-func parseOBJ(f *os.File, dir string) (*obj.Model, *mtl.Library, error) {
+func parseOBJ(f *os.File, dir string) (*obj.Model, *materialLibrary, error) {
 	limits := obj.DefaultLimits()
 	limits.MaxReferenceCount = 128
 	decoder := obj.NewDecoder(limits)
@@ -164,7 +278,8 @@ func processIllum(mat *mtl.Material, illum int64) *mtl.Material {
 }
 
 // convertMaterial converts OBJ material to *Material
-func convertMaterial(mat *mtl.Material, dir string) (*Material, error) {
+// Materials using the PBR extensions (pbr, may be nil) are converted to principled materials.
+func convertMaterial(mat *mtl.Material, pbr *mtlPBR, dir string) (*Material, error) {
 	// https://people.sc.fsu.edu/~jburkardt/data/mtl/mtl.html
 
 	// defines the ambient color of the material to be (r,g,b).
@@ -177,7 +292,6 @@ func convertMaterial(mat *mtl.Material, dir string) (*Material, error) {
 	kaColor := NewColor(ka.R, ka.G, ka.B)
 	kdColor := NewColor(kd.R, kd.G, kd.B)
 	ksColor := NewColor(ks.R, ks.G, ks.B)
-	// ke := mat.EmissiveCoefficient  // not implemented in library
 
 	// Dissolve indicates how much an object should blend.
 	// The value should range between 0.0 (fully transparent)
@@ -199,6 +313,11 @@ func convertMaterial(mat *mtl.Material, dir string) (*Material, error) {
 	log.Printf("    Transparency: %v\n", d)
 	log.Printf("    Illumination: %v\n", illum)
 
+	if pbr.isPrincipled() {
+		log.Printf("    PBR: %v\n", pbr.values)
+		return convertPrincipledMaterial(mat, pbr, dir)
+	}
+
 	m := NewDefaultMaterial()
 	m.Color = kdColor
 	m.Shininess = ns
@@ -207,49 +326,168 @@ func convertMaterial(mat *mtl.Material, dir string) (*Material, error) {
 	if m.Transparency > 0 {
 		m.ShadowCaster = false
 	}
+	// Ke is not read by the decoder
+	if pbr != nil && pbr.emission != nil {
+		m.Emissive = *pbr.emission
+	}
 
 	// TODO: Implement support for illum, probably in lighting()
 	// http://paulbourke.net/dataformats/mtl/
 	mat = processIllum(mat, illum)
 
 	// If there is a bump map present, use it
-	if mat.BumpTexture != "" {
-		log.Println("Reading in bump map textures...")
+	if err := convertBumpMap(m, mat, dir); err != nil {
+		return nil, err
+	}
+	if err := convertNormalMap(m, pbr, dir); err != nil {
+		return nil, err
+	}
 
-		imageFile := path.Join(dir, mat.BumpTexture)
+	// If there is a texture present, use it
+	if mat.DiffuseTexture != "" {
+		log.Println("Reading in material textures...")
 
-		pert, err := NewImageHeightmapPerturber(imageFile, NewPlaneMap())
+		t, err := LoadTexture(path.Join(dir, mat.DiffuseTexture), ColorEncodingSRGB)
 		if err != nil {
 			return nil, err
 		}
-		m.SetPerturber(pert)
+		m.Texture = NewTextureSampler(t)
+	}
+	if err := convertMaps(m, mat, pbr, dir); err != nil {
+		return nil, err
 	}
 
-	// If there is a texture present, use it
-	if mat.DiffuseTexture != "" {
-		log.Println("Reading in material textures...")
+	return m, nil
+}
+
+// convertMaps sets the maps of the other parameters of the OBJ material on m
+func convertMaps(m *Material, mat *mtl.Material, pbr *mtlPBR, dir string) error {
+	// Ke and map_Ke are not read by the decoder
+	var emission string
+	if pbr != nil {
+		emission = pbr.maps["map_Ke"]
+	}
 
-		imageFile := path.Join(dir, mat.DiffuseTexture)
-		f, err := os.Open(imageFile)
+	maps := []struct {
+		file  string
+		param MaterialParam
+		enc   ColorEncoding
+	}{
+		{mat.AmbientTexture, MaterialAmbient, ColorEncodingLinear},
+		{mat.SpecularTexture, MaterialSpecular, ColorEncodingLinear},
+		{mat.SpecularExponentTexture, MaterialShininess, ColorEncodingLinear},
+		{emission, MaterialEmissive, ColorEncodingSRGB},
+	}
+	for _, mm := range maps {
+		if mm.file == "" {
+			continue
+		}
+		log.Printf("Reading in %v texture...", mm.file)
+		t, err := LoadTexture(path.Join(dir, mm.file), mm.enc)
 		if err != nil {
-			return nil, err
+			return err
 		}
+		m.SetMap(mm.param, NewTextureMap(NewTextureSampler(t), ChannelLuminance))
+	}
+	// the emission map is multiplied with Ke, which defaults to black
+	if emission != "" && pbr.emission == nil {
+		m.Emissive = White()
+	}
+	return nil
+}
+
+// convertBumpMap sets the bump map of the OBJ material on m, if there is one
+func convertBumpMap(m *Material, mat *mtl.Material, dir string) error {
+	if mat.BumpTexture == "" {
+		return nil
+	}
+	log.Println("Reading in bump map textures...")
 
-		decode, format, err := image.Decode(f)
+	imageFile := path.Join(dir, mat.BumpTexture)
+
+	pert, err := NewImageHeightmapPerturber(imageFile, NewPlaneMap())
+	if err != nil {
+		return err
+	}
+	m.SetPerturber(pert)
+	return nil
+}
+
+// convertNormalMap sets the normal map (norm) of the OBJ material on m, if there is one, it replaces the bump map
+func convertNormalMap(m *Material, pbr *mtlPBR, dir string) error {
+	if pbr == nil || pbr.maps["norm"] == "" {
+		return nil
+	}
+	log.Println("Reading in normal map textures...")
+
+	// normals are data, not colors
+	t, err := LoadTexture(path.Join(dir, pbr.maps["norm"]), ColorEncodingLinear)
+	if err != nil {
+		return err
+	}
+	m.SetPerturber(NewNormalMapPerturber(NewTextureSampler(t)))
+	return nil
+}
+
+// convertPrincipledMaterial converts an OBJ material with PBR extensions to a principled *Material
+func convertPrincipledMaterial(mat *mtl.Material, pbr *mtlPBR, dir string) (*Material, error) {
+	pm := NewPrincipledMaterial()
+	pm.BaseColor = NewColor(mat.DiffuseColor.R, mat.DiffuseColor.G, mat.DiffuseColor.B)
+	pm.Roughness = pbr.value("Pr", pm.Roughness)
+	pm.Metallic = pbr.value("Pm", pm.Metallic)
+	pm.Sheen = pbr.value("Ps", pm.Sheen)
+	pm.Clearcoat = pbr.value("Pc", pm.Clearcoat)
+	pm.ClearcoatRoughness = pbr.value("Pcr", pm.ClearcoatRoughness)
+	pm.Anisotropy = pbr.value("aniso", pm.Anisotropy)
+	if ni := pbr.value("Ni", 0); ni >= 1 {
+		pm.IOR = ni
+	}
+	// d = 0 is fully transparent; the reverse of what we use
+	pm.Transmission = 1 - mat.Dissolve
+	if pbr.emission != nil {
+		pm.Emission = *pbr.emission
+	}
+
+	maps := []struct {
+		file  string
+		param PrincipledParam
+		enc   ColorEncoding
+	}{
+		{mat.DiffuseTexture, PrincipledBaseColor, ColorEncodingSRGB},
+		{pbr.maps["map_Pr"], PrincipledRoughness, ColorEncodingLinear},
+		{pbr.maps["map_Pm"], PrincipledMetallic, ColorEncodingLinear},
+		{pbr.maps["map_Ps"], PrincipledSheen, ColorEncodingLinear},
+		{pbr.maps["map_Pc"], PrincipledClearcoat, ColorEncodingLinear},
+		{pbr.maps["map_Ke"], PrincipledEmission, ColorEncodingSRGB},
+	}
+	for _, mm := range maps {
+		if mm.file == "" {
+			continue
+		}
+		log.Printf("Reading in %v texture...", mm.file)
+		t, err := LoadTexture(path.Join(dir, mm.file), mm.enc)
 		if err != nil {
 			return nil, err
 		}
-		log.Printf("decoded image format %v", format)
-
-		// store the texture in the material, only used by smooth triangles
-		m.AddDiffuseTexture(mat.Name, decode)
+		pm.SetMap(mm.param, NewTextureMap(NewTextureSampler(t), ChannelLuminance))
+	}
+	// the emission map is multiplied with Ke, which defaults to black
+	if _, ok := pm.Maps[PrincipledEmission]; ok && pbr.emission == nil {
+		pm.Emission = White()
 	}
 
+	m := pm.Material()
+	if err := convertBumpMap(m, mat, dir); err != nil {
+		return nil, err
+	}
+	if err := convertNormalMap(m, pbr, dir); err != nil {
+		return nil, err
+	}
 	return m, nil
 }
 
 // convertData converts the parsed model to *Group instance
-func convertData(model *obj.Model, lib *mtl.Library, dir string) (*Group, error) {
+func convertData(model *obj.Model, lib *materialLibrary, dir string) (*Group, error) {
 	g := NewGroup()
 
 	for _, o := range model.Objects {
@@ -261,7 +499,7 @@ func convertData(model *obj.Model, lib *mtl.Library, dir string) (*Group, error)
 				return nil, fmt.Errorf("Unable to find material %v in lib", m.MaterialName)
 			}
 
-			omat, err := convertMaterial(mat, dir)
+			omat, err := convertMaterial(mat, lib.pbr[m.MaterialName], dir)
 			if err != nil {
 				return nil, err
 			}
@@ -277,7 +515,7 @@ func convertData(model *obj.Model, lib *mtl.Library, dir string) (*Group, error)
 }
 
 // toMesh converts an object to a TriangleMesh
-func toMesh(model *obj.Model, o *obj.Object, lib *mtl.Library, dir string) (*TriangleMesh, error) {
+func toMesh(model *obj.Model, o *obj.Object, lib *materialLibrary, dir string) (*TriangleMesh, error) {
 	var tri *TriangleMesh
 	var vertices []Point
 	var normals []Vector
@@ -296,7 +534,7 @@ func toMesh(model *obj.Model, o *obj.Object, lib *mtl.Library, dir string) (*Tri
 			return nil, fmt.Errorf("Unable to find material %v in lib", m.MaterialName)
 		}
 
-		omat, err := convertMaterial(mat, dir)
+		omat, err := convertMaterial(mat, lib.pbr[m.MaterialName], dir)
 		if err != nil {
 			return nil, err
 		}
@@ -335,7 +573,7 @@ func toMesh(model *obj.Model, o *obj.Object, lib *mtl.Library, dir string) (*Tri
 }
 
 // convertToMesh converts the parsed model to a group of TriangleMesh objects
-func convertDataToMesh(model *obj.Model, lib *mtl.Library, dir string) (*Group, error) {
+func convertDataToMesh(model *obj.Model, lib *materialLibrary, dir string) (*Group, error) {
 	g := NewGroup()
 
 	for _, o := range model.Objects {
@@ -384,7 +622,214 @@ func ParseGLTF(f string) (*Group, error) {
 	fmt.Printf("%#v\n", doc.Meshes)
 	fmt.Printf("%#v\n", doc.Scenes)
 
+	// TODO: Import meshes and apply the materials to them
+	for _, mat := range doc.Materials {
+		if _, err := convertGLTFMaterial(doc, mat, filepath.Dir(f)); err != nil {
+			return nil, err
+		}
+		log.Printf("  material: %v", mat.Name)
+	}
+
 	g := NewGroup()
 
 	return g, nil
 }
+
+// gltfExtension decodes the extension of the material into v, returns false if the material doesn't use it
+func gltfExtension(mat *gltf.Material, name string, v interface{}) (bool, error) {
+	ext, ok := mat.Extensions[name]
+	if !ok {
+		return false, nil
+	}
+
+	data, err := json.Marshal(ext)
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("%v: %v", name, err)
+	}
+	return true, nil
+}
+
+// gltfTexture reads the texture with the given index, images are read from dir
+// The filter and wrap modes come from the texture's sampler, if it has one.
+// enc is the encoding of the image, glTF color textures are sRGB and the others linear.
+func gltfTexture(doc *gltf.Document, index int, dir string, enc ColorEncoding) (*TextureSampler, error) {
+	if index < 0 || index >= len(doc.Textures) || doc.Textures[index].Source == nil {
+		return nil, fmt.Errorf("invalid texture %v", index)
+	}
+	source := int(*doc.Textures[index].Source)
+	if source < 0 || source >= len(doc.Images) {
+		return nil, fmt.Errorf("invalid image %v", source)
+	}
+
+	img := doc.Images[source]
+	if img.URI == "" || strings.HasPrefix(img.URI, "data:") {
+		return nil, fmt.Errorf("embedded image %v is not supported", img.Name)
+	}
+	t, err := LoadTexture(path.Join(dir, img.URI), enc)
+	if err != nil {
+		return nil, err
+	}
+
+	ts := NewTextureSampler(t)
+	if doc.Textures[index].Sampler == nil {
+		return ts, nil
+	}
+	sampler := int(*doc.Textures[index].Sampler)
+	if sampler < 0 || sampler >= len(doc.Samplers) {
+		return nil, fmt.Errorf("invalid sampler %v", sampler)
+	}
+	if doc.Samplers[sampler].MagFilter == gltf.MagNearest {
+		ts.Filter = TextureFilterNearest
+	}
+	ts.WrapU = gltfWrapMode(doc.Samplers[sampler].WrapS)
+	ts.WrapV = gltfWrapMode(doc.Samplers[sampler].WrapT)
+	return ts, nil
+}
+
+// gltfWrapMode returns the wrap mode of the glTF wrapping mode
+func gltfWrapMode(w gltf.WrappingMode) WrapMode {
+	switch w {
+	case gltf.WrapClampToEdge:
+		return WrapClamp
+	case gltf.WrapMirroredRepeat:
+		return WrapMirror
+	}
+	return WrapRepeat
+}
+
+// convertGLTFMaterial converts a glTF material to a principled *Material
+// pbrMetallicRoughness maps directly, clear coat, sheen, transmission, ior, specular and emissive strength are read from
+// their KHR_materials extensions and the normal texture becomes a NormalMapPerturber.
+func convertGLTFMaterial(doc *gltf.Document, mat *gltf.Material, dir string) (*Material, error) {
+	pm := NewPrincipledMaterial()
+
+	// glTF defaults
+	pm.BaseColor = White()
+	pm.Metallic = 1
+	pm.Roughness = 1
+	pm.IOR = 1.5
+	pm.ClearcoatRoughness = 0
+	pm.SheenTint = 0
+	pm.Emission = NewColor(mat.EmissiveFactor[0], mat.EmissiveFactor[1], mat.EmissiveFactor[2])
+
+	setTexture := func(index int, enc ColorEncoding, ch Channel, params ...PrincipledParam) error {
+		t, err := gltfTexture(doc, index, dir, enc)
+		if err != nil {
+			return err
+		}
+		for _, param := range params {
+			pm.SetMap(param, NewTextureMap(t, ch))
+		}
+		return nil
+	}
+
+	if pbr := mat.PBRMetallicRoughness; pbr != nil {
+		if c := pbr.BaseColorFactor; c != nil {
+			pm.BaseColor = NewColor(c[0], c[1], c[2])
+		}
+		if pbr.MetallicFactor != nil {
+			pm.Metallic = *pbr.MetallicFactor
+		}
+		if pbr.RoughnessFactor != nil {
+			pm.Roughness = *pbr.RoughnessFactor
+		}
+
+		if t := pbr.BaseColorTexture; t != nil {
+			if err := setTexture(int(t.Index), ColorEncodingSRGB, ChannelLuminance, PrincipledBaseColor); err != nil {
+				return nil, err
+			}
+		}
+		// roughness is in the green channel, metalness in the blue channel
+		if t := pbr.MetallicRoughnessTexture; t != nil {
+			if err := setTexture(int(t.Index), ColorEncodingLinear, ChannelG, PrincipledRoughness); err != nil {
+				return nil, err
+			}
+			if err := setTexture(int(t.Index), ColorEncodingLinear, ChannelB, PrincipledMetallic); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if t := mat.EmissiveTexture; t != nil {
+		if err := setTexture(int(t.Index), ColorEncodingSRGB, ChannelLuminance, PrincipledEmission); err != nil {
+			return nil, err
+		}
+	}
+
+	// the scale of the normal texture is the strength of the normal map
+	var normalMap *NormalMapPerturber
+	if t := mat.NormalTexture; t != nil && t.Index != nil {
+		ts, err := gltfTexture(doc, int(*t.Index), dir, ColorEncodingLinear)
+		if err != nil {
+			return nil, err
+		}
+		normalMap = NewNormalMapPerturber(ts)
+		if t.Scale != nil {
+			normalMap.Strength = *t.Scale
+		}
+	}
+
+	var clearcoat struct {
+		ClearcoatFactor          float64 `json:"clearcoatFactor"`
+		ClearcoatRoughnessFactor float64 `json:"clearcoatRoughnessFactor"`
+	}
+	if ok, err := gltfExtension(mat, "KHR_materials_clearcoat", &clearcoat); err != nil {
+		return nil, err
+	} else if ok {
+		pm.Clearcoat = clearcoat.ClearcoatFactor
+		pm.ClearcoatRoughness = clearcoat.ClearcoatRoughnessFactor
+	}
+
+	var sheen struct {
+		SheenColorFactor [3]float64 `json:"sheenColorFactor"`
+	}
+	if ok, err := gltfExtension(mat, "KHR_materials_sheen", &sheen); err != nil {
+		return nil, err
+	} else if ok {
+		// the sheen is white or tinted by the base color, the strength of the sheen color is kept
+		c := sheen.SheenColorFactor
+		pm.Sheen = math.Max(c[0], math.Max(c[1], c[2]))
+	}
+
+	var transmission struct {
+		TransmissionFactor float64 `json:"transmissionFactor"`
+	}
+	if ok, err := gltfExtension(mat, "KHR_materials_transmission", &transmission); err != nil {
+		return nil, err
+	} else if ok {
+		pm.Transmission = transmission.TransmissionFactor
+	}
+
+	ior := struct {
+		IOR float64 `json:"ior"`
+	}{IOR: 1.5}
+	if _, err := gltfExtension(mat, "KHR_materials_ior", &ior); err != nil {
+		return nil, err
+	}
+	pm.IOR = ior.IOR
+
+	// the specular factor scales the reflectance given by the index of refraction, Specular 0.5 is 4%
+	specular := struct {
+		SpecularFactor float64 `json:"specularFactor"`
+	}{SpecularFactor: 1}
+	if _, err := gltfExtension(mat, "KHR_materials_specular", &specular); err != nil {
+		return nil, err
+	}
+	pm.Specular = math.Pow((pm.IOR-1)/(pm.IOR+1), 2) * specular.SpecularFactor / 0.08
+
+	strength := struct {
+		EmissiveStrength float64 `json:"emissiveStrength"`
+	}{EmissiveStrength: 1}
+	if _, err := gltfExtension(mat, "KHR_materials_emissive_strength", &strength); err != nil {
+		return nil, err
+	}
+	pm.EmissionStrength = strength.EmissiveStrength
+
+	m := pm.Material()
+	if normalMap != nil {
+		m.SetPerturber(normalMap)
+	}
+	return m, nil
+}
@@ -0,0 +1,229 @@
+package tracer
+
+import (
+	"math"
+	"math/rand"
+)
+
+// PathTracerIntegrator is a unidirectional Monte Carlo path tracer
+// Paths bounce off surfaces (cosine weighted for diffuse surfaces) until they hit an emitter, leave the scene
+// or are terminated by Russian roulette. At every diffuse bounce one point on an area light or emissive object
+// is sampled (next event estimation) and combined with the bounce using multiple importance sampling.
+// Point and spot lights are sampled at every bounce. Unlike in the Whitted integrator, their intensity falls off
+// with the square of the distance, so scenes need brighter lights.
+// Emitters do not scatter light, and Material.Ambient is ignored since indirect light is computed.
+// Subsurface materials are simulated with a random walk inside the shape, see Subsurface.
+type PathTracerIntegrator struct {
+	// MaxDepth is the maximum number of bounces
+	MaxDepth int
+
+	// RouletteDepth is the number of bounces after which Russian roulette starts terminating paths
+	RouletteDepth int
+
+	// NextEventEstimation enables sampling lights at every bounce, without it only paths that hit emitters
+	// by chance carry light (brute force), which converges to the same image much more slowly
+	NextEventEstimation bool
+
+	emitters []*emitter
+	// emitters by the shape rays hit
+	emitterByShape map[Shaper]*emitter
+}
+
+// NewPathTracerIntegrator returns a new path tracer with next event estimation enabled
+func NewPathTracerIntegrator(maxDepth int) *PathTracerIntegrator {
+	return &PathTracerIntegrator{
+		MaxDepth:            maxDepth,
+		RouletteDepth:       3,
+		NextEventEstimation: true,
+	}
+}
+
+// Preprocess implements the Integrator interface
+func (pt *PathTracerIntegrator) Preprocess(w *World) {
+	pt.emitters, pt.emitterByShape = findEmitters(w)
+}
+
+// Li implements the Integrator interface
+func (pt *PathTracerIntegrator) Li(w *World, r Ray, xs Intersections, rng *rand.Rand) Color {
+	result := Black()
+	beta := White()
+
+	// the previous bounce, used to weigh emitters hit by bsdf sampling
+	specular := true
+	var prev Point
+	var prevPdf float64
+
+	for depth := 0; depth <= pt.MaxDepth; depth++ {
+		xs = w.Intersections(r, xs[:0])
+		hit, err := xs.Hit()
+		if err != nil {
+			break
+		}
+		state := PrepareComputations(hit, r, xs)
+		beta = beta.Blend(state.transmittance())
+
+		// light emitted towards the previous vertex
+		if le := pt.emitted(state); le != Black() {
+			// emitters that can't be sampled are only found this way
+			weight := 1.0
+			if e, sampled := pt.emitterByShape[state.Object]; sampled && pt.NextEventEstimation && !specular {
+				weight = powerHeuristic(1, prevPdf, 1, pt.lightPdf(e, prev, state.Point, r.Dir))
+			}
+			result = result.Add(beta.Blend(le).Scale(weight))
+			break
+		}
+
+		var b *bsdf
+		if state.material().Subsurface != nil {
+			var weight Color
+			var ok bool
+			if b, weight, ok = w.subsurfaceBSDF(state, xs, rng); !ok {
+				break
+			}
+			beta = beta.Blend(weight)
+			// the path continues from where the light left the material
+			state = b.state
+		} else {
+			b = newBSDF(state)
+		}
+
+		if pt.NextEventEstimation && b.nonSpecular() {
+			result = result.Add(beta.Blend(pt.sampleLights(w, state, b, xs, rng)))
+		}
+
+		s, ok := b.sample(rng)
+		if !ok {
+			break
+		}
+		beta = beta.Blend(s.weight)
+		specular = s.specular
+		prev = state.Point
+		prevPdf = s.pdf
+
+		// Russian roulette, paths that carry little light are likely to stop
+		if depth >= pt.RouletteDepth {
+			q := math.Max(0.05, 1-math.Max(beta.R, math.Max(beta.G, beta.B)))
+			if rng.Float64() < q {
+				break
+			}
+			beta = beta.Scale(1 / (1 - q))
+		}
+
+		r = state.ray(s.origin, s.wi)
+		// only perfect reflections and refractions keep a narrow footprint
+		if specular {
+			r.Differentials = state.specularDifferentials(s.wi)
+		}
+	}
+
+	return result
+}
+
+// emitted returns the light emitted by the hit surface towards the ray origin
+func (pt *PathTracerIntegrator) emitted(state *IntersectionState) Color {
+	if e, ok := pt.emitterByShape[state.Object]; ok {
+		return e.radiance(state.EyeV)
+	}
+	return state.material().Emissive
+}
+
+// lightPdf returns the pdf (solid angle, at from) of sampleLights picking the point p on emitter e
+func (pt *PathTracerIntegrator) lightPdf(e *emitter, from, p Point, dir Vector) float64 {
+	if !e.inScene {
+		return 0
+	}
+	n, pdfA := e.pointPdf(p)
+	cos := math.Abs(n.Dot(dir.Normalize()))
+	if cos == 0 {
+		return 0
+	}
+	dist2 := p.SubPoint(from).Dot(p.SubPoint(from))
+	return pdfA * dist2 / cos / float64(len(pt.emitters))
+}
+
+// sampleLights returns the direct light arriving at the intersection, scattered towards the eye
+func (pt *PathTracerIntegrator) sampleLights(w *World, state *IntersectionState, b *bsdf, xs Intersections, rng *rand.Rand) Color {
+	result := Black()
+
+	// lights without area can't be hit, there is nothing to combine them with
+	for _, l := range w.Lights {
+		switch l := l.(type) {
+		case *PointLight:
+			result = result.Add(pt.deltaLight(w, b, l.Position(), l.Intensity(), nil, 0, xs))
+		case *SpotLight:
+			result = result.Add(pt.deltaLight(w, b, l.Position(), l.Intensity(), &l.direction, l.Angle(), xs))
+		}
+	}
+
+	if len(pt.emitters) == 0 {
+		return result
+	}
+
+	// one point on one emitter
+	e := pt.emitters[rng.Intn(len(pt.emitters))]
+	lp, ln, pdfA := e.sample(rng)
+
+	p := b.origin(lp)
+	dist, wi := lp.SubPoint(p).MagnitudeNormalize()
+	cosL := math.Abs(ln.Dot(wi))
+	if cosL == 0 || dist == 0 {
+		return result
+	}
+
+	f := b.f(wi)
+	if f == Black() {
+		return result
+	}
+	le := e.radiance(wi.Negate())
+	if le == Black() {
+		return result
+	}
+	if w.pathOccluded(p, wi, dist, xs) {
+		return result
+	}
+
+	// convert to solid angle
+	pdf := pdfA * dist * dist / cosL / float64(len(pt.emitters))
+	weight := 1.0
+	if e.inScene {
+		weight = powerHeuristic(1, pdf, 1, b.pdf(wi))
+	}
+
+	return result.Add(f.Blend(le).Scale(math.Abs(b.n.Dot(wi)) * weight / pdf))
+}
+
+// deltaLight returns the light from a point or spot light scattered towards the eye
+func (pt *PathTracerIntegrator) deltaLight(w *World, b *bsdf, lp Point, intensity Color, direction *Vector, angle float64, xs Intersections) Color {
+	p := b.origin(lp)
+	dist, wi := lp.SubPoint(p).MagnitudeNormalize()
+	if direction != nil && math.Acos(direction.Dot(wi.Negate())) > angle/2 {
+		return Black()
+	}
+
+	f := b.f(wi)
+	if f == Black() || w.pathOccluded(p, wi, dist, xs) {
+		return Black()
+	}
+	return f.Blend(intensity).Scale(math.Abs(b.n.Dot(wi)) / (dist * dist))
+}
+
+// pathOccluded returns true if something blocks the segment from p, in direction dir, of length dist
+// Emitters block light too, unlike in the Whitted integrator where light shapes don't cast shadows.
+func (w *World) pathOccluded(p Point, dir Vector, dist float64, xs Intersections) bool {
+	// stop just short of the end, which is usually on the surface of an emitter
+	max := dist * (1 - 1e-4)
+
+	for _, it := range w.Intersections(NewRay(p, dir), xs[:0]) {
+		if it.t < 0 {
+			continue
+		}
+		if it.t >= max {
+			return false
+		}
+		m := it.Object().Material()
+		if m.ShadowCaster || m.Emissive != Black() {
+			return true
+		}
+	}
+	return false
+}
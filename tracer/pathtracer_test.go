@@ -0,0 +1,178 @@
+package tracer
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// pathTestWorld is a floor and a wall, lit by an emissive sphere and a visible spherical area light
+func pathTestWorld() *World {
+	w := NewWorld(NewWorldConfig())
+
+	floor := NewPlane()
+	floor.Material().Color = NewColor(0.8, 0.8, 0.8)
+	w.AddObject(floor)
+
+	wall := NewPlane()
+	wall.SetTransform(IM().RotateX(math.Pi/2).Translate(0, 0, 3))
+	wall.Material().Color = NewColor(0.9, 0.2, 0.2)
+	w.AddObject(wall)
+
+	glow := NewUnitSphere()
+	glow.SetTransform(IM().Scale(0.5, 0.5, 0.5).Translate(1, 3, 0))
+	glow.Material().Emissive = NewColor(4, 4, 4)
+	w.AddObject(glow)
+
+	bulb := NewUnitSphere()
+	bulb.SetTransform(IM().Scale(0.3, 0.3, 0.3).Translate(-2, 2, 1))
+	w.SetLights(Lights{NewAreaLight(bulb, NewColor(6, 6, 6), true)})
+
+	return w
+}
+
+func TestPathTracerIntegrator_Converges(t *testing.T) {
+	r := NewRay(NewPoint(0, 1, -3), NewVector(0, -1, 3).Normalize())
+	n := 40000
+
+	estimate := func(nee bool) Color {
+		w := pathTestWorld()
+		pt := NewPathTracerIntegrator(16)
+		pt.NextEventEstimation = nee
+		pt.Preprocess(w)
+
+		rng := rand.New(rand.NewSource(1))
+		xs := NewIntersections()
+		sum := Black()
+		for i := 0; i < n; i++ {
+			sum = sum.Add(pt.Li(w, r, xs, rng))
+		}
+		return sum.Scale(1 / float64(n))
+	}
+
+	bruteForce := estimate(false)
+	got := estimate(true)
+
+	assert.True(t, got.R > got.B, "red wall should bleed onto the floor")
+	assert.InEpsilon(t, bruteForce.R, got.R, 0.05, "should converge to the same result")
+	assert.InEpsilon(t, bruteForce.G, got.G, 0.05, "should converge to the same result")
+	assert.InEpsilon(t, bruteForce.B, got.B, 0.05, "should converge to the same result")
+}
+
+func TestPathTracerIntegrator_PointLight(t *testing.T) {
+	// a single diffuse bounce that escapes the scene, the Whitted diffuse term with falloff
+	w := NewWorld(NewWorldConfig())
+	floor := NewPlane()
+	floor.Material().Ambient = 0
+	floor.Material().Specular = 0
+	w.AddObject(floor)
+	w.SetLights(Lights{NewPointLight(NewPoint(-2, 5, 1), White())})
+
+	r := NewRay(NewPoint(0, 1, -1), NewVector(0, -1, 1).Normalize())
+	// the ray hits the floor at (0, 0, 0)
+	want := w.ColorAt(r, 0, NewIntersections(), nil).Scale(1 / (math.Pi * 30))
+
+	pt := NewPathTracerIntegrator(16)
+	pt.Preprocess(w)
+	got := pt.Li(w, r, NewIntersections(), rand.New(rand.NewSource(1)))
+
+	assert.True(t, want.Equal(got), "%v should equal %v", got, want)
+}
+
+func TestPathTracerIntegrator_Miss(t *testing.T) {
+	w := pathTestWorld()
+	pt := NewPathTracerIntegrator(16)
+	pt.Preprocess(w)
+
+	got := pt.Li(w, NewRay(NewPoint(0, 1, 0), NewVector(0, 1, -1).Normalize()), NewIntersections(), rand.New(rand.NewSource(1)))
+	assert.Equal(t, Black(), got, "should equal")
+}
+
+func TestEmitter_Sample(t *testing.T) {
+	flat := NewUnitCube()
+	flat.SetTransform(IM().Scale(1, 0.01, 1).RotateZ(0.3).Translate(0, 4, 0))
+
+	sphere := NewUnitSphere()
+	sphere.SetTransform(IM().Scale(2, 2, 2))
+
+	g := NewGroup()
+	g.SetTransform(IM().Scale(3, 3, 3))
+	tri := NewTriangle(NewPoint(0, 0, 0), NewPoint(1, 0, 0), NewPoint(0, 1, 0))
+	g.AddMember(tri)
+
+	tests := []struct {
+		name     string
+		shape    Shaper
+		wantArea float64
+	}{
+		{
+			name:     "scaled sphere",
+			shape:    sphere,
+			wantArea: 16 * math.Pi,
+		},
+		{
+			name:     "flat cube",
+			shape:    flat,
+			wantArea: 2 * (2*0.02 + 0.02*2 + 2*2),
+		},
+		{
+			name:     "triangle in a group",
+			shape:    tri,
+			wantArea: 4.5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, ok := newEmitter(tt.shape, nil, true)
+			assert.True(t, ok, "should be able to sample")
+
+			// E[1 / pdf] is the area of the surface
+			rng := rand.New(rand.NewSource(1))
+			n := 20000
+			sum := 0.0
+			for i := 0; i < n; i++ {
+				p, normal, pdf := e.sample(rng)
+				sum += 1 / pdf
+
+				pn, ppdf := e.pointPdf(p)
+				assert.InDelta(t, pdf, ppdf, 1e-6, "pdf should match")
+				assert.InDelta(t, 1, math.Abs(pn.Dot(normal)), 1e-6, "normal should match")
+			}
+			assert.InEpsilon(t, tt.wantArea, sum/float64(n), 0.02, "should be close")
+		})
+	}
+
+	_, ok := newEmitter(NewPlane(), nil, true)
+	assert.False(t, ok, "planes can't be sampled")
+}
+
+func TestFindEmitters(t *testing.T) {
+	w := pathTestWorld()
+
+	hidden := NewUnitSphere()
+	w.AddLight(NewAreaLight(hidden, White(), false))
+
+	cylinder := NewDefaultCylinder()
+	cylinder.Material().Emissive = White()
+	w.AddObject(cylinder)
+
+	emitters, byShape := findEmitters(w)
+	assert.Equal(t, 3, len(emitters), "should equal")
+	assert.Equal(t, 3, len(byShape), "should equal")
+
+	assert.True(t, byShape[w.Lights[0].Shape()].inScene, "visible light should be in the scene")
+	assert.False(t, byShape[hidden].inScene, "hidden light should not be in the scene")
+	assert.Nil(t, byShape[w.Objects[2]].light, "emissive sphere is not a light")
+	_, ok := byShape[cylinder]
+	assert.False(t, ok, "cylinders can't be sampled")
+}
+
+func TestPowerHeuristic(t *testing.T) {
+	assert.Equal(t, 0.5, powerHeuristic(1, 1, 1, 1), "should equal")
+	assert.Equal(t, 0.8, powerHeuristic(1, 2, 1, 1), "should equal")
+	assert.Equal(t, 1.0, powerHeuristic(1, math.Inf(1), 1, 1), "should equal")
+	assert.Equal(t, 0.0, powerHeuristic(1, 0, 1, 0), "should equal")
+}
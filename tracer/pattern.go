@@ -2,7 +2,6 @@ package tracer
 
 import (
 	"math"
-	"time"
 
 	"github.com/ojrac/opensimplex-go"
 )
@@ -18,6 +17,15 @@ type Patterner interface {
 	SetTransform(Matrix)
 }
 
+// ScalarPattern is a pattern with a value in [0, 1] at each point, such as the noise patterns
+// The value can be used as a mask or as a height, see PatternPerturber.
+type ScalarPattern interface {
+	Patterner
+
+	// ValueAt returns the value at the point in object space
+	ValueAt(Point) float64
+}
+
 // basePattern is the base pattern for others
 type basePattern struct {
 	transform        Matrix
@@ -114,11 +122,11 @@ func (cm *CubeMapPattern) faceFromPoint(p Point) cubeFace {
 
 // ColorAtObject returns the color for the given pattern on the given object
 func (cm *CubeMapPattern) ColorAtObject(o Shaper, p Point) Color {
-	return cm.colorAt(cm.objectSpacePoint(o, p))
+	return cm.colorAt(workingSpaceOf(o), cm.objectSpacePoint(o, p))
 }
 
-// ColorAt implements Patterner
-func (cm *CubeMapPattern) colorAt(p Point) Color {
+// colorAt returns the color at point p (pattern space), in the working space ws
+func (cm *CubeMapPattern) colorAt(ws WorkingSpace, p Point) Color {
 	// The correct face is calculated by this function
 	u, v := cm.mapper.Map(p)
 
@@ -127,17 +135,17 @@ func (cm *CubeMapPattern) colorAt(p Point) Color {
 
 	switch face {
 	case cubeFaceFront:
-		return cm.front.UVColorAt(u, v)
+		return uvColorIn(cm.front, ws, u, v)
 	case cubeFaceBack:
-		return cm.back.UVColorAt(u, v)
+		return uvColorIn(cm.back, ws, u, v)
 	case cubeFaceLeft:
-		return cm.left.UVColorAt(u, v)
+		return uvColorIn(cm.left, ws, u, v)
 	case cubeFaceRight:
-		return cm.right.UVColorAt(u, v)
+		return uvColorIn(cm.right, ws, u, v)
 	case cubeFaceUp:
-		return cm.up.UVColorAt(u, v)
+		return uvColorIn(cm.up, ws, u, v)
 	case cubeFaceDown:
-		return cm.down.UVColorAt(u, v)
+		return uvColorIn(cm.down, ws, u, v)
 	}
 
 	// should never happen
@@ -153,6 +161,7 @@ type TextureMapPattern struct {
 
 // NewTextureMapPattern returns a new texture map pattern
 // For cubes, use NewCubeMapPattern, this one works for planes, spheres, cylinders and cones
+// A nil mapper uses the surface coordinates of the shape, see NewSurfaceUVPattern.
 func NewTextureMapPattern(p UVPatterner, m Mapper) *TextureMapPattern {
 	return &TextureMapPattern{
 		pattern: p,
@@ -164,15 +173,27 @@ func NewTextureMapPattern(p UVPatterner, m Mapper) *TextureMapPattern {
 	}
 }
 
+// NewSurfaceUVPattern returns a new texture map pattern using the surface coordinates of the shape (see Shaper.UVAt)
+// It works for every shape, including triangles and the members of groups and CSG shapes. The pattern transform is
+// not used.
+func NewSurfaceUVPattern(p UVPatterner) *TextureMapPattern {
+	return NewTextureMapPattern(p, nil)
+}
+
 // ColorAtObject returns the color for the given pattern on the given object
 func (tmp *TextureMapPattern) ColorAtObject(o Shaper, p Point) Color {
-	return tmp.colorAt(tmp.objectSpacePoint(o, p))
+	ws := workingSpaceOf(o)
+	if tmp.mapper == nil {
+		u, v := o.UVAt(p, nil)
+		return uvColorIn(tmp.pattern, ws, u, v)
+	}
+	return tmp.colorAt(ws, tmp.objectSpacePoint(o, p))
 }
 
-// ColorAt implements Patterner
-func (tmp *TextureMapPattern) colorAt(p Point) Color {
+// colorAt returns the color at point p (pattern space), in the working space ws
+func (tmp *TextureMapPattern) colorAt(ws WorkingSpace, p Point) Color {
 	u, v := tmp.mapper.Map(p)
-	return tmp.pattern.UVColorAt(u, v)
+	return uvColorIn(tmp.pattern, ws, u, v)
 }
 
 // StripedPattern is a pattern that overlays stripes
@@ -308,15 +329,15 @@ type PerturbedPattern struct {
 	maxNoise float64
 }
 
-// NewPerturbedPattern returns a new perturbed patterner
+// NewPerturbedPattern returns a new perturbed patterner, the same seed always gives the same noise
 // maxNoise is a [0, 1] value which clamps how much the noise affects the input
-func NewPerturbedPattern(p Patterner, maxNoise float64) *PerturbedPattern {
+func NewPerturbedPattern(p Patterner, maxNoise float64, seed int64) *PerturbedPattern {
 
 	if maxNoise < 0 || maxNoise > 1 {
 		panic("maxNoise must be between 0 and 1")
 	}
 
-	n := opensimplex.NewNormalized(time.Now().Unix())
+	n := opensimplex.NewNormalized(seed)
 
 	return &PerturbedPattern{
 		p:        p,
@@ -329,6 +350,11 @@ func NewPerturbedPattern(p Patterner, maxNoise float64) *PerturbedPattern {
 	}
 }
 
+// SetSeed reseeds the noise
+func (pp *PerturbedPattern) SetSeed(seed int64) {
+	pp.noise = opensimplex.NewNormalized(seed)
+}
+
 // ColorAtObject returns the color for the given pattern on the given object
 func (pp *PerturbedPattern) ColorAtObject(o Shaper, p Point) Color {
 	// change p using opensimplex
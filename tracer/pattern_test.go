@@ -661,7 +661,7 @@ func TestTextureMapSpherical_colorAt(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := tt.tm.colorAt(tt.args.p)
+			got := tt.tm.colorAt(WorkingSpaceSRGB, tt.args.p)
 			assert.Equal(t, tt.want, got, "should equal")
 		})
 	}
@@ -813,8 +813,45 @@ func TestCubeMapPattern_colorAt(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := cm.colorAt(tt.args.p)
+			got := cm.colorAt(WorkingSpaceSRGB, tt.args.p)
 			assert.Equal(t, tt.want, got, "should equal")
 		})
 	}
 }
+
+func TestSurfaceUVPattern(t *testing.T) {
+	p := NewSurfaceUVPattern(NewUVCheckersPattern(2, 2, Black(), White()))
+
+	plane := NewPlane()
+	g := NewGroup()
+	g.SetTransform(IM().Translate(0.5, 0, 0))
+	g.AddMember(plane)
+
+	tri := NewTriangle(NewPoint(0, 1, 0), NewPoint(-1, 0, 0), NewPoint(1, 0, 0))
+
+	tests := []struct {
+		name string
+		o    Shaper
+		p    Point
+		want Color
+	}{
+		{
+			name: "plane in a group",
+			o:    plane,
+			p:    NewPoint(0.75, 0, 0.5),
+			want: White(),
+		},
+		{
+			name: "triangle",
+			o:    tri,
+			p:    NewPoint(0, 0.5, 0),
+			want: Black(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, p.ColorAtObject(tt.o, tt.p), "should equal")
+		})
+	}
+}
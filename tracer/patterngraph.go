@@ -0,0 +1,352 @@
+package tracer
+
+import (
+	"math"
+	"sort"
+)
+
+// localPatterner is a pattern that can be evaluated at a point in the object space of the shape
+// Pattern graph nodes pass points to their inputs in their own space, patterns that don't implement it are given the
+// point converted back to world space.
+type localPatterner interface {
+	colorAtLocal(o Shaper, op Point) Color
+}
+
+// patternColorAt returns the color of the pattern at op, a point in the object space of o
+func patternColorAt(p Patterner, o Shaper, op Point) Color {
+	if lp, ok := p.(localPatterner); ok {
+		return lp.colorAtLocal(o, op)
+	}
+	return p.ColorAtObject(o, op.ToWorldSpace(o))
+}
+
+// colorAtLocal implements localPatterner
+func (np *noisePattern) colorAtLocal(o Shaper, op Point) Color {
+	return np.colorAt(op.TimesMatrix(np.TransformInverse()))
+}
+
+// patternNode is the base of the nodes of pattern graphs, which combine and change the colors of other patterns
+// The transform of a node applies to all its inputs, on top of their own transforms.
+type patternNode struct {
+	basePattern
+
+	// eval returns the color at the point in the space of the node, each node sets it to its own function
+	eval func(o Shaper, p Point) Color
+}
+
+// newPatternNode returns a new node base
+func newPatternNode() patternNode {
+	return patternNode{
+		basePattern: basePattern{
+			transform:        IM(),
+			transformInverse: IM().Inverse(),
+		},
+	}
+}
+
+// ColorAtObject returns the color for the given pattern on the given object
+func (pn *patternNode) ColorAtObject(o Shaper, p Point) Color {
+	return pn.colorAtLocal(o, p.ToObjectSpace(o))
+}
+
+// colorAtLocal implements localPatterner
+func (pn *patternNode) colorAtLocal(o Shaper, op Point) Color {
+	return pn.eval(o, op.TimesMatrix(pn.TransformInverse()))
+}
+
+// SolidPattern is a single color, mostly useful as the input of other nodes
+type SolidPattern struct {
+	patternNode
+	c Color
+}
+
+// NewSolidPattern returns a new pattern of one color
+func NewSolidPattern(c Color) *SolidPattern {
+	sp := &SolidPattern{patternNode: newPatternNode(), c: c}
+	sp.eval = func(Shaper, Point) Color { return sp.c }
+	return sp
+}
+
+// MixPattern blends between two patterns by the value of a mask pattern: a where the mask is 0, b where it is 1
+type MixPattern struct {
+	patternNode
+	a, b, mask Patterner
+
+	// Channel is the channel of the mask's color used as the blend factor
+	Channel Channel
+}
+
+// NewMixPattern returns a new pattern mixing a and b by the luminance of the mask
+func NewMixPattern(a, b, mask Patterner) *MixPattern {
+	mp := &MixPattern{patternNode: newPatternNode(), a: a, b: b, mask: mask, Channel: ChannelLuminance}
+	mp.eval = mp.colorAt
+	return mp
+}
+
+// colorAt returns the color at the point in the space of the node
+func (mp *MixPattern) colorAt(o Shaper, p Point) Color {
+	t := mp.Channel.value(patternColorAt(mp.mask, o, p))
+	// skip the inputs that don't contribute, they may be expensive
+	switch {
+	case t <= 0:
+		return patternColorAt(mp.a, o, p)
+	case t >= 1:
+		return patternColorAt(mp.b, o, p)
+	}
+	return patternColorAt(mp.a, o, p).Scale(1 - t).Add(patternColorAt(mp.b, o, p).Scale(t))
+}
+
+// ColorStop is a color at a position of a ColorRamp
+type ColorStop struct {
+	Position float64
+	Color    Color
+}
+
+// RampInterpolation is how a ColorRamp blends between its stops
+type RampInterpolation int
+
+const (
+	// RampLinear blends linearly between the stops
+	RampLinear RampInterpolation = iota
+	// RampConstant keeps the color of each stop until the next one
+	RampConstant
+	// RampSmooth blends between the stops with a smoothstep, so the colors ease in and out of each stop
+	RampSmooth
+)
+
+// ColorRamp maps values to colors through a list of stops, values outside the stops get the color of the closest one
+type ColorRamp struct {
+	Interpolation RampInterpolation
+	stops         []ColorStop
+}
+
+// NewColorRamp returns a new linear ramp through the stops, in any order
+func NewColorRamp(stops ...ColorStop) *ColorRamp {
+	s := append([]ColorStop(nil), stops...)
+	sort.SliceStable(s, func(i, j int) bool { return s[i].Position < s[j].Position })
+	return &ColorRamp{stops: s}
+}
+
+// Stops returns the stops of the ramp, sorted by position
+func (cr *ColorRamp) Stops() []ColorStop {
+	return cr.stops
+}
+
+// At returns the color of the ramp at t
+func (cr *ColorRamp) At(t float64) Color {
+	n := len(cr.stops)
+	switch {
+	case n == 0:
+		return Black()
+	case t <= cr.stops[0].Position:
+		return cr.stops[0].Color
+	case t >= cr.stops[n-1].Position:
+		return cr.stops[n-1].Color
+	}
+
+	// the first stop after t
+	i := sort.Search(n, func(i int) bool { return cr.stops[i].Position > t })
+	s0, s1 := cr.stops[i-1], cr.stops[i]
+	f := (t - s0.Position) / (s1.Position - s0.Position)
+	switch cr.Interpolation {
+	case RampConstant:
+		return s0.Color
+	case RampSmooth:
+		f = f * f * (3 - 2*f)
+	}
+	return s0.Color.Scale(1 - f).Add(s1.Color.Scale(f))
+}
+
+// RampPattern maps the value of a pattern to colors through a ColorRamp, to color masks and noise
+type RampPattern struct {
+	patternNode
+	input Patterner
+	Ramp  *ColorRamp
+
+	// Channel is the channel of the input's color looked up in the ramp
+	Channel Channel
+}
+
+// NewRampPattern returns a new pattern mapping the luminance of the input through the ramp
+func NewRampPattern(input Patterner, ramp *ColorRamp) *RampPattern {
+	rp := &RampPattern{patternNode: newPatternNode(), input: input, Ramp: ramp, Channel: ChannelLuminance}
+	rp.eval = func(o Shaper, p Point) Color {
+		return rp.Ramp.At(rp.Channel.value(patternColorAt(rp.input, o, p)))
+	}
+	return rp
+}
+
+// RampGradientPattern is a gradient through the colors of a ColorRamp along x, repeating every unit, the multi-stop
+// version of GradientPattern
+type RampGradientPattern struct {
+	patternNode
+	Ramp *ColorRamp
+}
+
+// NewRampGradientPattern returns a new gradient through the ramp
+func NewRampGradientPattern(ramp *ColorRamp) *RampGradientPattern {
+	gp := &RampGradientPattern{patternNode: newPatternNode(), Ramp: ramp}
+	gp.eval = func(o Shaper, p Point) Color {
+		return gp.Ramp.At(p.X() - math.Floor(p.X()))
+	}
+	return gp
+}
+
+// MathPattern combines the colors of its input patterns channel by channel
+type MathPattern struct {
+	patternNode
+	inputs []Patterner
+	op     func(c []Color) Color
+}
+
+// newMathPattern returns a new pattern applying op to the colors of the inputs
+func newMathPattern(op func(c []Color) Color, inputs ...Patterner) *MathPattern {
+	mp := &MathPattern{patternNode: newPatternNode(), inputs: inputs, op: op}
+	mp.eval = mp.colorAt
+	return mp
+}
+
+// colorAt returns the color at the point in the space of the node
+func (mp *MathPattern) colorAt(o Shaper, p Point) Color {
+	colors := make([]Color, len(mp.inputs))
+	for i, in := range mp.inputs {
+		colors[i] = patternColorAt(in, o, p)
+	}
+	return mp.op(colors)
+}
+
+// NewAddPattern returns a new pattern of the sum of the colors of the patterns
+func NewAddPattern(patterns ...Patterner) *MathPattern {
+	return newMathPattern(func(c []Color) Color {
+		sum := Black()
+		for _, clr := range c {
+			sum = sum.Add(clr)
+		}
+		return sum
+	}, patterns...)
+}
+
+// NewMultiplyPattern returns a new pattern of the product of the colors of the patterns
+func NewMultiplyPattern(patterns ...Patterner) *MathPattern {
+	return newMathPattern(func(c []Color) Color {
+		product := White()
+		for _, clr := range c {
+			product = product.Blend(clr)
+		}
+		return product
+	}, patterns...)
+}
+
+// NewInvertPattern returns a new pattern of white minus the color of the pattern
+func NewInvertPattern(p Patterner) *MathPattern {
+	return newMathPattern(func(c []Color) Color {
+		return White().Sub(c[0])
+	}, p)
+}
+
+// NewClampPattern returns a new pattern of the color of the pattern clamped to [min, max]
+func NewClampPattern(p Patterner, min, max float64) *MathPattern {
+	return newMathPattern(func(c []Color) Color {
+		clamp := func(v float64) float64 { return math.Max(min, math.Min(max, v)) }
+		return NewColor(clamp(c[0].R), clamp(c[0].G), clamp(c[0].B))
+	}, p)
+}
+
+// NewRemapPattern returns a new pattern mapping the color of the pattern from [fromMin, fromMax] to [toMin, toMax],
+// values outside the range are extrapolated (clamp them with NewClampPattern)
+func NewRemapPattern(p Patterner, fromMin, fromMax, toMin, toMax float64) *MathPattern {
+	return newMathPattern(func(c []Color) Color {
+		remap := func(v float64) float64 {
+			if fromMax == fromMin {
+				return toMin
+			}
+			return toMin + (v-fromMin)/(fromMax-fromMin)*(toMax-toMin)
+		}
+		return NewColor(remap(c[0].R), remap(c[0].G), remap(c[0].B))
+	}, p)
+}
+
+// NewChannelPattern returns a new grey pattern of one channel of the color of the pattern
+func NewChannelPattern(p Patterner, ch Channel) *MathPattern {
+	return newMathPattern(func(c []Color) Color {
+		v := ch.value(c[0])
+		return NewColor(v, v, v)
+	}, p)
+}
+
+// DistortPattern moves the points a pattern is evaluated at by fBm noise, domain distortion, which turns straight
+// lines into organic swirls
+type DistortPattern struct {
+	patternNode
+	Fractal
+	input Patterner
+	// Strength is the largest distance points are moved
+	Strength float64
+	noise    *PerlinNoise
+}
+
+// NewDistortPattern returns a new pattern distorting the input, the same seed always gives the same distortion
+func NewDistortPattern(input Patterner, strength float64, seed int64) *DistortPattern {
+	dp := &DistortPattern{
+		patternNode: newPatternNode(),
+		Fractal:     NewFractal(),
+		input:       input,
+		Strength:    strength,
+		noise:       NewPerlinNoise(seed),
+	}
+	dp.eval = func(o Shaper, p Point) Color {
+		return patternColorAt(dp.input, o, p.AddVector(dp.offset(p)))
+	}
+	return dp
+}
+
+// offset returns how far the point p moves
+// Each axis samples the noise far from the others, so they are unrelated.
+func (dp *DistortPattern) offset(p Point) Vector {
+	return NewVector(
+		dp.FBM(dp.noise, p),
+		dp.FBM(dp.noise, p.AddVector(NewVector(31.7, 0, 0))),
+		dp.FBM(dp.noise, p.AddVector(NewVector(0, 0, 47.3))),
+	).Scale(dp.Strength)
+}
+
+// PolarPattern evaluates its input in cylindrical coordinates around the y axis: x is the angle (0 to 1 around the
+// axis), y stays the same and z is the distance from the axis
+// Stripes become rays from the axis and gradients become sweeps around it.
+type PolarPattern struct {
+	patternNode
+	input Patterner
+}
+
+// NewPolarPattern returns a new pattern wrapping the input around the y axis
+func NewPolarPattern(input Patterner) *PolarPattern {
+	pp := &PolarPattern{patternNode: newPatternNode(), input: input}
+	pp.eval = func(o Shaper, p Point) Color {
+		angle := math.Atan2(p.Z(), p.X())/(2*math.Pi) + 0.5
+		return patternColorAt(pp.input, o, NewPoint(angle, p.Y(), math.Hypot(p.X(), p.Z())))
+	}
+	return pp
+}
+
+// UVPolarPattern evaluates its input in polar coordinates around the center of the texture: u is the angle (0 to 1
+// around the center) and v the distance from the center (1 at the middle of the edges)
+type UVPolarPattern struct {
+	input UVPatterner
+}
+
+// NewUVPolarPattern returns a new UV pattern wrapping the input around the center of the texture
+func NewUVPolarPattern(input UVPatterner) *UVPolarPattern {
+	return &UVPolarPattern{input: input}
+}
+
+// UVColorAt returns the color at the 2D coordinate (u, v)
+func (upp *UVPolarPattern) UVColorAt(u, v float64) Color {
+	return upp.uvColorIn(WorkingSpaceSRGB, u, v)
+}
+
+// uvColorIn implements uvSpacePatterner
+func (upp *UVPolarPattern) uvColorIn(ws WorkingSpace, u, v float64) Color {
+	x, y := u-0.5, v-0.5
+	angle := math.Atan2(y, x)/(2*math.Pi) + 0.5
+	return uvColorIn(upp.input, ws, angle, 2*math.Hypot(x, y))
+}
@@ -0,0 +1,252 @@
+package tracer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestColorRamp_At(t *testing.T) {
+	stops := []ColorStop{
+		{Position: 1, Color: NewColor(0, 0, 1)},
+		{Position: 0, Color: NewColor(1, 0, 0)},
+		{Position: 0.5, Color: NewColor(0, 1, 0)},
+	}
+
+	tests := []struct {
+		name          string
+		interpolation RampInterpolation
+		t             float64
+		want          Color
+	}{
+		{
+			name:          "before the first stop",
+			interpolation: RampLinear,
+			t:             -1,
+			want:          NewColor(1, 0, 0),
+		},
+		{
+			name:          "after the last stop",
+			interpolation: RampLinear,
+			t:             2,
+			want:          NewColor(0, 0, 1),
+		},
+		{
+			name:          "on a stop",
+			interpolation: RampLinear,
+			t:             0.5,
+			want:          NewColor(0, 1, 0),
+		},
+		{
+			name:          "linear",
+			interpolation: RampLinear,
+			t:             0.125,
+			want:          NewColor(0.75, 0.25, 0),
+		},
+		{
+			name:          "constant",
+			interpolation: RampConstant,
+			t:             0.75,
+			want:          NewColor(0, 1, 0),
+		},
+		{
+			name:          "smooth",
+			interpolation: RampSmooth,
+			t:             0.625,
+			want:          NewColor(0, 0.84375, 0.15625),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ramp := NewColorRamp(stops...)
+			ramp.Interpolation = tt.interpolation
+			assert.Equal(t, 0.0, ramp.Stops()[0].Position, "sorted")
+			got := ramp.At(tt.t)
+			assert.True(t, tt.want.Equal(got), "want %v, got %v", tt.want, got)
+		})
+	}
+}
+
+func TestPatternGraph(t *testing.T) {
+	red, blue := NewColor(1, 0, 0), NewColor(0, 0, 1)
+	grey := NewSolidPattern(NewColor(0.25, 0.5, 0.75))
+	// black to white along x
+	gradient := NewGradientPattern(Black(), White())
+
+	tests := []struct {
+		name    string
+		pattern Patterner
+		point   Point
+		want    Color
+	}{
+		{
+			name:    "solid",
+			pattern: grey,
+			point:   NewPoint(3, 4, 5),
+			want:    NewColor(0.25, 0.5, 0.75),
+		},
+		{
+			name:    "mix",
+			pattern: NewMixPattern(NewSolidPattern(red), NewSolidPattern(blue), gradient),
+			point:   NewPoint(0.25, 0, 0),
+			want:    NewColor(0.75, 0, 0.25),
+		},
+		{
+			name: "mix by channel",
+			pattern: func() Patterner {
+				mp := NewMixPattern(NewSolidPattern(red), NewSolidPattern(blue), grey)
+				mp.Channel = ChannelB
+				return mp
+			}(),
+			point: NewPoint(0, 0, 0),
+			want:  NewColor(0.25, 0, 0.75),
+		},
+		{
+			name:    "ramp",
+			pattern: NewRampPattern(gradient, NewColorRamp(ColorStop{0, red}, ColorStop{1, blue})),
+			point:   NewPoint(0.5, 0, 0),
+			want:    NewColor(0.5, 0, 0.5),
+		},
+		{
+			name:    "ramp gradient",
+			pattern: NewRampGradientPattern(NewColorRamp(ColorStop{0, red}, ColorStop{1, blue})),
+			point:   NewPoint(2.25, 0, 0),
+			want:    NewColor(0.75, 0, 0.25),
+		},
+		{
+			name:    "add",
+			pattern: NewAddPattern(grey, grey, NewSolidPattern(red)),
+			point:   NewPoint(0, 0, 0),
+			want:    NewColor(1.5, 1, 1.5),
+		},
+		{
+			name:    "multiply",
+			pattern: NewMultiplyPattern(grey, grey),
+			point:   NewPoint(0, 0, 0),
+			want:    NewColor(0.0625, 0.25, 0.5625),
+		},
+		{
+			name:    "invert",
+			pattern: NewInvertPattern(grey),
+			point:   NewPoint(0, 0, 0),
+			want:    NewColor(0.75, 0.5, 0.25),
+		},
+		{
+			name:    "clamp",
+			pattern: NewClampPattern(grey, 0.4, 0.6),
+			point:   NewPoint(0, 0, 0),
+			want:    NewColor(0.4, 0.5, 0.6),
+		},
+		{
+			name:    "remap",
+			pattern: NewRemapPattern(grey, 0.25, 0.75, 1, 0),
+			point:   NewPoint(0, 0, 0),
+			want:    NewColor(1, 0.5, 0),
+		},
+		{
+			name:    "channel",
+			pattern: NewChannelPattern(grey, ChannelG),
+			point:   NewPoint(0, 0, 0),
+			want:    NewColor(0.5, 0.5, 0.5),
+		},
+		{
+			name:    "polar",
+			pattern: NewPolarPattern(gradient),
+			point:   NewPoint(0, 0, -1),
+			want:    NewColor(0.25, 0.25, 0.25),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.pattern.ColorAtObject(NewUnitSphere(), tt.point)
+			assert.True(t, tt.want.Equal(got), "want %v, got %v", tt.want, got)
+		})
+	}
+}
+
+func TestPatternGraph_Transforms(t *testing.T) {
+	s := NewUnitSphere()
+	s.SetTransform(IM().Scale(2, 2, 2))
+
+	// the gradient is evaluated in the space of the node: world / 2 (shape) / 2 (node) / 2 (gradient)
+	gradient := NewGradientPattern(Black(), White())
+	gradient.SetTransform(IM().Scale(2, 2, 2))
+	node := NewRemapPattern(gradient, 0, 1, 0, 1)
+	node.SetTransform(IM().Scale(2, 2, 2))
+
+	got := node.ColorAtObject(s, NewPoint(3, 0, 0))
+	assert.True(t, NewColor(0.375, 0.375, 0.375).Equal(got), "got %v", got)
+
+	// noise patterns give the same value inside a node
+	fbm := NewFBMPattern(Black(), White(), 1)
+	fbm.SetTransform(IM().Scale(0.5, 0.5, 0.5))
+	p := NewPoint(0.3, 1.7, -2.2)
+	v := fbm.ValueAt(p.ToObjectSpace(s))
+	got = NewChannelPattern(fbm, ChannelLuminance).ColorAtObject(s, p)
+	assert.True(t, NewColor(v, v, v).Equal(got), "got %v", got)
+}
+
+func TestDistortPattern(t *testing.T) {
+	gradient := NewGradientPattern(Black(), White())
+	s := NewUnitSphere()
+
+	none := NewDistortPattern(gradient, 0, 1)
+	p := NewPoint(0.3, 0.2, 0.1)
+	assert.True(t, gradient.ColorAtObject(s, p).Equal(none.ColorAtObject(s, p)), "no strength, no distortion")
+
+	dp := NewDistortPattern(gradient, 0.5, 1)
+	same := NewDistortPattern(gradient, 0.5, 1)
+	differ := false
+	for _, pt := range randomNoisePoints(100) {
+		got := dp.ColorAtObject(s, pt)
+		assert.True(t, got.Equal(same.ColorAtObject(s, pt)), "same seed, same distortion")
+		differ = differ || !got.Equal(gradient.ColorAtObject(s, pt))
+	}
+	assert.True(t, differ, "the points move")
+}
+
+func TestUVPolarPattern(t *testing.T) {
+	// u to red, v to green
+	uv := NewUVPolarPattern(uvFunc(func(u, v float64) Color { return NewColor(u, v, 0) }))
+
+	tests := []struct {
+		name string
+		u, v float64
+		want Color
+	}{
+		{
+			name: "center",
+			u:    0.5,
+			v:    0.5,
+			want: NewColor(0.5, 0, 0),
+		},
+		{
+			name: "right edge",
+			u:    1,
+			v:    0.5,
+			want: NewColor(0.5, 1, 0),
+		},
+		{
+			name: "top edge",
+			u:    0.5,
+			v:    1,
+			want: NewColor(0.75, 1, 0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := uv.UVColorAt(tt.u, tt.v)
+			assert.True(t, tt.want.Equal(got), "want %v, got %v", tt.want, got)
+		})
+	}
+}
+
+// uvFunc is a UVPatterner calling the function
+type uvFunc func(u, v float64) Color
+
+func (f uvFunc) UVColorAt(u, v float64) Color {
+	return f(u, v)
+}
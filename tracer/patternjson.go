@@ -0,0 +1,442 @@
+package tracer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// patternJSON is a node of the JSON description of a pattern graph, see ParsePatternJSON
+// Each type of node only reads the fields it needs.
+type patternJSON struct {
+	Type string `json:"type"`
+
+	// inputs of nodes
+	Input  *patternJSON   `json:"input"`
+	Inputs []*patternJSON `json:"inputs"`
+	A      *patternJSON   `json:"a"`
+	B      *patternJSON   `json:"b"`
+	Mask   *patternJSON   `json:"mask"`
+
+	// colors
+	Color         *[3]float64  `json:"color"`
+	Colors        [][3]float64 `json:"colors"`
+	Stops         []stopJSON   `json:"stops"`
+	Interpolation string       `json:"interpolation"`
+	Channel       string       `json:"channel"`
+
+	// noise
+	Seed       int64    `json:"seed"`
+	Octaves    *int     `json:"octaves"`
+	Lacunarity *float64 `json:"lacunarity"`
+	Gain       *float64 `json:"gain"`
+	Offset     *float64 `json:"offset"`
+	Frequency  *float64 `json:"frequency"`
+	Distortion *float64 `json:"distortion"`
+	Rings      *float64 `json:"rings"`
+	Grain      *float64 `json:"grain"`
+	Crystals   *float64 `json:"crystals"`
+	Jitter     *float64 `json:"jitter"`
+	Mode       string   `json:"mode"`
+	Strength   float64  `json:"strength"`
+
+	// math
+	Min  *float64    `json:"min"`
+	Max  *float64    `json:"max"`
+	From *[2]float64 `json:"from"`
+	To   *[2]float64 `json:"to"`
+
+	// uv patterns
+	File   string  `json:"file"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+
+	Transform []transformJSON `json:"transform"`
+}
+
+// stopJSON is a stop of a color ramp
+type stopJSON struct {
+	Position float64    `json:"position"`
+	Color    [3]float64 `json:"color"`
+}
+
+// transformJSON is one step of the transform of a pattern, the steps are applied in order
+type transformJSON struct {
+	Translate *[3]float64 `json:"translate"`
+	Scale     *[3]float64 `json:"scale"`
+	RotateX   *float64    `json:"rotate_x"`
+	RotateY   *float64    `json:"rotate_y"`
+	RotateZ   *float64    `json:"rotate_z"`
+}
+
+// LoadPatternJSON reads the pattern graph described by the JSON file, see ParsePatternJSON
+// Images are read relative to the directory of the file.
+func LoadPatternJSON(filename string) (Patterner, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	p, err := ParsePatternJSON(f, filepath.Dir(filename))
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", filename, err)
+	}
+	return p, nil
+}
+
+// ParsePatternJSON returns the pattern graph described by the JSON, images are read relative to dir
+// Each node is an object with a "type" and the fields of that type, inputs are nested nodes:
+//
+//	{
+//	  "type": "mix",
+//	  "a": {"type": "solid", "color": [0.8, 0.1, 0.1]},
+//	  "b": {"type": "marble", "colors": [[1, 1, 1], [0.2, 0.2, 0.2]], "seed": 3},
+//	  "mask": {"type": "fbm", "seed": 1, "octaves": 4},
+//	  "transform": [{"scale": [2, 2, 2]}, {"rotate_y": 0.5}]
+//	}
+//
+// Patterns: solid (color), stripes, gradient, rings, checkers (colors), perlin, fbm, turbulence, ridged, worley, marble,
+// wood, granite (colors, seed, the fractal settings octaves, lacunarity and gain, and the settings of each pattern).
+// Nodes: mix (a, b, mask, channel), ramp (input, stops, interpolation, channel), ramp_gradient (stops,
+// interpolation), add and multiply (inputs), invert (input), clamp (input, min, max), remap (input, from, to), channel
+// (input, channel), distort (input, strength, seed) and polar (input).
+// UV patterns, mapped with the surface coordinates of the shape: image (file), uv_checkers (width, height, colors) and
+// uv_polar (input).
+// Two color patterns default to black and white, which makes them masks.
+func ParsePatternJSON(r io.Reader, dir string) (Patterner, error) {
+	d := json.NewDecoder(r)
+	d.DisallowUnknownFields()
+
+	var n patternJSON
+	if err := d.Decode(&n); err != nil {
+		return nil, err
+	}
+	return n.pattern(dir)
+}
+
+// pattern returns the pattern of the node
+func (n *patternJSON) pattern(dir string) (Patterner, error) {
+	p, err := n.build(dir)
+	if err != nil {
+		return nil, err
+	}
+	if n.Transform != nil {
+		p.SetTransform(n.transform())
+	}
+	return p, nil
+}
+
+// build returns the pattern of the node, without its transform
+func (n *patternJSON) build(dir string) (Patterner, error) {
+	switch n.Type {
+	case "solid":
+		if n.Color == nil {
+			return nil, fmt.Errorf("solid: no color")
+		}
+		return NewSolidPattern(jsonColor(*n.Color)), nil
+	case "stripes", "gradient", "rings", "checkers":
+		a, b, err := n.colors()
+		if err != nil {
+			return nil, err
+		}
+		switch n.Type {
+		case "stripes":
+			return NewStripedPattern(a, b), nil
+		case "gradient":
+			return NewGradientPattern(a, b), nil
+		case "rings":
+			return NewRingPattern(a, b), nil
+		}
+		return NewCheckerPattern(a, b), nil
+	case "perlin", "fbm", "turbulence", "ridged", "worley", "marble", "wood", "granite":
+		return n.noise()
+	case "mix":
+		inputs, err := n.inputs(dir, n.A, n.B, n.Mask)
+		if err != nil {
+			return nil, err
+		}
+		ch, err := n.channel()
+		if err != nil {
+			return nil, err
+		}
+		mp := NewMixPattern(inputs[0], inputs[1], inputs[2])
+		mp.Channel = ch
+		return mp, nil
+	case "ramp":
+		inputs, err := n.inputs(dir, n.Input)
+		if err != nil {
+			return nil, err
+		}
+		ramp, err := n.ramp()
+		if err != nil {
+			return nil, err
+		}
+		ch, err := n.channel()
+		if err != nil {
+			return nil, err
+		}
+		rp := NewRampPattern(inputs[0], ramp)
+		rp.Channel = ch
+		return rp, nil
+	case "ramp_gradient":
+		ramp, err := n.ramp()
+		if err != nil {
+			return nil, err
+		}
+		return NewRampGradientPattern(ramp), nil
+	case "add", "multiply":
+		if len(n.Inputs) == 0 {
+			return nil, fmt.Errorf("%v: no inputs", n.Type)
+		}
+		inputs, err := n.inputs(dir, n.Inputs...)
+		if err != nil {
+			return nil, err
+		}
+		if n.Type == "add" {
+			return NewAddPattern(inputs...), nil
+		}
+		return NewMultiplyPattern(inputs...), nil
+	case "invert", "clamp", "remap", "channel", "distort", "polar":
+		inputs, err := n.inputs(dir, n.Input)
+		if err != nil {
+			return nil, err
+		}
+		return n.unary(inputs[0])
+	case "image", "uv_checkers", "uv_polar":
+		uv, err := n.uvPattern(dir)
+		if err != nil {
+			return nil, err
+		}
+		return NewSurfaceUVPattern(uv), nil
+	case "":
+		return nil, fmt.Errorf("pattern without a type")
+	}
+	return nil, fmt.Errorf("unknown pattern type %q", n.Type)
+}
+
+// unary returns the pattern of the nodes with one input
+func (n *patternJSON) unary(input Patterner) (Patterner, error) {
+	switch n.Type {
+	case "invert":
+		return NewInvertPattern(input), nil
+	case "clamp":
+		min, max := 0.0, 1.0
+		if n.Min != nil {
+			min = *n.Min
+		}
+		if n.Max != nil {
+			max = *n.Max
+		}
+		return NewClampPattern(input, min, max), nil
+	case "remap":
+		if n.From == nil || n.To == nil {
+			return nil, fmt.Errorf("remap: needs from and to")
+		}
+		return NewRemapPattern(input, n.From[0], n.From[1], n.To[0], n.To[1]), nil
+	case "channel":
+		ch, err := n.channel()
+		if err != nil {
+			return nil, err
+		}
+		return NewChannelPattern(input, ch), nil
+	case "distort":
+		dp := NewDistortPattern(input, n.Strength, n.Seed)
+		dp.Fractal = n.fractal(dp.Fractal)
+		return dp, nil
+	}
+	return NewPolarPattern(input), nil
+}
+
+// noise returns the noise pattern of the node
+func (n *patternJSON) noise() (Patterner, error) {
+	a, b, err := n.colors()
+	if err != nil {
+		return nil, err
+	}
+	set := func(dst *float64, v *float64) {
+		if v != nil {
+			*dst = *v
+		}
+	}
+
+	switch n.Type {
+	case "perlin":
+		return NewPerlinPattern(a, b, n.Seed), nil
+	case "fbm":
+		p := NewFBMPattern(a, b, n.Seed)
+		p.Fractal = n.fractal(p.Fractal)
+		return p, nil
+	case "turbulence":
+		p := NewTurbulencePattern(a, b, n.Seed)
+		p.Fractal = n.fractal(p.Fractal)
+		return p, nil
+	case "ridged":
+		p := NewRidgedPattern(a, b, n.Seed)
+		p.Fractal = n.fractal(p.Fractal)
+		set(&p.Offset, n.Offset)
+		return p, nil
+	case "worley":
+		modes := map[string]WorleyMode{"": WorleyF1, "f1": WorleyF1, "f2": WorleyF2, "f2-f1": WorleyF2MinusF1, "cells": WorleyCells}
+		mode, ok := modes[n.Mode]
+		if !ok {
+			return nil, fmt.Errorf("worley: unknown mode %q", n.Mode)
+		}
+		p := NewWorleyPattern(a, b, n.Seed, mode)
+		set(&p.Noise().Jitter, n.Jitter)
+		return p, nil
+	case "marble":
+		p := NewMarblePattern(a, b, n.Seed)
+		p.Fractal = n.fractal(p.Fractal)
+		set(&p.Frequency, n.Frequency)
+		set(&p.Distortion, n.Distortion)
+		return p, nil
+	case "wood":
+		p := NewWoodPattern(a, b, n.Seed)
+		p.Fractal = n.fractal(p.Fractal)
+		set(&p.Rings, n.Rings)
+		set(&p.Distortion, n.Distortion)
+		set(&p.Grain, n.Grain)
+		return p, nil
+	}
+	p := NewGranitePattern(a, b, n.Seed)
+	p.Fractal = n.fractal(p.Fractal)
+	set(&p.Crystals, n.Crystals)
+	return p, nil
+}
+
+// uvPattern returns the UV pattern of the node
+func (n *patternJSON) uvPattern(dir string) (UVPatterner, error) {
+	if n.Transform != nil {
+		return nil, fmt.Errorf("%v: uv patterns have no transform", n.Type)
+	}
+
+	switch n.Type {
+	case "image":
+		if n.File == "" {
+			return nil, fmt.Errorf("image: no file")
+		}
+		file := n.File
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+		return NewUVImagePattern(file)
+	case "uv_checkers":
+		a, b, err := n.colors()
+		if err != nil {
+			return nil, err
+		}
+		return NewUVCheckersPattern(n.Width, n.Height, a, b), nil
+	case "uv_polar":
+		if n.Input == nil {
+			return nil, fmt.Errorf("uv_polar: no input")
+		}
+		input, err := n.Input.uvPattern(dir)
+		if err != nil {
+			return nil, fmt.Errorf("uv_polar: %v", err)
+		}
+		return NewUVPolarPattern(input), nil
+	}
+	return nil, fmt.Errorf("%q is not a uv pattern", n.Type)
+}
+
+// inputs returns the patterns of the input nodes, which must all be set
+func (n *patternJSON) inputs(dir string, nodes ...*patternJSON) ([]Patterner, error) {
+	var patterns []Patterner
+	for _, in := range nodes {
+		if in == nil {
+			return nil, fmt.Errorf("%v: missing input", n.Type)
+		}
+		p, err := in.pattern(dir)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", n.Type, err)
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+// colors returns the two colors of the node, black and white if not set
+func (n *patternJSON) colors() (Color, Color, error) {
+	switch len(n.Colors) {
+	case 0:
+		return Black(), White(), nil
+	case 2:
+		return jsonColor(n.Colors[0]), jsonColor(n.Colors[1]), nil
+	}
+	return Black(), Black(), fmt.Errorf("%v: needs 2 colors, got %v", n.Type, len(n.Colors))
+}
+
+// ramp returns the color ramp of the node
+func (n *patternJSON) ramp() (*ColorRamp, error) {
+	if len(n.Stops) == 0 {
+		return nil, fmt.Errorf("%v: no stops", n.Type)
+	}
+	var stops []ColorStop
+	for _, s := range n.Stops {
+		stops = append(stops, ColorStop{Position: s.Position, Color: jsonColor(s.Color)})
+	}
+	ramp := NewColorRamp(stops...)
+
+	interpolations := map[string]RampInterpolation{"": RampLinear, "linear": RampLinear, "constant": RampConstant, "smooth": RampSmooth}
+	i, ok := interpolations[n.Interpolation]
+	if !ok {
+		return nil, fmt.Errorf("%v: unknown interpolation %q", n.Type, n.Interpolation)
+	}
+	ramp.Interpolation = i
+	return ramp, nil
+}
+
+// channel returns the channel of the node, luminance if not set
+func (n *patternJSON) channel() (Channel, error) {
+	channels := map[string]Channel{"": ChannelLuminance, "luminance": ChannelLuminance, "r": ChannelR, "g": ChannelG, "b": ChannelB}
+	ch, ok := channels[n.Channel]
+	if !ok {
+		return ChannelLuminance, fmt.Errorf("%v: unknown channel %q", n.Type, n.Channel)
+	}
+	return ch, nil
+}
+
+// fractal returns the fractal settings f with the ones set on the node
+func (n *patternJSON) fractal(f Fractal) Fractal {
+	if n.Octaves != nil {
+		f.Octaves = *n.Octaves
+	}
+	if n.Lacunarity != nil {
+		f.Lacunarity = *n.Lacunarity
+	}
+	if n.Gain != nil {
+		f.Gain = *n.Gain
+	}
+	return f
+}
+
+// transform returns the transform of the node
+func (n *patternJSON) transform() Matrix {
+	m := IM()
+	for _, t := range n.Transform {
+		if t.Scale != nil {
+			m = m.Scale(t.Scale[0], t.Scale[1], t.Scale[2])
+		}
+		if t.RotateX != nil {
+			m = m.RotateX(*t.RotateX)
+		}
+		if t.RotateY != nil {
+			m = m.RotateY(*t.RotateY)
+		}
+		if t.RotateZ != nil {
+			m = m.RotateZ(*t.RotateZ)
+		}
+		if t.Translate != nil {
+			m = m.Translate(t.Translate[0], t.Translate[1], t.Translate[2])
+		}
+	}
+	return m
+}
+
+// jsonColor returns the color of the JSON array
+func jsonColor(c [3]float64) Color {
+	return NewColor(c[0], c[1], c[2])
+}
@@ -0,0 +1,163 @@
+package tracer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePatternJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		json  string
+		point Point
+		want  Color
+	}{
+		{
+			name:  "solid",
+			json:  `{"type": "solid", "color": [0.1, 0.2, 0.3]}`,
+			point: NewPoint(0, 0, 0),
+			want:  NewColor(0.1, 0.2, 0.3),
+		},
+		{
+			name:  "default colors",
+			json:  `{"type": "gradient"}`,
+			point: NewPoint(0.25, 0, 0),
+			want:  NewColor(0.25, 0.25, 0.25),
+		},
+		{
+			name:  "transform",
+			json:  `{"type": "gradient", "transform": [{"scale": [4, 4, 4]}, {"translate": [1, 0, 0]}]}`,
+			point: NewPoint(2, 0, 0),
+			want:  NewColor(0.25, 0.25, 0.25),
+		},
+		{
+			name: "mix",
+			json: `{
+				"type": "mix",
+				"a": {"type": "solid", "color": [1, 0, 0]},
+				"b": {"type": "solid", "color": [0, 0, 1]},
+				"mask": {"type": "gradient"}
+			}`,
+			point: NewPoint(0.25, 0, 0),
+			want:  NewColor(0.75, 0, 0.25),
+		},
+		{
+			name: "ramp",
+			json: `{
+				"type": "ramp",
+				"input": {"type": "gradient"},
+				"interpolation": "constant",
+				"stops": [{"position": 0, "color": [1, 0, 0]}, {"position": 0.5, "color": [0, 1, 0]}]
+			}`,
+			point: NewPoint(0.25, 0, 0),
+			want:  NewColor(1, 0, 0),
+		},
+		{
+			name: "math",
+			json: `{
+				"type": "remap",
+				"from": [0, 2],
+				"to": [0, 1],
+				"input": {
+					"type": "add",
+					"inputs": [
+						{"type": "solid", "color": [0.5, 0.5, 0.5]},
+						{"type": "invert", "input": {"type": "solid", "color": [0.5, 0.25, 0]}}
+					]
+				}
+			}`,
+			point: NewPoint(0, 0, 0),
+			want:  NewColor(0.5, 0.625, 0.75),
+		},
+		{
+			name:  "channel",
+			json:  `{"type": "channel", "channel": "r", "input": {"type": "solid", "color": [0.5, 0.25, 0]}}`,
+			point: NewPoint(0, 0, 0),
+			want:  NewColor(0.5, 0.5, 0.5),
+		},
+		{
+			name:  "uv pattern",
+			json:  `{"type": "uv_checkers", "width": 2, "height": 2, "colors": [[1, 0, 0], [0, 0, 1]]}`,
+			point: NewPoint(0, 1, 0),
+			want:  NewColor(0, 0, 1),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParsePatternJSON(strings.NewReader(tt.json), "")
+			assert.NoError(t, err, "should not error")
+			got := p.ColorAtObject(NewUnitSphere(), tt.point)
+			assert.True(t, tt.want.Equal(got), "want %v, got %v", tt.want, got)
+		})
+	}
+}
+
+func TestParsePatternJSON_Noise(t *testing.T) {
+	p, err := ParsePatternJSON(strings.NewReader(`{
+		"type": "distort",
+		"strength": 0.3,
+		"seed": 2,
+		"input": {"type": "marble", "seed": 1, "octaves": 3, "frequency": 2, "colors": [[1, 1, 1], [0, 0, 0]]}
+	}`), "")
+	assert.NoError(t, err, "should not error")
+
+	dp, ok := p.(*DistortPattern)
+	assert.True(t, ok, "distort node")
+	assert.Equal(t, 0.3, dp.Strength, "should equal")
+	mp, ok := dp.input.(*MarblePattern)
+	assert.True(t, ok, "marble input")
+	assert.Equal(t, 3, mp.Octaves, "should equal")
+	assert.Equal(t, 2.0, mp.Frequency, "should equal")
+	assert.Equal(t, 5.0, mp.Distortion, "default")
+}
+
+func TestParsePatternJSON_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want string
+	}{
+		{
+			name: "unknown type",
+			json: `{"type": "plaid"}`,
+			want: `unknown pattern type "plaid"`,
+		},
+		{
+			name: "unknown field",
+			json: `{"type": "solid", "colour": [1, 1, 1]}`,
+			want: `unknown field "colour"`,
+		},
+		{
+			name: "missing input",
+			json: `{"type": "mix", "a": {"type": "gradient"}, "b": {"type": "gradient"}}`,
+			want: "mix: missing input",
+		},
+		{
+			name: "nested error",
+			json: `{"type": "invert", "input": {"type": "checkers", "colors": [[1, 1, 1]]}}`,
+			want: "invert: checkers: needs 2 colors, got 1",
+		},
+		{
+			name: "unknown channel",
+			json: `{"type": "channel", "channel": "a", "input": {"type": "gradient"}}`,
+			want: `channel: unknown channel "a"`,
+		},
+		{
+			name: "uv transform",
+			json: `{"type": "uv_checkers", "width": 2, "height": 2, "transform": [{"scale": [2, 2, 2]}]}`,
+			want: "uv_checkers: uv patterns have no transform",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParsePatternJSON(strings.NewReader(tt.json), "")
+			if assert.Error(t, err, "should error") {
+				assert.Contains(t, err.Error(), tt.want, "should contain")
+			}
+		})
+	}
+}
@@ -1,11 +1,7 @@
 package tracer
 
 import (
-	"image"
-	"log"
 	"math"
-	"os"
-	"time"
 
 	"github.com/ojrac/opensimplex-go"
 )
@@ -19,6 +15,12 @@ type Perturber interface {
 	SetTransform(Matrix)
 }
 
+// tangentSpacePerturber is a Perturber that works in the tangent space of the surface, it is given the texture
+// coordinates and the tangent and bitangent (the directions of increasing u and v) at the point
+type tangentSpacePerturber interface {
+	perturbTangentSpace(n, t, b Vector, u, v float64) Vector
+}
+
 type basePerturb struct {
 	transform        Matrix
 	transformInverse Matrix
@@ -55,10 +57,10 @@ type NoisePerturber struct {
 	maxNoise float64
 }
 
-// NewNoisePerturber returns a perturber that makes waves on the shape
-func NewNoisePerturber(maxNoise float64) *NoisePerturber {
+// NewNoisePerturber returns a perturber that makes waves on the shape, the same seed always gives the same waves
+func NewNoisePerturber(maxNoise float64, seed int64) *NoisePerturber {
 	return &NoisePerturber{
-		n: opensimplex.NewNormalized(time.Now().Unix()),
+		n: opensimplex.NewNormalized(seed),
 
 		// These two parameters control the size and frequency of the bumps
 		maxNoise: maxNoise, // 1 is a nice value here
@@ -93,6 +95,53 @@ func (np *NoisePerturber) SetNoise(n opensimplex.Noise) {
 	np.n = n
 }
 
+// SetSeed reseeds the noise
+func (np *NoisePerturber) SetSeed(seed int64) {
+	np.n = opensimplex.NewNormalized(seed)
+}
+
+// PatternPerturber perturbes based on the value of a pattern, used as the height of the surface
+type PatternPerturber struct {
+	basePerturb
+
+	pattern ScalarPattern
+
+	// height is the height of the bumps where the pattern is 1
+	height float64
+}
+
+// NewPatternPerturber returns a perturber that makes bumps from the pattern
+func NewPatternPerturber(p ScalarPattern, height float64) *PatternPerturber {
+	return &PatternPerturber{
+		pattern: p,
+		height:  height,
+		basePerturb: basePerturb{
+			transform:        IM(),
+			transformInverse: IM().Inverse(),
+		},
+	}
+}
+
+// Perturb implements the Perturber interface
+func (pp *PatternPerturber) Perturb(v Vector, p Point) Vector {
+	return pp.perturb(v, p.TimesMatrix(pp.TransformInverse()))
+}
+
+// perturb is the local perturb function
+func (pp *PatternPerturber) perturb(n Vector, p Point) Vector {
+	epsilon := 0.001
+	f0 := pp.pattern.ValueAt(p) * pp.height
+	fx := pp.pattern.ValueAt(p.AddVector(NewVector(epsilon, 0, 0))) * pp.height
+	fy := pp.pattern.ValueAt(p.AddVector(NewVector(0, epsilon, 0))) * pp.height
+	fz := pp.pattern.ValueAt(p.AddVector(NewVector(0, 0, epsilon))) * pp.height
+
+	df := NewVector((fx-f0)/epsilon, (fy-f0)/epsilon, (fz-f0)/epsilon)
+
+	// only the slope along the surface tilts the normal
+	df = df.SubVector(n.Scale(df.Dot(n)))
+	return n.SubVector(df).Normalize()
+}
+
 // SinePerturber perturbes based on the Sine wave
 type SinePerturber struct {
 	basePerturb
@@ -131,33 +180,28 @@ func (sp *SinePerturber) perturb(n Vector, p Point) Vector {
 type ImageHeightmapPerturber struct {
 	basePerturb
 
-	canvas *Canvas
+	sampler *TextureSampler
 
 	// convert (x,y,z) -> (u,v)
 	mapper Mapper
 }
 
-// NewImageHeightmapPerturber returns a perturber that uses an image to simulate bumps
+// NewImageHeightmapPerturber returns a perturber that uses an image to simulate bumps, the image is read through the
+// texture cache
 func NewImageHeightmapPerturber(filename string, mapper Mapper) (*ImageHeightmapPerturber, error) {
-	// read in image
-	reader, err := os.Open(filename)
-	if err != nil {
-		return nil, err
-	}
-	defer reader.Close()
-
-	// Decode image
-	m, _, err := image.Decode(reader)
+	// heights are data, not colors
+	t, err := LoadTexture(filename, ColorEncodingLinear)
 	if err != nil {
 		return nil, err
 	}
 
-	// convert to canvas
-	canvas := imageToCanvas(m)
+	// the edges of the height map don't continue on the other side
+	sampler := NewTextureSampler(t)
+	sampler.SetWrap(WrapClamp)
 
 	p := &ImageHeightmapPerturber{
-		canvas: canvas,
-		mapper: mapper,
+		sampler: sampler,
+		mapper:  mapper,
 		basePerturb: basePerturb{
 			transform:        IM(),
 			transformInverse: IM().Inverse(),
@@ -167,19 +211,14 @@ func NewImageHeightmapPerturber(filename string, mapper Mapper) (*ImageHeightmap
 	return p, nil
 }
 
+// Sampler returns the sampler of the height map, use it to change the filtering, wrapping and transform
+func (ip *ImageHeightmapPerturber) Sampler() *TextureSampler {
+	return ip.sampler
+}
+
 // UVColorAt returns the color at the 2D coordinate (u, v)
 func (ip *ImageHeightmapPerturber) UVColorAt(u, v float64) Color {
-	// v = 1 - v
-	// u = 1 - u
-
-	x := u * (float64(ip.canvas.Width) - 1)
-	y := v * (float64(ip.canvas.Height) - 1)
-
-	c, err := ip.canvas.Get(int(x), int(y))
-	if err != nil {
-		log.Fatal(err)
-	}
-	return c
+	return ip.sampler.Sample(u, v)
 }
 
 // Perturb implements the Perturber interface
@@ -193,14 +232,15 @@ func (ip *ImageHeightmapPerturber) perturb(n Vector, p Point) Vector {
 	u, v := ip.mapper.Map(p)
 	epsilon := 0.001
 
-	north := ip.UVColorAt(u, math.Min(v+epsilon, 1))
-	northwest := ip.UVColorAt(math.Max(u-epsilon, 0), math.Min(v+epsilon, 1))
-	west := ip.UVColorAt(math.Max(u-epsilon, 0), v)
-	southwest := ip.UVColorAt(math.Max(u-epsilon, 0), math.Max(v-epsilon, 0))
-	south := ip.UVColorAt(u, math.Max(v-epsilon, 0))
-	southeast := ip.UVColorAt(math.Min(u+epsilon, 1), math.Max(v-epsilon, 0))
-	east := ip.UVColorAt(math.Min(u+epsilon, 1), v)
-	northeast := ip.UVColorAt(math.Min(u+epsilon, 1), math.Min(v+epsilon, 1))
+	// the sampler wraps coordinates outside the image
+	north := ip.UVColorAt(u, v+epsilon)
+	northwest := ip.UVColorAt(u-epsilon, v+epsilon)
+	west := ip.UVColorAt(u-epsilon, v)
+	southwest := ip.UVColorAt(u-epsilon, v-epsilon)
+	south := ip.UVColorAt(u, v-epsilon)
+	southeast := ip.UVColorAt(u+epsilon, v-epsilon)
+	east := ip.UVColorAt(u+epsilon, v)
+	northeast := ip.UVColorAt(u+epsilon, v+epsilon)
 
 	// gradient vector
 	dydx := ((northeast.GreyScale() + 2*east.GreyScale() + southeast.GreyScale()) - (northwest.GreyScale() + 2*west.GreyScale() + southwest.GreyScale())) / 2
@@ -211,3 +251,55 @@ func (ip *ImageHeightmapPerturber) perturb(n Vector, p Point) Vector {
 	// return new
 	return n.SubVector(new)
 }
+
+// NormalMapPerturber replaces the normals with the ones of a tangent-space normal map, the RGB image of normals baked
+// by modelling tools
+// The map is read at the texture coordinates of the hit and the normals are turned from the tangent frame of the
+// shape into shading space, so it needs shapes with tangents (triangles and meshes), other shapes keep their normals.
+type NormalMapPerturber struct {
+	basePerturb
+
+	sampler *TextureSampler
+
+	// Strength scales the tilt of the normals, 1 is the map as it is and 0 is flat
+	Strength float64
+
+	// FlipGreen is for maps where green points down the image (DirectX), the default is up (OpenGL and glTF)
+	FlipGreen bool
+}
+
+// NewNormalMapPerturber returns a perturber that reads the normals from the texture, which should be linear
+func NewNormalMapPerturber(ts *TextureSampler) *NormalMapPerturber {
+	return &NormalMapPerturber{
+		sampler:  ts,
+		Strength: 1,
+		basePerturb: basePerturb{
+			transform:        IM(),
+			transformInverse: IM().Inverse(),
+		},
+	}
+}
+
+// Sampler returns the sampler of the normal map, use it to change the filtering, wrapping and transform
+func (np *NormalMapPerturber) Sampler() *TextureSampler {
+	return np.sampler
+}
+
+// Perturb implements the Perturber interface, without the tangent frame the normal is kept
+func (np *NormalMapPerturber) Perturb(normal Vector, p Point) Vector {
+	return normal
+}
+
+// perturbTangentSpace implements tangentSpacePerturber
+func (np *NormalMapPerturber) perturbTangentSpace(n, t, b Vector, u, v float64) Vector {
+	c := np.sampler.Sample(u, v)
+	x := (2*c.R - 1) * np.Strength
+	y := (2*c.G - 1) * np.Strength
+	z := 2*c.B - 1
+
+	// v increases down the image
+	if !np.FlipGreen {
+		y = -y
+	}
+	return t.Scale(x).AddVector(b.Scale(y)).AddVector(n.Normalize().Scale(z)).Normalize()
+}
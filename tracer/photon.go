@@ -0,0 +1,312 @@
+package tracer
+
+import (
+	"log"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// photon is a packet of light that arrived at a diffuse surface
+type photon struct {
+	p Point
+	// dir is the direction the photon was travelling in
+	dir   Vector
+	power Color
+
+	// axis is the axis the kd-tree splits on at this photon
+	axis int
+}
+
+// pointAxis returns the x, y or z (axis 0, 1 or 2) coordinate of p
+func pointAxis(p Point, axis int) float64 {
+	switch axis {
+	case 0:
+		return p.x
+	case 1:
+		return p.y
+	}
+	return p.z
+}
+
+// photonMap stores photons in a balanced kd-tree, for finding all the photons near a point
+// The tree is implicit: the photon in the middle of a range splits it, the lower half goes left.
+type photonMap struct {
+	photons []photon
+}
+
+// newPhotonMap returns a new photon map holding the given photons
+func newPhotonMap(photons []photon) *photonMap {
+	pm := &photonMap{photons: photons}
+	pm.build(0, len(photons))
+	return pm
+}
+
+// build builds the kd-tree over photons [lo, hi)
+func (pm *photonMap) build(lo, hi int) {
+	if hi-lo <= 1 {
+		return
+	}
+
+	// split along the axis with the largest extent
+	min, max := []float64{math.Inf(1), math.Inf(1), math.Inf(1)}, []float64{math.Inf(-1), math.Inf(-1), math.Inf(-1)}
+	for _, ph := range pm.photons[lo:hi] {
+		for a := 0; a < 3; a++ {
+			min[a] = math.Min(min[a], pointAxis(ph.p, a))
+			max[a] = math.Max(max[a], pointAxis(ph.p, a))
+		}
+	}
+	axis := 0
+	for a := 1; a < 3; a++ {
+		if max[a]-min[a] > max[axis]-min[axis] {
+			axis = a
+		}
+	}
+
+	photons := pm.photons[lo:hi]
+	sort.Slice(photons, func(i, j int) bool {
+		return pointAxis(photons[i].p, axis) < pointAxis(photons[j].p, axis)
+	})
+
+	mid := (lo + hi) / 2
+	pm.photons[mid].axis = axis
+	pm.build(lo, mid)
+	pm.build(mid+1, hi)
+}
+
+// gather calls f for every photon within radius of p
+func (pm *photonMap) gather(p Point, radius float64, f func(ph *photon, dist2 float64)) {
+	pm.search(0, len(pm.photons), p, radius*radius, f)
+}
+
+func (pm *photonMap) search(lo, hi int, p Point, r2 float64, f func(ph *photon, dist2 float64)) {
+	if lo >= hi {
+		return
+	}
+
+	mid := (lo + hi) / 2
+	ph := &pm.photons[mid]
+	d := p.SubPoint(ph.p)
+	if dist2 := d.Dot(d); dist2 <= r2 {
+		f(ph, dist2)
+	}
+	if hi-lo == 1 {
+		return
+	}
+
+	// search the side p is on first, the other side only if the sphere crosses the splitting plane
+	delta := pointAxis(p, ph.axis) - pointAxis(ph.p, ph.axis)
+	if delta < 0 {
+		pm.search(lo, mid, p, r2, f)
+		if delta*delta <= r2 {
+			pm.search(mid+1, hi, p, r2, f)
+		}
+	} else {
+		pm.search(mid+1, hi, p, r2, f)
+		if delta*delta <= r2 {
+			pm.search(lo, mid, p, r2, f)
+		}
+	}
+}
+
+// irradiance returns the light arriving at p (on a surface with normal n) estimated from the photons within radius
+// Photons are weighed with a cone filter, so caustics stay sharp.
+func (pm *photonMap) irradiance(p Point, n Vector, radius float64) Color {
+	sum := Black()
+	pm.gather(p, radius, func(ph *photon, dist2 float64) {
+		// photons that arrived from the other side of the surface
+		if ph.dir.Dot(n) >= 0 {
+			return
+		}
+		sum = sum.Add(ph.power.Scale(1 - math.Sqrt(dist2)/radius))
+	})
+
+	// the cone filter integrates to 1/3 of the disc
+	return sum.Scale(3 / (math.Pi * radius * radius))
+}
+
+// photonMaps are built by the photon mapping stage, before rendering
+// The caustic map holds light that reached a diffuse surface after one or more reflections or refractions, the global
+// map light that bounced off at least one diffuse surface first. Direct light is left to the Whitted integrator.
+type photonMaps struct {
+	caustic, global *photonMap
+}
+
+// buildPhotonMaps emits photons from all the lights and traces them through the world
+// Returns nil if photon mapping is disabled (Config.CausticPhotons is 0). The maps are seeded from the render seed.
+func (w *World) buildPhotonMaps() *photonMaps {
+	if w.Config.CausticPhotons <= 0 || len(w.Lights) == 0 {
+		return nil
+	}
+
+	start := time.Now()
+	// draw the seeds of the maps, so their random numbers differ from each other and from those of the pixel workers
+	seeds := rand.New(rand.NewSource(w.renderSeed()))
+	maps := &photonMaps{
+		caustic: newPhotonMap(w.tracePhotons(w.Config.CausticPhotons, false, seeds.Int63())),
+	}
+	if w.Config.GlobalPhotons > 0 {
+		maps.global = newPhotonMap(w.tracePhotons(w.Config.GlobalPhotons, true, seeds.Int63()))
+	}
+
+	log.Printf("Photon maps: %v caustic and %v global photons stored (%v)", maps.caustic.len(), maps.global.len(), time.Since(start))
+	return maps
+}
+
+// len returns the number of photons in the map, 0 for a nil map
+func (pm *photonMap) len() int {
+	if pm == nil {
+		return 0
+	}
+	return len(pm.photons)
+}
+
+// tracePhotons emits n photons, spread evenly over the lights, and returns the ones stored in the map
+// global selects the global map, otherwise photons are traced for the caustic map. Worker k seeds its random number
+// generator with seed + k.
+func (w *World) tracePhotons(n int, global bool, seed int64) []photon {
+	// rays pass through the shapes of area lights, same as shadow rays
+	lightShapes := make(map[Shaper]bool)
+	for _, l := range w.Lights {
+		if l.Shape() != nil {
+			walkShapes([]Shaper{l.Shape()}, func(s Shaper) { lightShapes[s] = true })
+		}
+	}
+
+	workers := int(math.Max(1, float64(w.Config.Parallelism)))
+	results := make([][]photon, workers)
+
+	var wg sync.WaitGroup
+	for k := 0; k < workers; k++ {
+		wg.Add(1)
+		go func(k int) {
+			defer wg.Done()
+
+			rng := rand.New(rand.NewSource(seed + int64(k)))
+			xs := NewIntersections()
+			store := func(ph photon) { results[k] = append(results[k], ph) }
+
+			for i := k; i < n; i += workers {
+				l := w.Lights[i%len(w.Lights)]
+				// the number of photons emitted by this light
+				emitted := n / len(w.Lights)
+				if i%len(w.Lights) < n%len(w.Lights) {
+					emitted++
+				}
+
+				r, solidAngle := emitPhoton(l, rng)
+				power := l.Intensity().Scale(solidAngle / float64(emitted))
+				w.tracePhoton(r, power, global, lightShapes, xs, rng, store)
+			}
+		}(k)
+	}
+	wg.Wait()
+
+	var photons []photon
+	for _, r := range results {
+		photons = append(photons, r...)
+	}
+	return photons
+}
+
+// emitPhoton returns a ray leaving the light in a random direction and the solid angle the direction was picked from
+// Area lights emit like point lights from a random position, the same way the Whitted integrator treats them.
+func emitPhoton(l Light, rng *rand.Rand) (r Ray, solidAngle float64) {
+	origin := l.RandomPosition(rng)
+
+	switch l := l.(type) {
+	case *SpotLight:
+		cosMax := spotCosMax(l)
+		return NewRay(origin, uniformSampleCone(l.Direction(), cosMax, rng)), 2 * math.Pi * (1 - cosMax)
+	case *AreaSpotLight:
+		cosMax := math.Cos(l.Angle() / 2)
+		return NewRay(origin, uniformSampleCone(l.Direction(), cosMax, rng)), 2 * math.Pi * (1 - cosMax)
+	}
+	return NewRay(origin, uniformSampleSphere(rng)), 4 * math.Pi
+}
+
+// tracePhoton follows a photon through reflective and transparent materials, storing it at diffuse surfaces
+// The Whitted integrator doesn't dim light with distance, so the power of stored photons is scaled by the squared
+// distance travelled since the light (or the last diffuse bounce): light that is not focused gives the same
+// brightness as direct lighting, focused light is brighter.
+func (w *World) tracePhoton(r Ray, power Color, global bool, lightShapes map[Shaper]bool, xs Intersections, rng *rand.Rand, store func(photon)) {
+	var specular, diffuse bool
+	dist := 0.0
+
+	for bounce := 0; bounce <= w.Config.MaxRecusions+1; bounce++ {
+		xs = w.Intersections(r, xs[:0])
+
+		var hit *Intersection
+		for _, it := range xs {
+			if it.t >= 0 && !lightShapes[it.Object()] {
+				hit = it
+				break
+			}
+		}
+		if hit == nil {
+			return
+		}
+		state := PrepareComputations(hit, r, xs)
+		dist += state.Distance
+		power = power.Blend(state.transmittance())
+
+		m := state.material()
+		albedo := m.surfaceColor(state.Object, state.Point, state.texCoords()).Scale(m.Diffuse)
+
+		if m.Diffuse > 0 && ((global && diffuse) || (!global && specular && !diffuse)) {
+			store(photon{p: state.Point, dir: r.Dir.Normalize(), power: power.Scale(dist * dist)})
+		}
+
+		// pick what happens next with the same weights the Whitted integrator uses
+		pReflect, pRefract := m.Reflective, m.Transparency
+		if pReflect > 0 && pRefract > 0 {
+			reflectance := Schlick(state)
+			pReflect, pRefract = pReflect*reflectance, pRefract*(1-reflectance)
+		}
+		pDiffuse := 0.0
+		if global {
+			pDiffuse = math.Min((albedo.R+albedo.G+albedo.B)/3, 1-pReflect-pRefract)
+		}
+
+		u := rng.Float64()
+		switch {
+		case u < pReflect:
+			specular = true
+			r = NewRay(state.OverPoint, state.ReflectV)
+		case u < pReflect+pRefract:
+			dir, ok := refractedDirection(state)
+			if !ok {
+				// the Whitted integrator has no light for total internal reflection either
+				return
+			}
+			specular = true
+			r = NewRay(state.UnderPoint, dir)
+		case u < pReflect+pRefract+pDiffuse:
+			diffuse = true
+			power = power.Blend(albedo).Scale(1 / pDiffuse)
+			r = NewRay(state.OverPoint, newONB(state.NormalV).local(cosineSampleHemisphere(rng)))
+			// the surface acts as a new light
+			dist = 0
+		default:
+			return
+		}
+	}
+}
+
+// photonRadiance returns the light reflected at the hit from the photon maps
+func (w *World) photonRadiance(state *IntersectionState) Color {
+	m := state.material()
+	radius := w.Config.PhotonGatherRadius
+	if w.photons == nil || m.Diffuse == 0 || radius <= 0 {
+		return Black()
+	}
+
+	irradiance := w.photons.caustic.irradiance(state.Point, state.NormalV, radius)
+	if w.photons.global != nil {
+		irradiance = irradiance.Add(w.photons.global.irradiance(state.Point, state.NormalV, radius))
+	}
+
+	return m.surfaceColor(state.Object, state.Point, state.texCoords()).Scale(m.Diffuse).Blend(irradiance)
+}
@@ -0,0 +1,173 @@
+package tracer
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPhotonMap_Gather(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	var photons []photon
+	for i := 0; i < 2000; i++ {
+		photons = append(photons, photon{p: NewPoint(rng.Float64()*4, rng.Float64(), rng.Float64()*2)})
+	}
+	points := make([]Point, len(photons))
+	for i, ph := range photons {
+		points[i] = ph.p
+	}
+	pm := newPhotonMap(photons)
+
+	tests := []struct {
+		name   string
+		p      Point
+		radius float64
+	}{
+		{
+			name:   "inside",
+			p:      NewPoint(2, 0.5, 1),
+			radius: 0.2,
+		},
+		{
+			name:   "corner",
+			p:      NewPoint(0, 0, 0),
+			radius: 0.5,
+		},
+		{
+			name:   "outside",
+			p:      NewPoint(10, 10, 10),
+			radius: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := 0
+			for _, p := range points {
+				d := p.SubPoint(tt.p)
+				if d.Dot(d) <= tt.radius*tt.radius {
+					want++
+				}
+			}
+
+			got := 0
+			pm.gather(tt.p, tt.radius, func(ph *photon, dist2 float64) {
+				assert.True(t, dist2 <= tt.radius*tt.radius, "should be within radius")
+				got++
+			})
+			assert.Equal(t, want, got, "should find all photons")
+		})
+	}
+}
+
+// photonTestWorld is a glass sphere over a floor, lit by a point light
+func photonTestWorld() *World {
+	w := NewWorld(NewWorldConfig())
+	w.Config.CausticPhotons = 100000
+	w.Config.PhotonGatherRadius = 0.1
+
+	floor := NewPlane()
+	floor.Material().Ambient = 0
+	floor.Material().Specular = 0
+	w.AddObject(floor)
+
+	glass := NewGlassSphere()
+	glass.SetTransform(IM().Translate(0, 2, 0))
+	w.AddObject(glass)
+
+	w.SetLights(Lights{NewPointLight(NewPoint(0, 10, 0), White())})
+	return w
+}
+
+func TestWorld_BuildPhotonMaps(t *testing.T) {
+	tests := []struct {
+		name        string
+		world       func() *World
+		wantNil     bool
+		wantCaustic bool
+		wantGlobal  bool
+	}{
+		{
+			name: "disabled",
+			world: func() *World {
+				w := photonTestWorld()
+				w.Config.CausticPhotons = 0
+				return w
+			},
+			wantNil: true,
+		},
+		{
+			name:        "caustics",
+			world:       photonTestWorld,
+			wantCaustic: true,
+		},
+		{
+			name: "no specular objects",
+			world: func() *World {
+				w := photonTestWorld()
+				w.Objects = w.Objects[:1]
+				return w
+			},
+		},
+		{
+			name: "global",
+			world: func() *World {
+				w := photonTestWorld()
+				w.Config.GlobalPhotons = 10000
+
+				wall := NewPlane()
+				wall.SetTransform(IM().RotateX(math.Pi/2).Translate(0, 0, 3))
+				w.AddObject(wall)
+				return w
+			},
+			wantCaustic: true,
+			wantGlobal:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			maps := tt.world().buildPhotonMaps()
+			if tt.wantNil {
+				assert.Nil(t, maps, "should be nil")
+				return
+			}
+			assert.Equal(t, tt.wantCaustic, maps.caustic.len() > 0, "caustic photons")
+			assert.Equal(t, tt.wantGlobal, maps.global.len() > 0, "global photons")
+		})
+	}
+}
+
+func TestWorld_PhotonRadiance(t *testing.T) {
+	w := photonTestWorld()
+	NewWhittedIntegrator().Preprocess(w)
+
+	// straight under the sphere the floor is in its shadow, but the glass focuses the light there
+	under := NewRay(NewPoint(0, 0.5, -0.5), NewVector(0, -1, 1).Normalize())
+	xs := NewIntersections()
+	focused := w.ColorAt(under, w.Config.MaxRecusions, xs, nil)
+
+	// unshadowed floor, far from the sphere, only gets direct light
+	lit := NewRay(NewPoint(6, 0.5, -0.5), NewVector(0, -1, 1).Normalize())
+	direct := w.ColorAt(lit, w.Config.MaxRecusions, xs, nil)
+
+	assert.True(t, focused.R > direct.R, "caustic %v should be brighter than direct light %v", focused, direct)
+
+	// the floor far away only gets direct light, the same as without photons
+	w.photons = nil
+	assert.Equal(t, direct, w.ColorAt(lit, w.Config.MaxRecusions, xs, nil), "should equal")
+}
+
+func TestWorld_BuildPhotonMapsSeed(t *testing.T) {
+	build := func(seed int64) *photonMaps {
+		w := photonTestWorld()
+		w.Config.Seed = seed
+		return w.buildPhotonMaps()
+	}
+
+	a, b, c := build(1), build(1), build(2)
+	assert.Equal(t, a.caustic.photons, b.caustic.photons, "the same seed traces the same photons")
+	assert.NotEqual(t, a.caustic.photons, c.caustic.photons, "another seed traces other photons")
+}
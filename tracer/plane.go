@@ -32,6 +32,11 @@ func (pl *Plane) Equal(pl2 *Plane) bool {
 	return pl.Shape.Equal(&pl2.Shape)
 }
 
+// UVAt returns the surface coordinates of the point p (world space), the plane is tiled with 1x1 squares
+func (pl *Plane) UVAt(p Point, xs *Intersection) (float64, float64) {
+	return NewPlaneMap().Map(p.ToObjectSpace(pl))
+}
+
 func (pl *Plane) localNormalAt(unused Point, xs *Intersection) Vector {
 	return NewVector(0, 1, 0)
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/DanTulovsky/tracer/constants"
 	"github.com/google/go-cmp/cmp"
 	"github.com/stretchr/testify/assert"
 )
@@ -133,3 +134,33 @@ func TestPlane_IntersectWith(t *testing.T) {
 		})
 	}
 }
+
+func TestPlane_UVAt(t *testing.T) {
+	tests := []struct {
+		name  string
+		p     Point
+		wantU float64
+		wantV float64
+	}{
+		{
+			name:  "positive",
+			p:     NewPoint(0.25, 0, 0.5),
+			wantU: 0.25,
+			wantV: 0.5,
+		},
+		{
+			name:  "tiled",
+			p:     NewPoint(-0.25, 0, 1.75),
+			wantU: 0.75,
+			wantV: 0.75,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, v := NewPlane().UVAt(tt.p, nil)
+			assert.InDelta(t, tt.wantU, u, constants.Epsilon, "should equal")
+			assert.InDelta(t, tt.wantV, v, constants.Epsilon, "should equal")
+		})
+	}
+}
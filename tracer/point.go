@@ -105,14 +105,13 @@ func (p Point) ToObjectSpace(s Shaper) Point {
 
 // ToWorldSpace converts the given point from object space to world space
 func (p Point) ToWorldSpace(s Shaper) Point {
-	res := p
+	res := p.TimesMatrix(s.Transform())
+	res.SetW(1)
 
+	// the parent's transform applies after the shape's own
 	if s.HasParent() {
-		res = p.ToWorldSpace(s.Parent())
+		res = res.ToWorldSpace(s.Parent())
 	}
 
-	res = res.TimesMatrix(s.Transform())
-	res.SetW(1)
-
 	return res
 }
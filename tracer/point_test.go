@@ -380,3 +380,24 @@ func TestPoint_ToObjectSpace(t *testing.T) {
 
 	assert.True(t, want.Equal(got), "should equal")
 }
+
+func TestPoint_ToWorldSpace(t *testing.T) {
+	g1 := NewGroup()
+	g1.SetTransform(IM().RotateY(math.Pi / 2))
+
+	g2 := NewGroup()
+	g2.SetTransform(IM().Scale(2, 2, 2))
+
+	g1.AddMember(g2)
+
+	s := NewUnitSphere()
+	s.SetTransform(IM().Translate(5, 0, 0))
+	g2.AddMember(s)
+
+	point := NewPoint(0, 0, -1)
+	want := NewPoint(-2, 0, -10)
+	got := point.ToWorldSpace(s)
+
+	assert.True(t, want.Equal(got), "should equal")
+	assert.True(t, point.Equal(got.ToObjectSpace(s)), "round trip")
+}
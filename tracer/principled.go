@@ -0,0 +1,313 @@
+package tracer
+
+import (
+	"math"
+)
+
+// PrincipledParam is a parameter of the principled material that can be driven by a MaterialMap
+type PrincipledParam int
+
+const (
+	// PrincipledBaseColor is the diffuse color of dielectrics and the reflection color of metals
+	PrincipledBaseColor PrincipledParam = iota
+	// PrincipledMetallic blends between a dielectric (0) and a conductor (1)
+	PrincipledMetallic
+	// PrincipledRoughness is the roughness of reflections and refractions
+	PrincipledRoughness
+	// PrincipledAnisotropy stretches glossy reflections along the tangent
+	PrincipledAnisotropy
+	// PrincipledSpecular is the reflectance of dielectrics, 0.5 is 4% at normal incidence
+	PrincipledSpecular
+	// PrincipledClearcoat is the weight of the clear coat layer
+	PrincipledClearcoat
+	// PrincipledClearcoatRoughness is the roughness of the clear coat layer
+	PrincipledClearcoatRoughness
+	// PrincipledSheen is the weight of the sheen (cloth like grazing reflection)
+	PrincipledSheen
+	// PrincipledSheenTint blends the sheen color from white to the base color
+	PrincipledSheenTint
+	// PrincipledTransmission blends between an opaque and a transparent (glass like) dielectric
+	PrincipledTransmission
+	// PrincipledEmission is the emitted color
+	PrincipledEmission
+)
+
+// Channel selects the channel of a color that drives a scalar parameter
+type Channel int
+
+const (
+	// ChannelLuminance uses the luminance of the color
+	ChannelLuminance Channel = iota
+	// ChannelR uses the red channel
+	ChannelR
+	// ChannelG uses the green channel
+	ChannelG
+	// ChannelB uses the blue channel
+	ChannelB
+)
+
+// value returns the channel of c
+func (ch Channel) value(c Color) float64 {
+	switch ch {
+	case ChannelR:
+		return c.R
+	case ChannelG:
+		return c.G
+	case ChannelB:
+		return c.B
+	}
+	return c.Luminance()
+}
+
+// MaterialMap drives a material parameter with a pattern or a texture, the map multiplies the parameter's value
+// Same as Material.Texture, textures use the surface coordinates of the hit (see Shaper.UVAt).
+type MaterialMap struct {
+	Pattern Patterner
+	Texture *TextureSampler
+
+	// Channel is the channel of the color used for scalar parameters
+	Channel Channel
+}
+
+// NewPatternMap returns a new map driven by a pattern
+func NewPatternMap(p Patterner, ch Channel) *MaterialMap {
+	return &MaterialMap{Pattern: p, Channel: ch}
+}
+
+// NewTextureMap returns a new map driven by a texture
+func NewTextureMap(t *TextureSampler, ch Channel) *MaterialMap {
+	return &MaterialMap{Texture: t, Channel: ch}
+}
+
+// colorAt returns the color of the map at point p (world space) on the object, tc are the surface coordinates
+func (mm *MaterialMap) colorAt(o Shaper, p Point, tc texCoords) Color {
+	clr := White()
+
+	if mm.Pattern != nil {
+		clr = clr.Blend(mm.Pattern.ColorAtObject(o, p))
+	}
+	if mm.Texture != nil {
+		clr = clr.Blend(mm.Texture.sampleAt(tc))
+	}
+	return clr
+}
+
+// valueAt returns the value of the map at point p (world space) on the object
+func (mm *MaterialMap) valueAt(o Shaper, p Point, tc texCoords) float64 {
+	return mm.Channel.value(mm.colorAt(o, p, tc))
+}
+
+// PrincipledMaterial is a physically based "uber" material, modeled after the Principled BSDF of Blender and the
+// glTF metallic-roughness model
+// Every parameter can be driven by a pattern or a texture, see SetMap. Use Material to apply it to shapes.
+type PrincipledMaterial struct {
+	BaseColor Color
+
+	Metallic, Roughness, Anisotropy float64
+
+	// Specular is the reflectance of dielectrics, 0.5 is 4% at normal incidence (an index of refraction of 1.5)
+	Specular float64
+
+	Clearcoat, ClearcoatRoughness float64
+
+	Sheen, SheenTint float64
+
+	Transmission float64
+	IOR          float64
+
+	Emission         Color
+	EmissionStrength float64
+
+	// Maps drive the parameters with patterns and textures
+	Maps map[PrincipledParam]*MaterialMap
+}
+
+// NewPrincipledMaterial returns a new principled material with the same defaults as Blender
+func NewPrincipledMaterial() *PrincipledMaterial {
+	return &PrincipledMaterial{
+		BaseColor:          NewColor(0.8, 0.8, 0.8),
+		Roughness:          0.5,
+		Specular:           0.5,
+		ClearcoatRoughness: 0.03,
+		SheenTint:          0.5,
+		IOR:                1.45,
+		Emission:           Black(),
+		EmissionStrength:   1,
+		Maps:               make(map[PrincipledParam]*MaterialMap),
+	}
+}
+
+// SetMap drives the parameter with the map, nil removes the map
+func (pm *PrincipledMaterial) SetMap(param PrincipledParam, mm *MaterialMap) {
+	if mm == nil {
+		delete(pm.Maps, param)
+		return
+	}
+	pm.Maps[param] = mm
+}
+
+// Material returns a new material to apply to shapes
+// The parameters are evaluated at every hit, the index of refraction, emission and transmission are also copied into
+// the material, to find emissive shapes and refractive indexes without a hit.
+func (pm *PrincipledMaterial) Material() *Material {
+	m := NewDefaultMaterial()
+	m.Principled = pm
+	m.Color = pm.BaseColor
+	m.Metallic = pm.Metallic
+	m.Roughness = pm.Roughness
+	m.Anisotropy = pm.Anisotropy
+	m.Transparency = pm.Transmission
+	m.RefractiveIndex = pm.IOR
+	m.Emissive = pm.Emission.Scale(pm.EmissionStrength)
+	if pm.Transmission > 0 {
+		m.ShadowCaster = false
+	}
+	return m
+}
+
+// value returns the scalar parameter at point p on the object
+func (pm *PrincipledMaterial) value(param PrincipledParam, v float64, o Shaper, p Point, tc texCoords) float64 {
+	if mm, ok := pm.Maps[param]; ok {
+		v *= mm.valueAt(o, p, tc)
+	}
+	return math.Max(0, math.Min(1, v))
+}
+
+// color returns the color parameter at point p on the object
+func (pm *PrincipledMaterial) color(param PrincipledParam, c Color, o Shaper, p Point, tc texCoords) Color {
+	if mm, ok := pm.Maps[param]; ok {
+		c = c.Blend(mm.colorAt(o, p, tc))
+	}
+	return c
+}
+
+// principledLobes are the parts of the principled material that have no Phong equivalent, they are zero for Phong
+// materials
+type principledLobes struct {
+	// f0 is the reflectance of the dielectric at normal incidence, 0 derives it from RefractiveIndex
+	f0 float64
+
+	clearcoat          float64
+	clearcoatRoughness float64
+
+	// sheen is the color of the sheen
+	sheen Color
+}
+
+// resolve returns the principled material evaluated at the hit, as a Phong material
+// m is the material the principled material is attached to, its other settings (perturber, shadows) are kept.
+func (pm *PrincipledMaterial) resolve(m *Material, state *IntersectionState) *Material {
+	o, p, tc := state.Object, state.Point, state.texCoords()
+
+	r := *m
+	r.Principled = nil
+	r.Maps = nil
+	r.Pattern = nil
+	r.Texture = nil
+
+	r.Color = pm.color(PrincipledBaseColor, pm.BaseColor, o, p, tc)
+	r.Metallic = pm.value(PrincipledMetallic, pm.Metallic, o, p, tc)
+	r.Roughness = pm.value(PrincipledRoughness, pm.Roughness, o, p, tc)
+	r.Anisotropy = pm.value(PrincipledAnisotropy, pm.Anisotropy, o, p, tc)
+	r.Emissive = pm.color(PrincipledEmission, pm.Emission, o, p, tc).Scale(pm.EmissionStrength)
+	r.RefractiveIndex = pm.IOR
+
+	// opaque dielectrics reflect according to Fresnel, transparent ones are handled by Schlick like glass
+	transmission := pm.value(PrincipledTransmission, pm.Transmission, o, p, tc)
+	r.f0 = math.Max(1e-4, 0.08*pm.value(PrincipledSpecular, pm.Specular, o, p, tc))
+	fresnel := r.f0 + (1-r.f0)*schlickWeight(state.EyeV.Dot(state.NormalV))
+
+	r.Diffuse = 1 - transmission
+	r.Specular = 1
+	r.Reflective = transmission + (1-transmission)*fresnel
+	r.Transparency = transmission
+
+	r.clearcoat = pm.value(PrincipledClearcoat, pm.Clearcoat, o, p, tc)
+	r.clearcoatRoughness = pm.value(PrincipledClearcoatRoughness, pm.ClearcoatRoughness, o, p, tc)
+
+	// the sheen is tinted towards the hue of the base color, metals have none
+	tint := White()
+	if lum := r.Color.Luminance(); lum > 0 {
+		tint = r.Color.Scale(1 / lum)
+	}
+	sheenTint := pm.value(PrincipledSheenTint, pm.SheenTint, o, p, tc)
+	sheen := pm.value(PrincipledSheen, pm.Sheen, o, p, tc)
+	r.sheen = White().Scale(1 - sheenTint).Add(tint.Scale(sheenTint)).Scale(sheen * (1 - r.Metallic) * (1 - transmission))
+
+	return &r
+}
+
+// schlickWeight returns the Schlick Fresnel weight (1 - cos)^5
+func schlickWeight(cos float64) float64 {
+	return math.Pow(1-math.Max(0, math.Min(1, cos)), 5)
+}
+
+// clearcoatF0 is the reflectance of the clear coat at normal incidence, an index of refraction of 1.5
+const clearcoatF0 = 0.04
+
+// coat returns the distribution of the clear coat, nil if there is none
+func (m *Material) coat() *ggx {
+	if m.clearcoat <= 0 {
+		return nil
+	}
+	return newGGX(math.Max(m.clearcoatRoughness, 0.01), 0)
+}
+
+// coatBRDF returns the brdf of the clear coat for local directions wo and wi (above the surface)
+func (m *Material) coatBRDF(d *ggx, wo, wi Vector) float64 {
+	h := wo.AddVector(wi).Normalize()
+	f := clearcoatF0 + (1-clearcoatF0)*schlickWeight(wo.Dot(h))
+	return m.clearcoat * f * d.d(h) * d.g(wo, wi) / (4 * wo.z * wi.z)
+}
+
+// sheenBRDF returns the brdf of the sheen for local directions wo and wi (above the surface)
+func (m *Material) sheenBRDF(wo, wi Vector) Color {
+	h := wo.AddVector(wi).Normalize()
+	return m.sheen.Scale(schlickWeight(wi.Dot(h)) / math.Pi)
+}
+
+// principledHighlight returns the light reflected by the clear coat and the sheen of a light in direction lightv
+// Same as highlight, this is pi * brdf * cos, without falloff.
+func (m *Material) principledHighlight(eye, normal, lightv Vector) Color {
+	d := m.coat()
+	if d == nil && m.sheen == Black() {
+		return Black()
+	}
+
+	frame := newONB(normal)
+	wo, wi := frame.toLocal(eye), frame.toLocal(lightv)
+	if wo.z <= 0 || wi.z <= 0 {
+		return Black()
+	}
+
+	result := m.sheenBRDF(wo, wi)
+	if d != nil {
+		result = result.Add(White().Scale(m.coatBRDF(d, wo, wi)))
+	}
+	return result.Scale(math.Pi * wi.z)
+}
+
+// at returns the material at the hit, principled materials and maps are evaluated there and spectral rays convert the
+// material to their wavelength, other materials are returned as is
+// Principled materials have their own maps, Maps is ignored for them.
+func (m *Material) at(state *IntersectionState) *Material {
+	r := m
+	switch {
+	case m.Principled != nil:
+		r = m.Principled.resolve(m, state)
+	case len(m.Maps) > 0:
+		r = m.resolveMaps(state)
+	}
+	if state.Wavelength > 0 {
+		r = r.spectral(state)
+	}
+	return r
+}
+
+// material returns the material of the hit object, evaluated at the hit
+func (s *IntersectionState) material() *Material {
+	if s.mat == nil {
+		s.mat = s.Object.Material().at(s)
+	}
+	return s.mat
+}
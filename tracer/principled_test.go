@@ -0,0 +1,250 @@
+package tracer
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/qmuntal/gltf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrincipledMaterial_Resolve(t *testing.T) {
+	tests := []struct {
+		name     string
+		material func() *PrincipledMaterial
+		point    Point
+		check    func(t *testing.T, m *Material)
+	}{
+		{
+			name:     "defaults",
+			material: NewPrincipledMaterial,
+			point:    NewPoint(0, 0, -1),
+			check: func(t *testing.T, m *Material) {
+				assert.Equal(t, NewColor(0.8, 0.8, 0.8), m.Color, "should equal")
+				assert.Equal(t, 0.5, m.Roughness, "should equal")
+				assert.Equal(t, 1.0, m.Diffuse, "should equal")
+				assert.InDelta(t, 0.04, m.f0, 1e-9, "specular 0.5 is 4%")
+				assert.InDelta(t, 0.04, m.Reflective, 1e-9, "fresnel at normal incidence")
+				assert.Nil(t, m.Principled, "resolved materials are Phong materials")
+			},
+		},
+		{
+			name: "roughness map",
+			material: func() *PrincipledMaterial {
+				pm := NewPrincipledMaterial()
+				pm.SetMap(PrincipledRoughness, NewPatternMap(NewStripedPattern(White(), NewColor(0.5, 0, 0)), ChannelR))
+				return pm
+			},
+			point: NewPoint(1.5, 0, -1),
+			check: func(t *testing.T, m *Material) {
+				assert.Equal(t, 0.25, m.Roughness, "should equal")
+			},
+		},
+		{
+			name: "base color and emission maps",
+			material: func() *PrincipledMaterial {
+				pm := NewPrincipledMaterial()
+				pm.BaseColor = White()
+				pm.Emission = White()
+				pm.EmissionStrength = 2
+				pm.SetMap(PrincipledBaseColor, NewPatternMap(NewStripedPattern(NewColor(1, 0, 0), Black()), ChannelLuminance))
+				pm.SetMap(PrincipledEmission, NewPatternMap(NewStripedPattern(NewColor(0, 1, 0), Black()), ChannelLuminance))
+				return pm
+			},
+			point: NewPoint(0.5, 0, -1),
+			check: func(t *testing.T, m *Material) {
+				assert.Equal(t, NewColor(1, 0, 0), m.Color, "should equal")
+				assert.Equal(t, NewColor(0, 2, 0), m.Emissive, "should equal")
+			},
+		},
+		{
+			name: "glass",
+			material: func() *PrincipledMaterial {
+				pm := NewPrincipledMaterial()
+				pm.Transmission = 1
+				pm.Roughness = 0
+				pm.IOR = 1.5
+				return pm
+			},
+			point: NewPoint(0, 0, -1),
+			check: func(t *testing.T, m *Material) {
+				assert.Equal(t, 0.0, m.Diffuse, "should equal")
+				assert.Equal(t, 1.0, m.Reflective, "Schlick splits reflection and refraction")
+				assert.Equal(t, 1.0, m.Transparency, "should equal")
+				assert.Equal(t, 1.5, m.RefractiveIndex, "should equal")
+				assert.False(t, m.ShadowCaster, "should equal")
+				assert.Equal(t, Black(), m.sheen, "should equal")
+			},
+		},
+		{
+			name: "sheen and clear coat",
+			material: func() *PrincipledMaterial {
+				pm := NewPrincipledMaterial()
+				pm.BaseColor = NewColor(1, 0, 0)
+				pm.Sheen = 1
+				pm.SheenTint = 0
+				pm.Clearcoat = 0.5
+				return pm
+			},
+			point: NewPoint(0, 0, -1),
+			check: func(t *testing.T, m *Material) {
+				assert.Equal(t, White(), m.sheen, "untinted sheen is white")
+				assert.Equal(t, 0.5, m.clearcoat, "should equal")
+				assert.NotNil(t, m.coat(), "should have a clear coat")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewUnitSphere()
+			s.SetMaterial(tt.material().Material())
+			state := &IntersectionState{
+				Object:  s,
+				Point:   tt.point,
+				EyeV:    NewVector(0, 0, -1),
+				NormalV: NewVector(0, 0, -1),
+			}
+			tt.check(t, state.material())
+		})
+	}
+}
+
+func TestMaterial_PrincipledHighlight(t *testing.T) {
+	normal := NewVector(0, 1, 0)
+	eye := NewVector(0, 1, -1).Normalize()
+	lightv := NewVector(0, 1, 1).Normalize()
+
+	pm := NewPrincipledMaterial()
+	state := &IntersectionState{Object: NewPlane(), EyeV: eye, NormalV: normal}
+	plain := pm.Material().at(state)
+	assert.Equal(t, Black(), plain.principledHighlight(eye, normal, lightv), "no clear coat or sheen")
+	assert.Equal(t, Black(), NewDefaultMaterial().principledHighlight(eye, normal, lightv), "Phong materials have none")
+
+	pm.Clearcoat = 1
+	coated := pm.Material().at(state)
+	assert.True(t, coated.principledHighlight(eye, normal, lightv).R > 0, "clear coat highlight")
+	assert.Equal(t, Black(), coated.principledHighlight(eye, normal, NewVector(0, -1, 1).Normalize()), "light below the surface")
+
+	// the sheen is strongest at grazing angles
+	pm.Clearcoat = 0
+	pm.Sheen = 1
+	sheen := pm.Material().at(state)
+	grazing := sheen.principledHighlight(eye, normal, NewVector(0, 0.1, 1).Normalize()).Scale(1 / 0.1)
+	straight := sheen.principledHighlight(eye, normal, NewVector(0, 1, 0))
+	assert.True(t, grazing.R > straight.R, "sheen should be stronger at grazing angles")
+}
+
+func TestParseMTLPBR(t *testing.T) {
+	mtl := `# Blender MTL File
+newmtl plastic
+Kd 0.8 0.1 0.1
+Ns 250
+
+newmtl car_paint
+Kd 0.1 0.1 0.8
+Pr 0.4
+Pm 0.2
+Pc 1
+Pcr 0.05
+Ps 0.3
+Ke 0.1 0.2 0.3
+map_Pr -bm 1 roughness.png
+norm normal.png
+`
+	got, err := parseMTLPBR(strings.NewReader(mtl))
+	assert.NoError(t, err)
+
+	assert.False(t, got["plastic"].isPrincipled(), "no PBR keys")
+	assert.False(t, got["missing"].isPrincipled(), "missing materials are not principled")
+
+	p := got["car_paint"]
+	assert.True(t, p.isPrincipled(), "should be principled")
+	assert.Equal(t, map[string]float64{"Pr": 0.4, "Pm": 0.2, "Pc": 1, "Pcr": 0.05, "Ps": 0.3}, p.values, "should equal")
+	assert.Equal(t, NewColor(0.1, 0.2, 0.3), *p.emission, "should equal")
+	assert.Equal(t, map[string]string{"map_Pr": "roughness.png", "norm": "normal.png"}, p.maps, "should equal")
+	assert.Equal(t, 0.5, p.value("aniso", 0.5), "default")
+
+	_, err = parseMTLPBR(strings.NewReader("newmtl bad\nPr rough\n"))
+	assert.Error(t, err, "should fail")
+}
+
+func TestConvertGLTFMaterial(t *testing.T) {
+	metallic, roughness := 0.3, 0.6
+
+	tests := []struct {
+		name string
+		mat  *gltf.Material
+		want func() *PrincipledMaterial
+	}{
+		{
+			name: "defaults",
+			mat:  &gltf.Material{Name: "default"},
+			want: func() *PrincipledMaterial {
+				pm := NewPrincipledMaterial()
+				pm.BaseColor = White()
+				pm.Metallic = 1
+				pm.Roughness = 1
+				pm.IOR = 1.5
+				pm.ClearcoatRoughness = 0
+				pm.SheenTint = 0
+				return pm
+			},
+		},
+		{
+			name: "metallic roughness with extensions",
+			mat: &gltf.Material{
+				Name: "paint",
+				PBRMetallicRoughness: &gltf.PBRMetallicRoughness{
+					BaseColorFactor: &[4]float64{0.5, 0.2, 0.1, 1},
+					MetallicFactor:  &metallic,
+					RoughnessFactor: &roughness,
+				},
+				EmissiveFactor: [3]float64{1, 0.5, 0},
+				Extensions: map[string]interface{}{
+					"KHR_materials_clearcoat":         map[string]interface{}{"clearcoatFactor": 1, "clearcoatRoughnessFactor": 0.1},
+					"KHR_materials_sheen":             map[string]interface{}{"sheenColorFactor": []float64{0.2, 0.4, 0.1}},
+					"KHR_materials_transmission":      map[string]interface{}{"transmissionFactor": 0.5},
+					"KHR_materials_ior":               map[string]interface{}{"ior": 2},
+					"KHR_materials_emissive_strength": map[string]interface{}{"emissiveStrength": 4},
+				},
+			},
+			want: func() *PrincipledMaterial {
+				pm := NewPrincipledMaterial()
+				pm.BaseColor = NewColor(0.5, 0.2, 0.1)
+				pm.Metallic = 0.3
+				pm.Roughness = 0.6
+				pm.IOR = 2
+				pm.Specular = math.Pow(1.0/3, 2) / 0.08
+				pm.Clearcoat = 1
+				pm.ClearcoatRoughness = 0.1
+				pm.Sheen = 0.4
+				pm.SheenTint = 0
+				pm.Transmission = 0.5
+				pm.Emission = NewColor(1, 0.5, 0)
+				pm.EmissionStrength = 4
+				return pm
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := convertGLTFMaterial(&gltf.Document{}, tt.mat, "")
+			assert.NoError(t, err)
+
+			want := tt.want()
+			got := m.Principled
+			assert.InDelta(t, want.Specular, got.Specular, 1e-9, "should equal")
+			got.Specular = want.Specular
+			assert.Equal(t, want, got, "should equal")
+			assert.Equal(t, want.IOR, m.RefractiveIndex, "should equal")
+		})
+	}
+
+	_, err := convertGLTFMaterial(&gltf.Document{}, &gltf.Material{
+		PBRMetallicRoughness: &gltf.PBRMetallicRoughness{BaseColorTexture: &gltf.TextureInfo{Index: 0}},
+	}, "")
+	assert.Error(t, err, "missing texture")
+}
@@ -0,0 +1,87 @@
+package tracer
+
+import (
+	"log"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// progressiveOffset returns the sub-pixel position sampled in the given pass
+// The first passes walk the antialias grid, so that a progressive render with as many passes as
+// grid positions takes exactly the same samples as the equivalent fixed-sample render.
+// Later passes are jittered randomly.
+func progressiveOffset(pass int, offsets []subPixel, rng *rand.Rand) subPixel {
+	if pass < len(offsets) {
+		return offsets[pass]
+	}
+	return subPixel{x: rng.Float64(), y: rng.Float64()}
+}
+
+// progressiveDone returns true (and the reason) when the progressive render should stop after the given number of passes
+func (w *World) progressiveDone(passes int, start time.Time, film *Film) (bool, string) {
+	if w.Config.ProgressiveMaxSamples > 0 && passes >= w.Config.ProgressiveMaxSamples {
+		return true, "sample cap reached"
+	}
+	if w.Config.ProgressiveTimeBudget > 0 && time.Since(start) >= w.Config.ProgressiveTimeBudget {
+		return true, "time budget reached"
+	}
+	// variance needs at least two samples
+	if w.Config.ProgressiveNoiseThreshold > 0 && passes > 1 && film.maxRelativeError(w.region) <= w.Config.ProgressiveNoiseThreshold {
+		return true, "noise threshold reached"
+	}
+	// with adaptive sampling converged pixels are skipped, once all are the passes would do nothing
+	if w.Config.AdaptiveSampling && film.converged(w.region, w.Config) {
+		return true, "every pixel converged"
+	}
+	return false, ""
+}
+
+// doProgressiveRender renders the image in passes of one sample per pixel
+// Each pass is accumulated in the film, so the canvas always shows the running average of all passes
+func (w *World) doProgressiveRender(camera *Camera, canvas *Canvas, film *Film) {
+	offsets := antialiasOffsets(w.Config.Antialias)
+	start := time.Now()
+	lastSnapshot := start
+	seed := w.renderSeed()
+
+	for pass := 0; ; pass++ {
+		// every pass draws new random numbers
+		w.dispatch(camera, false, seed+int64(pass*w.Config.Parallelism), func(p *pixel, xs Intersections, rng *rand.Rand) {
+			// converged pixels are left alone when adaptive sampling is on
+			if w.Config.AdaptiveSampling {
+				if stats := film.Stats(int(p.x), int(p.y)); stats.converged(w.Config) {
+					return
+				}
+			}
+			o := progressiveOffset(pass, offsets, rng)
+			p.sample(w, film, p.x+o.x, p.y+o.y, xs, rng)
+			film.ResolvePixel(canvas, int(p.x), int(p.y))
+		})
+		log.Printf("Finished pass %v (elapsed: %v)", pass+1, time.Since(start).Round(time.Millisecond))
+
+		if w.Config.SnapshotFile != "" && w.Config.SnapshotInterval > 0 && time.Since(lastSnapshot) >= w.Config.SnapshotInterval {
+			film.ResolveAll(canvas)
+			exportSnapshot(canvas, w.Config.SnapshotFile)
+			lastSnapshot = time.Now()
+		}
+
+		if done, reason := w.progressiveDone(pass+1, start, film); done {
+			log.Printf("Progressive render done after %v passes: %v", pass+1, reason)
+			return
+		}
+	}
+}
+
+// exportSnapshot writes the current state of the canvas to a file
+func exportSnapshot(canvas *Canvas, output string) {
+	f, err := os.Create(output)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	defer f.Close()
+
+	log.Printf("Writing snapshot to %v", f.Name())
+	canvas.ExportToPNG(f)
+}
@@ -0,0 +1,163 @@
+package tracer
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// smallTestWorld returns the default test world with an 11x11 camera, small enough to render in every test
+func smallTestWorld() (*World, *Camera) {
+	w := NewDefaultTestWorld()
+	camera := NewCamera(11, 11, math.Pi/2)
+	camera.SetTransform(ViewTransform(NewPoint(0, 0, -5), NewPoint(0, 0, 0), NewVector(0, 1, 0)))
+	w.SetCamera(camera)
+	return w, camera
+}
+
+func TestWorld_RenderProgressive(t *testing.T) {
+	fixed, camera := smallTestWorld()
+	fixed.Config.Antialias = 2
+	want := NewCanvas(11, 11)
+	fixed.Render(camera, want)
+
+	progressive, camera := smallTestWorld()
+	progressive.Config.Antialias = 2
+	progressive.Config.Progressive = true
+	progressive.Config.ProgressiveMaxSamples = 4
+	got := NewCanvas(11, 11)
+	progressive.Render(camera, got)
+
+	for y := 0; y < 11; y++ {
+		for x := 0; x < 11; x++ {
+			assert.Equal(t, 4, progressive.Film().SampleCount(x, y), "should equal")
+
+			wantClr, err := want.Get(x, y)
+			assert.NoError(t, err)
+			gotClr, err := got.Get(x, y)
+			assert.NoError(t, err)
+			assert.True(t, wantClr.Equal(gotClr), "pixel (%v, %v): %v should equal %v", x, y, gotClr, wantClr)
+		}
+	}
+}
+
+func TestWorld_RenderProgressiveBudgets(t *testing.T) {
+	tests := []struct {
+		name      string
+		budget    time.Duration
+		threshold float64
+		crop      *CropWindow
+		adaptive  bool
+		minCount  int
+	}{
+		{
+			name:     "time budget",
+			budget:   time.Nanosecond,
+			minCount: 1,
+		},
+		{
+			name:      "noise threshold",
+			threshold: 0.05,
+			minCount:  2,
+		},
+		{
+			// the pixels outside the crop window are never sampled
+			name:      "noise threshold with crop window",
+			threshold: 0.05,
+			crop:      NewCropWindow(0, 0, 3, 3),
+			minCount:  2,
+		},
+		{
+			// converged pixels are skipped, the render stops once none are left
+			name:     "every pixel converged",
+			adaptive: true,
+			minCount: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, camera := smallTestWorld()
+			w.Config.Progressive = true
+			w.Config.ProgressiveTimeBudget = tt.budget
+			w.Config.ProgressiveNoiseThreshold = tt.threshold
+			w.Config.CropWindow = tt.crop
+			w.Config.AdaptiveSampling = tt.adaptive
+			w.Config.AdaptiveMaxSamples = 16
+			// safety net, so a broken budget can't hang the test, the edges of the spheres need about 2000 samples
+			w.Config.ProgressiveMaxSamples = 4096
+			w.Config.Seed = 1
+			assert.NoError(t, w.Render(camera, NewCanvas(11, 11)))
+
+			n := w.Film().SampleCount(0, 0)
+			assert.True(t, n >= tt.minCount, "should take at least %v samples, got %v", tt.minCount, n)
+			assert.True(t, n < 4096, "should stop before the sample cap")
+			if tt.threshold > 0 {
+				assert.True(t, w.Film().maxRelativeError(w.region) <= tt.threshold, "should be below the noise threshold")
+			}
+			if tt.adaptive {
+				done, reason := w.progressiveDone(1, time.Now(), w.Film())
+				assert.True(t, done, "should stop once every pixel converged")
+				assert.Equal(t, "every pixel converged", reason, "should equal")
+			}
+		})
+	}
+}
+
+func TestWorld_RenderProgressiveNoBudget(t *testing.T) {
+	w, camera := smallTestWorld()
+	w.Config.Progressive = true
+	assert.Error(t, w.Render(camera, NewCanvas(11, 11)), "a render without a budget would never finish")
+}
+
+func TestWorld_RenderProgressiveSeed(t *testing.T) {
+	render := func(seed int64) *Canvas {
+		w, camera := smallTestWorld()
+		w.Config.Progressive = true
+		w.Config.ProgressiveMaxSamples = 8
+		w.Config.Parallelism = 4
+		w.Config.Seed = seed
+		canvas := NewCanvas(11, 11)
+		w.Render(camera, canvas)
+		return canvas
+	}
+
+	want, got, other := render(1), render(1), render(2)
+	same := true
+	for y := 0; y < 11; y++ {
+		for x := 0; x < 11; x++ {
+			wantClr, err := want.Get(x, y)
+			assert.NoError(t, err)
+			gotClr, err := got.Get(x, y)
+			assert.NoError(t, err)
+			assert.Equal(t, wantClr, gotClr, "pixel (%v, %v): the same seed renders the same image", x, y)
+
+			otherClr, err := other.Get(x, y)
+			assert.NoError(t, err)
+			same = same && wantClr == otherClr
+		}
+	}
+	assert.False(t, same, "another seed takes other samples")
+}
+
+func TestWorld_RenderProgressiveSnapshot(t *testing.T) {
+	w, camera := smallTestWorld()
+	w.Config.Progressive = true
+	w.Config.ProgressiveMaxSamples = 2
+	w.Config.SnapshotFile = filepath.Join(t.TempDir(), "snapshot.png")
+	w.Config.SnapshotInterval = time.Nanosecond
+	w.Render(camera, NewCanvas(11, 11))
+
+	f, err := os.Open(w.Config.SnapshotFile)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	got, err := NewCanvasFromPNG(f)
+	assert.NoError(t, err)
+	assert.Equal(t, 11, got.Width, "should equal")
+	assert.Equal(t, 11, got.Height, "should equal")
+}
@@ -6,6 +6,19 @@ import "github.com/rcrowley/go-metrics"
 type Ray struct {
 	Origin Point
 	Dir    Vector
+
+	// Wavelength (nm) the ray is traced at in spectral mode, 0 for RGB rays
+	Wavelength float64
+
+	// Differentials are the rays through the neighbouring pixels, nil if unknown
+	Differentials *RayDifferentials
+}
+
+// RayDifferentials are two rays offset by one pixel in x and y from the main ray, they follow it through perfect
+// reflections and refractions and estimate the footprint of the ray on the surfaces it hits, used to filter textures
+type RayDifferentials struct {
+	RxOrigin, RyOrigin Point
+	RxDir, RyDir       Vector
 }
 
 // NewRay returns a new ray
@@ -20,9 +33,25 @@ func (r Ray) Position(t float64) Point {
 	return r.Origin.AddVector(r.Dir.Scale(t))
 }
 
+// ScaleDifferentials returns the ray with its differentials moved closer to it by s
+// With n samples per pixel, the samples are about 1/sqrt(n) pixels apart.
+func (r Ray) ScaleDifferentials(s float64) Ray {
+	if r.Differentials == nil {
+		return r
+	}
+	d := r.Differentials
+	r.Differentials = &RayDifferentials{
+		RxOrigin: r.Origin.AddVector(d.RxOrigin.SubPoint(r.Origin).Scale(s)),
+		RyOrigin: r.Origin.AddVector(d.RyOrigin.SubPoint(r.Origin).Scale(s)),
+		RxDir:    r.Dir.AddVector(d.RxDir.SubVector(r.Dir).Scale(s)),
+		RyDir:    r.Dir.AddVector(d.RyDir.SubVector(r.Dir).Scale(s)),
+	}
+	return r
+}
+
 // Transform returns a new ray transformed by the matrix
 func (r Ray) Transform(m Matrix) Ray {
-	return Ray{Origin: r.Origin.TimesMatrix(m), Dir: r.Dir.TimesMatrix(m)}
+	return Ray{Origin: r.Origin.TimesMatrix(m), Dir: r.Dir.TimesMatrix(m), Wavelength: r.Wavelength}
 }
 
 // Equal returns true if rays are equal within Epsilon of each other
@@ -115,3 +115,25 @@ func TestRay_Transform(t *testing.T) {
 		})
 	}
 }
+
+func TestRay_ScaleDifferentials(t *testing.T) {
+	r := NewRay(NewPoint(0, 0, 0), NewVector(0, 0, 1))
+	r.Differentials = &RayDifferentials{
+		RxOrigin: NewPoint(1, 0, 0),
+		RyOrigin: NewPoint(0, 1, 0),
+		RxDir:    NewVector(1, 0, 1),
+		RyDir:    NewVector(0, 1, 1),
+	}
+
+	want := &RayDifferentials{
+		RxOrigin: NewPoint(0.5, 0, 0),
+		RyOrigin: NewPoint(0, 0.5, 0),
+		RxDir:    NewVector(0.5, 0, 1),
+		RyDir:    NewVector(0, 0.5, 1),
+	}
+	got := r.ScaleDifferentials(0.5)
+	assert.Equal(t, want, got.Differentials, "should be equal")
+	assert.Equal(t, NewVector(1, 0, 1), r.Differentials.RxDir, "the original ray is unchanged")
+
+	assert.Nil(t, NewRay(Origin(), NewVector(0, 0, 1)).ScaleDifferentials(0.5).Differentials, "should have none")
+}
@@ -0,0 +1,189 @@
+package tracer
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// CropWindow restricts the render to a rectangle of the full frame
+// In pixel coordinates the window is [X0, X1) x [Y0, Y1), in normalized coordinates all values are in [0, 1]
+// and every pixel touched by the window is rendered.
+type CropWindow struct {
+	X0, Y0, X1, Y1 float64
+	Normalized     bool
+}
+
+// NewCropWindow returns a crop window in pixel coordinates
+func NewCropWindow(x0, y0, x1, y1 int) *CropWindow {
+	return &CropWindow{X0: float64(x0), Y0: float64(y0), X1: float64(x1), Y1: float64(y1)}
+}
+
+// NewNormalizedCropWindow returns a crop window in normalized coordinates
+func NewNormalizedCropWindow(x0, y0, x1, y1 float64) *CropWindow {
+	return &CropWindow{X0: x0, Y0: y0, X1: x1, Y1: y1, Normalized: true}
+}
+
+// ParseCropWindow parses a crop window given as "x0,y0,x1,y1"
+func ParseCropWindow(s string, normalized bool) (*CropWindow, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("crop window must be x0,y0,x1,y1, got %q", s)
+	}
+
+	var v [4]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid crop window %q: %v", s, err)
+		}
+		v[i] = f
+	}
+	return &CropWindow{X0: v[0], Y0: v[1], X1: v[2], Y1: v[3], Normalized: normalized}, nil
+}
+
+// Pixels returns the pixels covered by the window, [x0, x1) x [y0, y1), clamped to the image
+func (c *CropWindow) Pixels(width, height int) (x0, y0, x1, y1 int) {
+	fx0, fy0, fx1, fy1 := c.X0, c.Y0, c.X1, c.Y1
+	if c.Normalized {
+		fx0, fx1 = fx0*float64(width), fx1*float64(width)
+		fy0, fy1 = fy0*float64(height), fy1*float64(height)
+	}
+
+	clamp := func(v float64, max int) int {
+		return int(math.Max(0, math.Min(float64(max), v)))
+	}
+	return clamp(math.Floor(fx0), width), clamp(math.Floor(fy0), height),
+		clamp(math.Ceil(fx1), width), clamp(math.Ceil(fy1), height)
+}
+
+// ParseTileRange parses a tile range given as "start:end" (end is exclusive)
+func ParseTileRange(s string) (start, end int, err error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("tile range must be start:end, got %q", s)
+	}
+	if start, err = strconv.Atoi(strings.TrimSpace(parts[0])); err != nil {
+		return 0, 0, fmt.Errorf("invalid tile range %q: %v", s, err)
+	}
+	if end, err = strconv.Atoi(strings.TrimSpace(parts[1])); err != nil {
+		return 0, 0, fmt.Errorf("invalid tile range %q: %v", s, err)
+	}
+	if start < 0 || end <= start {
+		return 0, 0, fmt.Errorf("invalid tile range %q, need 0 <= start < end", s)
+	}
+	return start, end, nil
+}
+
+// region is the part of the full frame being rendered
+type region struct {
+	width, height int
+
+	// crop window, [x0, x1) x [y0, y1)
+	x0, y0, x1, y1 int
+
+	// tiles is the selected tile range, nil means all tiles
+	tiles []tile
+
+	// margin is how many pixels around the region are traced as well, filters wider than a pixel splat the samples
+	// of these into the pixels at the edge of the region
+	margin int
+}
+
+// renderRegion returns the part of the image the config asks to render
+func (w *World) renderRegion(camera *Camera) *region {
+	width, height := int(camera.Hsize), int(camera.Vsize)
+	r := &region{width: width, height: height, x1: width, y1: height}
+
+	if w.Config.CropWindow != nil {
+		r.x0, r.y0, r.x1, r.y1 = w.Config.CropWindow.Pixels(width, height)
+	}
+
+	// a sample in a pixel reaches the centers of the pixels up to radius - 0.5 away
+	if w.Config.Filter != nil {
+		r.margin = int(math.Max(0, math.Ceil(w.Config.Filter.Radius()-0.5)))
+	}
+
+	if w.Config.TileEnd > 0 {
+		all := tiles(width, height, w.Config.TileSize)
+		start := int(math.Min(float64(w.Config.TileStart), float64(len(all))))
+		end := int(math.Min(float64(w.Config.TileEnd), float64(len(all))))
+		r.tiles = all[start:end]
+	}
+	return r
+}
+
+// full returns true if the region is the whole frame
+func (r *region) full() bool {
+	return r.tiles == nil && r.x0 == 0 && r.y0 == 0 && r.x1 == r.width && r.y1 == r.height
+}
+
+// contains returns true if pixel x,y is inside the region
+func (r *region) contains(x, y int) bool {
+	if x < r.x0 || x >= r.x1 || y < r.y0 || y >= r.y1 {
+		return false
+	}
+	if r.tiles == nil {
+		return true
+	}
+	for _, t := range r.tiles {
+		if x >= t.x0 && x < t.x1 && y >= t.y0 && y < t.y1 {
+			return true
+		}
+	}
+	return false
+}
+
+// traced returns true if pixel x,y is inside the region or its margin
+// Only its samples are needed outside the region, its color is not part of the render.
+func (r *region) traced(x, y int) bool {
+	m := r.margin
+	if x < r.x0-m || x >= r.x1+m || y < r.y0-m || y >= r.y1+m {
+		return false
+	}
+	if r.tiles == nil {
+		return true
+	}
+	for _, t := range r.tiles {
+		if x >= t.x0-m && x < t.x1+m && y >= t.y0-m && y < t.y1+m {
+			return true
+		}
+	}
+	return false
+}
+
+// tileIndexes returns the indexes of the tiles with pixels to trace, all is every tile of the frame
+// Tiles next to the tile range are included for the pixels in the margin.
+func (r *region) tileIndexes(all []tile) []int {
+	var indexes []int
+	for i, t := range all {
+		if r.tiles == nil || r.touches(t) {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// touches returns true if tile t is one of the tiles of the region or within the margin of one
+func (r *region) touches(t tile) bool {
+	m := r.margin
+	for _, rt := range r.tiles {
+		if t.x0 < rt.x1+m && t.x1 > rt.x0-m && t.y0 < rt.y1+m && t.y1 > rt.y0-m {
+			return true
+		}
+	}
+	return false
+}
+
+// coverage returns the coverage mask of the region, column major like the canvas
+func (r *region) coverage() [][]bool {
+	mask := make([][]bool, r.width)
+	for x := range mask {
+		mask[x] = make([]bool, r.height)
+		for y := range mask[x] {
+			mask[x][y] = r.contains(x, y)
+		}
+	}
+	return mask
+}
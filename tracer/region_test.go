@@ -0,0 +1,249 @@
+package tracer
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCropWindow_Pixels(t *testing.T) {
+	tests := []struct {
+		name           string
+		window         *CropWindow
+		x0, y0, x1, y1 int
+	}{
+		{
+			name:   "pixels",
+			window: NewCropWindow(2, 3, 5, 7),
+			x0:     2, y0: 3, x1: 5, y1: 7,
+		},
+		{
+			name:   "pixels clamped",
+			window: NewCropWindow(-2, 3, 50, 70),
+			x0:     0, y0: 3, x1: 10, y1: 20,
+		},
+		{
+			name:   "normalized",
+			window: NewNormalizedCropWindow(0.5, 0.25, 1, 0.5),
+			x0:     5, y0: 5, x1: 10, y1: 10,
+		},
+		{
+			name:   "normalized partial pixels",
+			window: NewNormalizedCropWindow(0.15, 0, 0.27, 0.01),
+			x0:     1, y0: 0, x1: 3, y1: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x0, y0, x1, y1 := tt.window.Pixels(10, 20)
+			assert.Equal(t, []int{tt.x0, tt.y0, tt.x1, tt.y1}, []int{x0, y0, x1, y1}, "should equal")
+		})
+	}
+}
+
+func TestParseCropWindow(t *testing.T) {
+	tests := []struct {
+		name       string
+		s          string
+		normalized bool
+		want       *CropWindow
+		wantErr    bool
+	}{
+		{
+			name: "pixels",
+			s:    "1, 2,3,4",
+			want: NewCropWindow(1, 2, 3, 4),
+		},
+		{
+			name:       "normalized",
+			s:          "0,0.5,0.25,1",
+			normalized: true,
+			want:       NewNormalizedCropWindow(0, 0.5, 0.25, 1),
+		},
+		{
+			name:    "too short",
+			s:       "1,2,3",
+			wantErr: true,
+		},
+		{
+			name:    "not a number",
+			s:       "1,2,3,x",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCropWindow(tt.s, tt.normalized)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got, "should equal")
+		})
+	}
+}
+
+func TestParseTileRange(t *testing.T) {
+	tests := []struct {
+		name       string
+		s          string
+		start, end int
+		wantErr    bool
+	}{
+		{
+			name:  "range",
+			s:     "3:7",
+			start: 3,
+			end:   7,
+		},
+		{
+			name:    "empty range",
+			s:       "3:3",
+			wantErr: true,
+		},
+		{
+			name:    "missing end",
+			s:       "3",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, err := ParseTileRange(tt.s)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.start, start, "should equal")
+			assert.Equal(t, tt.end, end, "should equal")
+		})
+	}
+}
+
+func TestWorld_RenderCropWindow(t *testing.T) {
+	full, camera := smallTestWorld()
+	want := NewCanvas(11, 11)
+	full.Render(camera, want)
+
+	cropped, camera := smallTestWorld()
+	cropped.Config.CropWindow = NewCropWindow(3, 4, 8, 6)
+	got := NewCanvas(11, 11)
+	cropped.Render(camera, got)
+
+	for y := 0; y < 11; y++ {
+		for x := 0; x < 11; x++ {
+			inside := x >= 3 && x < 8 && y >= 4 && y < 6
+			assert.Equal(t, inside, got.Covered(x, y), "pixel (%v, %v) coverage", x, y)
+
+			if inside {
+				assert.Equal(t, want.colors[x][y], got.colors[x][y], "pixel (%v, %v) should equal", x, y)
+			} else {
+				assert.Equal(t, 0, cropped.Film().SampleCount(x, y), "pixel (%v, %v) should not be rendered", x, y)
+			}
+		}
+	}
+}
+
+func TestWorld_RenderTileRangeMerge(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+	}{
+		{
+			name:   "box filter",
+			filter: NewBoxFilter(0.5),
+		},
+		{
+			name:   "wide filter",
+			filter: NewGaussianFilter(2, 2),
+		},
+	}
+
+	// close enough for the sphere to cross the tile edges
+	view := ViewTransform(NewPoint(0, 0, -2), NewPoint(0, 0, 0), NewVector(0, 1, 0))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			full, camera := smallTestWorld()
+			full.Config.Filter = tt.filter
+			full.Config.TileSize = 4
+			camera.SetTransform(view)
+			want := NewCanvas(11, 11)
+			full.Render(camera, want)
+			want = pngRoundTrip(t, want)
+
+			// 11x11 with 4x4 tiles is 9 tiles, split across two "machines"
+			var parts []*Canvas
+			for _, r := range [][2]int{{0, 5}, {5, 9}} {
+				w, camera := smallTestWorld()
+				w.Config.Filter = tt.filter
+				w.Config.TileSize = 4
+				w.Config.TileStart, w.Config.TileEnd = r[0], r[1]
+				camera.SetTransform(view)
+				canvas := NewCanvas(11, 11)
+				w.Render(camera, canvas)
+
+				// round trip through png, like separate processes would
+				parts = append(parts, pngRoundTrip(t, canvas))
+			}
+
+			assert.False(t, parts[0].Covered(10, 10), "last tile is not in the first part")
+			assert.True(t, parts[1].Covered(10, 10), "last tile is in the second part")
+
+			got, err := MergeCanvases(parts...)
+			assert.NoError(t, err)
+			assert.Nil(t, got.covered, "merged canvas should be complete")
+
+			// both went through png, only the rounding of the 8 bit channels can differ
+			for y := 0; y < 11; y++ {
+				for x := 0; x < 11; x++ {
+					wantClr, gotClr := want.colors[x][y], got.colors[x][y]
+					assert.InDelta(t, wantClr.R, gotClr.R, 1.0/255, "pixel (%v, %v) should equal", x, y)
+					assert.InDelta(t, wantClr.G, gotClr.G, 1.0/255, "pixel (%v, %v) should equal", x, y)
+					assert.InDelta(t, wantClr.B, gotClr.B, 1.0/255, "pixel (%v, %v) should equal", x, y)
+				}
+			}
+		})
+	}
+}
+
+// pngRoundTrip returns c after exporting it to png and reading it back
+func pngRoundTrip(t *testing.T, c *Canvas) *Canvas {
+	var buf bytes.Buffer
+	assert.NoError(t, c.ExportToPNG(&buf))
+	got, err := NewCanvasFromPNG(&buf)
+	assert.NoError(t, err)
+	return got
+}
+
+func TestMergeCanvases(t *testing.T) {
+	a := NewCanvas(2, 1)
+	a.Set(0, 0, NewColor(1, 0, 0))
+	a.SetCoverage([][]bool{{true}, {false}})
+
+	b := NewCanvas(2, 1)
+	b.Set(1, 0, NewColor(0, 0, 1))
+	b.SetCoverage([][]bool{{false}, {true}})
+
+	got, err := MergeCanvases(a, b)
+	assert.NoError(t, err)
+	assert.Equal(t, NewColor(1, 0, 0), got.colors[0][0], "should equal")
+	assert.Equal(t, NewColor(0, 0, 1), got.colors[1][0], "should equal")
+	assert.Nil(t, got.covered, "should be complete")
+
+	got, err = MergeCanvases(a)
+	assert.NoError(t, err)
+	assert.False(t, got.Covered(1, 0), "should not be covered")
+
+	_, err = MergeCanvases(a, NewCanvas(3, 1))
+	assert.Error(t, err)
+
+	_, err = MergeCanvases()
+	assert.Error(t, err)
+}
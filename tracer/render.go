@@ -3,17 +3,101 @@ package tracer
 import (
 	"flag"
 	"fmt"
+	"log"
 	"math"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/rcrowley/go-metrics"
 )
 
 var (
-	output = flag.String("output", "", "name of the output file, if empty, renders to screen")
+	output   = flag.String("output", "", "name of the output file, if empty, renders to screen")
+	heatmap  = flag.String("heatmap", "", "name of the file to write the per-pixel sample count heatmap to (only when rendering to a file)")
+	snapshot = flag.String("snapshot", "", "name of the file progressive renders periodically write the current image to")
+
+	checkpointFile     = flag.String("checkpoint", "", "name of the file to periodically save the render progress to")
+	checkpointInterval = flag.Duration("checkpoint_interval", 5*time.Minute, "how often to save the render progress")
+	resume             = flag.String("resume", "", "name of the checkpoint file to resume the render from")
+
+	crop           = flag.String("crop", "", "only render the pixels in x0,y0,x1,y1 (pixel coordinates, x1 and y1 exclusive)")
+	cropNormalized = flag.String("crop_normalized", "", "only render the pixels in x0,y0,x1,y1 (normalized [0, 1] coordinates)")
+	tileRange      = flag.String("tiles", "", "only render tiles start:end (end exclusive), see -tile_size")
+	tileSize       = flag.Int("tile_size", 16, "size of the tiles used by -tiles and -checkpoint")
+	integrator     = flag.String("integrator", "", "integrator to render with (whitted, ao, path, bdpt, normals, uvs, depth, barycentrics, materials)")
+	photons        = flag.Int("photons", 0, "number of caustic photons to emit (whitted integrator), 0 disables photon mapping")
+	globalPhotons  = flag.Int("global_photons", 0, "number of photons to emit for indirect light (needs -photons)")
+	photonRadius   = flag.Float64("photon_radius", 0.1, "radius around a hit photons are gathered from")
+	spectral       = flag.Bool("spectral", false, "trace rays at sampled wavelengths, for dispersion (whitted and path integrators)")
+	merge          = flag.String("merge", "", "comma separated list of partial renders to stitch together into -output, nothing is rendered")
 )
 
 // Render runs the render
 func Render(w *World) {
+	if *merge != "" {
+		if err := MergeFiles(strings.Split(*merge, ","), *output); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+
+	switch {
+	case *crop != "" && *cropNormalized != "":
+		log.Fatalln("only one of -crop and -crop_normalized can be set")
+	case *crop != "" || *cropNormalized != "":
+		window, err := ParseCropWindow(*crop+*cropNormalized, *cropNormalized != "")
+		if err != nil {
+			log.Fatalln(err)
+		}
+		w.Config.CropWindow = window
+	}
+	if *tileRange != "" {
+		start, end, err := ParseTileRange(*tileRange)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		w.Config.TileStart, w.Config.TileEnd = start, end
+	}
+	if *integrator != "" {
+		i, err := NewIntegrator(*integrator)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		w.Config.Integrator = i
+	}
+
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "tile_size":
+			w.Config.TileSize = *tileSize
+		case "photons":
+			w.Config.CausticPhotons = *photons
+		case "global_photons":
+			w.Config.GlobalPhotons = *globalPhotons
+		case "photon_radius":
+			w.Config.PhotonGatherRadius = *photonRadius
+		case "spectral":
+			w.Config.Spectral = *spectral
+		}
+	})
+
+	if *snapshot != "" {
+		w.Config.SnapshotFile = *snapshot
+	}
+	if *checkpointFile != "" {
+		w.Config.CheckpointFile = *checkpointFile
+		w.Config.CheckpointInterval = *checkpointInterval
+	}
+	if *resume != "" {
+		w.Config.ResumeFile = *resume
+		// keep saving progress to the same file, in case the render is killed again
+		if w.Config.CheckpointFile == "" {
+			w.Config.CheckpointFile = *resume
+			w.Config.CheckpointInterval = *checkpointInterval
+		}
+	}
+
 	if *output != "" {
 		RenderToFile(w, *output)
 	} else {
@@ -36,3 +120,38 @@ func showProgress(total, finished, last float64) float64 {
 
 	return last
 }
+
+// MergeFiles stitches partial renders (png files) of the same frame together and writes the result to output
+func MergeFiles(inputs []string, output string) error {
+	if output == "" {
+		return fmt.Errorf("no output file to merge into")
+	}
+
+	var parts []*Canvas
+	for _, in := range inputs {
+		f, err := os.Open(in)
+		if err != nil {
+			return err
+		}
+		c, err := NewCanvasFromPNG(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("error reading %v: %v", in, err)
+		}
+		parts = append(parts, c)
+	}
+
+	canvas, err := MergeCanvases(parts...)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	log.Printf("Exporting merged canvas to %v", f.Name())
+	return canvas.ExportToPNG(f)
+}
@@ -54,7 +54,7 @@ func pedestal() *Cube {
 	up := NewUVCheckersPattern(8, 8,
 		ColorName(colornames.White), ColorName(colornames.Violet))
 	cp := NewTextureMapPattern(up, NewCubeMapSame(up))
-	p := NewPerturbedPattern(cp, 0.09)
+	p := NewPerturbedPattern(cp, 0.09, 1)
 	s.Material().SetPattern(p)
 
 	return s
@@ -368,3 +368,21 @@ func BenchmarkRenderGlassSphere(b *testing.B) {
 		RenderToFile(w, output)
 	}
 }
+
+// BenchmarkRenderPlain renders an untextured scene into memory, most of the time goes to camera rays and shading
+func BenchmarkRenderPlain(b *testing.B) {
+	w := NewDefaultWorld(200, 200)
+	w.Config.Antialias = 2
+	w.Camera().SetTransform(ViewTransform(NewPoint(0, 1.7, -4.7), NewPoint(0, -1, 10), NewVector(0, 1, 0)))
+	w.AddObject(NewUnitSphere())
+	w.AddObject(NewPlane())
+	canvas := NewCanvas(200, 200)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if err := w.Render(w.Camera(), canvas); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package tracer
+
+import (
+	"math"
+
+	"golang.org/x/image/colornames"
+)
+
+// TextureFilter is the way a TextureSampler reconstructs the color between texels
+type TextureFilter int
+
+const (
+	// TextureFilterNearest returns the texel the point falls in
+	TextureFilterNearest TextureFilter = iota
+	// TextureFilterBilinear interpolates between the 4 closest texels
+	TextureFilterBilinear
+	// TextureFilterBicubic interpolates between the 16 closest texels with a Catmull-Rom spline
+	TextureFilterBicubic
+)
+
+// WrapMode is what a TextureSampler does with coordinates outside [0, 1]
+type WrapMode int
+
+const (
+	// WrapRepeat tiles the texture
+	WrapRepeat WrapMode = iota
+	// WrapClamp repeats the texels on the edges
+	WrapClamp
+	// WrapMirror tiles the texture, flipping every other tile
+	WrapMirror
+)
+
+// MipmapFilter is the way a TextureSampler filters the texels covered by the footprint of a hit
+type MipmapFilter int
+
+const (
+	// MipmapNone ignores the footprint and always samples the full resolution texture
+	MipmapNone MipmapFilter = iota
+	// MipmapTrilinear blends the two mipmap levels closest to the size of the footprint, blurring textures seen at
+	// grazing angles
+	MipmapTrilinear
+	// MipmapAnisotropic averages trilinear samples along the longest axis of the footprint, from the level of its
+	// shortest axis
+	MipmapAnisotropic
+)
+
+// TextureSampler looks up the color of a texture at surface (u, v) coordinates
+// Before the lookup the coordinates are scaled, rotated (counter clockwise, in radians) and offset, in that order, the
+// same as the glTF KHR_texture_transform extension. Texel centers are at (x + 0.5) / width, (y + 0.5) / height.
+// Textures are filtered in linear space, colors of sRGB textures are returned in linear sRGB, materials and patterns
+// convert them to the working space of their world.
+// Hits of rays with differentials (see RayDifferentials) have a footprint, the area of the texture one pixel covers.
+// The texture is then sampled from a mipmap, a chain of copies each half the size of the previous, at the level where
+// the footprint is about one texel, which removes the moire patterns of textures far away.
+type TextureSampler struct {
+	Texture *Texture
+
+	Filter       TextureFilter
+	WrapU, WrapV WrapMode
+
+	OffsetU, OffsetV float64
+	ScaleU, ScaleV   float64
+	Rotation         float64
+
+	Mipmap MipmapFilter
+	// MaxAnisotropy is the maximum number of samples of anisotropic filtering, footprints that are longer than that
+	// are blurred more
+	MaxAnisotropy int
+}
+
+// NewTextureSampler returns a new bilinear, repeating sampler of the texture, with anisotropic mipmap filtering
+func NewTextureSampler(t *Texture) *TextureSampler {
+	return &TextureSampler{
+		Texture:       t,
+		Filter:        TextureFilterBilinear,
+		WrapU:         WrapRepeat,
+		WrapV:         WrapRepeat,
+		ScaleU:        1,
+		ScaleV:        1,
+		Mipmap:        MipmapAnisotropic,
+		MaxAnisotropy: 8,
+	}
+}
+
+// SetWrap sets the wrap mode in both directions
+func (ts *TextureSampler) SetWrap(w WrapMode) {
+	ts.WrapU, ts.WrapV = w, w
+}
+
+// SetTransform sets the offset, scale and rotation applied to the coordinates
+func (ts *TextureSampler) SetTransform(offsetU, offsetV, scaleU, scaleV, rotation float64) {
+	ts.OffsetU, ts.OffsetV = offsetU, offsetV
+	ts.ScaleU, ts.ScaleV = scaleU, scaleV
+	ts.Rotation = rotation
+}
+
+// linear returns (u, v) scaled and rotated, the transform without the offset
+func (ts *TextureSampler) linear(u, v float64) (float64, float64) {
+	u, v = u*ts.ScaleU, v*ts.ScaleV
+	if ts.Rotation != 0 {
+		sin, cos := math.Sincos(ts.Rotation)
+		u, v = cos*u+sin*v, -sin*u+cos*v
+	}
+	return u, v
+}
+
+// transform returns the texture coordinates of the surface coordinates (u, v)
+func (ts *TextureSampler) transform(u, v float64) (float64, float64) {
+	u, v = ts.linear(u, v)
+	return u + ts.OffsetU, v + ts.OffsetV
+}
+
+// Sample returns the color of the full resolution texture at the surface coordinates (u, v)
+func (ts *TextureSampler) Sample(u, v float64) Color {
+	m := ts.Texture.mipmap()
+	if m.err != nil {
+		return ColorName(colornames.Purple) // highly visible, texture missing
+	}
+	u, v = ts.transform(u, v)
+	return ts.sampleLevel(m.base, u, v)
+}
+
+// SampleFootprint returns the color of the texture at the surface coordinates (u, v), filtered over the footprint
+// given by the derivatives of the coordinates from one pixel to the next in x and y
+func (ts *TextureSampler) SampleFootprint(u, v, dudx, dvdx, dudy, dvdy float64) Color {
+	if ts.Mipmap == MipmapNone || (dudx == 0 && dvdx == 0 && dudy == 0 && dvdy == 0) {
+		return ts.Sample(u, v)
+	}
+	m := ts.Texture.mipmap()
+	if m.err != nil {
+		return ColorName(colornames.Purple) // highly visible, texture missing
+	}
+	levels := textureCache.levels(ts.Texture, m)
+
+	u, v = ts.transform(u, v)
+	dudx, dvdx = ts.linear(dudx, dvdx)
+	dudy, dvdy = ts.linear(dudy, dvdy)
+
+	// the axes of the footprint, in texels of the full resolution texture
+	w, h := float64(levels[0].Width), float64(levels[0].Height)
+	lx := math.Hypot(dudx*w, dvdx*h)
+	ly := math.Hypot(dudy*w, dvdy*h)
+
+	if ts.Mipmap == MipmapTrilinear {
+		return ts.trilinear(levels, u, v, math.Max(lx, ly))
+	}
+
+	// the major axis, in texture coordinates
+	du, dv, major, minor := dudx, dvdx, lx, ly
+	if ly > lx {
+		du, dv, major, minor = dudy, dvdy, ly, lx
+	}
+	max := math.Max(1, float64(ts.MaxAnisotropy))
+	if minor*max < major {
+		minor = major / max
+	}
+	n := int(math.Min(max, math.Ceil(major/math.Max(minor, 1e-12))))
+	if n <= 1 {
+		return ts.trilinear(levels, u, v, minor)
+	}
+
+	// samples spread evenly along the major axis
+	result := Black()
+	for i := 0; i < n; i++ {
+		t := (float64(i)+0.5)/float64(n) - 0.5
+		result = result.Add(ts.trilinear(levels, u+t*du, v+t*dv, minor))
+	}
+	return result.Scale(1 / float64(n))
+}
+
+// sampleIn returns the color of the full resolution texture at (u, v) in the working space ws
+func (ts *TextureSampler) sampleIn(ws WorkingSpace, u, v float64) Color {
+	return ts.color(ws, ts.Sample(u, v))
+}
+
+// sampleAt returns the color of the texture at the hit, filtered over its footprint, in the working space of the hit
+func (ts *TextureSampler) sampleAt(tc texCoords) Color {
+	return ts.color(tc.space, ts.SampleFootprint(tc.u, tc.v, tc.dudx, tc.dvdx, tc.dudy, tc.dvdy))
+}
+
+// color returns the filtered (linear) texture color c in the working space ws
+func (ts *TextureSampler) color(ws WorkingSpace, c Color) Color {
+	if ts.Texture.Encoding == ColorEncodingSRGB {
+		return ws.FromSRGB(c)
+	}
+	return c
+}
+
+// trilinear blends the two mipmap levels where width (in texels of the full resolution texture) is closest to one
+// texel, (u, v) are texture coordinates
+func (ts *TextureSampler) trilinear(levels []*TextureImage, u, v, width float64) Color {
+	last := len(levels) - 1
+	level := math.Log2(math.Max(width, 1e-12))
+	switch {
+	case level <= 0:
+		return ts.sampleLevel(levels[0], u, v)
+	case level >= float64(last):
+		return ts.sampleLevel(levels[last], u, v)
+	}
+
+	l := int(level)
+	f := level - float64(l)
+	return ts.sampleLevel(levels[l], u, v).Scale(1 - f).Add(ts.sampleLevel(levels[l+1], u, v).Scale(f))
+}
+
+// sampleLevel returns the color of the texture c at the texture coordinates (u, v), using the sampler's filter
+func (ts *TextureSampler) sampleLevel(c *TextureImage, u, v float64) Color {
+	x := u * float64(c.Width)
+	y := v * float64(c.Height)
+
+	switch ts.Filter {
+	case TextureFilterBilinear:
+		return ts.bilinear(c, x-0.5, y-0.5)
+	case TextureFilterBicubic:
+		return ts.bicubic(c, x-0.5, y-0.5)
+	}
+	return ts.texel(c, int(math.Floor(x)), int(math.Floor(y)))
+}
+
+// texel returns the texel of c at (x, y), wrapping coordinates outside the texture
+func (ts *TextureSampler) texel(c *TextureImage, x, y int) Color {
+	x = wrap(x, c.Width, ts.WrapU)
+	y = wrap(y, c.Height, ts.WrapV)
+	return c.At(x, y)
+}
+
+// bilinear interpolates the 4 texels of c around (x, y), in texel space with centers on integers
+func (ts *TextureSampler) bilinear(c *TextureImage, x, y float64) Color {
+	x0, y0 := math.Floor(x), math.Floor(y)
+	fx, fy := x-x0, y-y0
+	i, j := int(x0), int(y0)
+
+	top := ts.texel(c, i, j).Scale(1 - fx).Add(ts.texel(c, i+1, j).Scale(fx))
+	bottom := ts.texel(c, i, j+1).Scale(1 - fx).Add(ts.texel(c, i+1, j+1).Scale(fx))
+	return top.Scale(1 - fy).Add(bottom.Scale(fy))
+}
+
+// bicubic interpolates the 16 texels of c around (x, y), in texel space with centers on integers
+// Catmull-Rom overshoots near sharp edges, the result can be outside the range of the texels.
+func (ts *TextureSampler) bicubic(c *TextureImage, x, y float64) Color {
+	x0, y0 := math.Floor(x), math.Floor(y)
+	wx, wy := catmullRom(x-x0), catmullRom(y-y0)
+	i, j := int(x0), int(y0)
+
+	result := Black()
+	for n := 0; n < 4; n++ {
+		row := Black()
+		for m := 0; m < 4; m++ {
+			row = row.Add(ts.texel(c, i-1+m, j-1+n).Scale(wx[m]))
+		}
+		result = result.Add(row.Scale(wy[n]))
+	}
+	return result
+}
+
+// catmullRom returns the weights of the 4 samples around t in [0, 1), at -1, 0, 1 and 2
+func catmullRom(t float64) [4]float64 {
+	t2, t3 := t*t, t*t*t
+	return [4]float64{
+		(-t3 + 2*t2 - t) / 2,
+		(3*t3 - 5*t2 + 2) / 2,
+		(-3*t3 + 4*t2 + t) / 2,
+		(t3 - t2) / 2,
+	}
+}
+
+// wrap returns the index i in [0, n) according to the wrap mode
+func wrap(i, n int, mode WrapMode) int {
+	switch mode {
+	case WrapClamp:
+		if i < 0 {
+			return 0
+		}
+		if i >= n {
+			return n - 1
+		}
+		return i
+	case WrapMirror:
+		period := 2 * n
+		i = ((i % period) + period) % period
+		if i >= n {
+			return period - 1 - i
+		}
+		return i
+	}
+	return ((i % n) + n) % n
+}
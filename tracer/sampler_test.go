@@ -0,0 +1,263 @@
+package tracer
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestTexture returns a 2x2 texture with a red, green, blue and white texel
+func newTestTexture() *Canvas {
+	c := NewCanvas(2, 2)
+	c.Set(0, 0, NewColor(1, 0, 0))
+	c.Set(1, 0, NewColor(0, 1, 0))
+	c.Set(0, 1, NewColor(0, 0, 1))
+	c.Set(1, 1, White())
+	return c
+}
+
+func TestTextureSampler_Sample(t *testing.T) {
+	type args struct {
+		u, v float64
+	}
+	tests := []struct {
+		name    string
+		sampler func(*TextureSampler)
+		args    args
+		want    Color
+	}{
+		{
+			name:    "nearest",
+			sampler: func(ts *TextureSampler) { ts.Filter = TextureFilterNearest },
+			args:    args{0.7, 0.2},
+			want:    NewColor(0, 1, 0),
+		},
+		{
+			name:    "bilinear at a texel center",
+			sampler: func(ts *TextureSampler) {},
+			args:    args{0.25, 0.75},
+			want:    NewColor(0, 0, 1),
+		},
+		{
+			name:    "bilinear between texels",
+			sampler: func(ts *TextureSampler) {},
+			args:    args{0.5, 0.25},
+			want:    NewColor(0.5, 0.5, 0),
+		},
+		{
+			name:    "bilinear in the middle",
+			sampler: func(ts *TextureSampler) {},
+			args:    args{0.5, 0.5},
+			want:    NewColor(0.5, 0.5, 0.5),
+		},
+		{
+			name:    "bicubic at a texel center",
+			sampler: func(ts *TextureSampler) { ts.Filter = TextureFilterBicubic },
+			args:    args{0.75, 0.25},
+			want:    NewColor(0, 1, 0),
+		},
+		{
+			name:    "bicubic in the middle",
+			sampler: func(ts *TextureSampler) { ts.Filter = TextureFilterBicubic },
+			args:    args{0.5, 0.5},
+			want:    NewColor(0.5, 0.5, 0.5),
+		},
+		{
+			name:    "repeat",
+			sampler: func(ts *TextureSampler) { ts.Filter = TextureFilterNearest },
+			args:    args{1.25, -0.25},
+			want:    NewColor(0, 0, 1),
+		},
+		{
+			name: "clamp",
+			sampler: func(ts *TextureSampler) {
+				ts.Filter = TextureFilterNearest
+				ts.SetWrap(WrapClamp)
+			},
+			args: args{1.25, -0.25},
+			want: NewColor(0, 1, 0),
+		},
+		{
+			name: "mirror",
+			sampler: func(ts *TextureSampler) {
+				ts.Filter = TextureFilterNearest
+				ts.SetWrap(WrapMirror)
+			},
+			args: args{1.25, 0.25},
+			want: NewColor(0, 1, 0),
+		},
+		{
+			name: "bilinear clamp at the edge",
+			sampler: func(ts *TextureSampler) {
+				ts.SetWrap(WrapClamp)
+			},
+			args: args{1, 0.25},
+			want: NewColor(0, 1, 0),
+		},
+		{
+			name: "bilinear repeat at the edge",
+			sampler: func(ts *TextureSampler) {
+			},
+			args: args{1, 0.25},
+			want: NewColor(0.5, 0.5, 0),
+		},
+		{
+			name: "offset",
+			sampler: func(ts *TextureSampler) {
+				ts.Filter = TextureFilterNearest
+				ts.SetTransform(0.5, 0, 1, 1, 0)
+			},
+			args: args{0.25, 0.25},
+			want: NewColor(0, 1, 0),
+		},
+		{
+			name: "scale",
+			sampler: func(ts *TextureSampler) {
+				ts.Filter = TextureFilterNearest
+				ts.SetTransform(0, 0, 2, 2, 0)
+			},
+			args: args{0.3, 0.3},
+			want: White(),
+		},
+		{
+			name: "rotation",
+			sampler: func(ts *TextureSampler) {
+				ts.Filter = TextureFilterNearest
+				// (0.25, 0.75) -> (0.75, -0.25)
+				ts.SetTransform(0, 0, 1, 1, math.Pi/2)
+			},
+			args: args{0.25, 0.75},
+			want: White(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := NewTextureSampler(NewCanvasTexture(newTestTexture()))
+			tt.sampler(ts)
+			assert.True(t, tt.want.Equal(ts.Sample(tt.args.u, tt.args.v)), "should equal, got %v", ts.Sample(tt.args.u, tt.args.v))
+		})
+	}
+}
+
+func TestTextureSampler_Smooth(t *testing.T) {
+	c := NewCanvas(4, 1)
+	for x := 0; x < 4; x++ {
+		c.Set(x, 0, White().Scale(float64(x)/3))
+	}
+
+	tests := []struct {
+		filter   TextureFilter
+		min, max float64
+	}{
+		{filter: TextureFilterBilinear, min: 0.125, max: 0.875},
+		// the clamped texels beyond the edges bend the curve
+		{filter: TextureFilterBicubic, min: 0.375, max: 0.625},
+	}
+
+	for _, tt := range tests {
+		ts := NewTextureSampler(NewCanvasTexture(c))
+		ts.Filter = tt.filter
+		ts.SetWrap(WrapClamp)
+
+		// a linear ramp is reproduced between the texel centers, up to the float32 precision of the texels
+		for u := tt.min; u <= tt.max; u += 0.05 {
+			assert.InDelta(t, (u*4-0.5)/3, ts.Sample(u, 0.5).R, 1e-6, "filter %v at %v", tt.filter, u)
+		}
+	}
+}
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		mode WrapMode
+		want []int // for -3 .. 5
+	}{
+		{mode: WrapRepeat, want: []int{0, 1, 2, 0, 1, 2, 0, 1, 2}},
+		{mode: WrapClamp, want: []int{0, 0, 0, 0, 1, 2, 2, 2, 2}},
+		{mode: WrapMirror, want: []int{2, 1, 0, 0, 1, 2, 2, 1, 0}},
+	}
+
+	for _, tt := range tests {
+		for i, want := range tt.want {
+			assert.Equal(t, want, wrap(i-3, 3, tt.mode), "mode %v, index %v", tt.mode, i-3)
+		}
+	}
+}
+
+// newTestStripes returns a size x size texture of horizontal black and white stripes, one texel high
+func newTestStripes(size int) *Canvas {
+	c := NewCanvas(size, size)
+	for x := 0; x < size; x++ {
+		for y := 0; y < size; y += 2 {
+			c.Set(x, y, White())
+		}
+	}
+	return c
+}
+
+func TestTextureSampler_SampleFootprint(t *testing.T) {
+	grey := NewColor(0.5, 0.5, 0.5)
+	type args struct {
+		dudx, dvdx, dudy, dvdy float64
+	}
+	tests := []struct {
+		name   string
+		mipmap MipmapFilter
+		args   args
+		want   func(Color) bool
+	}{
+		{
+			name:   "no footprint",
+			mipmap: MipmapAnisotropic,
+			want:   func(c Color) bool { return c.Equal(White()) },
+		},
+		{
+			name:   "no mipmap",
+			mipmap: MipmapNone,
+			args:   args{1, 0, 0, 1},
+			want:   func(c Color) bool { return c.Equal(White()) },
+		},
+		{
+			name:   "trilinear, large footprint",
+			mipmap: MipmapTrilinear,
+			args:   args{0.5, 0, 0, 0.5},
+			want:   func(c Color) bool { return c.Equal(grey) },
+		},
+		{
+			name:   "trilinear, footprint of one texel",
+			mipmap: MipmapTrilinear,
+			args:   args{1.0 / 64, 0, 0, 1.0 / 64},
+			want:   func(c Color) bool { return c.Equal(White()) },
+		},
+		{
+			name:   "trilinear, stretched along the stripes blurs",
+			mipmap: MipmapTrilinear,
+			args:   args{0.5, 0, 0, 1.0 / 64},
+			want:   func(c Color) bool { return c.Equal(grey) },
+		},
+		{
+			name:   "anisotropic, stretched along the stripes",
+			mipmap: MipmapAnisotropic,
+			args:   args{0.1, 0, 0, 1.0 / 64},
+			want:   func(c Color) bool { return c.Equal(White()) },
+		},
+		{
+			name:   "anisotropic, stretched across the stripes",
+			mipmap: MipmapAnisotropic,
+			args:   args{1.0 / 64, 0, 0, 0.1},
+			want:   func(c Color) bool { return math.Abs(c.R-0.5) < 0.15 },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := NewTextureSampler(NewCanvasTexture(newTestStripes(64)))
+			ts.Mipmap = tt.mipmap
+
+			// the center of a white texel
+			got := ts.SampleFootprint(0.5/64, 0.5/64, tt.args.dudx, tt.args.dvdx, tt.args.dudy, tt.args.dvdy)
+			assert.True(t, tt.want(got), "got %v", got)
+		})
+	}
+}
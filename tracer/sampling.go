@@ -0,0 +1,69 @@
+package tracer
+
+import (
+	"math"
+	"math/rand"
+)
+
+// onb is an orthonormal basis, used to turn directions sampled around the z axis into world space
+type onb struct {
+	u, v, w Vector
+}
+
+// newONB returns an orthonormal basis with w pointing along n (which must be normalized)
+// Uses the branchless construction from "Building an Orthonormal Basis, Revisited" (Duff et al.)
+func newONB(n Vector) onb {
+	sign := math.Copysign(1, n.z)
+	a := -1 / (sign + n.z)
+	b := n.x * n.y * a
+
+	return onb{
+		u: NewVector(1+sign*n.x*n.x*a, sign*b, -sign*n.x),
+		v: NewVector(b, sign+n.y*n.y*a, -n.y),
+		w: n,
+	}
+}
+
+// local converts the vector (x, y, z) in the basis into world space
+func (b onb) local(x, y, z float64) Vector {
+	return b.u.Scale(x).AddVector(b.v.Scale(y)).AddVector(b.w.Scale(z))
+}
+
+// cosineSampleHemisphere returns a direction on the hemisphere around +z, with probability proportional to cos(theta)
+// The pdf of the returned direction is z / pi.
+func cosineSampleHemisphere(rng *rand.Rand) (x, y, z float64) {
+	u1, u2 := rng.Float64(), rng.Float64()
+
+	r := math.Sqrt(u1)
+	phi := 2 * math.Pi * u2
+
+	return r * math.Cos(phi), r * math.Sin(phi), math.Sqrt(math.Max(0, 1-u1))
+}
+
+// uniformSampleSphere returns a uniformly distributed direction
+func uniformSampleSphere(rng *rand.Rand) Vector {
+	z := 1 - 2*rng.Float64()
+	r := math.Sqrt(math.Max(0, 1-z*z))
+	phi := 2 * math.Pi * rng.Float64()
+
+	return NewVector(r*math.Cos(phi), r*math.Sin(phi), z)
+}
+
+// uniformSampleTriangle returns uniformly distributed barycentric coordinates
+func uniformSampleTriangle(rng *rand.Rand) (u, v float64) {
+	su := math.Sqrt(rng.Float64())
+	return 1 - su, rng.Float64() * su
+}
+
+// powerHeuristic returns the multiple importance sampling weight of strategy f (with nf samples)
+// when combined with strategy g (with ng samples), using the power heuristic with beta = 2
+func powerHeuristic(nf int, fPdf float64, ng int, gPdf float64) float64 {
+	f, g := float64(nf)*fPdf, float64(ng)*gPdf
+	if math.IsInf(f, 1) {
+		return 1
+	}
+	if f == 0 && g == 0 {
+		return 0
+	}
+	return (f * f) / (f*f + g*g)
+}
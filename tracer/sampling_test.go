@@ -0,0 +1,59 @@
+package tracer
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/DanTulovsky/tracer/constants"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewONB(t *testing.T) {
+	tests := []struct {
+		name string
+		n    Vector
+	}{
+		{
+			name: "up",
+			n:    NewVector(0, 1, 0),
+		},
+		{
+			name: "down z",
+			n:    NewVector(0, 0, -1),
+		},
+		{
+			name: "diagonal",
+			n:    NewVector(1, 1, 1).Normalize(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newONB(tt.n)
+
+			assert.InDelta(t, 1, b.u.Magnitude(), constants.Epsilon, "should be normalized")
+			assert.InDelta(t, 1, b.v.Magnitude(), constants.Epsilon, "should be normalized")
+			assert.InDelta(t, 0, b.u.Dot(b.v), constants.Epsilon, "should be orthogonal")
+			assert.InDelta(t, 0, b.u.Dot(b.w), constants.Epsilon, "should be orthogonal")
+			assert.InDelta(t, 0, b.v.Dot(b.w), constants.Epsilon, "should be orthogonal")
+			assert.True(t, tt.n.Equal(b.local(0, 0, 1)), "z should map to n")
+		})
+	}
+}
+
+func TestCosineSampleHemisphere(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	n := 10000
+	sumZ := 0.0
+	for i := 0; i < n; i++ {
+		x, y, z := cosineSampleHemisphere(rng)
+		assert.InDelta(t, 1, math.Sqrt(x*x+y*y+z*z), constants.Epsilon, "should be normalized")
+		assert.True(t, z >= 0, "should be in the upper hemisphere")
+		sumZ += z
+	}
+
+	// E[cos(theta)] for a cosine distribution is 2/3
+	assert.InDelta(t, 2.0/3, sumZ/float64(n), 0.01, "should be close")
+}
@@ -0,0 +1,155 @@
+package tracer
+
+import (
+	"fmt"
+	"math"
+)
+
+// meshVertex is a vertex of a generated mesh
+type meshVertex struct {
+	p  Point
+	n  Vector
+	vt Point
+}
+
+// newMeshTriangle returns the smooth triangle through the vertices, wound so its face normal agrees with the normals
+// of the vertices (which backface culling relies on)
+func newMeshTriangle(a, b, c meshVertex) *SmoothTriangle {
+	face := c.p.SubPoint(a.p).Cross(b.p.SubPoint(a.p))
+	if face.Dot(a.n.AddVector(b.n).AddVector(c.n)) < 0 {
+		b, c = c, b
+	}
+	return NewSmoothTriangle(a.p, b.p, c.p, a.n, b.n, c.n, a.vt, b.vt, c.vt)
+}
+
+// newTriangleMesh returns a new mesh of the triangles, the triangles become its children so they are shaded with its
+// transform
+func newTriangleMesh(tris []*SmoothTriangle) *TriangleMesh {
+	m := &TriangleMesh{
+		Triangles: tris,
+		Shape: Shape{
+			transform:        IM(),
+			transformInverse: IM().Inverse(),
+			material:         NewDefaultMaterial(),
+			shape:            "trimesh",
+		},
+	}
+	for _, t := range tris {
+		m.V = append(m.V, t.P1, t.P2, t.P3)
+		t.SetParent(m)
+	}
+	if len(m.V) > 0 {
+		m.calculateBounds()
+	}
+	return m
+}
+
+// ShapeToMesh returns a triangle mesh of the surface of a sphere, plane or cube, with the same transform, material and
+// texture coordinates as the shape, so it can be displaced (see Displacement)
+// segments is the number of rows of triangles from pole to pole of spheres and along each side of planes and cube
+// faces. Planes are infinite, the mesh covers the square from -1 to 1 in x and z (scale it with the transform) and
+// its texture coordinates keep increasing across the tiles of the plane's map, which repeating textures don't notice.
+func ShapeToMesh(s Shaper, segments int) (*TriangleMesh, error) {
+	if segments < 1 {
+		return nil, fmt.Errorf("need at least 1 segment, got %v", segments)
+	}
+
+	var tris []*SmoothTriangle
+	switch sh := s.(type) {
+	case *Sphere:
+		tris = sphereTriangles(sh, segments)
+	case *Plane:
+		tris = planeTriangles(segments)
+	case *Cube:
+		tris = cubeTriangles(segments)
+	default:
+		return nil, fmt.Errorf("can't convert %T to a mesh", s)
+	}
+
+	m := newTriangleMesh(tris)
+	m.SetTransform(s.Transform())
+	m.SetMaterial(s.Material())
+	for _, t := range m.Triangles {
+		t.SetMaterial(s.Material())
+	}
+	m.SetName(s.Name())
+	return m, nil
+}
+
+// gridTriangles returns the triangles of a grid of rows x cols quads, vertex(i, j) returns the vertex at column i
+// (0 to cols) and row j (0 to rows)
+// Quads with two vertices at the same place (the poles of spheres) become one triangle.
+func gridTriangles(cols, rows int, vertex func(i, j int) meshVertex) []*SmoothTriangle {
+	var tris []*SmoothTriangle
+	for j := 0; j < rows; j++ {
+		for i := 0; i < cols; i++ {
+			a, b, c, d := vertex(i, j), vertex(i+1, j), vertex(i+1, j+1), vertex(i, j+1)
+			if !a.p.Equal(b.p) {
+				tris = append(tris, newMeshTriangle(a, b, c))
+			}
+			if !c.p.Equal(d.p) {
+				tris = append(tris, newMeshTriangle(a, c, d))
+			}
+		}
+	}
+	return tris
+}
+
+// sphereTriangles returns the triangles of the sphere, u and v follow the SphericalMap
+func sphereTriangles(s *Sphere, segments int) []*SmoothTriangle {
+	return gridTriangles(2*segments, segments, func(i, j int) meshVertex {
+		u, v := float64(i)/float64(2*segments), float64(j)/float64(segments)
+
+		// the inverse of SphericalMap, the seam (u = 1) is at the same place as u = 0 so the mesh closes there
+		theta := (float64(i%(2*segments))/float64(2*segments) - 0.5) * 2 * math.Pi
+		phi := v * math.Pi
+		n := NewVector(math.Sin(phi)*math.Sin(theta), math.Cos(phi), math.Sin(phi)*math.Cos(theta))
+		// exact poles, so the triangles around them close
+		switch j {
+		case 0:
+			n = NewVector(0, 1, 0)
+		case segments:
+			n = NewVector(0, -1, 0)
+		}
+		return meshVertex{p: s.Center.AddVector(n.Scale(s.Radius)), n: n, vt: NewPoint(u, v, 0)}
+	})
+}
+
+// planeTriangles returns the triangles of the square from -1 to 1 in x and z, u and v follow the PlaneMap
+func planeTriangles(segments int) []*SmoothTriangle {
+	return gridTriangles(segments, segments, func(i, j int) meshVertex {
+		x, z := 2*float64(i)/float64(segments)-1, 2*float64(j)/float64(segments)-1
+		return meshVertex{p: NewPoint(x, 0, z), n: NewVector(0, 1, 0), vt: NewPoint(x, z, 0)}
+	})
+}
+
+// cubeTriangles returns the triangles of the faces of the cube, u and v follow the CubeMap
+// The faces don't share vertices, the normals are flat on each face. Displacement keeps the edges closed.
+func cubeTriangles(segments int) []*SmoothTriangle {
+	cm := &CubeMap{}
+	faces := []struct {
+		n, s, t Vector
+		uv      func(Point) (float64, float64)
+	}{
+		{NewVector(1, 0, 0), NewVector(0, 0, 1), NewVector(0, 1, 0), cm.uvRight},
+		{NewVector(-1, 0, 0), NewVector(0, 0, 1), NewVector(0, 1, 0), cm.uvLeft},
+		{NewVector(0, 1, 0), NewVector(1, 0, 0), NewVector(0, 0, 1), cm.uvUp},
+		{NewVector(0, -1, 0), NewVector(1, 0, 0), NewVector(0, 0, 1), cm.uvDown},
+		{NewVector(0, 0, 1), NewVector(1, 0, 0), NewVector(0, 1, 0), cm.uvFront},
+		{NewVector(0, 0, -1), NewVector(1, 0, 0), NewVector(0, 1, 0), cm.uvBack},
+	}
+
+	var tris []*SmoothTriangle
+	for _, f := range faces {
+		f := f
+		tris = append(tris, gridTriangles(segments, segments, func(i, j int) meshVertex {
+			a, b := 2*float64(i)/float64(segments)-1, 2*float64(j)/float64(segments)-1
+			p := Origin().AddVector(f.n).AddVector(f.s.Scale(a)).AddVector(f.t.Scale(b))
+			// the map wraps at the edges of the faces, read it just inside
+			const inside = 1 - 1e-9
+			u, v := f.uv(Origin().AddVector(f.n).AddVector(f.s.Scale(a * inside)).AddVector(f.t.Scale(b * inside)))
+			return meshVertex{p: p, n: f.n, vt: NewPoint(u, v, 0)}
+		})...)
+	}
+	return tris
+}
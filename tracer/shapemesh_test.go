@@ -0,0 +1,102 @@
+package tracer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShapeToMesh(t *testing.T) {
+	tests := []struct {
+		name      string
+		shape     Shaper
+		segments  int
+		triangles int
+		bound     Bound
+	}{
+		{
+			name:      "sphere",
+			shape:     NewUnitSphere(),
+			segments:  4,
+			triangles: 48, // 8 x 4 quads, one triangle at the poles
+			bound:     NewBound(NewPoint(-1, -1, -1), NewPoint(1, 1, 1)),
+		},
+		{
+			name:      "plane",
+			shape:     NewPlane(),
+			segments:  2,
+			triangles: 8,
+			bound:     NewBound(NewPoint(-1, 0, -1), NewPoint(1, 0, 1)),
+		},
+		{
+			name:      "cube",
+			shape:     NewUnitCube(),
+			segments:  1,
+			triangles: 12,
+			bound:     NewBound(NewPoint(-1, -1, -1), NewPoint(1, 1, 1)),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.shape.SetTransform(IM().Scale(2, 2, 2))
+			m, err := ShapeToMesh(tt.shape, tt.segments)
+			assert.NoError(t, err, "should not error")
+
+			assert.Len(t, m.Triangles, tt.triangles, "should equal")
+			assert.True(t, tt.bound.Min.Equal(m.Bounds().Min) && tt.bound.Max.Equal(m.Bounds().Max), "got %v", m.Bounds())
+			assert.True(t, tt.shape.Transform().Equals(m.Transform()), "same transform")
+
+			for _, tri := range m.Triangles {
+				assert.Equal(t, tt.shape.Material(), tri.Material(), "same material")
+				assert.Equal(t, m, tri.Parent(), "the mesh is the parent")
+
+				// wound the way of the normals
+				face := tri.E2.Cross(tri.E1)
+				assert.True(t, face.Dot(tri.N1) > 0, "winding")
+
+				for _, vt := range []Point{tri.VT1, tri.VT2, tri.VT3} {
+					assert.True(t, vt.X() >= 0 && vt.X() <= 1 || tt.name == "plane", "u: %v", vt.X())
+					assert.True(t, vt.Y() >= 0 && vt.Y() <= 1 || tt.name == "plane", "v: %v", vt.Y())
+				}
+			}
+		})
+	}
+}
+
+func TestShapeToMesh_TextureCoordinates(t *testing.T) {
+	s := NewUnitSphere()
+	m, err := ShapeToMesh(s, 8)
+	assert.NoError(t, err, "should not error")
+
+	// the texture coordinates follow the map of the shape, away from the seam and the poles
+	for _, tri := range m.Triangles {
+		for i, p := range []Point{tri.P1, tri.P2, tri.P3} {
+			vt := []Point{tri.VT1, tri.VT2, tri.VT3}[i]
+			if vt.X() == 0 || vt.X() == 1 || vt.Y() == 0 || vt.Y() == 1 {
+				continue
+			}
+			u, v := s.UVAt(p, nil)
+			assert.InDelta(t, u, vt.X(), 1e-9, "should equal")
+			assert.InDelta(t, v, vt.Y(), 1e-9, "should equal")
+			assert.True(t, p.SubPoint(Origin()).Equal(tri.N1) || i > 0, "normal")
+		}
+	}
+
+	cube, err := ShapeToMesh(NewUnitCube(), 2)
+	assert.NoError(t, err, "should not error")
+	found := false
+	for _, tri := range cube.Triangles {
+		if tri.P1.Equal(NewPoint(1, 0, 0)) && tri.N1.Equal(NewVector(1, 0, 0)) {
+			found = true
+			assert.InDelta(t, 0.5, tri.VT1.X(), 1e-6, "should equal")
+			assert.InDelta(t, 0.5, tri.VT1.Y(), 1e-6, "should equal")
+		}
+	}
+	assert.True(t, found, "the middle of the right face")
+
+	_, err = ShapeToMesh(NewDefaultCylinder(), 4)
+	assert.Error(t, err, "not supported")
+	_, err = ShapeToMesh(s, 0)
+	assert.Error(t, err, "no segments")
+}
@@ -1,5 +1,9 @@
 package tracer
 
+import (
+	"math"
+)
+
 // SmoothTriangle is a triangle defined by 3 points in 3d space and the normals at those points
 type SmoothTriangle struct {
 	P1, P2, P3 Point
@@ -10,12 +14,18 @@ type SmoothTriangle struct {
 	// Texture coordinates at each point
 	VT1, VT2, VT3 Point
 
+	// Tangents at each point, from the texture coordinates
+	T1, T2, T3 Tangent
+
 	Triangle
 }
 
 // NewSmoothTriangle returns a new triangle
 func NewSmoothTriangle(p1, p2, p3 Point, n1, n2, n3 Vector, vt1, vt2, vt3 Point) *SmoothTriangle {
 	t := &SmoothTriangle{
+		P1:  p1,
+		P2:  p2,
+		P3:  p3,
 		N1:  n1,
 		N2:  n2,
 		N3:  n3,
@@ -39,9 +49,35 @@ func NewSmoothTriangle(p1, p2, p3 Point, n1, n2, n3 Vector, vt1, vt2, vt3 Point)
 	}
 	t.lna = t.localNormalAt
 	t.calculateBounds()
+	t.setFaceTangents()
 	return t
 }
 
+// setFaceTangents sets the tangents of the vertices from the texture coordinates of this triangle alone, meshes
+// share them between the triangles meeting at each vertex (see smoothTangents)
+func (t *SmoothTriangle) setFaceTangents() {
+	ft, fb, ok := faceTangents(t.P1, t.P2, t.P3, t.VT1, t.VT2, t.VT3)
+	if !ok {
+		// no texture coordinates, any frame will do
+		ft, fb = t.E1, t.E2
+	}
+	t.T1 = newTangent(t.N1, ft, fb)
+	t.T2 = newTangent(t.N2, ft, fb)
+	t.T3 = newTangent(t.N3, ft, fb)
+}
+
+// setTangent sets the tangent of vertex i (0-2)
+func (t *SmoothTriangle) setTangent(i int, tg Tangent) {
+	switch i {
+	case 0:
+		t.T1 = tg
+	case 1:
+		t.T2 = tg
+	default:
+		t.T3 = tg
+	}
+}
+
 // Equal returns true if the mooth triangles are equal
 func (t *SmoothTriangle) Equal(t2 *SmoothTriangle) bool {
 	return t.Shape.Equal(&t2.Shape) &&
@@ -64,8 +100,34 @@ func (t *SmoothTriangle) IntersectWith(r Ray, xs Intersections) Intersections {
 	return xs
 }
 
-func (t *SmoothTriangle) localNormalAt(unused Point, hit *Intersection) Vector {
-	return t.N2.Scale(hit.u).AddVector(t.N3.Scale(hit.v)).AddVector(t.N1.Scale(1 - hit.u - hit.v))
+// UVAt returns the surface coordinates of the point p (world space), interpolated from the texture coordinates of the
+// vertices
+func (t *SmoothTriangle) UVAt(p Point, xs *Intersection) (float64, float64) {
+	return t.texCoordsAt(t.barycentric(p.ToObjectSpace(t), xs))
+}
+
+// texCoordsAt returns the texture coordinates at the barycentric coordinates (u, v)
+func (t *SmoothTriangle) texCoordsAt(u, v float64) (float64, float64) {
+	w := 1 - u - v
+	return u*t.VT2.x + v*t.VT3.x + w*t.VT1.x, u*t.VT2.y + v*t.VT3.y + w*t.VT1.y
+}
+
+// tangentsAt implements tangentShaper, the tangents of the vertices are interpolated like the normals
+func (t *SmoothTriangle) tangentsAt(p Point, n Vector, xs *Intersection) (float64, float64, Vector, Vector) {
+	bu, bv := t.barycentric(p, xs)
+	w := 1 - bu - bv
+	tg := Tangent{
+		Dir:  t.T2.Dir.Scale(bu).AddVector(t.T3.Dir.Scale(bv)).AddVector(t.T1.Dir.Scale(w)),
+		Sign: math.Copysign(1, t.T2.Sign*bu+t.T3.Sign*bv+t.T1.Sign*w),
+	}
+	u, v := t.texCoordsAt(bu, bv)
+	tangent, bitangent := tg.frame(n)
+	return u, v, tangent, bitangent
+}
+
+func (t *SmoothTriangle) localNormalAt(p Point, hit *Intersection) Vector {
+	u, v := t.barycentric(p, hit)
+	return t.N2.Scale(u).AddVector(t.N3.Scale(v)).AddVector(t.N1.Scale(1 - u - v))
 }
 
 // Includes implements includes logic
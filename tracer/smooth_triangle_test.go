@@ -145,3 +145,34 @@ func TestSmoothTriangle_NormalAt(t *testing.T) {
 		})
 	}
 }
+
+func TestSmoothTriangle_UVAt(t *testing.T) {
+	tests := []struct {
+		name  string
+		p     Point
+		wantU float64
+		wantV float64
+	}{
+		{
+			name:  "center",
+			p:     NewPoint(0, 0.5, 0),
+			wantU: 0,
+			wantV: 0.5,
+		},
+		{
+			name:  "edge",
+			p:     NewPoint(-0.5, 0.5, 0),
+			wantU: -0.5,
+			wantV: 0.5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the texture coordinates of the test triangle are its x, y coordinates
+			u, v := newTestTriangle(NewWorldConfig()).UVAt(tt.p, nil)
+			assert.InDelta(t, tt.wantU, u, constants.Epsilon, "should equal")
+			assert.InDelta(t, tt.wantV, v, constants.Epsilon, "should equal")
+		})
+	}
+}
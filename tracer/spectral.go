@@ -0,0 +1,248 @@
+package tracer
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Spectral mode (Config.Spectral) traces every camera ray at a single, randomly sampled wavelength (in nm), carried
+// by Ray.Wavelength. Materials are converted to that wavelength at each hit: their RGB colors are upsampled to a
+// spectrum and transparent materials with a Dispersion get a wavelength dependent index of refraction. Lights stay
+// RGB, the light arriving along a ray is linear in them, so it is upsampled at the end and converted back to RGB
+// through the CIE color matching functions.
+
+const (
+	// wavelengthMin and wavelengthMax bound the visible wavelengths sampled in spectral mode
+	wavelengthMin = 380.0
+	wavelengthMax = 780.0
+
+	// RGB colors are upsampled to three bands: blue below wavelengthBlue, green below wavelengthGreen, red above
+	wavelengthBlue  = 490.0
+	wavelengthGreen = 590.0
+)
+
+var (
+	// spectralWhite is the RGB of the flat spectrum, used to normalize it to white
+	spectralWhite Color
+
+	// upsampleMatrix converts an RGB color into the values of the red, green and blue bands of its spectrum
+	upsampleMatrix Matrix
+)
+
+func init() {
+	// the RGB of each band with a value of 1
+	var bands [3]Color
+	for l := wavelengthMin + 0.5; l < wavelengthMax; l++ {
+		bands[wavelengthBand(l)] = bands[wavelengthBand(l)].Add(xyzToRGB(cieXYZ(l)))
+	}
+	spectralWhite = bands[0].Add(bands[1]).Add(bands[2])
+
+	a := NewMatrix(3, 3)
+	for b, clr := range bands {
+		clr = NewColor(clr.R/spectralWhite.R, clr.G/spectralWhite.G, clr.B/spectralWhite.B)
+		a[0][b], a[1][b], a[2][b] = clr.R, clr.G, clr.B
+	}
+	upsampleMatrix = a.Inverse()
+}
+
+// sampleWavelength returns a uniformly sampled visible wavelength
+func sampleWavelength(rng *rand.Rand) float64 {
+	return wavelengthMin + rng.Float64()*(wavelengthMax-wavelengthMin)
+}
+
+// wavelengthBand returns the band (0 red, 1 green, 2 blue) the wavelength is upsampled into
+func wavelengthBand(wavelength float64) int {
+	switch {
+	case wavelength < wavelengthBlue:
+		return 2
+	case wavelength < wavelengthGreen:
+		return 1
+	}
+	return 0
+}
+
+// cieGaussian is a piecewise gaussian, with width s1 below mu and s2 above
+func cieGaussian(l, mu, s1, s2 float64) float64 {
+	s := s2
+	if l < mu {
+		s = s1
+	}
+	t := (l - mu) / s
+	return math.Exp(-0.5 * t * t)
+}
+
+// cieXYZ returns the CIE 1931 color matching functions at wavelength (nm)
+// Uses the multi-lobe fit from "Simple Analytic Approximations to the CIE XYZ Color Matching Functions"
+// (Wyman, Sloan and Shirley 2013).
+func cieXYZ(wavelength float64) (x, y, z float64) {
+	l := wavelength
+	x = 1.056*cieGaussian(l, 599.8, 37.9, 31.0) + 0.362*cieGaussian(l, 442.0, 16.0, 26.7) - 0.065*cieGaussian(l, 501.1, 20.4, 26.2)
+	y = 0.821*cieGaussian(l, 568.8, 46.9, 40.5) + 0.286*cieGaussian(l, 530.9, 16.3, 31.1)
+	z = 1.217*cieGaussian(l, 437.0, 11.8, 36.0) + 0.681*cieGaussian(l, 459.0, 26.0, 13.8)
+	return x, y, z
+}
+
+// xyzToRGB converts CIE XYZ to linear sRGB
+func xyzToRGB(x, y, z float64) Color {
+	return NewColor(
+		3.2404542*x-1.5371385*y-0.4985314*z,
+		-0.9692660*x+1.8760108*y+0.0415560*z,
+		0.0556434*x-0.2040259*y+1.0572252*z,
+	)
+}
+
+// upsample returns the value of the spectrum of the RGB color at wavelength
+// The upsampling is linear in the color, so sums and scales of colors give sums and scales of spectra. Saturated
+// colors can have negative values outside their band.
+func upsample(c Color, wavelength float64) float64 {
+	row := upsampleMatrix[wavelengthBand(wavelength)]
+	return row[0]*c.R + row[1]*c.G + row[2]*c.B
+}
+
+// upsampleReflectance returns the value of the spectrum of the RGB color at wavelength, clamped to [0, 1], as a grey
+// color
+func upsampleReflectance(c Color, wavelength float64) Color {
+	v := math.Max(0, math.Min(1, upsample(c, wavelength)))
+	return NewColor(v, v, v)
+}
+
+// spectrumToRGB returns the RGB estimate of a spectrum with the given value at a uniformly sampled wavelength
+// The average over many sampled wavelengths converges to the RGB of the spectrum, a flat spectrum of 1 is white.
+func spectrumToRGB(wavelength, value float64) Color {
+	rgb := xyzToRGB(cieXYZ(wavelength)).Scale(value * (wavelengthMax - wavelengthMin))
+	return NewColor(rgb.R/spectralWhite.R, rgb.G/spectralWhite.G, rgb.B/spectralWhite.B)
+}
+
+// rgbAt interpolates a quantity given at roughly 650nm (R), 550nm (G) and 450nm (B) at wavelength
+func rgbAt(c Color, wavelength float64) float64 {
+	switch {
+	case wavelength <= 450:
+		return c.B
+	case wavelength <= 550:
+		return c.B + (c.G-c.B)*(wavelength-450)/100
+	case wavelength <= 650:
+		return c.G + (c.R-c.G)*(wavelength-550)/100
+	}
+	return c.R
+}
+
+// Dispersion gives the index of refraction of a material at a wavelength (nm), only used in spectral mode
+type Dispersion interface {
+	IOR(wavelength float64) float64
+}
+
+// CauchyDispersion is Cauchy's equation n = A + B/λ² + C/λ⁴, with λ in micrometers
+type CauchyDispersion struct {
+	A, B, C float64
+}
+
+// NewCauchyDispersion returns a new dispersion following Cauchy's equation
+func NewCauchyDispersion(a, b, c float64) *CauchyDispersion {
+	return &CauchyDispersion{A: a, B: b, C: c}
+}
+
+// IOR implements the Dispersion interface
+func (cd *CauchyDispersion) IOR(wavelength float64) float64 {
+	l2 := math.Pow(wavelength/1000, 2)
+	return cd.A + cd.B/l2 + cd.C/(l2*l2)
+}
+
+// SellmeierDispersion is the Sellmeier equation n² = 1 + Σ B[i] λ² / (λ² - C[i]), with λ in micrometers
+type SellmeierDispersion struct {
+	B, C [3]float64
+}
+
+// NewSellmeierDispersion returns a new dispersion following the Sellmeier equation
+func NewSellmeierDispersion(b, c [3]float64) *SellmeierDispersion {
+	return &SellmeierDispersion{B: b, C: c}
+}
+
+// IOR implements the Dispersion interface
+func (sd *SellmeierDispersion) IOR(wavelength float64) float64 {
+	l2 := math.Pow(wavelength/1000, 2)
+	n2 := 1.0
+	for i := range sd.B {
+		n2 += sd.B[i] * l2 / (l2 - sd.C[i])
+	}
+	return math.Sqrt(n2)
+}
+
+// NewBK7Dispersion returns the dispersion of BK7, a common optical glass (n = 1.5168 at 587.6nm)
+func NewBK7Dispersion() *SellmeierDispersion {
+	return NewSellmeierDispersion(
+		[3]float64{1.03961212, 0.231792344, 1.01046945},
+		[3]float64{0.00600069867, 0.0200179144, 103.560653})
+}
+
+// NewDiamondDispersion returns the dispersion of diamond (n = 2.417 at 589nm)
+func NewDiamondDispersion() *SellmeierDispersion {
+	return NewSellmeierDispersion(
+		[3]float64{0.3306, 4.3356, 0},
+		[3]float64{0.1750 * 0.1750, 0.1060 * 0.1060, 0})
+}
+
+// NewWaterDispersion returns the dispersion of water (n = 1.333 at 589nm)
+func NewWaterDispersion() *CauchyDispersion {
+	return NewCauchyDispersion(1.3199, 0.00653, 0)
+}
+
+// ior returns the index of refraction of the material at wavelength, 0 (RGB rays) uses RefractiveIndex
+func (m *Material) ior(wavelength float64) float64 {
+	if m.Dispersion == nil || wavelength <= 0 {
+		return m.RefractiveIndex
+	}
+	return m.Dispersion.IOR(wavelength)
+}
+
+// spectral returns the material at the hit converted to the wavelength of the ray
+// Colors (including patterns and textures) become grey reflectances at the wavelength, emission stays RGB like lights.
+func (m *Material) spectral(state *IntersectionState) *Material {
+	l := state.Wavelength
+
+	r := *m
+	r.Color = upsampleReflectance(m.surfaceColor(state.Object, state.Point, state.texCoords()), l)
+	r.Pattern = nil
+	r.Texture = nil
+	r.RefractiveIndex = m.ior(l)
+	r.Absorption = upsampleReflectance(m.Absorption, l)
+	r.sheen = upsampleReflectance(m.sheen, l)
+	if m.Conductor != nil {
+		eta, k := rgbAt(m.Conductor.Eta, l), rgbAt(m.Conductor.K, l)
+		r.Conductor = NewConductor(NewColor(eta, eta, eta), NewColor(k, k, k))
+	}
+	if m.Subsurface != nil {
+		s, a := rgbAt(m.Subsurface.Scattering, l), rgbAt(m.Subsurface.Absorption, l)
+		r.Subsurface = NewSubsurface(NewColor(s, s, s), NewColor(a, a, a))
+	}
+	return &r
+}
+
+// ray returns a new ray leaving the hit, with the wavelength of the ray that hit it
+func (s *IntersectionState) ray(o Point, d Vector) Ray {
+	r := NewRay(o, d)
+	r.Wavelength = s.Wavelength
+	return r
+}
+
+// spectral returns true if the world renders in spectral mode, only the Whitted and path tracer integrators support it
+func (w *World) spectral() bool {
+	if !w.Config.Spectral {
+		return false
+	}
+	switch w.Config.Integrator.(type) {
+	case *WhittedIntegrator, *PathTracerIntegrator:
+		return true
+	}
+	return false
+}
+
+// li returns the color seen along the camera ray, at a randomly sampled wavelength in spectral mode
+func (w *World) li(r Ray, xs Intersections, rng *rand.Rand) Color {
+	if !w.spectral() {
+		return w.Config.Integrator.Li(w, r, xs, rng)
+	}
+
+	r.Wavelength = sampleWavelength(rng)
+	l := w.Config.Integrator.Li(w, r, xs, rng)
+	return spectrumToRGB(r.Wavelength, upsample(l, r.Wavelength))
+}
@@ -0,0 +1,175 @@
+package tracer
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// integrateSpectrum returns the RGB of the spectrum, integrated in 1nm steps
+func integrateSpectrum(s func(wavelength float64) float64) Color {
+	sum := Black()
+	n := 0
+	for l := wavelengthMin + 0.5; l < wavelengthMax; l++ {
+		sum = sum.Add(spectrumToRGB(l, s(l)))
+		n++
+	}
+	return sum.Scale(1 / float64(n))
+}
+
+func TestCIEXYZ(t *testing.T) {
+	_, y, _ := cieXYZ(555)
+	assert.InDelta(t, 1, y, 0.02, "luminous efficiency peaks at 555nm")
+
+	x, _, z := cieXYZ(450)
+	assert.True(t, z > x, "450nm is blue")
+}
+
+func TestUpsample(t *testing.T) {
+	tests := []struct {
+		name string
+		clr  Color
+	}{
+		{
+			name: "white",
+			clr:  White(),
+		},
+		{
+			name: "grey",
+			clr:  NewColor(0.3, 0.3, 0.3),
+		},
+		{
+			name: "red",
+			clr:  NewColor(1, 0, 0),
+		},
+		{
+			name: "orange",
+			clr:  NewColor(0.9, 0.5, 0.1),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := integrateSpectrum(func(l float64) float64 { return upsample(tt.clr, l) })
+			assert.InDelta(t, tt.clr.R, got.R, 1e-6, "should round trip")
+			assert.InDelta(t, tt.clr.G, got.G, 1e-6, "should round trip")
+			assert.InDelta(t, tt.clr.B, got.B, 1e-6, "should round trip")
+		})
+	}
+
+	assert.InDelta(t, 0.3, upsample(NewColor(0.3, 0.3, 0.3), 500), 1e-9, "grey is a flat spectrum")
+	assert.True(t, upsample(NewColor(1, 0, 0), 650) > 0.9, "red reflects red light")
+	assert.True(t, upsampleReflectance(NewColor(1, 0, 0), 450).R < 0.05, "red absorbs blue light")
+}
+
+func TestSpectrumToRGB_Sampled(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	sum := Black()
+	n := 100000
+	for i := 0; i < n; i++ {
+		sum = sum.Add(spectrumToRGB(sampleWavelength(rng), 1))
+	}
+	got := sum.Scale(1 / float64(n))
+	assert.InDelta(t, 1, got.R, 0.02, "flat spectrum should converge to white")
+	assert.InDelta(t, 1, got.G, 0.02, "flat spectrum should converge to white")
+	assert.InDelta(t, 1, got.B, 0.02, "flat spectrum should converge to white")
+}
+
+func TestDispersion_IOR(t *testing.T) {
+	tests := []struct {
+		name       string
+		d          Dispersion
+		wavelength float64
+		want       float64
+	}{
+		{
+			name:       "BK7",
+			d:          NewBK7Dispersion(),
+			wavelength: 587.6,
+			want:       1.5168,
+		},
+		{
+			name:       "diamond",
+			d:          NewDiamondDispersion(),
+			wavelength: 589,
+			want:       2.417,
+		},
+		{
+			name:       "water",
+			d:          NewWaterDispersion(),
+			wavelength: 589,
+			want:       1.3387,
+		},
+		{
+			name:       "cauchy",
+			d:          NewCauchyDispersion(1.5, 0.01, 0.001),
+			wavelength: 500,
+			want:       1.5 + 0.01/0.25 + 0.001/0.0625,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.InDelta(t, tt.want, tt.d.IOR(tt.wavelength), 1e-3, "should equal")
+			assert.True(t, tt.d.IOR(450) > tt.d.IOR(650), "blue light bends more")
+		})
+	}
+}
+
+func TestPrepareComputations_Dispersion(t *testing.T) {
+	glass := NewGlassSphere()
+	glass.Material().Dispersion = NewBK7Dispersion()
+
+	n2 := func(wavelength float64) float64 {
+		r := NewRay(NewPoint(0, 0, -5), NewVector(0, 0, 1))
+		r.Wavelength = wavelength
+		xs := NewIntersections(NewIntersection(glass, 4), NewIntersection(glass, 6))
+		return PrepareComputations(xs[0], r, xs).N2
+	}
+
+	assert.Equal(t, 1.5, n2(0), "RGB rays use RefractiveIndex")
+	assert.True(t, n2(450) > n2(650), "blue light sees a higher index")
+}
+
+func TestMaterial_Spectral(t *testing.T) {
+	gold, err := ConductorByName("gold")
+	assert.NoError(t, err)
+
+	s := NewUnitSphere()
+	s.Material().Color = NewColor(1, 0, 0)
+	s.Material().Conductor = gold
+
+	at := func(wavelength float64) *Material {
+		state := &IntersectionState{Object: s, Point: NewPoint(0, 0, -1), Wavelength: wavelength}
+		return state.material()
+	}
+
+	assert.Equal(t, s.Material(), at(0), "RGB rays use the material as is")
+	assert.True(t, at(650).Color.R > 0.9, "red reflects red light")
+	assert.True(t, at(450).Color.R < 0.05, "red absorbs blue light")
+	assert.Equal(t, gold.Eta.B, at(450).Conductor.Eta.R, "conductors use the index at the wavelength")
+	assert.True(t, math.Abs(at(500).Conductor.K.G-(gold.K.B+gold.K.G)/2) < 1e-9, "and interpolate between channels")
+}
+
+func TestWorld_RenderSpectral(t *testing.T) {
+	w, camera := smallTestWorld()
+	w.Config.Antialias = 10
+	want := NewCanvas(11, 11)
+	w.Render(camera, want)
+
+	spectral, camera := smallTestWorld()
+	spectral.Config.Antialias = 10
+	spectral.Config.Spectral = true
+	spectral.Config.Seed = 1
+	got := NewCanvas(11, 11)
+	spectral.Render(camera, got)
+
+	// without dispersion the spectral render converges to the RGB one, a hundred samples are close already
+	wantClr, err := want.Get(5, 5)
+	assert.NoError(t, err)
+	gotClr, err := got.Get(5, 5)
+	assert.NoError(t, err)
+	assert.InDelta(t, wantClr.Luminance(), gotClr.Luminance(), 0.1, "should be close")
+}
@@ -76,6 +76,12 @@ func (s *Sphere) IntersectWith(r Ray, t Intersections) Intersections {
 	return t
 }
 
+// UVAt returns the surface coordinates of the point p (world space), using a spherical map
+func (s *Sphere) UVAt(p Point, xs *Intersection) (float64, float64) {
+	op := p.ToObjectSpace(s)
+	return NewSphericalMap().Map(Origin().AddVector(op.SubPoint(s.Center)))
+}
+
 func (s *Sphere) localNormalAt(p Point, xs *Intersection) Vector {
 	return p.SubPoint(Origin())
 }
@@ -5,6 +5,7 @@ import (
 	"math"
 	"testing"
 
+	"github.com/DanTulovsky/tracer/constants"
 	"github.com/google/go-cmp/cmp"
 	"github.com/stretchr/testify/assert"
 )
@@ -318,3 +319,45 @@ func TestNewGlassSphere(t *testing.T) {
 		})
 	}
 }
+
+func TestSphere_UVAt(t *testing.T) {
+	s := NewUnitSphere()
+	s.SetTransform(IM().Scale(2, 2, 2))
+	g := NewGroup()
+	g.SetTransform(IM().Translate(0, 0, 5))
+	g.AddMember(s)
+
+	tests := []struct {
+		name  string
+		p     Point
+		wantU float64
+		wantV float64
+	}{
+		{
+			name:  "north pole",
+			p:     NewPoint(0, 2, 5),
+			wantU: 0.5,
+			wantV: 0,
+		},
+		{
+			name:  "front",
+			p:     NewPoint(0, 0, 3),
+			wantU: 1,
+			wantV: 0.5,
+		},
+		{
+			name:  "side",
+			p:     NewPoint(2, 0, 5),
+			wantU: 0.75,
+			wantV: 0.5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, v := s.UVAt(tt.p, nil)
+			assert.InDelta(t, tt.wantU, u, constants.Epsilon, "should equal")
+			assert.InDelta(t, tt.wantV, v, constants.Epsilon, "should equal")
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package tracer
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// Subsurface describes how light scatters inside a translucent material (skin, wax, marble, milk), per RGB channel
+// Light that enters the material bounces around inside until it is absorbed or leaves, often far from where it
+// entered. The path tracer simulates this with a random walk inside the shape, which must be closed (a sphere, a CSG
+// shape, a closed mesh). The other integrators render the material as diffuse, with Material.Color.
+type Subsurface struct {
+	// Scattering and Absorption are the scattering and absorption coefficients, the probability per unit distance of
+	// light being scattered or absorbed
+	Scattering, Absorption Color
+}
+
+// NewSubsurface returns a new subsurface scattering with the given coefficients
+func NewSubsurface(scattering, absorption Color) *Subsurface {
+	return &Subsurface{Scattering: scattering, Absorption: absorption}
+}
+
+// NewSubsurfaceFromMeanFreePath returns a new subsurface scattering from the (single scattering) albedo, the fraction
+// of light scattered rather than absorbed at each interaction, and the mean free path, the average distance light
+// travels between interactions
+func NewSubsurfaceFromMeanFreePath(albedo, meanFreePath Color) *Subsurface {
+	extinction := func(mfp float64) float64 {
+		if mfp <= 0 {
+			return 0
+		}
+		return 1 / mfp
+	}
+	sigmaT := NewColor(extinction(meanFreePath.R), extinction(meanFreePath.G), extinction(meanFreePath.B))
+	return NewSubsurface(sigmaT.Blend(albedo), sigmaT.Blend(White().Sub(albedo)))
+}
+
+// subsurfaces are the built in materials measured by Jensen et al. in "A Practical Model for Subsurface Light
+// Transport" (2001), with coefficients per millimeter
+var subsurfaces = map[string]*Subsurface{
+	"apple":     NewSubsurface(NewColor(2.29, 2.39, 1.97), NewColor(0.0030, 0.0034, 0.046)),
+	"chicken":   NewSubsurface(NewColor(0.15, 0.21, 0.38), NewColor(0.015, 0.077, 0.19)),
+	"cream":     NewSubsurface(NewColor(7.38, 5.47, 3.15), NewColor(0.0002, 0.0028, 0.0163)),
+	"ketchup":   NewSubsurface(NewColor(0.18, 0.07, 0.03), NewColor(0.061, 0.97, 1.45)),
+	"marble":    NewSubsurface(NewColor(2.19, 2.62, 3.00), NewColor(0.0021, 0.0041, 0.0071)),
+	"potato":    NewSubsurface(NewColor(0.68, 0.70, 0.55), NewColor(0.0024, 0.0090, 0.12)),
+	"skimmilk":  NewSubsurface(NewColor(0.70, 1.22, 1.90), NewColor(0.0014, 0.0025, 0.0142)),
+	"skin1":     NewSubsurface(NewColor(0.74, 0.88, 1.01), NewColor(0.032, 0.17, 0.48)),
+	"skin2":     NewSubsurface(NewColor(1.09, 1.59, 1.79), NewColor(0.013, 0.070, 0.145)),
+	"wholemilk": NewSubsurface(NewColor(2.55, 3.21, 3.77), NewColor(0.0011, 0.0024, 0.014)),
+}
+
+// SubsurfaceByName returns the built in measured material with the given name (apple, chicken, cream, ketchup, marble,
+// potato, skimmilk, skin1, skin2 or wholemilk)
+// The coefficients are per millimeter, use Scale for scenes in other units.
+func SubsurfaceByName(name string) (*Subsurface, error) {
+	ss, ok := subsurfaces[strings.ToLower(name)]
+	if !ok {
+		var names []string
+		for n := range subsurfaces {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown subsurface material %q, known materials: %v", name, strings.Join(names, ", "))
+	}
+	return NewSubsurface(ss.Scattering, ss.Absorption), nil
+}
+
+// Scale returns the subsurface scattering with the coefficients scaled by s
+// Use it to change units, for the built in materials s is the number of millimeters in one unit of the scene.
+func (ss *Subsurface) Scale(s float64) *Subsurface {
+	return NewSubsurface(ss.Scattering.Scale(s), ss.Absorption.Scale(s))
+}
+
+// extinction returns the extinction coefficient, the probability per unit distance of any interaction
+func (ss *Subsurface) extinction() Color {
+	return ss.Scattering.Add(ss.Absorption)
+}
+
+// MeanFreePath returns the average distance light travels between interactions, per channel
+func (ss *Subsurface) MeanFreePath() Color {
+	mfp := func(sigmaT float64) float64 {
+		if sigmaT <= 0 {
+			return math.Inf(1)
+		}
+		return 1 / sigmaT
+	}
+	sigmaT := ss.extinction()
+	return NewColor(mfp(sigmaT.R), mfp(sigmaT.G), mfp(sigmaT.B))
+}
+
+// Reflectance returns the diffuse reflectance of a thick slab of the material, the color it appears to have
+// Uses van de Hulst's approximation for isotropic scattering.
+func (ss *Subsurface) Reflectance() Color {
+	reflectance := func(sigmaS, sigmaT float64) float64 {
+		if sigmaT <= 0 {
+			return 0
+		}
+		s := math.Sqrt(1 - sigmaS/sigmaT)
+		return (1 - s) * (1 - 0.139*s) / (1 + 1.17*s)
+	}
+	sigmaT := ss.extinction()
+	return NewColor(
+		reflectance(ss.Scattering.R, sigmaT.R),
+		reflectance(ss.Scattering.G, sigmaT.G),
+		reflectance(ss.Scattering.B, sigmaT.B),
+	)
+}
+
+// NewSubsurfaceMaterial returns a new translucent material, with the index of refraction used by Jensen et al. and
+// the reflectance of the material as its color
+func NewSubsurfaceMaterial(ss *Subsurface) *Material {
+	m := NewDefaultMaterial()
+	m.Subsurface = ss
+	m.Color = ss.Reflectance()
+	m.RefractiveIndex = 1.3
+	return m
+}
+
+// transmittance returns the fraction of light (per channel) left after travelling distance without interacting
+func (ss *Subsurface) transmittance(distance float64) Color {
+	sigmaT := ss.extinction()
+	return NewColor(math.Exp(-sigmaT.R*distance), math.Exp(-sigmaT.G*distance), math.Exp(-sigmaT.B*distance))
+}
+
+// maxSubsurfaceSteps is the maximum number of interactions of a random walk
+const maxSubsurfaceSteps = 256
+
+// randomWalk follows the light entering the subsurface material at the hit as it scatters inside the shape
+// It returns the state where the light leaves, facing outwards, and the throughput of the walk. ok is false if the
+// light is absorbed or never leaves.
+// The distance to the next interaction is sampled using one random channel, and weighed by the average pdf of all
+// channels, so colored media converge without a walk per channel.
+func (w *World) randomWalk(state *IntersectionState, ss *Subsurface, xs Intersections, rng *rand.Rand) (exit *IntersectionState, beta Color, ok bool) {
+	sigmaT := ss.extinction()
+	beta = White()
+
+	// light that isn't reflected enters diffusely
+	frame := newONB(state.NormalV.Negate())
+	r := state.ray(state.UnderPoint, frame.local(cosineSampleHemisphere(rng)))
+
+	for step := 0; step < maxSubsurfaceSteps; step++ {
+		xs = w.Intersections(r, xs[:0])
+		hit, err := xs.Hit()
+		if err != nil {
+			// the shape is not closed
+			return nil, Black(), false
+		}
+
+		t := math.Inf(1)
+		if c := Channel(1 + rng.Intn(3)).value(sigmaT); c > 0 {
+			t = -math.Log(1-rng.Float64()) / c
+		}
+
+		if t >= hit.T() {
+			// left the material, the probability of getting this far is the transmittance
+			tr := ss.transmittance(hit.T())
+			pdf := (tr.R + tr.G + tr.B) / 3
+			beta = beta.Blend(tr).Scale(1 / pdf)
+
+			exit = PrepareComputations(hit, r, xs)
+			exit.NormalV = exit.NormalV.Negate()
+			exit.EyeV = exit.NormalV
+			exit.OverPoint, exit.UnderPoint = exit.UnderPoint, exit.OverPoint
+			exit.Inside = false
+			return exit, beta, true
+		}
+
+		tr := ss.transmittance(t)
+		pdf := (sigmaT.R*tr.R + sigmaT.G*tr.G + sigmaT.B*tr.B) / 3
+		beta = beta.Blend(ss.Scattering).Blend(tr).Scale(1 / pdf)
+
+		// Russian roulette, same as the path tracer
+		if step >= 8 {
+			q := math.Max(0.05, 1-math.Max(beta.R, math.Max(beta.G, beta.B)))
+			if rng.Float64() < q {
+				return nil, Black(), false
+			}
+			beta = beta.Scale(1 / (1 - q))
+		}
+
+		// isotropic scattering
+		r = state.ray(r.Position(t), uniformSampleSphere(rng))
+	}
+
+	return nil, Black(), false
+}
+
+// subsurfaceBSDF returns the bsdf the path continues with at a subsurface material and its weight, ok is false if the
+// path should end
+// The smooth boundary reflects light according to Fresnel, the rest enters the material, and leaves diffusely where
+// the random walk inside the shape ends.
+func (w *World) subsurfaceBSDF(state *IntersectionState, xs Intersections, rng *rand.Rand) (b *bsdf, weight Color, ok bool) {
+	m := state.material()
+
+	if rng.Float64() < Schlick(state) {
+		return &bsdf{
+			state:   state,
+			n:       state.NormalV,
+			wo:      state.EyeV,
+			mirror:  1,
+			m:       m,
+			clr:     White(),
+			frame:   newONB(state.NormalV),
+			pMirror: 1,
+		}, White(), true
+	}
+
+	exit, weight, ok := w.randomWalk(state, m.Subsurface, xs, rng)
+	if !ok {
+		return nil, Black(), false
+	}
+	return &bsdf{
+		state:    exit,
+		n:        exit.NormalV,
+		wo:       exit.EyeV,
+		albedo:   White(),
+		m:        m,
+		clr:      White(),
+		frame:    newONB(exit.NormalV),
+		pDiffuse: 1,
+	}, weight, true
+}
@@ -0,0 +1,245 @@
+package tracer
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/DanTulovsky/tracer/constants"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestCubeMesh returns a closed mesh of the cube from -1 to 1, with face normals
+func newTestCubeMesh(m *Material) *TriangleMesh {
+	verts := []Point{
+		NewPoint(-1, -1, -1), NewPoint(1, -1, -1), NewPoint(1, 1, -1), NewPoint(-1, 1, -1),
+		NewPoint(-1, -1, 1), NewPoint(1, -1, 1), NewPoint(1, 1, 1), NewPoint(-1, 1, 1),
+	}
+	normals := []Vector{
+		NewVector(0, 0, -1), NewVector(0, 0, 1), NewVector(0, -1, 0),
+		NewVector(0, 1, 0), NewVector(-1, 0, 0), NewVector(1, 0, 0),
+	}
+	vertexIndex := []int{
+		0, 1, 2, 3, // front
+		4, 5, 6, 7, // back
+		0, 1, 5, 4, // bottom
+		3, 2, 6, 7, // top
+		0, 3, 7, 4, // left
+		1, 2, 6, 5, // right
+	}
+	var normalIndex []int
+	for f := range normals {
+		normalIndex = append(normalIndex, f, f, f, f)
+	}
+	textures := make([]Point, len(normals))
+
+	return NewMesh(6, []int{4, 4, 4, 4, 4, 4}, vertexIndex, normalIndex, normalIndex, make([]int, 6),
+		verts, normals, textures, []*Material{m})
+}
+
+func TestNewSubsurfaceFromMeanFreePath(t *testing.T) {
+	ss := NewSubsurfaceFromMeanFreePath(NewColor(0.9, 0.5, 0), NewColor(0.5, 1, 2))
+
+	assert.True(t, NewColor(1.8, 0.5, 0).Equal(ss.Scattering), "should equal")
+	assert.True(t, NewColor(0.2, 0.5, 0.5).Equal(ss.Absorption), "should equal")
+	assert.True(t, NewColor(0.5, 1, 2).Equal(ss.MeanFreePath()), "should equal")
+}
+
+func TestSubsurface_Reflectance(t *testing.T) {
+	tests := []struct {
+		name string
+		ss   *Subsurface
+		want Color
+	}{
+		{
+			name: "no absorption",
+			ss:   NewSubsurface(White(), Black()),
+			want: White(),
+		},
+		{
+			name: "no scattering",
+			ss:   NewSubsurface(Black(), White()),
+			want: Black(),
+		},
+		{
+			name: "empty",
+			ss:   NewSubsurface(Black(), Black()),
+			want: Black(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.True(t, tt.want.Equal(tt.ss.Reflectance()), "should equal")
+		})
+	}
+}
+
+func TestSubsurfaceByName(t *testing.T) {
+	tests := []struct {
+		name  string
+		check func(t *testing.T, r Color)
+	}{
+		{
+			name:  "marble",
+			check: func(t *testing.T, r Color) { assert.True(t, r.Luminance() > 0.8, "marble should be white") },
+		},
+		{
+			name:  "Skin1",
+			check: func(t *testing.T, r Color) { assert.True(t, r.R > r.G && r.G > r.B, "skin should be red") },
+		},
+		{
+			name:  "ketchup",
+			check: func(t *testing.T, r Color) { assert.True(t, r.R > 10*r.B, "ketchup should be red") },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ss, err := SubsurfaceByName(tt.name)
+			assert.NoError(t, err)
+			tt.check(t, ss.Reflectance())
+
+			// the reflectance doesn't depend on the units
+			assert.True(t, ss.Reflectance().Equal(ss.Scale(10).Reflectance()), "should equal")
+		})
+	}
+
+	_, err := SubsurfaceByName("unobtainium")
+	assert.Error(t, err, "should fail")
+}
+
+func TestWorld_RandomWalk(t *testing.T) {
+	ss := NewSubsurfaceFromMeanFreePath(White(), White().Scale(0.5))
+	m := NewSubsurfaceMaterial(ss)
+
+	sphere := NewUnitSphere()
+	sphere.SetMaterial(m)
+	// rays hit the members of CSG shapes, the material goes on them
+	s1, s2 := NewUnitSphere(), NewUnitCube()
+	s1.SetMaterial(m)
+	s2.SetMaterial(m)
+	csg := NewCSG(s1, s2, Intersect)
+	csg.SetTransform(IM().Scale(1.2, 1.2, 1.2))
+
+	tests := []struct {
+		name  string
+		shape Shaper
+	}{
+		{
+			name:  "sphere",
+			shape: sphere,
+		},
+		{
+			name:  "csg",
+			shape: csg,
+		},
+		{
+			name:  "mesh",
+			shape: newTestCubeMesh(m),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := NewWorld(NewWorldConfig())
+			w.AddObject(tt.shape)
+
+			r := NewRay(NewPoint(0, 0, -5), NewVector(0, 0, 1))
+			xs := w.Intersections(r, NewIntersections())
+			hit, err := xs.Hit()
+			assert.NoError(t, err)
+			state := PrepareComputations(hit, r, xs)
+
+			rng := rand.New(rand.NewSource(1))
+			exits := 0
+			for i := 0; i < 100; i++ {
+				exit, beta, ok := w.randomWalk(state, ss, NewIntersections(), rng)
+				if !ok {
+					continue
+				}
+				exits++
+
+				// without absorption light leaves unchanged, apart from Russian roulette
+				assert.True(t, beta.R >= 1-constants.Epsilon && beta.R == beta.B, "should not absorb: %v", beta)
+				// the exit state faces outwards
+				outwards := exit.Point.SubPoint(Origin()).Normalize()
+				assert.True(t, exit.NormalV.Dot(outwards) > 0, "normal should face outwards")
+				assert.True(t, exit.OverPoint.SubPoint(Origin()).Magnitude() > exit.Point.SubPoint(Origin()).Magnitude(),
+					"over point should be outside")
+			}
+			assert.True(t, exits > 80, "most walks should leave the shape, got %v", exits)
+		})
+	}
+}
+
+func TestWorld_RandomWalkAbsorbs(t *testing.T) {
+	s := NewUnitSphere()
+	ss := NewSubsurface(White().Scale(10), NewColor(0, 1, 10))
+	s.SetMaterial(NewSubsurfaceMaterial(ss))
+	w := NewWorld(NewWorldConfig())
+	w.AddObject(s)
+
+	r := NewRay(NewPoint(0, 0, -5), NewVector(0, 0, 1))
+	xs := w.Intersections(r, NewIntersections())
+	state := PrepareComputations(xs[0], r, xs)
+
+	rng := rand.New(rand.NewSource(1))
+	sum := Black()
+	n := 2000
+	for i := 0; i < n; i++ {
+		if _, beta, ok := w.randomWalk(state, ss, NewIntersections(), rng); ok {
+			sum = sum.Add(beta)
+		}
+	}
+	got := sum.Scale(1 / float64(n))
+
+	assert.InDelta(t, 1, got.R, 0.05, "red is not absorbed")
+	assert.True(t, got.G < got.R && got.B < got.G, "more absorbing channels lose more light: %v", got)
+	assert.True(t, got.B < 0.2, "blue is mostly absorbed: %v", got)
+}
+
+// subsurfaceTestWorld returns a thin slab, lit from behind, seen by a camera in front of it
+func subsurfaceTestWorld(m *Material) (*World, *Camera) {
+	w := NewWorld(NewWorldConfig())
+	w.Config.Integrator = NewPathTracerIntegrator(16)
+	w.Config.Antialias = 8
+	// the same image on every machine, the light through the slab is noisy
+	w.Config.Seed = 1
+	w.Config.Parallelism = 4
+	w.SetLights(Lights{NewPointLight(NewPoint(0, 0, 3), White().Scale(10))})
+
+	slab := NewUnitCube()
+	slab.SetTransform(IM().Scale(2, 2, 0.1))
+	slab.SetMaterial(m)
+	w.AddObject(slab)
+
+	camera := NewCamera(5, 5, math.Pi/3)
+	camera.SetTransform(ViewTransform(NewPoint(0, 0, -5), NewPoint(0, 0, 0), NewVector(0, 1, 0)))
+	w.SetCamera(camera)
+	return w, camera
+}
+
+func TestWorld_RenderSubsurface(t *testing.T) {
+	marble, err := SubsurfaceByName("marble")
+	assert.NoError(t, err)
+	// a slab 2mm thick
+	marble = marble.Scale(10)
+
+	w, camera := subsurfaceTestWorld(NewSubsurfaceMaterial(marble))
+	canvas := NewCanvas(5, 5)
+	w.Render(camera, canvas)
+	translucent, err := canvas.Get(2, 2)
+	assert.NoError(t, err)
+
+	opaque := NewDefaultMaterial()
+	opaque.Color = marble.Reflectance()
+	w, camera = subsurfaceTestWorld(opaque)
+	canvas = NewCanvas(5, 5)
+	w.Render(camera, canvas)
+	diffuse, err := canvas.Get(2, 2)
+	assert.NoError(t, err)
+
+	assert.Equal(t, Black(), diffuse, "light behind an opaque slab doesn't reach the eye")
+	assert.True(t, translucent.Luminance() > 0.05, "light shines through a translucent slab: %v", translucent)
+}
@@ -0,0 +1,113 @@
+package tracer
+
+import (
+	"math"
+)
+
+// Tangent is the tangent of a vertex in the form used by MikkTSpace: Dir is the direction of increasing u, orthogonal
+// to the vertex normal, and the bitangent (the direction of increasing v) is Sign * N x Dir
+type Tangent struct {
+	Dir  Vector
+	Sign float64
+}
+
+// tangentShaper is a shape with a tangent frame that follows its texture coordinates, see NormalMapPerturber
+type tangentShaper interface {
+	// tangentsAt returns the texture coordinates and the tangent and bitangent (the directions of increasing u and v)
+	// at the point p (object space) with the normal n
+	tangentsAt(p Point, n Vector, xs *Intersection) (u, v float64, t, b Vector)
+}
+
+// frame returns the tangent and bitangent at the normal n, the tangent is made orthogonal to n per point so the
+// frame matches the one the normal map was baked with
+func (tg Tangent) frame(n Vector) (t, b Vector) {
+	n = n.Normalize()
+	t = tg.Dir.SubVector(n.Scale(n.Dot(tg.Dir)))
+	if t.Magnitude() < 1e-12 {
+		basis := newONB(n)
+		return basis.u, basis.v
+	}
+	t = t.Normalize()
+	return t, n.Cross(t).Scale(tg.Sign)
+}
+
+// faceTangents returns the directions of increasing u and v across the triangle p1, p2, p3 with texture coordinates
+// vt1, vt2, vt3, false if the texture coordinates don't span an area
+func faceTangents(p1, p2, p3, vt1, vt2, vt3 Point) (t, b Vector, ok bool) {
+	e1, e2 := p2.SubPoint(p1), p3.SubPoint(p1)
+	du1, dv1 := vt2.x-vt1.x, vt2.y-vt1.y
+	du2, dv2 := vt3.x-vt1.x, vt3.y-vt1.y
+
+	det := du1*dv2 - du2*dv1
+	if math.Abs(det) < 1e-12 {
+		return Vector{}, Vector{}, false
+	}
+	r := 1 / det
+	t = e1.Scale(dv2).SubVector(e2.Scale(dv1)).Scale(r)
+	b = e2.Scale(du1).SubVector(e1.Scale(du2)).Scale(r)
+	return t, b, true
+}
+
+// newTangent returns the tangent at the normal n of a surface where u and v increase along t and b
+func newTangent(n, t, b Vector) Tangent {
+	n = n.Normalize()
+	dir := t.SubVector(n.Scale(n.Dot(t)))
+	if dir.Magnitude() < 1e-12 {
+		basis := newONB(n)
+		return Tangent{Dir: basis.u, Sign: 1}
+	}
+	dir = dir.Normalize()
+
+	// mirrored texture coordinates flip the bitangent
+	sign := 1.0
+	if n.Cross(dir).Dot(b) < 0 {
+		sign = -1
+	}
+	return Tangent{Dir: dir, Sign: sign}
+}
+
+// smoothTangents sets the tangents of the triangles to the ones shared by the triangles meeting at each vertex
+// Like MikkTSpace, the tangents of the faces are weighted by the angle of the corner and vertices are only shared
+// when their position, normal, texture coordinates and the sign of the bitangent all match, so seams and mirrored
+// halves keep their own tangents.
+func smoothTangents(tris []*SmoothTriangle) {
+	type vertex struct {
+		p    Point
+		n    Vector
+		vt   Point
+		sign float64
+	}
+	type corner struct {
+		tri, i int
+		key    vertex
+	}
+
+	sums := make(map[vertex]Vector)
+	var corners []corner
+
+	for ti, tri := range tris {
+		p := [3]Point{tri.P1, tri.P2, tri.P3}
+		n := [3]Vector{tri.N1, tri.N2, tri.N3}
+		vt := [3]Point{tri.VT1, tri.VT2, tri.VT3}
+
+		ft, fb, ok := faceTangents(p[0], p[1], p[2], vt[0], vt[1], vt[2])
+		if !ok {
+			continue
+		}
+		for i := 0; i < 3; i++ {
+			tg := newTangent(n[i], ft, fb)
+			key := vertex{p: p[i], n: n[i], vt: vt[i], sign: tg.Sign}
+
+			e1, e2 := p[(i+1)%3].SubPoint(p[i]), p[(i+2)%3].SubPoint(p[i])
+			angle := math.Acos(math.Max(-1, math.Min(1, e1.Normalize().Dot(e2.Normalize()))))
+			sums[key] = sums[key].AddVector(tg.Dir.Scale(angle))
+			corners = append(corners, corner{tri: ti, i: i, key: key})
+		}
+	}
+
+	for _, c := range corners {
+		tg := newTangent(c.key.n, sums[c.key], Vector{})
+		tg.Sign = c.key.sign
+		tris[c.tri].setTangent(c.i, tg)
+	}
+}
@@ -0,0 +1,223 @@
+package tracer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFaceTangents(t *testing.T) {
+	p1, p2, p3 := NewPoint(0, 0, 0), NewPoint(1, 0, 0), NewPoint(0, 1, 0)
+
+	tests := []struct {
+		name          string
+		vt1, vt2, vt3 Point
+		wantT, wantB  Vector
+		wantOK        bool
+	}{
+		{
+			name:   "aligned",
+			vt1:    NewPoint(0, 0, 0),
+			vt2:    NewPoint(1, 0, 0),
+			vt3:    NewPoint(0, 1, 0),
+			wantT:  NewVector(1, 0, 0),
+			wantB:  NewVector(0, 1, 0),
+			wantOK: true,
+		},
+		{
+			name:   "stretched",
+			vt1:    NewPoint(0, 0, 0),
+			vt2:    NewPoint(2, 0, 0),
+			vt3:    NewPoint(0, 1, 0),
+			wantT:  NewVector(0.5, 0, 0),
+			wantB:  NewVector(0, 1, 0),
+			wantOK: true,
+		},
+		{
+			name:   "swapped",
+			vt1:    NewPoint(0, 0, 0),
+			vt2:    NewPoint(0, 1, 0),
+			vt3:    NewPoint(1, 0, 0),
+			wantT:  NewVector(0, 1, 0),
+			wantB:  NewVector(1, 0, 0),
+			wantOK: true,
+		},
+		{
+			name: "degenerate",
+			vt1:  NewPoint(0, 0, 0),
+			vt2:  NewPoint(1, 1, 0),
+			vt3:  NewPoint(2, 2, 0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tangent, bitangent, ok := faceTangents(p1, p2, p3, tt.vt1, tt.vt2, tt.vt3)
+			assert.Equal(t, tt.wantOK, ok, "should equal")
+			if ok {
+				assert.True(t, tt.wantT.Equal(tangent), "want %v, got %v", tt.wantT, tangent)
+				assert.True(t, tt.wantB.Equal(bitangent), "want %v, got %v", tt.wantB, bitangent)
+			}
+		})
+	}
+}
+
+func TestNewTangent(t *testing.T) {
+	n := NewVector(0, 0, 1)
+
+	tests := []struct {
+		name string
+		t, b Vector
+		want Tangent
+	}{
+		{
+			name: "orthogonal",
+			t:    NewVector(2, 0, 0),
+			b:    NewVector(0, 1, 0),
+			want: Tangent{Dir: NewVector(1, 0, 0), Sign: 1},
+		},
+		{
+			name: "projected on the surface",
+			t:    NewVector(1, 0, 1),
+			b:    NewVector(0, 1, 0),
+			want: Tangent{Dir: NewVector(1, 0, 0), Sign: 1},
+		},
+		{
+			name: "mirrored",
+			t:    NewVector(1, 0, 0),
+			b:    NewVector(0, -1, 0),
+			want: Tangent{Dir: NewVector(1, 0, 0), Sign: -1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newTangent(n, tt.t, tt.b)
+			assert.True(t, tt.want.Dir.Equal(got.Dir), "want %v, got %v", tt.want.Dir, got.Dir)
+			assert.Equal(t, tt.want.Sign, got.Sign, "should equal")
+
+			tangent, bitangent := got.frame(n)
+			assert.True(t, tt.want.Dir.Equal(tangent), "should equal")
+			assert.True(t, tt.b.Normalize().Equal(bitangent), "the bitangent follows v, got %v", bitangent)
+		})
+	}
+}
+
+func TestSmoothTangents(t *testing.T) {
+	n := NewVector(0, 0, 1)
+	// u increases along x in a and along -y in b, the triangles share the vertex at the origin
+	a := NewSmoothTriangle(NewPoint(0, 0, 0), NewPoint(1, 0, 0), NewPoint(0, 1, 0), n, n, n,
+		NewPoint(0, 0, 0), NewPoint(1, 0, 0), NewPoint(0, 1, 0))
+	b := NewSmoothTriangle(NewPoint(0, 0, 0), NewPoint(0, -1, 0), NewPoint(1, -1, 0), n, n, n,
+		NewPoint(0, 0, 0), NewPoint(1, 0, 0), NewPoint(1, 1, 0))
+
+	assert.True(t, NewVector(1, 0, 0).Equal(a.T1.Dir), "per face, got %v", a.T1.Dir)
+	assert.True(t, NewVector(0, -1, 0).Equal(b.T1.Dir), "per face, got %v", b.T1.Dir)
+
+	smoothTangents([]*SmoothTriangle{a, b})
+
+	// weighted by the angles of the corners, 90 and 45 degrees
+	want := NewVector(2, -1, 0).Normalize()
+	assert.True(t, want.Equal(a.T1.Dir), "want %v, got %v", want, a.T1.Dir)
+	assert.True(t, want.Equal(b.T1.Dir), "want %v, got %v", want, b.T1.Dir)
+	assert.Equal(t, 1.0, b.T1.Sign, "should equal")
+
+	// the other vertices are not shared
+	assert.True(t, NewVector(1, 0, 0).Equal(a.T2.Dir), "got %v", a.T2.Dir)
+	assert.True(t, NewVector(0, -1, 0).Equal(b.T3.Dir), "got %v", b.T3.Dir)
+}
+
+func TestNormalMapPerturber(t *testing.T) {
+	// the normal of the triangle is -z, u increases along x and v along y
+	tangent, bitangent, normal := NewVector(1, 0, 0), NewVector(0, 1, 0), NewVector(0, 0, -1)
+
+	tests := []struct {
+		name      string
+		clr       Color
+		strength  float64
+		flipGreen bool
+		want      Vector
+	}{
+		{
+			name:     "flat",
+			clr:      NewColor(0.5, 0.5, 1),
+			strength: 1,
+			want:     normal,
+		},
+		{
+			name:     "red is the tangent",
+			clr:      NewColor(1, 0.5, 0.5),
+			strength: 1,
+			want:     tangent,
+		},
+		{
+			name:     "green is up the image",
+			clr:      NewColor(0.5, 1, 0.5),
+			strength: 1,
+			want:     bitangent.Negate(),
+		},
+		{
+			name:      "flipped green",
+			clr:       NewColor(0.5, 1, 0.5),
+			strength:  1,
+			flipGreen: true,
+			want:      bitangent,
+		},
+		{
+			name:     "strength",
+			clr:      NewColor(1, 0.5, 1),
+			strength: 0.5,
+			want:     tangent.Scale(0.5).AddVector(normal).Normalize(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCanvas(1, 1)
+			c.Set(0, 0, tt.clr)
+			np := NewNormalMapPerturber(NewTextureSampler(NewCanvasTexture(c)))
+			np.Strength = tt.strength
+			np.FlipGreen = tt.flipGreen
+
+			m := NewDefaultMaterial()
+			m.SetPerturber(np)
+
+			tri := NewTriangle(NewPoint(0, 0, 0), NewPoint(1, 0, 0), NewPoint(0, 1, 0))
+			tri.SetMaterial(m)
+			p := NewPoint(0.25, 0.25, 0)
+			got := tri.NormalAt(p, NewIntersectionUV(tri, 1, 0.25, 0.25))
+			assert.True(t, tt.want.Equal(got), "want %v, got %v", tt.want, got)
+
+			// without a hit there is no tangent frame
+			assert.True(t, normal.Equal(tri.NormalAt(p, nil)), "should equal")
+
+			// shapes without tangents keep their normals
+			s := NewUnitSphere()
+			s.SetMaterial(m)
+			sp := NewPoint(0, 0, -1)
+			assert.True(t, NewVector(0, 0, -1).Equal(s.NormalAt(sp, NewIntersection(s, 1))), "should equal")
+		})
+	}
+}
+
+func TestSmoothTriangle_tangentsAt(t *testing.T) {
+	n := NewVector(0, 0, 1)
+	tri := NewSmoothTriangle(NewPoint(0, 0, 0), NewPoint(1, 0, 0), NewPoint(0, 1, 0),
+		NewVector(0, 0.5, 1).Normalize(), n, n,
+		NewPoint(0.5, 0.5, 0), NewPoint(1, 0.5, 0), NewPoint(0.5, 1, 0))
+
+	xs := NewIntersectionUV(tri, 1, 0.25, 0.25)
+	op := NewPoint(0.25, 0.25, 0)
+	normal := tri.localNormalAt(op, xs).Normalize()
+	u, v, tangent, bitangent := tri.tangentsAt(op, normal, xs)
+
+	assert.InDelta(t, 0.625, u, 1e-9, "should equal")
+	assert.InDelta(t, 0.625, v, 1e-9, "should equal")
+
+	// an orthonormal frame around the interpolated normal
+	assert.InDelta(t, 0, tangent.Dot(normal), 1e-9, "should equal")
+	assert.InDelta(t, 0, bitangent.Dot(normal), 1e-9, "should equal")
+	assert.InDelta(t, 0, tangent.Dot(bitangent), 1e-9, "should equal")
+	assert.InDelta(t, 1, tangent.Magnitude(), 1e-9, "should equal")
+	assert.True(t, tangent.X() > 0.9 && bitangent.Y() > 0.8, "u along x, v along y: %v %v", tangent, bitangent)
+}
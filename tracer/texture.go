@@ -0,0 +1,407 @@
+package tracer
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"math"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// TextureImage is an image in compact storage, RGB with 8 bits per channel (images decoded from 8 bit files) or a
+// float32 per channel (16 bit files, canvases), row major
+// sRGB images store the encoded values, which keeps the precision of dark colors in 8 bits, At and set convert them.
+type TextureImage struct {
+	Width, Height int
+	Encoding      ColorEncoding
+
+	pix8  []uint8
+	pix32 []float32
+}
+
+// newTextureImage returns a new black image, wide images store a float32 per channel
+func newTextureImage(w, h int, wide bool, enc ColorEncoding) *TextureImage {
+	ti := &TextureImage{Width: w, Height: h, Encoding: enc}
+	if wide {
+		ti.pix32 = make([]float32, w*h*3)
+	} else {
+		ti.pix8 = make([]uint8, w*h*3)
+	}
+	return ti
+}
+
+// NewTextureImageFromCanvas returns the canvas as a float32 image, canvas colors are linear
+func NewTextureImageFromCanvas(c *Canvas) *TextureImage {
+	ti := newTextureImage(c.Width, c.Height, true, ColorEncodingLinear)
+	for x := 0; x < c.Width; x++ {
+		for y := 0; y < c.Height; y++ {
+			ti.set(x, y, c.colors[x][y])
+		}
+	}
+	return ti
+}
+
+// NewTextureImageFromImage returns the image in compact storage, 16 bit images keep their precision
+// enc is the encoding of the image: sRGB for color textures, linear for data.
+func NewTextureImageFromImage(m image.Image, enc ColorEncoding) *TextureImage {
+	wide := false
+	switch m.(type) {
+	case *image.RGBA64, *image.NRGBA64, *image.Gray16:
+		wide = true
+	}
+
+	bounds := m.Bounds()
+	ti := newTextureImage(bounds.Dx(), bounds.Dy(), wide, enc)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			// alpha = 0 returns black
+			ti.setEncoded(x-bounds.Min.X, y-bounds.Min.Y, ColorName(m.At(x, y)))
+		}
+	}
+	return ti
+}
+
+// At returns the linear color of the texel at (x, y), which must be inside the image
+func (ti *TextureImage) At(x, y int) Color {
+	i := (y*ti.Width + x) * 3
+	if ti.pix32 != nil {
+		c := NewColor(float64(ti.pix32[i]), float64(ti.pix32[i+1]), float64(ti.pix32[i+2]))
+		if ti.Encoding == ColorEncodingSRGB {
+			return c.SRGBToLinear()
+		}
+		return c
+	}
+	if ti.Encoding == ColorEncodingSRGB {
+		return NewColor(srgbTable[ti.pix8[i]], srgbTable[ti.pix8[i+1]], srgbTable[ti.pix8[i+2]])
+	}
+	return NewColor(float64(ti.pix8[i])/255, float64(ti.pix8[i+1])/255, float64(ti.pix8[i+2])/255)
+}
+
+// set sets the linear color of the texel at (x, y), 8 bit images clamp it to [0, 1]
+func (ti *TextureImage) set(x, y int, c Color) {
+	if ti.Encoding == ColorEncodingSRGB {
+		c = c.Clamp().LinearToSRGB()
+	}
+	ti.setEncoded(x, y, c)
+}
+
+// setEncoded sets the texel at (x, y) to the value c, already in the encoding of the image
+func (ti *TextureImage) setEncoded(x, y int, c Color) {
+	i := (y*ti.Width + x) * 3
+	if ti.pix32 != nil {
+		ti.pix32[i], ti.pix32[i+1], ti.pix32[i+2] = float32(c.R), float32(c.G), float32(c.B)
+		return
+	}
+	quantize := func(v float64) uint8 {
+		return uint8(math.Round(math.Max(0, math.Min(1, v)) * 255))
+	}
+	ti.pix8[i], ti.pix8[i+1], ti.pix8[i+2] = quantize(c.R), quantize(c.G), quantize(c.B)
+}
+
+// bytes returns the memory used by the texels
+func (ti *TextureImage) bytes() int64 {
+	if ti.pix32 != nil {
+		return int64(len(ti.pix32)) * 4
+	}
+	return int64(len(ti.pix8))
+}
+
+// mipmap is a texture and the chain of copies of it, each half the size of the previous one
+type mipmap struct {
+	// base is the full resolution texture, it never changes
+	base *TextureImage
+
+	// levels are base and its copies, built the first time they are needed, read them through buildLevels
+	levels     []*TextureImage
+	levelsOnce sync.Once
+
+	// err is set if the texture could not be decoded
+	err error
+}
+
+// newMipmap returns a new mipmap of the texture, without its other levels
+func newMipmap(base *TextureImage) *mipmap {
+	return &mipmap{base: base}
+}
+
+// buildLevels builds the mipmap, halving the texture until it is one texel, and returns the levels and the memory
+// used by the new levels, which is 0 once they are built
+// Each texel is the average of the (up to) 2x2 texels it covers in the previous level.
+func (m *mipmap) buildLevels() (levels []*TextureImage, bytes int64) {
+	m.levelsOnce.Do(func() {
+		// built aside and published once, the levels are read by other workers as soon as they are set
+		levels := []*TextureImage{m.base}
+		for c := m.base; c.Width > 1 || c.Height > 1; {
+			w, h := (c.Width+1)/2, (c.Height+1)/2
+			next := newTextureImage(w, h, c.pix32 != nil, c.Encoding)
+			for x := 0; x < w; x++ {
+				for y := 0; y < h; y++ {
+					sum, n := Black(), 0.0
+					for i := 2 * x; i < 2*x+2 && i < c.Width; i++ {
+						for j := 2 * y; j < 2*y+2 && j < c.Height; j++ {
+							sum = sum.Add(c.At(i, j))
+							n++
+						}
+					}
+					next.set(x, y, sum.Scale(1/n))
+				}
+			}
+			levels = append(levels, next)
+			bytes += next.bytes()
+			c = next
+		}
+		m.levels = levels
+	})
+	return m.levels, bytes
+}
+
+// Texture is an image sampled by a TextureSampler
+// Textures read from files (see LoadTexture) are shared by everything that uses the same file, decoded the first time
+// they are sampled and evicted when the texture cache is over its budget, textures created in memory are never
+// evicted.
+type Texture struct {
+	// path is the file the texture is read from, empty for textures created in memory
+	path string
+	// Width and Height are the size of the texture
+	Width, Height int
+	// Encoding is the encoding of the texels, sRGB textures are converted to the working space when sampled
+	Encoding ColorEncoding
+
+	// current holds the decoded *mipmap, a nil *mipmap before the first sample and after eviction
+	current atomic.Value
+	// lastUse is the value of the cache clock when the texture was last sampled
+	lastUse int64
+	// loading serializes decoding
+	loading sync.Mutex
+}
+
+// NewTexture returns a new texture of the image
+func NewTexture(ti *TextureImage) *Texture {
+	t := &Texture{Width: ti.Width, Height: ti.Height, Encoding: ti.Encoding}
+	t.current.Store(newMipmap(ti))
+	return t
+}
+
+// NewCanvasTexture returns a new texture of the canvas
+func NewCanvasTexture(c *Canvas) *Texture {
+	return NewTexture(NewTextureImageFromCanvas(c))
+}
+
+// NewImageTexture returns a new texture of the image, enc is sRGB for color textures and linear for data
+func NewImageTexture(m image.Image, enc ColorEncoding) *Texture {
+	return NewTexture(NewTextureImageFromImage(m, enc))
+}
+
+// LoadTexture returns the texture of the image file, through the process-wide texture cache
+// enc is sRGB for color textures and linear for data. Only the size of the image is read, the texels are decoded the
+// first time the texture is sampled. All calls with the same path and encoding return the same texture.
+func LoadTexture(path string, enc ColorEncoding) (*Texture, error) {
+	return textureCache.load(path, enc)
+}
+
+// Path returns the file the texture is read from, empty for textures created in memory
+func (t *Texture) Path() string {
+	return t.path
+}
+
+// mipmap returns the decoded texture, decoding it if needed
+func (t *Texture) mipmap() *mipmap {
+	if t.path == "" {
+		return t.current.Load().(*mipmap)
+	}
+	return textureCache.get(t)
+}
+
+// decode reads the image file
+func (t *Texture) decode() *mipmap {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return &mipmap{err: err}
+	}
+	defer f.Close()
+
+	m, _, err := image.Decode(f)
+	if err != nil {
+		return &mipmap{err: fmt.Errorf("%v: %v", t.path, err)}
+	}
+	return newMipmap(NewTextureImageFromImage(m, t.Encoding))
+}
+
+// DefaultTextureCacheBudget is the memory the texture cache keeps decoded textures in, unless changed with
+// SetTextureCacheBudget
+const DefaultTextureCacheBudget = 1 << 30
+
+// TextureCacheStats are the statistics of the texture cache
+type TextureCacheStats struct {
+	// Textures is the number of textures read from files, Resident the number of them that are decoded
+	Textures, Resident int
+	// Bytes is the memory used by the decoded textures and their mipmaps, Budget the most the cache tries to use
+	Bytes, Budget int64
+	// Lookups, Loads and Evictions count how many times textures were sampled, decoded and evicted
+	Lookups, Loads, Evictions int64
+}
+
+// textureCacheType keeps the textures read from files, decoded textures are evicted (least recently used first) when
+// they use more memory than the budget
+type textureCacheType struct {
+	mu       sync.Mutex
+	textures map[textureKey]*Texture
+	// bytes used by each decoded texture
+	resident map[*Texture]int64
+	bytes    int64
+	budget   int64
+
+	// clock orders the uses of textures
+	clock int64
+
+	lookups, loads, evictions int64
+}
+
+// textureKey identifies a texture in the cache, the same file can be used both as color and as data
+type textureKey struct {
+	path string
+	enc  ColorEncoding
+}
+
+// textureCache is the process-wide texture cache
+var textureCache = newTextureCache(DefaultTextureCacheBudget)
+
+// newTextureCache returns a new empty texture cache
+func newTextureCache(budget int64) *textureCacheType {
+	return &textureCacheType{
+		textures: make(map[textureKey]*Texture),
+		resident: make(map[*Texture]int64),
+		budget:   budget,
+	}
+}
+
+// SetTextureCacheBudget sets the memory (in bytes) the texture cache keeps decoded textures in
+// The texture being sampled is never evicted, so a single texture larger than the budget is still kept.
+func SetTextureCacheBudget(bytes int64) {
+	textureCache.mu.Lock()
+	defer textureCache.mu.Unlock()
+	textureCache.budget = bytes
+	textureCache.evict(nil)
+}
+
+// TextureCacheStatistics returns the statistics of the texture cache
+func TextureCacheStatistics() TextureCacheStats {
+	return textureCache.stats()
+}
+
+// stats returns the statistics of the cache
+func (tc *textureCacheType) stats() TextureCacheStats {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	return TextureCacheStats{
+		Textures:  len(tc.textures),
+		Resident:  len(tc.resident),
+		Bytes:     tc.bytes,
+		Budget:    tc.budget,
+		Lookups:   atomic.LoadInt64(&tc.lookups),
+		Loads:     tc.loads,
+		Evictions: tc.evictions,
+	}
+}
+
+// load returns the texture of the file, checking that it is an image
+func (tc *textureCacheType) load(path string, enc ColorEncoding) (*Texture, error) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	key := textureKey{path: path, enc: enc}
+	if t, ok := tc.textures[key]; ok {
+		return t, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+
+	t := &Texture{path: path, Width: config.Width, Height: config.Height, Encoding: enc}
+	t.current.Store((*mipmap)(nil))
+	tc.textures[key] = t
+	return t, nil
+}
+
+// get returns the decoded texture, decoding it if it isn't resident
+func (tc *textureCacheType) get(t *Texture) *mipmap {
+	atomic.AddInt64(&tc.lookups, 1)
+	atomic.StoreInt64(&t.lastUse, atomic.AddInt64(&tc.clock, 1))
+
+	if m := t.current.Load().(*mipmap); m != nil {
+		return m
+	}
+
+	t.loading.Lock()
+	defer t.loading.Unlock()
+	if m := t.current.Load().(*mipmap); m != nil {
+		return m
+	}
+
+	m := t.decode()
+	if m.err != nil {
+		// keep the error, there is no point trying again
+		log.Println(m.err)
+		t.current.Store(m)
+		return m
+	}
+	t.current.Store(m)
+
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	tc.loads++
+	tc.add(t, m.base.bytes())
+	return m
+}
+
+// levels returns the mipmap levels of the texture, building them if needed
+func (tc *textureCacheType) levels(t *Texture, m *mipmap) []*TextureImage {
+	levels, bytes := m.buildLevels()
+	if bytes > 0 && t.path != "" {
+		tc.mu.Lock()
+		defer tc.mu.Unlock()
+		// the texture might have been evicted in the meantime
+		if t.current.Load().(*mipmap) == m {
+			tc.add(t, bytes)
+		}
+	}
+	return levels
+}
+
+// add accounts for bytes more memory used by the texture and evicts other textures if over budget, must be called
+// with the lock held
+func (tc *textureCacheType) add(t *Texture, bytes int64) {
+	tc.resident[t] += bytes
+	tc.bytes += bytes
+	tc.evict(t)
+}
+
+// evict evicts the least recently used textures, except keep, until the cache is within budget, must be called with
+// the lock held
+func (tc *textureCacheType) evict(keep *Texture) {
+	for tc.bytes > tc.budget {
+		var lru *Texture
+		for t := range tc.resident {
+			if t != keep && (lru == nil || atomic.LoadInt64(&t.lastUse) < atomic.LoadInt64(&lru.lastUse)) {
+				lru = t
+			}
+		}
+		if lru == nil {
+			return
+		}
+
+		tc.bytes -= tc.resident[lru]
+		delete(tc.resident, lru)
+		lru.current.Store((*mipmap)(nil))
+		tc.evictions++
+	}
+}
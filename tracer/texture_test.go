@@ -0,0 +1,227 @@
+package tracer
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestPNG writes a size x size png of a single color to dir and returns its path
+func writeTestPNG(t *testing.T, dir, name string, size int, clr color.Color) string {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for x := 0; x < size; x++ {
+		for y := 0; y < size; y++ {
+			img.Set(x, y, clr)
+		}
+	}
+	file := filepath.Join(dir, name)
+	f, err := os.Create(file)
+	assert.NoError(t, err)
+	defer f.Close()
+	assert.NoError(t, png.Encode(f, img))
+	return file
+}
+
+// withTestTextureCache replaces the process-wide texture cache with an empty one for the duration of the test
+func withTestTextureCache(t *testing.T, budget int64) {
+	old := textureCache
+	textureCache = newTextureCache(budget)
+	t.Cleanup(func() { textureCache = old })
+}
+
+func TestNewTextureImageFromImage(t *testing.T) {
+	img8 := image.NewNRGBA(image.Rect(10, 20, 12, 21))
+	img8.Set(10, 20, color.NRGBA{R: 255, A: 255})
+	img8.Set(11, 20, color.NRGBA{G: 128, A: 255})
+
+	img16 := image.NewRGBA64(image.Rect(0, 0, 1, 1))
+	img16.Set(0, 0, color.RGBA64{R: 0x8000, G: 0x0101, B: 0xffff, A: 0xffff})
+
+	tests := []struct {
+		name      string
+		img       image.Image
+		enc       ColorEncoding
+		bytes     int64
+		x         int
+		want      Color
+		precision float64
+	}{
+		{
+			name:      "8 bit",
+			img:       img8,
+			enc:       ColorEncodingLinear,
+			bytes:     6,
+			x:         1,
+			want:      NewColor(0, 128.0/255, 0),
+			precision: 1e-9,
+		},
+		{
+			name:      "8 bit sRGB",
+			img:       img8,
+			enc:       ColorEncodingSRGB,
+			bytes:     6,
+			x:         1,
+			want:      NewColor(0, 0.2158605, 0),
+			precision: 1e-7,
+		},
+		{
+			name:      "16 bit",
+			img:       img16,
+			enc:       ColorEncodingLinear,
+			bytes:     12,
+			want:      NewColor(float64(0x8000)/0xffff, float64(0x0101)/0xffff, 1),
+			precision: 1e-7,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ti := NewTextureImageFromImage(tt.img, tt.enc)
+			assert.Equal(t, tt.bytes, ti.bytes(), "should equal")
+
+			got := ti.At(tt.x, 0)
+			assert.InDelta(t, tt.want.R, got.R, tt.precision, "should equal")
+			assert.InDelta(t, tt.want.G, got.G, tt.precision, "should equal")
+			assert.InDelta(t, tt.want.B, got.B, tt.precision, "should equal")
+		})
+	}
+}
+
+func TestMipmap_BuildLevels(t *testing.T) {
+	m := NewCanvasTexture(newTestStripes(8)).mipmap()
+	levels, bytes := m.buildLevels()
+	assert.Equal(t, int64(4*4+2*2+1)*3*4, bytes, "the memory of the new levels")
+	again, bytes := m.buildLevels()
+	assert.Equal(t, int64(0), bytes, "built once")
+	assert.Equal(t, levels, again, "should equal")
+
+	assert.Equal(t, 4, len(levels), "8, 4, 2 and 1 texels")
+	assert.Equal(t, m.base, levels[0], "the full resolution texture")
+	for i, l := range levels[1:] {
+		assert.Equal(t, 4>>uint(i), l.Width, "should equal")
+		for x := 0; x < l.Width; x++ {
+			for y := 0; y < l.Height; y++ {
+				assert.True(t, NewColor(0.5, 0.5, 0.5).Equal(l.At(x, y)), "every 2x2 block averages to grey")
+			}
+		}
+	}
+
+	// odd sizes
+	m = NewCanvasTexture(NewCanvas(5, 3)).mipmap()
+	levels, _ = m.buildLevels()
+	assert.Equal(t, 4, len(levels), "5x3, 3x2, 2x1 and 1x1 texels")
+}
+
+func TestLoadTexture(t *testing.T) {
+	withTestTextureCache(t, DefaultTextureCacheBudget)
+	dir := t.TempDir()
+	red := writeTestPNG(t, dir, "red.png", 4, color.RGBA{R: 255, A: 255})
+
+	tex, err := LoadTexture(red, ColorEncodingSRGB)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, tex.Width, "the size is read without decoding")
+	assert.Equal(t, red, tex.Path(), "should equal")
+
+	same, err := LoadTexture(red, ColorEncodingSRGB)
+	assert.NoError(t, err)
+	assert.True(t, tex == same, "the same file is loaded once")
+	assert.Equal(t, TextureCacheStats{Textures: 1, Budget: DefaultTextureCacheBudget}, textureCache.stats(), "nothing is decoded yet")
+
+	assert.Equal(t, NewColor(1, 0, 0), NewTextureSampler(tex).Sample(0.5, 0.5), "should equal")
+	assert.Equal(t, NewColor(1, 0, 0), NewTextureSampler(same).Sample(0.1, 0.7), "should equal")
+	assert.Equal(t, TextureCacheStats{Textures: 1, Resident: 1, Bytes: 4 * 4 * 3, Budget: DefaultTextureCacheBudget, Lookups: 2, Loads: 1},
+		textureCache.stats(), "decoded on the first sample")
+
+	data, err := LoadTexture(red, ColorEncodingLinear)
+	assert.NoError(t, err)
+	assert.False(t, tex == data, "a file used as data is a different texture")
+
+	_, err = LoadTexture(filepath.Join(dir, "missing.png"), ColorEncodingSRGB)
+	assert.Error(t, err, "missing file")
+
+	notImage := filepath.Join(dir, "text.png")
+	assert.NoError(t, os.WriteFile(notImage, []byte("not an image"), 0644))
+	_, err = LoadTexture(notImage, ColorEncodingSRGB)
+	assert.Error(t, err, "not an image")
+}
+
+func TestTextureCache_Evict(t *testing.T) {
+	// room for two 4x4 textures
+	withTestTextureCache(t, 2*4*4*3)
+	dir := t.TempDir()
+
+	var textures []*Texture
+	for _, name := range []string{"a.png", "b.png", "c.png"} {
+		tex, err := LoadTexture(writeTestPNG(t, dir, name, 4, color.White), ColorEncodingSRGB)
+		assert.NoError(t, err)
+		textures = append(textures, tex)
+	}
+	a, b, c := textures[0], textures[1], textures[2]
+	resident := func(tex *Texture) bool { return tex.current.Load().(*mipmap) != nil }
+
+	NewTextureSampler(a).Sample(0, 0)
+	NewTextureSampler(b).Sample(0, 0)
+	NewTextureSampler(a).Sample(0, 0)
+	NewTextureSampler(c).Sample(0, 0)
+
+	assert.True(t, resident(a), "recently used")
+	assert.False(t, resident(b), "least recently used")
+	assert.True(t, resident(c), "just loaded")
+
+	// evicted textures are decoded again when needed
+	assert.Equal(t, White(), NewTextureSampler(b).Sample(0, 0), "should equal")
+	stats := textureCache.stats()
+	assert.Equal(t, int64(4), stats.Loads, "should equal")
+	assert.Equal(t, int64(2), stats.Evictions, "should equal")
+	assert.Equal(t, 2, stats.Resident, "should equal")
+	assert.Equal(t, int64(2*4*4*3), stats.Bytes, "should equal")
+
+	// the mipmap counts too
+	ts := NewTextureSampler(b)
+	ts.SampleFootprint(0, 0, 0.5, 0, 0, 0.5)
+	assert.Equal(t, 1, textureCache.stats().Resident, "only b fits")
+
+	SetTextureCacheBudget(0)
+	assert.Equal(t, 0, textureCache.stats().Resident, "should equal")
+}
+
+func TestTextureCache_Concurrent(t *testing.T) {
+	// room for one texture, the others keep getting evicted
+	withTestTextureCache(t, 4*4*3)
+	dir := t.TempDir()
+
+	colors := []color.RGBA{{R: 255, A: 255}, {G: 255, A: 255}, {B: 255, A: 255}}
+	var samplers []*TextureSampler
+	for i, clr := range colors {
+		tex, err := LoadTexture(writeTestPNG(t, dir, fmt.Sprintf("%v.png", i), 4, clr), ColorEncodingSRGB)
+		assert.NoError(t, err)
+		samplers = append(samplers, NewTextureSampler(tex))
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				n := (w + i) % len(samplers)
+				// full resolution samples read the texture while other workers build its mipmap
+				got := samplers[n].SampleFootprint(0.5, 0.5, 0.3, 0, 0, 0.3)
+				if i%2 == 1 {
+					got = samplers[n].Sample(0.5, 0.5)
+				}
+				assert.Equal(t, ColorName(colors[n]), got, "should equal")
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(1200), textureCache.stats().Lookups, "every sample looks the texture up")
+}
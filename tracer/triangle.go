@@ -89,15 +89,45 @@ func (t *Triangle) sharedIntersectWith(r Ray) (float64, float64, float64, bool)
 func (t *Triangle) IntersectWith(r Ray, xs Intersections) Intersections {
 	r = r.Transform(t.transformInverse)
 
-	// u, v not used here
-	tval, _, _, found := t.sharedIntersectWith(r)
+	// u, v are the barycentric coordinates of the hit, only used by the debug integrator
+	tval, u, v, found := t.sharedIntersectWith(r)
 	if !found {
 		return xs
 	}
-	xs = append(xs, NewIntersection(t, tval))
+	xs = append(xs, NewIntersectionUV(t, tval, u, v))
 	return xs
 }
 
+// barycentric returns the barycentric coordinates (the weights of P2 and P3) of the point p (object space), taken from
+// the intersection when there is one
+func (t *Triangle) barycentric(p Point, xs *Intersection) (u, v float64) {
+	if xs != nil {
+		return xs.u, xs.v
+	}
+
+	w := p.SubPoint(t.P1)
+	d00, d01, d11 := t.E1.Dot(t.E1), t.E1.Dot(t.E2), t.E2.Dot(t.E2)
+	d20, d21 := w.Dot(t.E1), w.Dot(t.E2)
+	denom := d00*d11 - d01*d01
+	if denom == 0 {
+		return 0, 0
+	}
+	return (d11*d20 - d01*d21) / denom, (d00*d21 - d01*d20) / denom
+}
+
+// UVAt returns the surface coordinates of the point p (world space), the barycentric coordinates of the point
+func (t *Triangle) UVAt(p Point, xs *Intersection) (float64, float64) {
+	return t.barycentric(p.ToObjectSpace(t), xs)
+}
+
+// tangentsAt implements tangentShaper, the texture coordinates are the barycentric coordinates, which increase along
+// the edges
+func (t *Triangle) tangentsAt(p Point, n Vector, xs *Intersection) (float64, float64, Vector, Vector) {
+	u, v := t.barycentric(p, xs)
+	tangent, bitangent := newTangent(t.Normal, t.E1, t.E2).frame(n)
+	return u, v, tangent, bitangent
+}
+
 func (t *Triangle) localNormalAt(unused Point, xs *Intersection) Vector {
 	return t.Normal
 }
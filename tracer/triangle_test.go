@@ -149,3 +149,19 @@ func TestTriangle_IntersectWith(t *testing.T) {
 		})
 	}
 }
+
+func TestTriangle_UVAt(t *testing.T) {
+	tri := NewTriangle(NewPoint(0, 1, 0), NewPoint(-1, 0, 0), NewPoint(1, 0, 0))
+	tri.SetWorldConfig(NewWorldConfig())
+
+	xs := tri.IntersectWith(NewRay(NewPoint(0, 0.5, -2), NewVector(0, 0, 1)), NewIntersections())
+	assert.Len(t, xs, 1)
+
+	u, v := tri.UVAt(NewPoint(0, 0.5, 0), xs[0])
+	assert.InDelta(t, 0.25, u, constants.Epsilon, "should use the intersection")
+	assert.InDelta(t, 0.25, v, constants.Epsilon, "should use the intersection")
+
+	u, v = tri.UVAt(NewPoint(0, 0.5, 0), nil)
+	assert.InDelta(t, 0.25, u, constants.Epsilon, "should compute the barycentric coordinates")
+	assert.InDelta(t, 0.25, v, constants.Epsilon, "should compute the barycentric coordinates")
+}
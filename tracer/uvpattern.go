@@ -2,9 +2,7 @@ package tracer
 
 import (
 	"image"
-	"log"
 	"math"
-	"os"
 )
 
 // UVPatterner is a pattern that acceps UV coordinates
@@ -12,76 +10,60 @@ type UVPatterner interface {
 	UVColorAt(float64, float64) Color
 }
 
-// UVImagePattern maps an image to the surface of an object
-type UVImagePattern struct {
-	canvas *Canvas
+// uvSpacePatterner is a UV pattern whose colors depend on the working space, such as images with sRGB colors
+type uvSpacePatterner interface {
+	uvColorIn(ws WorkingSpace, u, v float64) Color
 }
 
-// imageToCanvas converts an image to a Canvas
-func imageToCanvas(m image.Image) *Canvas {
-
-	bounds := m.Bounds()
-	canvas := NewCanvas(bounds.Max.X, bounds.Max.Y)
-	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			// alpha = 0 returns black
-			clr := ColorName(m.At(x, y))
-			canvas.Set(x, y, clr)
-		}
+// uvColorIn returns the color of the UV pattern at (u, v) in the working space ws
+func uvColorIn(p UVPatterner, ws WorkingSpace, u, v float64) Color {
+	if sp, ok := p.(uvSpacePatterner); ok {
+		return sp.uvColorIn(ws, u, v)
 	}
-	return canvas
+	return p.UVColorAt(u, v)
+}
+
+// UVImagePattern maps an image to the surface of an object
+type UVImagePattern struct {
+	sampler *TextureSampler
 }
 
 // NewUVImagePatternImage returns a new image pattern, input is an image.Image interface
 func NewUVImagePatternImage(m image.Image) (*UVImagePattern, error) {
-	// convert to canvas
-	canvas := imageToCanvas(m)
-
 	p := &UVImagePattern{
-		canvas: canvas,
+		sampler: NewTextureSampler(NewImageTexture(m, ColorEncodingSRGB)),
 	}
 
 	return p, nil
 }
 
-// NewUVImagePattern returns a new image pattern
+// NewUVImagePattern returns a new image pattern, the image is read through the texture cache
 func NewUVImagePattern(filename string) (*UVImagePattern, error) {
-	// read in image
-	reader, err := os.Open(filename)
+	t, err := LoadTexture(filename, ColorEncodingSRGB)
 	if err != nil {
 		return nil, err
 	}
-	defer reader.Close()
-
-	// Decode image
-	m, _, err := image.Decode(reader)
-	if err != nil {
-		return nil, err
-	}
-
-	// convert to canvas
-	canvas := imageToCanvas(m)
 
 	p := &UVImagePattern{
-		canvas: canvas,
+		sampler: NewTextureSampler(t),
 	}
 
 	return p, nil
 }
 
-// UVColorAt returns the color at the 2D coordinate (u, v)
-func (uvip *UVImagePattern) UVColorAt(u, v float64) Color {
-	// v = 1 - v
-	// u = 1 - u
+// Sampler returns the sampler of the image, use it to change the filtering, wrapping and transform
+func (uvip *UVImagePattern) Sampler() *TextureSampler {
+	return uvip.sampler
+}
 
-	x := u * (float64(uvip.canvas.Width) - 1)
-	y := v * (float64(uvip.canvas.Height) - 1)
+// UVColorAt returns the color at the 2D coordinate (u, v), in linear sRGB
+func (uvip *UVImagePattern) UVColorAt(u, v float64) Color {
+	return uvip.sampler.Sample(u, v)
+}
 
-	c, err := uvip.canvas.Get(int(x), int(y))
-	if err != nil {
-		log.Fatal(err)
-	}
-	return c
+// uvColorIn implements uvSpacePatterner
+func (uvip *UVImagePattern) uvColorIn(ws WorkingSpace, u, v float64) Color {
+	return uvip.sampler.sampleIn(ws, u, v)
 }
 
 // UVCheckersPattern maps checkers to the surface of the object
@@ -20,6 +20,18 @@ type World struct {
 	Lights  []Light
 	camera  *Camera
 	Config  *WorldConfig
+
+	// film holds the samples of the last render
+	film *Film
+
+	// region is the part of the frame being rendered
+	region *region
+
+	// photons are the photon maps built by the Whitted integrator, nil if photon mapping is off
+	photons *photonMaps
+
+	// differentials is true when camera rays carry differentials, only textures use them
+	differentials bool
 }
 
 // NewWorld returns a new empty world
@@ -113,6 +125,11 @@ func (w *World) Camera() *Camera {
 	return w.camera
 }
 
+// Film returns the film of the last render, nil if nothing was rendered yet
+func (w *World) Film() *Film {
+	return w.film
+}
+
 // ColorAt returns the color in the world where the given ray hits
 func (w *World) ColorAt(r Ray, remaining int, xs Intersections, rng *rand.Rand) Color {
 	// First solve the visibility problem
@@ -125,29 +142,45 @@ func (w *World) ColorAt(r Ray, remaining int, xs Intersections, rng *rand.Rand)
 
 	// Second solve the shading problem
 	state := PrepareComputations(hit, r, xs)
-	return w.shadeHit(state, remaining, xs, rng).Clamp()
+
+	// light is absorbed on the way back through transparent materials
+	return w.shadeHit(state, remaining, xs, rng).Blend(state.transmittance()).Clamp()
 }
 
 // ReflectedColor returns the reflected color given an IntersectionState
 // remaining controls how many times a light ray can bounce between the same objects
 func (w *World) ReflectedColor(state *IntersectionState, remaining int, xs Intersections, rng *rand.Rand) Color {
-	if remaining <= 0 || state.Object.Material().Reflective == 0 {
+	m := state.material()
+	if remaining <= 0 || m.reflectivity() == 0 {
 		return Black()
 	}
+	if d := m.microfacet(); d != nil {
+		return w.glossyReflectedColor(state, d, remaining, xs, rng)
+	}
 
-	reflectR := NewRay(state.OverPoint, state.ReflectV)
+	reflectR := state.ray(state.OverPoint, state.ReflectV)
+	reflectR.Differentials = state.reflectedDifferentials(state.ReflectV)
 	xs = xs[:0]
 	clr := w.ColorAt(reflectR, remaining-1, xs, rng)
 
-	return clr.Scale(state.Object.Material().Reflective)
+	// metals tint their reflections
+	if m.Metallic > 0 {
+		tint := m.reflectionTint(m.surfaceColor(state.Object, state.Point, state.texCoords()), state.EyeV.Dot(state.NormalV))
+		clr = clr.Blend(tint)
+	}
+
+	return clr.Scale(m.reflectivity())
 }
 
 // RefractedColor returns the refracted color given an IntersectionState
 // remaining controls how many times a light ray can bounce between the same objects
 func (w *World) RefractedColor(state *IntersectionState, remaining int, xs Intersections, rng *rand.Rand) Color {
-	if remaining <= 0 || state.Object.Material().Transparency == 0 {
+	if remaining <= 0 || state.material().Transparency == 0 {
 		return Black()
 	}
+	if d := state.material().microfacet(); d != nil {
+		return w.glossyRefractedColor(state, d, remaining, xs, rng)
+	}
 	// check for total internal reflection
 
 	// find the ratio of the first index of refraction to the second
@@ -172,12 +205,13 @@ func (w *World) RefractedColor(state *IntersectionState, remaining int, xs Inter
 	dir := state.NormalV.Scale(nRatio*cosi - cost).SubVector(state.EyeV.Scale(nRatio))
 
 	// create the refracted ray
-	refractedRay := NewRay(state.UnderPoint, dir)
+	refractedRay := state.ray(state.UnderPoint, dir)
+	refractedRay.Differentials = state.refractedDifferentials(dir)
 
 	// find the color of the refracted ray, making sure to multiply
 	// by the transparency value to account for any opacity
 	xs = xs[:0]
-	clr := w.ColorAt(refractedRay, remaining-1, xs, rng).Scale(state.Object.Material().Transparency)
+	clr := w.ColorAt(refractedRay, remaining-1, xs, rng).Scale(state.material().Transparency)
 
 	return clr
 
@@ -193,7 +227,7 @@ func (w *World) shadeHit(state *IntersectionState, remaining int, xs Intersectio
 		inensity := w.IntensityAt(state.OverPoint, l, xs, rng)
 
 		surface := lighting(
-			state.Object.Material(),
+			state.material(),
 			state.Object,
 			state.OverPoint,
 			l,
@@ -201,14 +235,13 @@ func (w *World) shadeHit(state *IntersectionState, remaining int, xs Intersectio
 			state.NormalV,
 			inensity,
 			w.Config.AreaLightRays,
-			state.U,
-			state.V,
+			state.texCoords(),
 			rng)
 
 		reflected := w.ReflectedColor(state, remaining, xs, rng)
 		refracted := w.RefractedColor(state, remaining, xs, rng)
 
-		m := state.Object.Material()
+		m := state.material()
 		if m.Reflective > 0 && m.Transparency > 0 {
 			// Use Schlick approximation for the Fresnel Effect
 			reflectance := Schlick(state)
@@ -220,7 +253,8 @@ func (w *World) shadeHit(state *IntersectionState, remaining int, xs Intersectio
 		}
 	}
 
-	return result
+	// caustics and indirect light
+	return result.Add(w.photonRadiance(state))
 }
 
 // IntensityAt returns the intensity of the light at point p
@@ -288,72 +322,106 @@ type pixel struct {
 	x, y float64
 }
 
-// Render is the work done by the renderWorker, renders one pixel
-func (p *pixel) Render(w *World, canvas *Canvas, xs Intersections, offset, l float64, rng *rand.Rand) {
-	clrs := Colors{}
+// subPixel is the offset of a sample from the top left corner of its pixel
+type subPixel struct {
+	x, y float64
+}
+
+// antialiasOffsets returns the sub-pixel positions sampled for the given antialias setting
+func antialiasOffsets(antialias int) []subPixel {
+	aa := float64(antialias)
+	numSquares := 1.0
+	offset := 0.5
 
-	// Collect colors for each sub-pixel and average them (antialias), slow and naive implementation
+	if aa > 0 {
+		numSquares = math.Pow(2, aa)
+		offset = 1.0 / (2 * aa)
+	}
+	l := math.Sqrt(numSquares)
+
+	var offsets []subPixel
 	for sx := 1.0; sx < l+1; sx++ {
 		for sy := 1.0; sy < l+1; sy++ {
-			a := p.x + offset*(sx*2-1)
-			b := p.y + offset*(sy*2-1)
+			offsets = append(offsets, subPixel{x: offset * (sx*2 - 1), y: offset * (sy*2 - 1)})
+		}
+	}
+	return offsets
+}
 
-			ray := w.Camera().RayForPixel(a, b)
-			clr := w.ColorAt(ray, w.Config.MaxRecusions, xs, rng)
-			clrs = append(clrs, clr)
+// sample renders a single sample at a,b (raster space) and adds it to the film
+func (p *pixel) sample(w *World, film *Film, a, b float64, xs Intersections, rng *rand.Rand) {
+	var ray Ray
+	if w.differentials {
+		ray = w.Camera().RayForPixelDifferentials(a, b, differentialScale(w.Config.Antialias))
+	} else {
+		ray = w.Camera().RayForPixel(a, b)
+	}
+	clr := w.li(ray, xs, rng)
+	film.AddPixelSample(int(p.x), int(p.y), a, b, clr)
+}
+
+// Render is the work done by the renderWorker, renders one pixel
+func (p *pixel) Render(w *World, film *Film, canvas *Canvas, xs Intersections, offsets []subPixel, rng *rand.Rand) {
+	// Collect colors for each sub-pixel and splat them into the film (antialias), slow and naive implementation
+	for _, o := range offsets {
+		p.sample(w, film, p.x+o.x, p.y+o.y, xs, rng)
+	}
+
+	// Keep adding randomly placed samples until the pixel is no longer noisy
+	if w.Config.AdaptiveSampling {
+		for stats := film.Stats(int(p.x), int(p.y)); !stats.converged(w.Config); stats = film.Stats(int(p.x), int(p.y)) {
+			p.sample(w, film, p.x+rng.Float64(), p.y+rng.Float64(), xs, rng)
 		}
 	}
 
-	// There is a race condition here, as canvas is also read by the GPU
-	// Only true when using GPU to display the render live.
-	canvas.SetFloat(p.x, p.y, clrs.Average())
+	// the filter might have spread the samples into the neighbouring pixels, update all of them
+	film.ResolvePixel(canvas, int(p.x), int(p.y))
 }
 
-// renderWorker processes a single pixel at a time
-func (w *World) renderWorker(in chan *pixel, canvas *Canvas) {
+// renderWorker processes a single pixel at a time, seed seeds its random number generator
+func (w *World) renderWorker(in chan *pixel, seed int64, render func(*pixel, Intersections, *rand.Rand)) {
 	// One intersections list per worker, making these per pixel is very expensive
 	xs := NewIntersections()
 
-	// antialias config
-	aa := float64(w.Config.Antialias)
-	numSquares := 1.0
-	offset := 0.5
-
-	if aa > 0 {
-		numSquares = math.Pow(2, aa)
-		offset = 1.0 / (2 * aa)
-	}
-	rowLength := math.Sqrt(numSquares)
-
-	rng := rand.New(rand.NewSource(time.Now().Unix()))
+	rng := rand.New(rand.NewSource(seed))
 
 	for pixel := range in {
 		// render the pixel
-		pixel.Render(w, canvas, xs, offset, rowLength, rng)
+		render(pixel, xs, rng)
 		// clear intersections for next pixel
 		xs = xs[:0]
 	}
 }
 
-func (w *World) doRender(camera *Camera, canvas *Canvas) *Canvas {
-
-	log.Println("Running render...")
+// renderSeed returns the seed of the render, Config.Seed or a random one if it is 0
+func (w *World) renderSeed() int64 {
+	if w.Config.Seed != 0 {
+		return w.Config.Seed
+	}
+	return time.Now().UnixNano()
+}
 
+// dispatch sends every pixel seen by the camera to the render workers, and waits for them to finish
+// Worker i seeds its random number generator with seed + i, and the pixels are dealt to the workers in turn, so the
+// same seed renders the same image.
+func (w *World) dispatch(camera *Camera, progress bool, seed int64, render func(*pixel, Intersections, *rand.Rand)) {
 	// allow this many renders to run at once
 	max := w.Config.Parallelism
 
-	// create communications channel
-	pending := make(chan *pixel)
+	// one channel per worker, buffered so that a slow pixel doesn't hold up the others
+	pending := make([]chan *pixel, max)
 	var wg sync.WaitGroup
 
 	// start the render goroutines
 	for i := 0; i < max; i++ {
+		pending[i] = make(chan *pixel, 64)
 		wg.Add(1)
-		go func() {
+		go func(i int) {
 			defer wg.Done()
-			w.renderWorker(pending, canvas)
-		}()
+			w.renderWorker(pending[i], seed+int64(i), render)
+		}(i)
 	}
+	next := 0
 
 	// keep track of progress
 	total := (camera.Vsize - 1) * (camera.Hsize - 1)
@@ -366,18 +434,68 @@ func (w *World) doRender(camera *Camera, canvas *Canvas) *Canvas {
 			for y := i; y < camera.Vsize; y = y + offset {
 				for x := j; x < camera.Hsize; x = x + offset {
 					// send work to workers
-					pending <- &pixel{x: x, y: y}
-					done++
-					last = showProgress(total, done, last)
+					if w.region.traced(int(x), int(y)) {
+						pending[next] <- &pixel{x: x, y: y}
+						next = (next + 1) % max
+					}
+					if progress {
+						done++
+						last = showProgress(total, done, last)
+					}
 				}
 			}
 		}
 	}
-	close(pending)
+	for _, p := range pending {
+		close(p)
+	}
 	wg.Wait()
+}
+
+// hasTextures returns true if any shape samples a texture, only then camera rays need differentials
+func (w *World) hasTextures() bool {
+	textured := false
+	walkShapes(w.Objects, func(s Shaper) {
+		if m := s.Material(); m != nil && m.usesTextures() {
+			textured = true
+		}
+	})
+	return textured
+}
+
+func (w *World) doRender(camera *Camera, canvas *Canvas) error {
+
+	log.Println("Running render...")
+
+	// samples are accumulated in the film, and copied into the canvas as pixels are finished
+	film := NewFilm(int(camera.Hsize), int(camera.Vsize), w.Config.Filter)
+	w.film = film
+	w.region = w.renderRegion(camera)
+	w.differentials = w.hasTextures()
+
+	switch {
+	case w.Config.Progressive:
+		w.doProgressiveRender(camera, canvas, film)
+	case w.Config.CheckpointFile != "" || w.Config.ResumeFile != "" || w.Config.TileEnd > 0:
+		if err := w.doTiledRender(camera, canvas, film); err != nil {
+			return err
+		}
+	default:
+		offsets := antialiasOffsets(w.Config.Antialias)
+		w.dispatch(camera, true, w.renderSeed(), func(p *pixel, xs Intersections, rng *rand.Rand) {
+			p.Render(w, film, canvas, xs, offsets, rng)
+		})
+	}
+
+	// pixels near the edge of a large filter might have received samples after they were last resolved
+	film.ResolveAll(canvas)
+
+	if !w.region.full() {
+		canvas.SetCoverage(w.region.coverage())
+	}
 
 	log.Print("Render finished!")
-	return canvas
+	return nil
 }
 
 // RegisterMetrics initializes metrics
@@ -416,7 +534,38 @@ func (w *World) ShowInfo() {
 	log.Printf("Camera Pixel Size: %.4f", w.Camera().PixelSize)
 	log.Printf("Camera Half With: %.4f", w.Camera().HalfWidth)
 	log.Printf("Camera Half Height: %.4f", w.Camera().HalfHeight)
+	log.Printf("Integrator: %T", w.Config.Integrator)
 	log.Printf("Antialiasing: %v", w.Config.Antialias)
+	log.Printf("Reconstruction Filter: %T (radius: %v)", w.Config.Filter, w.Config.Filter.Radius())
+	log.Printf("Adaptive Sampling enabled? -> %v", w.Config.AdaptiveSampling)
+	if w.Config.AdaptiveSampling {
+		log.Printf("  Adaptive threshold: %v", w.Config.AdaptiveThreshold)
+		log.Printf("  Adaptive samples: [%v, %v]", w.Config.AdaptiveMinSamples, w.Config.AdaptiveMaxSamples)
+	}
+	log.Printf("Progressive enabled? -> %v", w.Config.Progressive)
+	if w.Config.Progressive {
+		log.Printf("  Time budget: %v", w.Config.ProgressiveTimeBudget)
+		log.Printf("  Max samples: %v", w.Config.ProgressiveMaxSamples)
+		log.Printf("  Noise threshold: %v", w.Config.ProgressiveNoiseThreshold)
+	}
+	if w.Config.CropWindow != nil {
+		x0, y0, x1, y1 := w.Config.CropWindow.Pixels(int(w.Camera().Hsize), int(w.Camera().Vsize))
+		log.Printf("Crop Window: [%v, %v) x [%v, %v)", x0, x1, y0, y1)
+	}
+	if w.Config.TileEnd > 0 {
+		log.Printf("Tile Range: [%v, %v)", w.Config.TileStart, w.Config.TileEnd)
+	}
+	if w.Config.CheckpointFile != "" || w.Config.ResumeFile != "" || w.Config.TileEnd > 0 {
+		log.Printf("Tiled render (tile size: %v)", w.Config.TileSize)
+		log.Printf("  Checkpoint: %v (every %v)", w.Config.CheckpointFile, w.Config.CheckpointInterval)
+		log.Printf("  Resume from: %v", w.Config.ResumeFile)
+	}
+	if w.Config.CausticPhotons > 0 {
+		log.Printf("Photon mapping: %v caustic, %v global photons (gather radius: %v)", w.Config.CausticPhotons, w.Config.GlobalPhotons, w.Config.PhotonGatherRadius)
+	}
+	log.Printf("Spectral enabled? -> %v", w.spectral())
+	log.Printf("Working Space: %v", w.Config.WorkingSpace)
+	log.Printf("Glossy Rays: %v", w.Config.GlossyRays)
 	log.Printf("Parallelism: %v", w.Config.Parallelism)
 	log.Printf("Max Recursion: %v", w.Config.MaxRecusions)
 	log.Printf("BackfaceCulling enabled? -> %v", w.Config.BackfaceCulling)
@@ -429,16 +578,28 @@ func (w *World) ShowInfo() {
 		log.Printf("  Soft shadow rays: %v", w.Config.SoftShadowRays)
 	}
 	log.Printf("Total Shapes (if obj import, all are triangles): %v", numShapes)
+	tcs := TextureCacheStatistics()
+	log.Printf("Texture Cache: %v textures, %v decoded", tcs.Textures, tcs.Resident)
+	log.Printf("  Memory: %.1f of %.1f MiB", float64(tcs.Bytes)/(1<<20), float64(tcs.Budget)/(1<<20))
+	log.Printf("  Lookups: %v, loads: %v, evictions: %v", tcs.Lookups, tcs.Loads, tcs.Evictions)
 }
 
-// Render renders the world using the world camera
-func (w *World) Render(camera *Camera, canvas *Canvas) {
+// Render renders the world using the world camera, it returns an error if the config can't be rendered
+func (w *World) Render(camera *Camera, canvas *Canvas) error {
+	if err := w.Config.validate(); err != nil {
+		return err
+	}
+	canvas.WorkingSpace = w.Config.WorkingSpace
 	w.LintWorld()
 	w.PrecomputeValues()
+	if w.Config.Integrator == nil {
+		w.Config.Integrator = NewWhittedIntegrator()
+	}
+	w.Config.Integrator.Preprocess(w)
 	w.RegisterMetrics()
 	go metrics.Log(metrics.DefaultRegistry, 5*time.Second, log.New(os.Stderr, "metrics: ", log.Lmicroseconds))
 
 	w.ShowInfo()
 
-	w.doRender(camera, canvas)
+	return w.doRender(camera, canvas)
 }
@@ -539,3 +539,127 @@ func TestWorld_shadeHit_Schlick(t *testing.T) {
 	assert.True(t, NewColor(0.93391, 0.69643, 0.69243).Equal(clr), "should be true")
 
 }
+
+func TestWorld_ColorAtAbsorption(t *testing.T) {
+	tests := []struct {
+		name    string
+		radius  float64
+		density float64
+		want    Color
+	}{
+		{
+			name:    "no absorption",
+			radius:  1,
+			density: 0,
+			want:    White(),
+		},
+		{
+			name:    "thin glass",
+			radius:  1,
+			density: 1,
+			want:    NewColor(1, 0.25, 0.25),
+		},
+		{
+			name:    "thick glass",
+			radius:  2,
+			density: 1,
+			want:    NewColor(1, 0.0625, 0.0625),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := NewWorld(NewWorldConfig())
+			w.SetLights([]Light{NewPointLight(NewPoint(0, 0, -10), White())})
+
+			// only the refracted light of the glass is seen
+			glass := NewGlassSphere()
+			glass.SetTransform(IM().Scale(tt.radius, tt.radius, tt.radius))
+			glass.Material().Ambient = 0
+			glass.Material().Diffuse = 0
+			glass.Material().Specular = 0
+			glass.Material().Absorption = NewColor(1, 0.5, 0.5)
+			glass.Material().AbsorptionDensity = tt.density
+			w.AddObject(glass)
+
+			backdrop := NewPlane()
+			backdrop.SetTransform(IM().RotateX(math.Pi/2).Translate(0, 0, 10))
+			backdrop.Material().Ambient = 1
+			backdrop.Material().Diffuse = 0
+			backdrop.Material().Specular = 0
+			w.AddObject(backdrop)
+
+			r := NewRay(NewPoint(0, 0, -5), NewVector(0, 0, 1))
+			got := w.ColorAt(r, 5, NewIntersections(), rand.New(rand.NewSource(1)))
+			assert.True(t, tt.want.Equal(got), "%v should equal %v", got, tt.want)
+		})
+	}
+}
+
+func TestWorld_HasTextures(t *testing.T) {
+	texture := func() *TextureSampler { return NewTextureSampler(NewCanvasTexture(NewCanvas(2, 2))) }
+
+	tests := []struct {
+		name     string
+		material func() *Material
+		want     bool
+	}{
+		{
+			name:     "plain",
+			material: NewDefaultMaterial,
+			want:     false,
+		},
+		{
+			name: "pattern map",
+			material: func() *Material {
+				m := NewDefaultMaterial()
+				m.SetMap(MaterialColor, NewPatternMap(NewSolidPattern(White()), ChannelLuminance))
+				return m
+			},
+			want: false,
+		},
+		{
+			name: "texture",
+			material: func() *Material {
+				m := NewDefaultMaterial()
+				m.Texture = texture()
+				return m
+			},
+			want: true,
+		},
+		{
+			name: "texture map",
+			material: func() *Material {
+				m := NewDefaultMaterial()
+				m.SetMap(MaterialColor, NewTextureMap(texture(), ChannelLuminance))
+				return m
+			},
+			want: true,
+		},
+		{
+			name: "principled texture map",
+			material: func() *Material {
+				m := NewDefaultMaterial()
+				m.Principled = NewPrincipledMaterial()
+				m.Principled.SetMap(PrincipledBaseColor, NewTextureMap(texture(), ChannelLuminance))
+				return m
+			},
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// textured shapes inside groups count too
+			s := NewUnitSphere()
+			s.SetMaterial(tt.material())
+			g := NewGroup()
+			g.AddMember(s)
+
+			w := NewWorld(NewWorldConfig())
+			w.AddObject(NewPlane())
+			w.AddObject(g)
+			assert.Equal(t, tt.want, w.hasTextures(), "should equal")
+		})
+	}
+}